@@ -15,6 +15,7 @@ import "C"
 
 import (
 	"errors"
+	"sync/atomic"
 	"unsafe"
 
 	geo "github.com/kellydunn/golang-geo"
@@ -50,6 +51,8 @@ const (
 // Carto holds the c type viam_carto
 type Carto struct {
 	value *C.viam_carto
+	// cancelled is the flag, allocated in C memory, which viam_carto polls to cancel long running calls
+	cancelled *C.int
 	SlamMode
 }
 
@@ -63,8 +66,13 @@ type CartoInterface interface {
 	addOdometerReading(string, s.TimedOdometerReadingResponse) error
 	position() (Position, error)
 	pointCloudMap() ([]byte, error)
+	submaps([]Submap) ([]Submap, error)
 	internalState() ([]byte, error)
+	writePointCloudMap(string) error
+	writeInternalState(string) error
 	runFinalOptimization() error
+	cancel(bool)
+	release()
 }
 
 // Position holds values returned from c to be processed later
@@ -79,6 +87,23 @@ type Position struct {
 	Kmag float64
 }
 
+// SubmapID identifies a submap of the map.
+type SubmapID struct {
+	TrajectoryID int
+	SubmapIndex  int
+}
+
+// Submap holds a submap returned from c to be processed later
+type Submap struct {
+	SubmapID
+	// Version increases whenever lidar data is inserted into the submap
+	Version int
+	// Pose is the global pose of the submap, in millimeters from the origin
+	Pose Position
+	// PointCloud is the PCD of the submap, nil when the submap was known and did not change
+	PointCloud []byte
+}
+
 // LidarConfig represents the lidar configuration
 type LidarConfig int64
 
@@ -97,6 +122,9 @@ type CartoConfig struct {
 
 	EnableMapping bool
 	ExistingMap   string
+	// BlockingAdd makes adding sensor readings wait up to 100ms for cartographer to be unlocked before
+	// returning ErrUnableToAcquireLock. The wait is bounded as it holds up all other calls into cartographer.
+	BlockingAdd bool
 }
 
 // CartoAlgoConfig contains config values from app
@@ -120,6 +148,15 @@ type CartoAlgoConfig struct {
 	InitialTrajectoryPoseX     float64
 	InitialTrajectoryPoseY     float64
 	InitialTrajectoryPoseTheta float64
+
+	// MinIntensity drops lidar returns with a lower intensity, 0 disables the filter.
+	MinIntensity float32
+	// MarkerMinIntensity is the lowest intensity of the lidar returns kept in the intensity layer of the map.
+	MarkerMinIntensity float32
+	// PointCloudMapIntensity adds the intensity layer to the point cloud map. The intensity of a cell is
+	// packed as a 16 bit integer into the red (high byte) and green (low byte) channels of its color, the
+	// blue channel keeps the probability.
+	PointCloudMapIntensity bool
 }
 
 // NewLib calls viam_carto_lib_init and returns a pointer to a viam carto lib object.
@@ -171,13 +208,17 @@ func NewCarto(cfg CartoConfig, acfg CartoAlgoConfig, vcl CartoLibInterface) (Car
 	if !ok {
 		return Carto{}, errors.New("cannot cast provided library to a CartoLib")
 	}
+	// the flag is read by C while Go may move its own memory, so it lives in C memory
+	cancelled := (*C.int)(C.calloc(1, C.size_t(unsafe.Sizeof(C.int(0)))))
+	vcc.cancelled = cancelled
 	status := C.viam_carto_init(&pVc, cl.value, vcc, vcac)
 
 	if err := toError(status); err != nil {
+		C.free(unsafe.Pointer(cancelled))
 		return Carto{}, err
 	}
 
-	carto := Carto{value: pVc, SlamMode: toSlamMode(pVc.slam_mode)}
+	carto := Carto{value: pVc, cancelled: cancelled, SlamMode: toSlamMode(pVc.slam_mode)}
 
 	return carto, nil
 }
@@ -212,9 +253,32 @@ func (vc *Carto) terminate() error {
 		return err
 	}
 
+	vc.release()
 	return nil
 }
 
+// release frees the cancellation flag. It must only be called once no call into C can poll the flag anymore.
+func (vc *Carto) release() {
+	if vc.cancelled != nil {
+		C.free(unsafe.Pointer(vc.cancelled))
+		vc.cancelled = nil
+	}
+}
+
+// cancel sets or clears the flag which makes viam_carto_get_point_cloud_map, viam_carto_get_submaps,
+// viam_carto_get_internal_state, the viam_carto_write calls and viam_carto_run_final_optimization return
+// VIAM_CARTO_CANCELLED. It is safe to call while one of them is running.
+func (vc *Carto) cancel(cancelled bool) {
+	if vc.cancelled == nil {
+		return
+	}
+	var value int32
+	if cancelled {
+		value = 1
+	}
+	atomic.StoreInt32((*int32)(unsafe.Pointer(vc.cancelled)), value)
+}
+
 // addLidarReading is a wrapper for viam_carto_add_lidar_reading
 func (vc *Carto) addLidarReading(lidar string, reading s.TimedLidarReadingResponse) error {
 	value := toLidarReading(lidar, reading)
@@ -309,6 +373,40 @@ func (vc *Carto) pointCloudMap() ([]byte, error) {
 	return pcd, nil
 }
 
+// submaps is a wrapper for viam_carto_get_submaps
+func (vc *Carto) submaps(known []Submap) ([]Submap, error) {
+	req := C.viam_carto_get_submaps_request{}
+	if len(known) > 0 {
+		knownC := (*C.viam_carto_submap)(C.calloc(C.size_t(len(known)), C.size_t(unsafe.Sizeof(C.viam_carto_submap{}))))
+		if knownC == nil {
+			return nil, ErrOutOfMemory
+		}
+		defer C.free(unsafe.Pointer(knownC))
+		knownSlice := unsafe.Slice(knownC, len(known))
+		for i, submap := range known {
+			knownSlice[i] = toSubmap(submap)
+		}
+		req.known = knownC
+		req.known_len = C.int(len(known))
+	}
+	value := C.viam_carto_get_submaps_response{}
+
+	status := C.viam_carto_get_submaps(vc.value, &req, &value)
+
+	if err := toError(status); err != nil {
+		return nil, err
+	}
+
+	submaps := toSubmapsResponse(value)
+
+	status = C.viam_carto_get_submaps_response_destroy(&value)
+	if err := toError(status); err != nil {
+		return nil, err
+	}
+
+	return submaps, nil
+}
+
 // internalState is a wrapper for viam_carto_get_internal_state
 func (vc *Carto) internalState() ([]byte, error) {
 	value := C.viam_carto_get_internal_state_response{}
@@ -329,6 +427,34 @@ func (vc *Carto) internalState() ([]byte, error) {
 	return interalState, nil
 }
 
+// writePointCloudMap is a wrapper for viam_carto_write_point_cloud_map
+func (vc *Carto) writePointCloudMap(path string) error {
+	pathBstring := goStringToBstring(path)
+	defer C.bdestroy(pathBstring)
+
+	status := C.viam_carto_write_point_cloud_map(vc.value, pathBstring)
+
+	if err := toError(status); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// writeInternalState is a wrapper for viam_carto_write_internal_state
+func (vc *Carto) writeInternalState(path string) error {
+	pathBstring := goStringToBstring(path)
+	defer C.bdestroy(pathBstring)
+
+	status := C.viam_carto_write_internal_state(vc.value, pathBstring)
+
+	if err := toError(status); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // runFinalOptimization is a wrapper for viam_carto_run_final_optimization
 func (vc *Carto) runFinalOptimization() error {
 	status := C.viam_carto_run_final_optimization(vc.value)
@@ -393,6 +519,7 @@ func getConfig(cfg CartoConfig) (C.viam_carto_config, error) {
 
 	vcc.enable_mapping = C.bool(cfg.EnableMapping)
 	vcc.existing_map = goStringToBstring(cfg.ExistingMap)
+	vcc.blocking_add = C.bool(cfg.BlockingAdd)
 
 	return vcc, nil
 }
@@ -422,6 +549,11 @@ func toAlgoConfig(acfg CartoAlgoConfig) C.viam_carto_algo_config {
 	vcac.initial_trajectory_pose_y = C.double(acfg.InitialTrajectoryPoseY)
 	vcac.initial_trajectory_pose_theta = C.double(acfg.InitialTrajectoryPoseTheta)
 
+	// Values used to filter lidar returns and build the intensity layer by intensity
+	vcac.min_intensity = C.float(acfg.MinIntensity)
+	vcac.marker_min_intensity = C.float(acfg.MarkerMinIntensity)
+	vcac.point_cloud_map_intensity = C.bool(acfg.PointCloudMapIntensity)
+
 	return vcac
 }
 
@@ -438,6 +570,51 @@ func toPositionResponse(value C.viam_carto_get_position_response) Position {
 	}
 }
 
+// toSubmap returns the c submap of a known submap, without its points as c ignores them.
+func toSubmap(submap Submap) C.viam_carto_submap {
+	return C.viam_carto_submap{
+		trajectory_id: C.int(submap.TrajectoryID),
+		submap_index:  C.int(submap.SubmapIndex),
+		version:       C.int(submap.Version),
+		x:             C.double(submap.Pose.X),
+		y:             C.double(submap.Pose.Y),
+		z:             C.double(submap.Pose.Z),
+		real:          C.double(submap.Pose.Real),
+		imag:          C.double(submap.Pose.Imag),
+		jmag:          C.double(submap.Pose.Jmag),
+		kmag:          C.double(submap.Pose.Kmag),
+	}
+}
+
+func toSubmapsResponse(value C.viam_carto_get_submaps_response) []Submap {
+	submaps := []Submap{}
+	if value.submaps == nil {
+		return submaps
+	}
+	for _, submap := range unsafe.Slice(value.submaps, int(value.submaps_len)) {
+		var pointCloud []byte
+		if submap.point_cloud_pcd != nil {
+			pointCloud = bstringToByteSlice(submap.point_cloud_pcd)
+		}
+		submaps = append(submaps, Submap{
+			SubmapID: SubmapID{TrajectoryID: int(submap.trajectory_id), SubmapIndex: int(submap.submap_index)},
+			Version:  int(submap.version),
+			Pose: Position{
+				X: float64(submap.x),
+				Y: float64(submap.y),
+				Z: float64(submap.z),
+
+				Real: float64(submap.real),
+				Imag: float64(submap.imag),
+				Jmag: float64(submap.jmag),
+				Kmag: float64(submap.kmag),
+			},
+			PointCloud: pointCloud,
+		})
+	}
+	return submaps
+}
+
 func toLidarReading(lidar string, reading s.TimedLidarReadingResponse) C.viam_carto_lidar_reading {
 	sr := C.viam_carto_lidar_reading{}
 	sensorCStr := C.CString(lidar)
@@ -447,6 +624,9 @@ func toLidarReading(lidar string, reading s.TimedLidarReadingResponse) C.viam_ca
 	defer C.free(readingsCBytes)
 	sr.lidar_reading = C.blk2bstr(readingsCBytes, C.int(len(reading.Reading)))
 	sr.lidar_reading_time_unix_milli = C.int64_t(reading.ReadingTime.UnixMilli())
+	sr.lidar_reading_format = C.viam_carto_LIDAR_READING_FORMAT(reading.Format)
+	sr.angle_min = C.float(reading.AngleMin)
+	sr.angle_increment = C.float(reading.AngleIncrement)
 	return sr
 }
 
@@ -499,68 +679,80 @@ func toError(status C.int) error {
 	case C.VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK:
 		return ErrUnableToAcquireLock
 	case C.VIAM_CARTO_VC_INVALID:
-		return errors.New("VIAM_CARTO_VC_INVALID")
+		return ErrVCInvalid
 	case C.VIAM_CARTO_OUT_OF_MEMORY:
-		return errors.New("VIAM_CARTO_OUT_OF_MEMORY")
+		return ErrOutOfMemory
 	case C.VIAM_CARTO_DESTRUCTOR_ERROR:
-		return errors.New("VIAM_CARTO_DESTRUCTOR_ERROR")
+		return ErrDestructorError
 	case C.VIAM_CARTO_LIB_PLATFORM_INVALID:
-		return errors.New("VIAM_CARTO_LIB_PLATFORM_INVALID")
+		return ErrLibPlatformInvalid
 	case C.VIAM_CARTO_LIB_INVALID:
-		return errors.New("VIAM_CARTO_LIB_INVALID")
+		return ErrLibInvalid
 	case C.VIAM_CARTO_LIB_NOT_INITIALIZED:
-		return errors.New("VIAM_CARTO_LIB_NOT_INITIALIZED")
+		return ErrLibNotInitialized
 	case C.VIAM_CARTO_UNKNOWN_ERROR:
-		return errors.New("VIAM_CARTO_UNKNOWN_ERROR")
+		return ErrUnknownError
 	case C.VIAM_CARTO_SLAM_MODE_INVALID:
-		return errors.New("VIAM_CARTO_SLAM_MODE_INVALID")
+		return ErrSlamModeInvalid
 	case C.VIAM_CARTO_LIDAR_CONFIG_INVALID:
-		return errors.New("VIAM_CARTO_LIDAR_CONFIG_INVALID")
+		return ErrLidarConfigInvalid
+	case C.VIAM_CARTO_COMPONENT_REFERENCE_INVALID:
+		return ErrComponentReferenceInvalid
 	case C.VIAM_CARTO_LUA_CONFIG_NOT_FOUND:
-		return errors.New("VIAM_CARTO_LUA_CONFIG_NOT_FOUND")
+		return ErrLuaConfigNotFound
 	case C.VIAM_CARTO_INTERNAL_STATE_FILE_SYSTEM_ERROR:
-		return errors.New("VIAM_CARTO_INTERNAL_STATE_FILE_SYSTEM_ERROR")
+		return ErrInternalStateFileSystemError
 	case C.VIAM_CARTO_MAP_CREATION_ERROR:
-		return errors.New("VIAM_CARTO_MAP_CREATION_ERROR")
+		return ErrMapCreationError
 	case C.VIAM_CARTO_UNKNOWN_SENSOR_NAME:
-		return errors.New("VIAM_CARTO_UNKNOWN_SENSOR_NAME")
+		return ErrUnknownSensorName
 	case C.VIAM_CARTO_LIDAR_READING_EMPTY:
-		return errors.New("VIAM_CARTO_LIDAR_READING_EMPTY")
+		return ErrLidarReadingEmpty
 	case C.VIAM_CARTO_LIDAR_READING_INVALID:
-		return errors.New("VIAM_CARTO_LIDAR_READING_INVALID")
+		return ErrLidarReadingInvalid
 	case C.VIAM_CARTO_GET_POSITION_RESPONSE_INVALID:
-		return errors.New("VIAM_CARTO_GET_POSITION_RESPONSE_INVALID")
+		return ErrGetPositionResponseInvalid
 	case C.VIAM_CARTO_GET_POSITION_NOT_INITIALIZED:
-		return errors.New("VIAM_CARTO_GET_POSITION_NOT_INITIALIZED")
+		return ErrGetPositionNotInitialized
 	case C.VIAM_CARTO_POINTCLOUD_MAP_EMPTY:
-		return errors.New("VIAM_CARTO_POINTCLOUD_MAP_EMPTY")
+		return ErrPointCloudMapEmpty
 	case C.VIAM_CARTO_GET_POINT_CLOUD_MAP_RESPONSE_INVALID:
-		return errors.New("VIAM_CARTO_GET_POINT_CLOUD_MAP_RESPONSE_INVALID")
+		return ErrGetPointCloudMapResponseInvalid
 	case C.VIAM_CARTO_LIB_ALREADY_INITIALIZED:
-		return errors.New("VIAM_CARTO_LIB_ALREADY_INITIALIZED")
+		return ErrLibAlreadyInitialized
 	case C.VIAM_CARTO_GET_INTERNAL_STATE_RESPONSE_INVALID:
-		return errors.New("VIAM_CARTO_GET_INTERNAL_STATE_RESPONSE_INVALID")
+		return ErrGetInternalStateResponseInvalid
 	case C.VIAM_CARTO_GET_INTERNAL_STATE_FILE_WRITE_IO_ERROR:
-		return errors.New("VIAM_CARTO_GET_INTERNAL_STATE_FILE_WRITE_IO_ERROR")
+		return ErrGetInternalStateFileWriteIOError
 	case C.VIAM_CARTO_GET_INTERNAL_STATE_FILE_READ_IO_ERROR:
-		return errors.New("VIAM_CARTO_GET_INTERNAL_STATE_FILE_READ_IO_ERROR")
+		return ErrGetInternalStateFileReadIOError
 	case C.VIAM_CARTO_NOT_IN_INITIALIZED_STATE:
-		return errors.New("VIAM_CARTO_NOT_IN_INITIALIZED_STATE")
+		return ErrNotInInitializedState
 	case C.VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE:
-		return errors.New("VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE")
+		return ErrNotInIOInitializedState
 	case C.VIAM_CARTO_NOT_IN_STARTED_STATE:
-		return errors.New("VIAM_CARTO_NOT_IN_STARTED_STATE")
+		return ErrNotInStartedState
 	case C.VIAM_CARTO_NOT_IN_TERMINATABLE_STATE:
-		return errors.New("VIAM_CARTO_NOT_IN_TERMINATABLE_STATE")
+		return ErrNotInTerminatableState
 	case C.VIAM_CARTO_IMU_PROVIDED_AND_IMU_ENABLED_MISMATCH:
-		return errors.New("VIAM_CARTO_IMU_PROVIDED_AND_IMU_ENABLED_MISMATCH")
+		return ErrIMUProvidedAndIMUEnabledMismatch
 	case C.VIAM_CARTO_IMU_READING_EMPTY:
-		return errors.New("VIAM_CARTO_IMU_READING_EMPTY")
+		return ErrIMUReadingEmpty
 	case C.VIAM_CARTO_IMU_READING_INVALID:
-		return errors.New("VIAM_CARTO_IMU_READING_INVALID")
+		return ErrIMUReadingInvalid
 	case C.VIAM_CARTO_ODOMETER_READING_INVALID:
-		return errors.New("VIAM_CARTO_ODOMETER_READING_INVALID")
+		return ErrOdometerReadingInvalid
+	case C.VIAM_CARTO_CANCELLED:
+		return ErrCancelled
+	case C.VIAM_CARTO_GET_SUBMAPS_REQUEST_INVALID:
+		return ErrGetSubmapsRequestInvalid
+	case C.VIAM_CARTO_GET_SUBMAPS_RESPONSE_INVALID:
+		return ErrGetSubmapsResponseInvalid
+	case C.VIAM_CARTO_EXPORT_PATH_INVALID:
+		return ErrExportPathInvalid
+	case C.VIAM_CARTO_EXPORT_FILE_WRITE_IO_ERROR:
+		return ErrExportFileWriteIOError
 	default:
-		return errors.New("status code unclassified")
+		return newUnclassifiedStatusError(int(status))
 	}
 }
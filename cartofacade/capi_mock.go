@@ -2,6 +2,8 @@
 package cartofacade
 
 import (
+	"sync/atomic"
+
 	s "github.com/viamrobotics/viam-cartographer/sensors"
 )
 
@@ -30,8 +32,13 @@ type CartoMock struct {
 	AddOdometerReadingFunc   func(string, s.TimedOdometerReadingResponse) error
 	PositionFunc             func() (Position, error)
 	PointCloudMapFunc        func() ([]byte, error)
+	SubmapsFunc              func([]Submap) ([]Submap, error)
 	InternalStateFunc        func() ([]byte, error)
+	WritePointCloudMapFunc   func(string) error
+	WriteInternalStateFunc   func(string) error
 	RunFinalOptimizationFunc func() error
+
+	cancelled atomic.Bool
 }
 
 // start calls the injected StartFunc or the real version.
@@ -98,6 +105,14 @@ func (cf *CartoMock) pointCloudMap() ([]byte, error) {
 	return cf.PointCloudMapFunc()
 }
 
+// submaps calls the injected SubmapsFunc or the real version.
+func (cf *CartoMock) submaps(known []Submap) ([]Submap, error) {
+	if cf.SubmapsFunc == nil {
+		return cf.Carto.submaps(known)
+	}
+	return cf.SubmapsFunc(known)
+}
+
 // internalState calls the injected InternalState or the real version.
 func (cf *CartoMock) internalState() ([]byte, error) {
 	if cf.InternalStateFunc == nil {
@@ -106,6 +121,22 @@ func (cf *CartoMock) internalState() ([]byte, error) {
 	return cf.InternalStateFunc()
 }
 
+// writePointCloudMap calls the injected WritePointCloudMapFunc or the real version.
+func (cf *CartoMock) writePointCloudMap(path string) error {
+	if cf.WritePointCloudMapFunc == nil {
+		return cf.Carto.writePointCloudMap(path)
+	}
+	return cf.WritePointCloudMapFunc(path)
+}
+
+// writeInternalState calls the injected WriteInternalStateFunc or the real version.
+func (cf *CartoMock) writeInternalState(path string) error {
+	if cf.WriteInternalStateFunc == nil {
+		return cf.Carto.writeInternalState(path)
+	}
+	return cf.WriteInternalStateFunc(path)
+}
+
 // runFinalOptimization calls the injected RunFinalOptimization or the real version.
 func (cf *CartoMock) runFinalOptimization() error {
 	if cf.RunFinalOptimizationFunc == nil {
@@ -113,3 +144,13 @@ func (cf *CartoMock) runFinalOptimization() error {
 	}
 	return cf.RunFinalOptimizationFunc()
 }
+
+// cancel records whether the running call was cancelled.
+func (cf *CartoMock) cancel(cancelled bool) {
+	cf.cancelled.Store(cancelled)
+}
+
+// Cancelled returns whether the running call was cancelled, for injected funcs to poll like C does.
+func (cf *CartoMock) Cancelled() bool {
+	return cf.cancelled.Load()
+}
@@ -2,8 +2,17 @@ package cartofacade
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -76,6 +85,15 @@ func TestGetConfig(t *testing.T) {
 		test.That(t, enableMapping, test.ShouldBeTrue)
 
 		test.That(t, vcc.lidar_config, test.ShouldEqual, TwoD)
+		test.That(t, bool(vcc.blocking_add), test.ShouldBeFalse)
+	})
+
+	t.Run("config properly converted between C and go with blocking add", func(t *testing.T) {
+		cfg := GetTestConfig("my-lidar", "", "", true)
+		cfg.BlockingAdd = true
+		vcc, err := getConfig(cfg)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, bool(vcc.blocking_add), test.ShouldBeTrue)
 	})
 
 	t.Run("config properly converted between C and go with a movement sensor specified", func(t *testing.T) {
@@ -141,6 +159,23 @@ func TestToLidarReading(t *testing.T) {
 		test.That(t, bstringToGoString(sr.lidar), test.ShouldResemble, "my-lidar")
 		test.That(t, bstringToGoString(sr.lidar_reading), test.ShouldResemble, "he0llo")
 		test.That(t, sr.lidar_reading_time_unix_milli, test.ShouldEqual, timestamp.UnixMilli())
+		test.That(t, s.LidarReadingFormat(sr.lidar_reading_format), test.ShouldEqual, s.LidarReadingFormatPCD)
+	})
+
+	t.Run("polar lidar reading properly converted between c and go", func(t *testing.T) {
+		timestamp := time.Date(2021, 8, 15, 14, 30, 45, 100, time.UTC)
+		reading := s.TimedLidarReadingResponse{
+			Reading:        []byte("he0llo"),
+			ReadingTime:    timestamp,
+			Format:         s.LidarReadingFormatPolar,
+			AngleMin:       -1.5,
+			AngleIncrement: 0.25,
+		}
+		sr := toLidarReading("my-lidar", reading)
+		test.That(t, bstringToGoString(sr.lidar_reading), test.ShouldResemble, "he0llo")
+		test.That(t, s.LidarReadingFormat(sr.lidar_reading_format), test.ShouldEqual, s.LidarReadingFormatPolar)
+		test.That(t, float32(sr.angle_min), test.ShouldEqual, -1.5)
+		test.That(t, float32(sr.angle_increment), test.ShouldEqual, 0.25)
 	})
 }
 
@@ -214,7 +249,7 @@ func TestCGoAPIWithoutMovementSensor(t *testing.T) {
 		cfgBad := GetBadTestConfig()
 		vc, err = NewCarto(cfgBad, algoCfg, &pvcl)
 		// initialize viam_carto incorrectly
-		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_LIDAR_CONFIG_INVALID"))
+		test.That(t, err, test.ShouldEqual, ErrLidarConfigInvalid)
 		test.That(t, vc, test.ShouldNotBeNil)
 
 		algoCfg = GetTestAlgoConfig(false)
@@ -232,14 +267,14 @@ func TestCGoAPIWithoutMovementSensor(t *testing.T) {
 		// test position before sensor data is added
 		position, err := vc.position()
 		test.That(t, err, test.ShouldNotBeNil)
-		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_GET_POSITION_NOT_INITIALIZED"))
+		test.That(t, err, test.ShouldEqual, ErrGetPositionNotInitialized)
 		test.That(t, position, test.ShouldResemble, Position{})
 
 		// test pointCloudMap before sensor data is added
 		pcd, err := vc.pointCloudMap()
 		test.That(t, pcd, test.ShouldBeNil)
 		test.That(t, err, test.ShouldBeError)
-		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_POINTCLOUD_MAP_EMPTY"))
+		test.That(t, err, test.ShouldEqual, ErrPointCloudMapEmpty)
 
 		// test internalState before sensor data is added
 		internalState, err := vc.internalState()
@@ -281,14 +316,14 @@ func TestCGoAPIWithoutMovementSensor(t *testing.T) {
 		// test position should be unchanged by failed attempt to add data
 		position, err = vc.position()
 		test.That(t, err, test.ShouldNotBeNil)
-		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_GET_POSITION_NOT_INITIALIZED"))
+		test.That(t, err, test.ShouldEqual, ErrGetPositionNotInitialized)
 		test.That(t, position, test.ShouldResemble, Position{})
 
 		// test pointCloudMap should be unchanged by failed attempt to add data
 		pcd, err = vc.pointCloudMap()
 		test.That(t, pcd, test.ShouldBeNil)
 		test.That(t, err, test.ShouldBeError)
-		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_POINTCLOUD_MAP_EMPTY"))
+		test.That(t, err, test.ShouldEqual, ErrPointCloudMapEmpty)
 
 		// test internalState should be unchanged by failed attempt to add data
 		internalState, err = vc.internalState()
@@ -316,14 +351,14 @@ func TestCGoAPIWithoutMovementSensor(t *testing.T) {
 		// test position not initialized after first sensor data has been provided
 		position, err = vc.position()
 		test.That(t, err, test.ShouldNotBeNil)
-		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_GET_POSITION_NOT_INITIALIZED"))
+		test.That(t, err, test.ShouldEqual, ErrGetPositionNotInitialized)
 		test.That(t, position, test.ShouldResemble, Position{})
 
 		// test pointCloudMap returns error if not enough sensor data has been provided
 		pcd, err = vc.pointCloudMap()
 		test.That(t, pcd, test.ShouldBeNil)
 		test.That(t, err, test.ShouldBeError)
-		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_POINTCLOUD_MAP_EMPTY"))
+		test.That(t, err, test.ShouldEqual, ErrPointCloudMapEmpty)
 
 		// test internalState always returns non empty results
 		internalState, err = vc.internalState()
@@ -351,6 +386,35 @@ func TestCGoAPIWithoutMovementSensor(t *testing.T) {
 		test.That(t, err, test.ShouldBeNil)
 		test.That(t, pc.Size(), test.ShouldNotEqual, 0)
 
+		// test the pointcloud map and the internal state are written to files
+		exportDir := t.TempDir()
+		test.That(t, vc.writePointCloudMap(""), test.ShouldBeError, ErrExportPathInvalid)
+		test.That(t, vc.writePointCloudMap(filepath.Join(exportDir, "map.pcd")), test.ShouldBeNil)
+		writtenPCD, err := os.ReadFile(filepath.Join(exportDir, "map.pcd"))
+		test.That(t, err, test.ShouldBeNil)
+		_, err = pointcloud.ReadPCD(bytes.NewReader(writtenPCD))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, vc.writeInternalState(filepath.Join(exportDir, "state.pbstream")), test.ShouldBeNil)
+		stat, err := os.Stat(filepath.Join(exportDir, "state.pbstream"))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, stat.Size(), test.ShouldBeGreaterThan, 0)
+
+		// test submaps returns the points of every submap, and none once the submaps are known
+		submaps, err := vc.submaps(nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, submaps, test.ShouldNotBeEmpty)
+		for _, submap := range submaps {
+			pc, err := pointcloud.ReadPCD(bytes.NewReader(submap.PointCloud))
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, pc.Size(), test.ShouldNotEqual, 0)
+		}
+		unchanged, err := vc.submaps(submaps)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(unchanged), test.ShouldEqual, len(submaps))
+		for _, submap := range unchanged {
+			test.That(t, submap.PointCloud, test.ShouldBeNil)
+		}
+
 		// test internalState always returns different non empty results than first call
 		internalState, err = vc.internalState()
 		test.That(t, err, test.ShouldBeNil)
@@ -426,7 +490,7 @@ func TestCGoAPIWithMovementSensor(t *testing.T) {
 		// test invalid IMU enabling configuration
 		algoCfg := GetTestAlgoConfig(true)
 		vc, err := NewCarto(cfg, algoCfg, &pvcl)
-		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_IMU_PROVIDED_AND_IMU_ENABLED_MISMATCH"))
+		test.That(t, err, test.ShouldEqual, ErrIMUProvidedAndIMUEnabledMismatch)
 		test.That(t, vc, test.ShouldNotBeNil)
 
 		cfg = GetTestConfig("my-lidar", "my-movement-sensor", "", true)
@@ -445,14 +509,14 @@ func TestCGoAPIWithMovementSensor(t *testing.T) {
 		// test position before sensor data is added
 		position, err := vc.position()
 		test.That(t, err, test.ShouldNotBeNil)
-		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_GET_POSITION_NOT_INITIALIZED"))
+		test.That(t, err, test.ShouldEqual, ErrGetPositionNotInitialized)
 		test.That(t, position, test.ShouldResemble, Position{})
 
 		// test pointCloudMap before sensor data is added
 		pcd, err := vc.pointCloudMap()
 		test.That(t, pcd, test.ShouldBeNil)
 		test.That(t, err, test.ShouldBeError)
-		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_POINTCLOUD_MAP_EMPTY"))
+		test.That(t, err, test.ShouldEqual, ErrPointCloudMapEmpty)
 
 		// test internalState before sensor data is added
 		internalState, err := vc.internalState()
@@ -496,14 +560,14 @@ func TestCGoAPIWithMovementSensor(t *testing.T) {
 		// test position should be unchanged by failed attempt to add data
 		position, err = vc.position()
 		test.That(t, err, test.ShouldNotBeNil)
-		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_GET_POSITION_NOT_INITIALIZED"))
+		test.That(t, err, test.ShouldEqual, ErrGetPositionNotInitialized)
 		test.That(t, position, test.ShouldResemble, Position{})
 
 		// test pointCloudMap should be unchanged by failed attempt to add data
 		pcd, err = vc.pointCloudMap()
 		test.That(t, pcd, test.ShouldBeNil)
 		test.That(t, err, test.ShouldBeError)
-		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_POINTCLOUD_MAP_EMPTY"))
+		test.That(t, err, test.ShouldEqual, ErrPointCloudMapEmpty)
 
 		// test internalState should be unchanged by failed attempt to add data
 		internalState, err = vc.internalState()
@@ -631,3 +695,404 @@ func TestCGoAPIWithMovementSensor(t *testing.T) {
 		test.That(t, err, test.ShouldBeNil)
 	})
 }
+
+func TestCGoAPIPointCloudMapIntensity(t *testing.T) {
+	pvcl, err := NewLib(0, 1)
+	test.That(t, err, test.ShouldBeNil)
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+	algoCfg.MarkerMinIntensity = 100
+	algoCfg.PointCloudMapIntensity = true
+	vc, err := NewCarto(cfg, algoCfg, &pvcl)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, vc.start(), test.ShouldBeNil)
+
+	// add the mock lidar readings with an intensity above the marker threshold on every return
+	const intensity = 1000
+	timestamp := time.Date(2021, 8, 15, 14, 30, 45, 100, time.UTC)
+	for _, pcdPath := range []string{
+		"viam-cartographer/mock_lidar/0.pcd",
+		"viam-cartographer/mock_lidar/1.pcd",
+		"viam-cartographer/mock_lidar/2.pcd",
+	} {
+		file, err := os.Open(artifact.MustPath(pcdPath))
+		test.That(t, err, test.ShouldBeNil)
+		pc, err := pointcloud.ReadPCD(file)
+		test.That(t, err, test.ShouldBeNil)
+		withIntensity := pointcloud.New()
+		pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+			test.That(t, withIntensity.Set(p, pointcloud.NewBasicData().SetIntensity(intensity)), test.ShouldBeNil)
+			return true
+		})
+		reading, err := s.EncodeLidarReading(withIntensity, s.LidarReadingFormatPointsIntensity)
+		test.That(t, err, test.ShouldBeNil)
+
+		timestamp = timestamp.Add(time.Second * 2)
+		err = vc.addLidarReading("my-lidar", s.TimedLidarReadingResponse{
+			Reading:     reading,
+			ReadingTime: timestamp,
+			Format:      s.LidarReadingFormatPointsIntensity,
+		})
+		test.That(t, err, test.ShouldBeNil)
+	}
+
+	// the map with the intensity layer can still be read by the RDK, the intensity being packed into the red
+	// and green channels and the probability staying in the blue channel
+	pcd, err := vc.pointCloudMap()
+	test.That(t, err, test.ShouldBeNil)
+	pc, err := pointcloud.ReadPCD(bytes.NewReader(pcd))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pc.Size(), test.ShouldNotEqual, 0)
+	markers := 0
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		r, g, b := d.RGB255()
+		test.That(t, b, test.ShouldBeLessThanOrEqualTo, 100)
+		if packed := uint16(r)<<8 | uint16(g); packed != 0 {
+			test.That(t, packed, test.ShouldEqual, intensity)
+			markers++
+		}
+		return true
+	})
+	test.That(t, markers, test.ShouldBeGreaterThan, 0)
+
+	test.That(t, vc.stop(), test.ShouldBeNil)
+	test.That(t, vc.terminate(), test.ShouldBeNil)
+	test.That(t, pvcl.Terminate(), test.ShouldBeNil)
+}
+
+func BenchmarkCGoAPIAddLidarReading(b *testing.B) {
+	var readings [][]byte
+	for _, pcdPath := range []string{
+		"viam-cartographer/mock_lidar/0.pcd",
+		"viam-cartographer/mock_lidar/1.pcd",
+		"viam-cartographer/mock_lidar/2.pcd",
+	} {
+		file, err := os.Open(artifact.MustPath(pcdPath))
+		if err != nil {
+			b.Fatal(err)
+		}
+		pc, err := pointcloud.ReadPCD(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		if err := pointcloud.ToPCD(pc, buf, pointcloud.PCDBinary); err != nil {
+			b.Fatal(err)
+		}
+		readings = append(readings, buf.Bytes())
+	}
+
+	pvcl, err := NewLib(0, 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		if err := pvcl.Terminate(); err != nil {
+			b.Fatal(err)
+		}
+	}()
+
+	for _, tc := range []struct {
+		name        string
+		blockingAdd bool
+	}{
+		{name: "try lock", blockingAdd: false},
+		{name: "blocking add", blockingAdd: true},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			cfg := GetTestConfig("my-lidar", "", "", true)
+			cfg.BlockingAdd = tc.blockingAdd
+			vc, err := NewCarto(cfg, GetTestAlgoConfig(false), &pvcl)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := vc.start(); err != nil {
+				b.Fatal(err)
+			}
+			timestamp := time.Date(2021, 8, 15, 14, 30, 45, 100, time.UTC)
+			if err := vc.addLidarReading("my-lidar", s.TimedLidarReadingResponse{
+				Reading:     readings[0],
+				ReadingTime: timestamp,
+			}); err != nil {
+				b.Fatal(err)
+			}
+
+			// render the map in a loop, which holds the map builder lock like a client polling the map does
+			done := make(chan struct{})
+			rendered := make(chan struct{})
+			go func() {
+				defer close(rendered)
+				for {
+					select {
+					case <-done:
+						return
+					default:
+						if _, err := vc.pointCloudMap(); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				}
+			}()
+
+			var attempts int
+			var maxCall time.Duration
+			cpuStart := cpuTime(b)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				timestamp = timestamp.Add(200 * time.Millisecond)
+				reading := s.TimedLidarReadingResponse{Reading: readings[i%len(readings)], ReadingTime: timestamp}
+				for {
+					attempts++
+					callStart := time.Now()
+					err := vc.addLidarReading("my-lidar", reading)
+					if call := time.Since(callStart); call > maxCall {
+						maxCall = call
+					}
+					if err == nil {
+						break
+					}
+					if !errors.Is(err, ErrUnableToAcquireLock) {
+						b.Fatal(err)
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}
+			b.StopTimer()
+			close(done)
+			<-rendered
+
+			b.ReportMetric(float64(attempts)/float64(b.N), "attempts/reading")
+			b.ReportMetric(float64((cpuTime(b)-cpuStart).Microseconds())/float64(b.N), "cpu-µs/reading")
+			// the longest call into cartographer, which every other request waits for
+			b.ReportMetric(float64(maxCall.Microseconds())/1000, "max-call-ms")
+
+			if err := vc.stop(); err != nil {
+				b.Fatal(err)
+			}
+			if err := vc.terminate(); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+// cpuTime returns the user and system CPU time used by the process so far.
+func cpuTime(b *testing.B) time.Duration {
+	b.Helper()
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		b.Fatal(err)
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+const (
+	// syntheticRoomMeters is the side length of the square room the synthetic map is scanned in.
+	syntheticRoomMeters = 48.0
+	// syntheticPillarSpacingMeters is the distance between the square pillars of the room, which
+	// give the scans features to match.
+	syntheticPillarSpacingMeters = 6.0
+	// syntheticScanRays is the number of rays of a synthetic scan.
+	syntheticScanRays = 1440
+	// syntheticScanStepMeters is the distance travelled between two synthetic scans.
+	syntheticScanStepMeters = 0.2
+	// exportChunkSizeBytes is the size of the chunks an export is read in from its file.
+	exportChunkSizeBytes = 1 << 20
+)
+
+// syntheticScan returns a polar scan taken at x, y in a square room with a grid of pillars.
+func syntheticScan(x, y float64) []byte {
+	half := syntheticRoomMeters / 2
+	reading := make([]byte, 4*syntheticScanRays)
+	for i := 0; i < syntheticScanRays; i++ {
+		angle := -math.Pi + float64(i)*2*math.Pi/syntheticScanRays
+		dx, dy := math.Cos(angle), math.Sin(angle)
+		// the distance to the walls of the room, which the scan is taken in
+		r := math.Inf(1)
+		for _, d := range [][2]float64{{dx, x}, {dy, y}} {
+			if d[0] > 0 {
+				r = math.Min(r, (half-d[1])/d[0])
+			} else if d[0] < 0 {
+				r = math.Min(r, (-half-d[1])/d[0])
+			}
+		}
+		// the distance to the nearest pillar in the way
+		for px := -half + syntheticPillarSpacingMeters; px < half; px += syntheticPillarSpacingMeters {
+			for py := -half + syntheticPillarSpacingMeters; py < half; py += syntheticPillarSpacingMeters {
+				tMin, tMax := math.Inf(-1), math.Inf(1)
+				for _, d := range [][3]float64{{dx, x, px}, {dy, y, py}} {
+					if d[0] == 0 {
+						if math.Abs(d[1]-d[2]) > 0.5 {
+							tMin = math.Inf(1)
+						}
+						continue
+					}
+					t1, t2 := (d[2]-0.5-d[1])/d[0], (d[2]+0.5-d[1])/d[0]
+					tMin, tMax = math.Max(tMin, math.Min(t1, t2)), math.Min(tMax, math.Max(t1, t2))
+				}
+				if tMin > 0 && tMin <= tMax {
+					r = math.Min(r, tMin)
+				}
+			}
+		}
+		binary.LittleEndian.PutUint32(reading[4*i:], math.Float32bits(float32(r)))
+	}
+	return reading
+}
+
+// addSyntheticMap adds the scans of a serpentine path through the synthetic room between the pillars.
+func addSyntheticMap(b *testing.B, vc Carto) {
+	b.Helper()
+	half := syntheticRoomMeters / 2
+	timestamp := time.Date(2021, 8, 15, 14, 30, 45, 100, time.UTC)
+	direction := 1.0
+	for y := -half + syntheticPillarSpacingMeters/2; y < half; y += syntheticPillarSpacingMeters {
+		for step := 0.0; step <= syntheticRoomMeters-2; step += syntheticScanStepMeters {
+			x := direction * (step - half + 1)
+			timestamp = timestamp.Add(200 * time.Millisecond)
+			reading := s.TimedLidarReadingResponse{
+				Reading:        syntheticScan(x, y),
+				ReadingTime:    timestamp,
+				Format:         s.LidarReadingFormatPolar,
+				AngleMin:       -math.Pi,
+				AngleIncrement: 2 * math.Pi / syntheticScanRays,
+			}
+			for {
+				err := vc.addLidarReading("my-lidar", reading)
+				if err == nil {
+					break
+				}
+				if !errors.Is(err, ErrUnableToAcquireLock) {
+					b.Fatal(err)
+				}
+			}
+		}
+		direction = -direction
+	}
+}
+
+// resetPeakRSS resets the peak resident set size of the process and returns the current one, in bytes.
+func resetPeakRSS(b *testing.B) uint64 {
+	b.Helper()
+	runtime.GC()
+	debug.FreeOSMemory()
+	// writing 5 to clear_refs resets the peak resident set size, which is only supported on linux
+	if err := os.WriteFile("/proc/self/clear_refs", []byte("5"), 0o600); err != nil {
+		b.Skipf("cannot reset the peak resident set size: %v", err)
+	}
+	return procStatusBytes(b, "VmRSS")
+}
+
+// procStatusBytes returns a size in kB of /proc/self/status in bytes.
+func procStatusBytes(b *testing.B, field string) uint64 {
+	b.Helper()
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		value, ok := strings.CutPrefix(line, field+":")
+		if !ok {
+			continue
+		}
+		kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			b.Fatal(err)
+		}
+		return kb * 1024
+	}
+	b.Fatalf("/proc/self/status has no field %v", field)
+	return 0
+}
+
+// BenchmarkCGoAPIExport compares the peak memory of exporting the map and the internal state of a large
+// synthetic map copied into memory with streaming them to a file and reading it in chunks.
+func BenchmarkCGoAPIExport(b *testing.B) {
+	pvcl, err := NewLib(0, 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	algoCfg := GetTestAlgoConfig(false)
+	// the global optimization does not change the size of the map, so it is left out to build it faster
+	algoCfg.OptimizeEveryNNodes = 0
+	vc, err := NewCarto(GetTestConfig("my-lidar", "", "", true), algoCfg, &pvcl)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := vc.start(); err != nil {
+		b.Fatal(err)
+	}
+	addSyntheticMap(b, vc)
+	defer func() {
+		if err := vc.stop(); err != nil {
+			b.Fatal(err)
+		}
+		if err := vc.terminate(); err != nil {
+			b.Fatal(err)
+		}
+		if err := pvcl.Terminate(); err != nil {
+			b.Fatal(err)
+		}
+	}()
+
+	for _, tc := range []struct {
+		name     string
+		inMemory func() ([]byte, error)
+		toFile   func(path string) error
+	}{
+		{name: "point cloud map", inMemory: vc.pointCloudMap, toFile: vc.writePointCloudMap},
+		{name: "internal state", inMemory: vc.internalState, toFile: vc.writeInternalState},
+	} {
+		b.Run(tc.name+"/in memory", func(b *testing.B) {
+			var size int
+			baseline := resetPeakRSS(b)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				data, err := tc.inMemory()
+				if err != nil {
+					b.Fatal(err)
+				}
+				size = len(data)
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(size)/(1<<20), "export-MB")
+			b.ReportMetric(float64(procStatusBytes(b, "VmHWM")-baseline)/(1<<20), "peak-rss-growth-MB")
+		})
+
+		b.Run(tc.name+"/to file", func(b *testing.B) {
+			path := filepath.Join(b.TempDir(), "export")
+			chunk := make([]byte, exportChunkSizeBytes)
+			var size int
+			baseline := resetPeakRSS(b)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := tc.toFile(path); err != nil {
+					b.Fatal(err)
+				}
+				file, err := os.Open(path)
+				if err != nil {
+					b.Fatal(err)
+				}
+				size = 0
+				for {
+					n, err := file.Read(chunk)
+					size += n
+					if errors.Is(err, io.EOF) {
+						break
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := file.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(size)/(1<<20), "export-MB")
+			b.ReportMetric(float64(procStatusBytes(b, "VmHWM")-baseline)/(1<<20), "peak-rss-growth-MB")
+		})
+	}
+}
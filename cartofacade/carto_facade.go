@@ -15,9 +15,16 @@ import (
 
 var emptyRequestParams = map[RequestParamType]interface{}{}
 
-// ErrUnableToAcquireLock is the error returned from AddLidarReading, AddIMUReading,
-// and/or AddOdometerReading when lock can't be acquired.
-var ErrUnableToAcquireLock = errors.New("VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK")
+var (
+	// ErrTimeoutReading is the error returned when a call into C did not return before the timeout.
+	ErrTimeoutReading = errors.New("timeout reading from cartographer")
+	// ErrTimeoutWriting is the error returned when a call into C could not start before the timeout,
+	// because the previous call had not returned yet.
+	ErrTimeoutWriting = errors.New("timeout writing to cartographer")
+	// ErrHung is returned together with ErrTimeoutReading or ErrTimeoutWriting when the call into C which is
+	// running, the timed out call or the call it waited on, has been running for longer than its own timeout.
+	ErrHung = errors.New("call into cartographer did not return before its timeout")
+)
 
 // Initialize calls into the cartofacade C code.
 func (cf *CartoFacade) Initialize(ctx context.Context, timeout time.Duration, activeBackgroundWorkers *sync.WaitGroup) (SlamMode, error) {
@@ -172,6 +179,56 @@ func (cf *CartoFacade) PointCloudMap(ctx context.Context, timeout time.Duration)
 	return pointCloud, nil
 }
 
+// WritePointCloudMap calls into the cartofacade C code. The pointcloud map is written to the file at path
+// instead of being copied into memory.
+func (cf *CartoFacade) WritePointCloudMap(ctx context.Context, timeout time.Duration, path string) error {
+	requestParams := map[RequestParamType]interface{}{
+		filePath: path,
+	}
+
+	_, err := cf.request(ctx, writePointCloudMap, requestParams, timeout)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// WriteInternalState calls into the cartofacade C code. The internal state is written to the file at path
+// instead of being copied into memory.
+func (cf *CartoFacade) WriteInternalState(ctx context.Context, timeout time.Duration, path string) error {
+	requestParams := map[RequestParamType]interface{}{
+		filePath: path,
+	}
+
+	_, err := cf.request(ctx, writeInternalState, requestParams, timeout)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Submaps calls into the cartofacade C code. Submaps known to the caller which did not change since are
+// returned without their points.
+func (cf *CartoFacade) Submaps(ctx context.Context, timeout time.Duration, known []Submap) ([]Submap, error) {
+	requestParams := map[RequestParamType]interface{}{
+		knownSubmaps: known,
+	}
+
+	untyped, err := cf.request(ctx, submaps, requestParams, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	submaps, ok := untyped.([]Submap)
+	if !ok {
+		return nil, errors.New("unable to cast response from cartofacade to a slice of submaps")
+	}
+
+	return submaps, nil
+}
+
 // RunFinalOptimization calls into the cartofacade C code.
 func (cf *CartoFacade) RunFinalOptimization(ctx context.Context, timeout time.Duration) error {
 	_, err := cf.request(ctx, runFinalOptimization, emptyRequestParams, timeout)
@@ -182,6 +239,11 @@ func (cf *CartoFacade) RunFinalOptimization(ctx context.Context, timeout time.Du
 	return nil
 }
 
+// QueueStats returns the counts and queue latencies of the requests of each priority class.
+func (cf *CartoFacade) QueueStats() QueueStats {
+	return cf.dispatcher.Stats()
+}
+
 // RequestType defines the carto C API call that is being made.
 type RequestType int64
 
@@ -208,8 +270,50 @@ const (
 	pointCloudMap
 	// runFinalOptimization represents viam_carto_run_final_optimization.
 	runFinalOptimization
+	// submaps represents the viam_carto_get_submaps call in c.
+	submaps
+	// writePointCloudMap represents the viam_carto_write_point_cloud_map call in c.
+	writePointCloudMap
+	// writeInternalState represents the viam_carto_write_internal_state call in c.
+	writeInternalState
 )
 
+// String returns the name of the C API call of the request type.
+func (r RequestType) String() string {
+	switch r {
+	case initialize:
+		return "viam_carto_init"
+	case start:
+		return "viam_carto_start"
+	case stop:
+		return "viam_carto_stop"
+	case terminate:
+		return "viam_carto_terminate"
+	case addLidarReading:
+		return "viam_carto_add_lidar_reading"
+	case addIMUReading:
+		return "viam_carto_add_imu_reading"
+	case addOdometerReading:
+		return "viam_carto_add_odometer_reading"
+	case position:
+		return "viam_carto_get_position"
+	case internalState:
+		return "viam_carto_get_internal_state"
+	case pointCloudMap:
+		return "viam_carto_get_point_cloud_map"
+	case runFinalOptimization:
+		return "viam_carto_run_final_optimization"
+	case submaps:
+		return "viam_carto_get_submaps"
+	case writePointCloudMap:
+		return "viam_carto_write_point_cloud_map"
+	case writeInternalState:
+		return "viam_carto_write_internal_state"
+	default:
+		return fmt.Sprintf("unknown request type %d", int64(r))
+	}
+}
+
 // RequestParamType defines the type being provided as input to the work.
 type RequestParamType int64
 
@@ -218,6 +322,10 @@ const (
 	sensor RequestParamType = iota
 	// reading represents a sensor reading input into c funcs.
 	reading
+	// knownSubmaps represents the submaps already known to the caller input into c funcs.
+	knownSubmaps
+	// filePath represents the path of the file c funcs write to.
+	filePath
 )
 
 // Response defines the result of one piece of work that can be put on the result channel.
@@ -228,14 +336,15 @@ type Response struct {
 
 /*
 CartoFacade exists to ensure that only one go routine is calling into the CGO api at a time to ensure the
-go runtime doesn't spawn multiple OS threads, which would harm performance.
+go runtime doesn't spawn multiple OS threads, which would harm performance. Requests waiting to call into C
+are dispatched by priority class, so that interactive queries do not wait behind sensor inserts and exports.
 */
 type CartoFacade struct {
 	cartoLib        CartoLibInterface
 	carto           CartoInterface
 	cartoConfig     CartoConfig
 	cartoAlgoConfig CartoAlgoConfig
-	requestChan     chan Request
+	dispatcher      *dispatcher
 }
 
 // RequestInterface defines the functionality of a Request.
@@ -304,10 +413,26 @@ type Interface interface {
 		ctx context.Context,
 		timeout time.Duration,
 	) ([]byte, error)
+	Submaps(
+		ctx context.Context,
+		timeout time.Duration,
+		known []Submap,
+	) ([]Submap, error)
+	WritePointCloudMap(
+		ctx context.Context,
+		timeout time.Duration,
+		path string,
+	) error
+	WriteInternalState(
+		ctx context.Context,
+		timeout time.Duration,
+		path string,
+	) error
 	RunFinalOptimization(
 		ctx context.Context,
 		timeout time.Duration,
 	) error
+	QueueStats() QueueStats
 }
 
 // Request defines all of the necessary pieces to call into the CGo API.
@@ -315,6 +440,8 @@ type Request struct {
 	responseChan  chan Response
 	requestType   RequestType
 	requestParams map[RequestParamType]interface{}
+	// timeout is how long the call into C may run once dispatched, zero if it may run forever
+	timeout time.Duration
 }
 
 // New instantiates the Cartofacade struct which limits calls into C.
@@ -324,13 +451,28 @@ func New(cartoLib CartoLibInterface, cartoCfg CartoConfig, cartoAlgoCfg CartoAlg
 		cartoLib:        cartoLib,
 		cartoConfig:     cartoCfg,
 		cartoAlgoConfig: cartoAlgoCfg,
-		requestChan:     make(chan Request),
+		dispatcher:      newDispatcher(),
 	}
 }
 
-// doWork provides the logic to call the correct cgo functions with the correct input.
+// doWork provides the logic to call the correct cgo functions with the correct input. Errors of the
+// C API are wrapped with the request type and, when adding a reading, the sensor name.
 func (r *Request) doWork(
 	cf *CartoFacade,
+) (interface{}, error) {
+	result, err := r.callC(cf)
+	if err == nil {
+		return result, nil
+	}
+	if sensorName, ok := r.requestParams[sensor].(string); ok {
+		return result, fmt.Errorf("%v of sensor %q failed: %w", r.requestType, sensorName, err)
+	}
+	return result, fmt.Errorf("%v failed: %w", r.requestType, err)
+}
+
+// callC calls the cgo function of the request type with the inputs of the request.
+func (r *Request) callC(
+	cf *CartoFacade,
 ) (interface{}, error) {
 	switch r.requestType {
 	case initialize:
@@ -385,8 +527,29 @@ func (r *Request) doWork(
 		return cf.carto.pointCloudMap()
 	case runFinalOptimization:
 		return nil, cf.carto.runFinalOptimization()
+	case submaps:
+		known, ok := r.requestParams[knownSubmaps].([]Submap)
+		if !ok {
+			return nil, errors.New("could not cast inputted known submaps to a slice of submaps")
+		}
+
+		return cf.carto.submaps(known)
+	case writePointCloudMap:
+		path, ok := r.requestParams[filePath].(string)
+		if !ok {
+			return nil, errors.New("could not cast inputted file path to string")
+		}
+
+		return nil, cf.carto.writePointCloudMap(path)
+	case writeInternalState:
+		path, ok := r.requestParams[filePath].(string)
+		if !ok {
+			return nil, errors.New("could not cast inputted file path to string")
+		}
+
+		return nil, cf.carto.writeInternalState(path)
 	}
-	return nil, fmt.Errorf("no worktype found for: %v", r.requestType)
+	return nil, fmt.Errorf("no worktype found for: %d", int64(r.requestType))
 }
 
 // request wraps calls into C. This function requires the caller to know which RequestTypes
@@ -404,38 +567,56 @@ func (cf *CartoFacade) request(
 		responseChan:  make(chan Response, 1),
 		requestType:   requestType,
 		requestParams: inputs,
+		timeout:       timeout,
 	}
 
-	// wait until work can call into C (and timeout if needed)
+	// wait until work has called into C (and timeout if needed)
+	pending := cf.dispatcher.push(ctx, req)
 	select {
-	case cf.requestChan <- req:
-		select {
-		case response := <-req.responseChan:
-			return response.result, response.err
-		case <-ctx.Done():
-			msg := "timeout reading from cartographer"
-			return nil, multierr.Combine(errors.New(msg), ctx.Err())
-		}
+	case response := <-req.responseChan:
+		return response.result, response.err
 	case <-ctx.Done():
-		msg := "timeout writing to cartographer"
-		return nil, multierr.Combine(errors.New(msg), ctx.Err())
+		timeoutErr := ErrTimeoutReading
+		if cf.dispatcher.remove(pending, req.responseChan) {
+			timeoutErr = ErrTimeoutWriting
+		}
+		// time spent waiting to be dispatched, or a caller giving up, says nothing about whether cartographer
+		// hung, only the call into C overrunning its own timeout does
+		if ctxParent.Err() == nil && cf.dispatcher.runningOverran(time.Now()) {
+			return nil, multierr.Combine(timeoutErr, ErrHung, ctx.Err())
+		}
+		return nil, multierr.Combine(timeoutErr, ctx.Err())
 	}
 }
 
+// prepareCancel clears the cancellation flag of cartographer before a cancellable request calls into C, and
+// returns the function which sets it.
+func (cf *CartoFacade) prepareCancel(pending *pendingRequest) func() {
+	if !pending.requestType.cancellable() {
+		return nil
+	}
+	cf.carto.cancel(false)
+	return func() { cf.carto.cancel(true) }
+}
+
 // startCGoroutine starts the background goroutine that is responsible for ensuring only one call
-// into C is being made at a time.
+// into C is being made at a time. Waiting requests are dispatched by priority class.
 func (cf *CartoFacade) startCGoroutine(ctx context.Context, activeBackgroundWorkers *sync.WaitGroup) {
 	activeBackgroundWorkers.Add(1)
 	go func() {
 		defer activeBackgroundWorkers.Done()
+		// no call into C polls the cancellation flag anymore, e.g. of an instance abandoned after it hung
+		defer func() { cf.dispatcher.close(cf.carto.release) }()
 
 		for {
-			select {
-			case <-ctx.Done():
+			workToDo, err := cf.dispatcher.pop(ctx, cf.prepareCancel)
+			if err != nil {
 				return
-			case workToDo := <-cf.requestChan:
-				result, err := workToDo.doWork(cf)
-				workToDo.responseChan <- Response{result: result, err: err}
+			}
+			result, err := workToDo.doWork(cf)
+			// coalesced requests share the result
+			for _, responseChan := range cf.dispatcher.finish(workToDo) {
+				responseChan <- Response{result: result, err: err}
 			}
 		}
 	}()
@@ -83,10 +83,26 @@ type Mock struct {
 		ctx context.Context,
 		timeout time.Duration,
 	) ([]byte, error)
+	SubmapsFunc func(
+		ctx context.Context,
+		timeout time.Duration,
+		known []Submap,
+	) ([]Submap, error)
+	WritePointCloudMapFunc func(
+		ctx context.Context,
+		timeout time.Duration,
+		path string,
+	) error
+	WriteInternalStateFunc func(
+		ctx context.Context,
+		timeout time.Duration,
+		path string,
+	) error
 	RunFinalOptimizationFunc func(
 		ctx context.Context,
 		timeout time.Duration,
 	) error
+	QueueStatsFunc func() QueueStats
 }
 
 // request calls the injected requestFunc or the real version.
@@ -230,6 +246,42 @@ func (cf *Mock) PointCloudMap(
 	return cf.PointCloudMapFunc(ctx, timeout)
 }
 
+// Submaps calls the injected SubmapsFunc or the real version.
+func (cf *Mock) Submaps(
+	ctx context.Context,
+	timeout time.Duration,
+	known []Submap,
+) ([]Submap, error) {
+	if cf.SubmapsFunc == nil {
+		return cf.CartoFacade.Submaps(ctx, timeout, known)
+	}
+	return cf.SubmapsFunc(ctx, timeout, known)
+}
+
+// WritePointCloudMap calls the injected WritePointCloudMapFunc or the real version.
+func (cf *Mock) WritePointCloudMap(
+	ctx context.Context,
+	timeout time.Duration,
+	path string,
+) error {
+	if cf.WritePointCloudMapFunc == nil {
+		return cf.CartoFacade.WritePointCloudMap(ctx, timeout, path)
+	}
+	return cf.WritePointCloudMapFunc(ctx, timeout, path)
+}
+
+// WriteInternalState calls the injected WriteInternalStateFunc or the real version.
+func (cf *Mock) WriteInternalState(
+	ctx context.Context,
+	timeout time.Duration,
+	path string,
+) error {
+	if cf.WriteInternalStateFunc == nil {
+		return cf.CartoFacade.WriteInternalState(ctx, timeout, path)
+	}
+	return cf.WriteInternalStateFunc(ctx, timeout, path)
+}
+
 // RunFinalOptimization calls the injected RunFinalOptimizationFunc or the real version.
 func (cf *Mock) RunFinalOptimization(
 	ctx context.Context,
@@ -240,3 +292,11 @@ func (cf *Mock) RunFinalOptimization(
 	}
 	return cf.RunFinalOptimizationFunc(ctx, timeout)
 }
+
+// QueueStats calls the injected QueueStatsFunc or the real version.
+func (cf *Mock) QueueStats() QueueStats {
+	if cf.QueueStatsFunc == nil {
+		return cf.CartoFacade.QueueStats()
+	}
+	return cf.QueueStatsFunc()
+}
@@ -186,7 +186,7 @@ func TestStart(t *testing.T) {
 		}
 		err := cartoFacade.Start(cancelCtx, 5*time.Second)
 		test.That(t, err, test.ShouldBeError)
-		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, errors.Is(err, expectedErr), test.ShouldBeTrue)
 	})
 
 	t.Run("failure due to time out", func(t *testing.T) {
@@ -233,7 +233,7 @@ func TestStop(t *testing.T) {
 		}
 		err := cartoFacade.Stop(cancelCtx, 5*time.Second)
 		test.That(t, err, test.ShouldBeError)
-		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, errors.Is(err, expectedErr), test.ShouldBeTrue)
 	})
 
 	t.Run("failure due to time out", func(t *testing.T) {
@@ -280,7 +280,7 @@ func TestTerminate(t *testing.T) {
 		}
 		err := cartoFacade.Terminate(cancelCtx, 5*time.Second)
 		test.That(t, err, test.ShouldBeError)
-		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, errors.Is(err, expectedErr), test.ShouldBeTrue)
 	})
 
 	t.Run("failure due to time out", func(t *testing.T) {
@@ -341,7 +341,8 @@ func TestAddLidarReading(t *testing.T) {
 		}
 		err = cartoFacade.AddLidarReading(cancelCtx, 5*time.Second, "my-lidar", reading)
 		test.That(t, err, test.ShouldBeError)
-		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, errors.Is(err, expectedErr), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldEqual, `viam_carto_add_lidar_reading of sensor "my-lidar" failed: AddLidarReading failed`)
 	})
 
 	t.Run("failure due to time out", func(t *testing.T) {
@@ -394,7 +395,7 @@ func TestAddIMUReading(t *testing.T) {
 		}
 		err := cartoFacade.AddIMUReading(cancelCtx, 5*time.Second, "my-movement-sensor", testIMUReading)
 		test.That(t, err, test.ShouldBeError)
-		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, errors.Is(err, expectedErr), test.ShouldBeTrue)
 	})
 
 	t.Run("failure due to time out", func(t *testing.T) {
@@ -448,7 +449,7 @@ func TestAddOdometerReading(t *testing.T) {
 		}
 		err := cartoFacade.AddOdometerReading(cancelCtx, 5*time.Second, "my-movement-sensor", testOdometerReading)
 		test.That(t, err, test.ShouldBeError)
-		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, errors.Is(err, expectedErr), test.ShouldBeTrue)
 	})
 
 	t.Run("failure due to time out", func(t *testing.T) {
@@ -499,7 +500,7 @@ func TestPosition(t *testing.T) {
 		}
 		_, err := cartoFacade.Position(cancelCtx, 5*time.Second)
 		test.That(t, err, test.ShouldBeError)
-		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, errors.Is(err, expectedErr), test.ShouldBeTrue)
 	})
 
 	t.Run("failure due to time out", func(t *testing.T) {
@@ -548,7 +549,7 @@ func TestInternalState(t *testing.T) {
 		}
 		_, err := cartoFacade.InternalState(cancelCtx, 5*time.Second)
 		test.That(t, err, test.ShouldBeError)
-		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, errors.Is(err, expectedErr), test.ShouldBeTrue)
 	})
 
 	t.Run("failure due to time out", func(t *testing.T) {
@@ -597,7 +598,7 @@ func TestPointCloudMap(t *testing.T) {
 		}
 		_, err := cartoFacade.PointCloudMap(cancelCtx, 5*time.Second)
 		test.That(t, err, test.ShouldBeError)
-		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, errors.Is(err, expectedErr), test.ShouldBeTrue)
 	})
 
 	t.Run("failure due to time out", func(t *testing.T) {
@@ -615,6 +616,133 @@ func TestPointCloudMap(t *testing.T) {
 	activeBackgroundWorkers.Wait()
 }
 
+func TestWritePointCloudMap(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	carto := CartoMock{}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	t.Run("success", func(t *testing.T) {
+		var writtenPath string
+		carto.WritePointCloudMapFunc = func(path string) error {
+			writtenPath = path
+			return nil
+		}
+		err := cartoFacade.WritePointCloudMap(cancelCtx, 5*time.Second, "/tmp/export")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, writtenPath, test.ShouldEqual, "/tmp/export")
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		carto.WritePointCloudMapFunc = func(path string) error {
+			return ErrExportFileWriteIOError
+		}
+		err := cartoFacade.WritePointCloudMap(cancelCtx, 5*time.Second, "/tmp/export")
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, errors.Is(err, ErrExportFileWriteIOError), test.ShouldBeTrue)
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
+
+func TestWriteInternalState(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	carto := CartoMock{}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	t.Run("success", func(t *testing.T) {
+		var writtenPath string
+		carto.WriteInternalStateFunc = func(path string) error {
+			writtenPath = path
+			return nil
+		}
+		err := cartoFacade.WriteInternalState(cancelCtx, 5*time.Second, "/tmp/export")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, writtenPath, test.ShouldEqual, "/tmp/export")
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		carto.WriteInternalStateFunc = func(path string) error {
+			return ErrExportFileWriteIOError
+		}
+		err := cartoFacade.WriteInternalState(cancelCtx, 5*time.Second, "/tmp/export")
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, errors.Is(err, ErrExportFileWriteIOError), test.ShouldBeTrue)
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
+
+func TestSubmaps(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	carto := CartoMock{}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	t.Run("success", func(t *testing.T) {
+		known := []Submap{{SubmapID: SubmapID{SubmapIndex: 0}, Version: 3}}
+		expected := []Submap{known[0], {SubmapID: SubmapID{SubmapIndex: 1}, Version: 1, PointCloud: []byte("hello!")}}
+		carto.SubmapsFunc = func(knownSubmaps []Submap) ([]Submap, error) {
+			test.That(t, knownSubmaps, test.ShouldResemble, known)
+			return expected, nil
+		}
+		submaps, err := cartoFacade.Submaps(cancelCtx, 5*time.Second, known)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, submaps, test.ShouldResemble, expected)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		expectedErr := errors.New("Submaps failed")
+		carto.SubmapsFunc = func([]Submap) ([]Submap, error) {
+			return nil, expectedErr
+		}
+		_, err := cartoFacade.Submaps(cancelCtx, 5*time.Second, nil)
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, errors.Is(err, expectedErr), test.ShouldBeTrue)
+	})
+
+	t.Run("failure due to time out", func(t *testing.T) {
+		carto.SubmapsFunc = func([]Submap) ([]Submap, error) {
+			time.Sleep(50 * time.Millisecond)
+			return nil, nil
+		}
+		_, err := cartoFacade.Submaps(cancelCtx, 1*time.Millisecond, nil)
+		test.That(t, err, test.ShouldBeError)
+		expectedErr := multierr.Combine(errors.New(timeoutErrMessage), context.DeadlineExceeded)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
+
 func TestRunFinalOptimization(t *testing.T) {
 	lib := CartoLibMock{}
 
@@ -644,7 +772,7 @@ func TestRunFinalOptimization(t *testing.T) {
 		}
 		err := cartoFacade.RunFinalOptimization(cancelCtx, 5*time.Second)
 		test.That(t, err, test.ShouldBeError)
-		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, errors.Is(err, expectedErr), test.ShouldBeTrue)
 	})
 
 	t.Run("failure due to time out", func(t *testing.T) {
@@ -0,0 +1,335 @@
+package cartofacade
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxPriorityWait is how long a request waits behind requests of higher priority classes before it is
+// dispatched first, so that a steady stream of sensor inserts cannot starve exports.
+const maxPriorityWait = 5 * time.Second
+
+// RequestPriority is the class of a request, which decides the order in which requests waiting to call into C
+// are dispatched.
+type RequestPriority int
+
+const (
+	// PriorityInteractive is the class of queries a client waits on, such as Position, and of starting and
+	// stopping cartographer.
+	PriorityInteractive RequestPriority = iota
+	// PrioritySensorInsert is the class of adding sensor readings.
+	PrioritySensorInsert
+	// PriorityExport is the class of heavy exports of the map and the internal state, and of the final
+	// optimization.
+	PriorityExport
+	numPriorities
+)
+
+// String returns the name of the priority class.
+func (p RequestPriority) String() string {
+	switch p {
+	case PriorityInteractive:
+		return "interactive"
+	case PrioritySensorInsert:
+		return "sensor_insert"
+	case PriorityExport:
+		return "export"
+	default:
+		return "unknown"
+	}
+}
+
+// priority returns the priority class of the request type.
+func (r RequestType) priority() RequestPriority {
+	switch r {
+	case addLidarReading, addIMUReading, addOdometerReading:
+		return PrioritySensorInsert
+	case internalState, pointCloudMap, submaps, writePointCloudMap, writeInternalState, runFinalOptimization:
+		return PriorityExport
+	default:
+		return PriorityInteractive
+	}
+}
+
+// coalescable returns whether pending requests of the type can share one result. These requests take no
+// inputs, so requests dispatched back to back return the same result.
+func (r RequestType) coalescable() bool {
+	return r == internalState || r == pointCloudMap
+}
+
+// cancellable returns whether a running request of the type stops early once cancelled.
+func (r RequestType) cancellable() bool {
+	switch r {
+	case internalState, pointCloudMap, submaps, writePointCloudMap, writeInternalState, runFinalOptimization:
+		return true
+	default:
+		return false
+	}
+}
+
+// QueueClassStats are the counts and queue latencies of the requests of a priority class.
+type QueueClassStats struct {
+	// Pending is the number of requests waiting to be dispatched.
+	Pending int
+	// Dispatched is the number of requests which called into C.
+	Dispatched int
+	// Coalesced is the number of requests which shared the result of a pending request of the same type
+	// instead of calling into C themselves.
+	Coalesced int
+	// Skipped is the number of requests which were not dispatched because every request sharing them timed
+	// out or was cancelled while waiting.
+	Skipped int
+	// Cancelled is the number of dispatched requests which were told to stop calling into C because every
+	// request sharing them timed out or was cancelled.
+	Cancelled int
+	// MeanQueueLatency and MaxQueueLatency are the times the dispatched requests waited to call into C.
+	MeanQueueLatency time.Duration
+	MaxQueueLatency  time.Duration
+}
+
+// QueueStats are the queue stats of each priority class.
+type QueueStats struct {
+	Interactive  QueueClassStats
+	SensorInsert QueueClassStats
+	Export       QueueClassStats
+}
+
+// waiter is a request waiting on the result of a pending request.
+type waiter struct {
+	ctx          context.Context
+	responseChan chan Response
+}
+
+// pendingRequest is a request waiting to be dispatched or running, and the requests waiting on its result.
+type pendingRequest struct {
+	Request
+	waiters  []waiter
+	queuedAt time.Time
+}
+
+// removeWaiter removes the waiter with the response channel.
+func (pending *pendingRequest) removeWaiter(responseChan chan Response) {
+	for i, w := range pending.waiters {
+		if w.responseChan == responseChan {
+			pending.waiters = append(pending.waiters[:i], pending.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// removeDoneWaiters removes the waiters whose context is done and returns how many remain.
+func (pending *pendingRequest) removeDoneWaiters() int {
+	waiters := pending.waiters[:0]
+	for _, w := range pending.waiters {
+		if w.ctx.Err() == nil {
+			waiters = append(waiters, w)
+		}
+	}
+	pending.waiters = waiters
+	return len(waiters)
+}
+
+// dispatcher queues the requests waiting to call into C by priority class.
+type dispatcher struct {
+	// ready is signalled when a request is queued
+	ready chan struct{}
+
+	mu                sync.Mutex
+	queues            [numPriorities][]*pendingRequest
+	stats             [numPriorities]QueueClassStats
+	totalQueueLatency [numPriorities]time.Duration
+	// running is the request calling into C since runningSince, and cancelRunning tells it to stop early
+	running       *pendingRequest
+	runningSince  time.Time
+	cancelRunning func()
+}
+
+func newDispatcher() *dispatcher {
+	return &dispatcher{ready: make(chan struct{}, 1)}
+}
+
+// push queues a request, which is skipped if ctx is done by the time it is dispatched. A coalescable
+// request joins a pending request of the same type instead.
+func (d *dispatcher) push(ctx context.Context, req Request) *pendingRequest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p := req.requestType.priority()
+	w := waiter{ctx: ctx, responseChan: req.responseChan}
+	if req.requestType.coalescable() {
+		for _, pending := range d.queues[p] {
+			if pending.requestType == req.requestType {
+				pending.waiters = append(pending.waiters, w)
+				d.stats[p].Coalesced++
+				return pending
+			}
+		}
+	}
+
+	pending := &pendingRequest{Request: req, waiters: []waiter{w}, queuedAt: time.Now()}
+	d.queues[p] = append(d.queues[p], pending)
+	select {
+	case d.ready <- struct{}{}:
+	default:
+	}
+	return pending
+}
+
+// remove removes the response channel of a request which timed out while waiting. A queued request is
+// skipped and a running request is cancelled once no request is waiting on it anymore. It returns false if
+// the request was already dispatched.
+func (d *dispatcher) remove(pending *pendingRequest, responseChan chan Response) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p := pending.requestType.priority()
+	pending.removeWaiter(responseChan)
+	for i, queued := range d.queues[p] {
+		if queued != pending {
+			continue
+		}
+		if len(pending.waiters) == 0 {
+			d.queues[p] = append(d.queues[p][:i], d.queues[p][i+1:]...)
+			d.stats[p].Skipped++
+		}
+		return true
+	}
+
+	if d.running == pending && len(pending.waiters) == 0 && pending.requestType.cancellable() {
+		d.cancelRunning()
+		d.stats[p].Cancelled++
+	}
+	return false
+}
+
+// finish marks the request as no longer running and returns the response channels of the requests still
+// waiting on it.
+func (d *dispatcher) finish(pending *pendingRequest) []chan Response {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.running = nil
+	d.cancelRunning = nil
+
+	responseChans := make([]chan Response, 0, len(pending.waiters))
+	for _, w := range pending.waiters {
+		responseChans = append(responseChans, w.responseChan)
+	}
+	return responseChans
+}
+
+/*
+pop waits for the next request to dispatch: the first request of the highest priority class, unless a
+request of a lower class waited longer than maxPriorityWait, in which case the lower class whose first
+request waited longest is dispatched. Requests whose waiters are all done are skipped.
+
+The request is marked as running before it is returned, so that it is cancelled if every request waiting
+on it gives up before it calls into C. prepare is called with the request while it is marked as running and
+returns the function which cancels it, a nil prepare or cancel function does not cancel the request.
+*/
+func (d *dispatcher) pop(ctx context.Context, prepare func(*pendingRequest) func()) (*pendingRequest, error) {
+	for {
+		if pending := d.next(prepare); pending != nil {
+			return pending, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-d.ready:
+		}
+	}
+}
+
+func (d *dispatcher) next(prepare func(*pendingRequest) func()) *pendingRequest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	next := numPriorities
+	// the lower class whose first request waited longest beyond maxPriorityWait, if any
+	starved, starvedWait := numPriorities, maxPriorityWait
+	for p := RequestPriority(0); p < numPriorities; p++ {
+		d.skipDone(p)
+		if len(d.queues[p]) == 0 {
+			continue
+		}
+		if next == numPriorities {
+			next = p
+		} else if wait := now.Sub(d.queues[p][0].queuedAt); wait > starvedWait {
+			starved, starvedWait = p, wait
+		}
+	}
+	if starved != numPriorities {
+		next = starved
+	}
+	if next == numPriorities {
+		return nil
+	}
+
+	pending := d.queues[next][0]
+	d.queues[next] = d.queues[next][1:]
+	latency := now.Sub(pending.queuedAt)
+	d.stats[next].Dispatched++
+	d.totalQueueLatency[next] += latency
+	if latency > d.stats[next].MaxQueueLatency {
+		d.stats[next].MaxQueueLatency = latency
+	}
+
+	d.running = pending
+	d.runningSince = now
+	d.cancelRunning = func() {}
+	if prepare != nil {
+		if cancel := prepare(pending); cancel != nil {
+			d.cancelRunning = cancel
+		}
+	}
+	return pending
+}
+
+// runningOverran returns whether the running request has been calling into C for longer than its timeout.
+func (d *dispatcher) runningOverran(now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.running != nil && d.running.timeout > 0 && now.Sub(d.runningSince) > d.running.timeout
+}
+
+// close stops tracking the running request and calls release while holding the lock cancelling the running
+// request takes, so that release can free what cancelling uses.
+func (d *dispatcher) close(release func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.running = nil
+	d.cancelRunning = nil
+	release()
+}
+
+// skipDone drops the requests at the front of the queue whose waiters are all done.
+func (d *dispatcher) skipDone(p RequestPriority) {
+	for len(d.queues[p]) > 0 && d.queues[p][0].removeDoneWaiters() == 0 {
+		d.queues[p] = d.queues[p][1:]
+		d.stats[p].Skipped++
+	}
+}
+
+// Stats returns the queue stats of each priority class.
+func (d *dispatcher) Stats() QueueStats {
+	if d == nil {
+		return QueueStats{}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var classStats [numPriorities]QueueClassStats
+	for p := range classStats {
+		classStats[p] = d.stats[p]
+		classStats[p].Pending = len(d.queues[p])
+		if classStats[p].Dispatched > 0 {
+			classStats[p].MeanQueueLatency = d.totalQueueLatency[p] / time.Duration(classStats[p].Dispatched)
+		}
+	}
+	return QueueStats{
+		Interactive:  classStats[PriorityInteractive],
+		SensorInsert: classStats[PrioritySensorInsert],
+		Export:       classStats[PriorityExport],
+	}
+}
@@ -0,0 +1,348 @@
+package cartofacade
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+)
+
+func newTestRequest(requestType RequestType) Request {
+	return Request{responseChan: make(chan Response, 1), requestType: requestType}
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Run("dispatches requests by priority class and in order within a class", func(t *testing.T) {
+		d := newDispatcher()
+		for _, requestType := range []RequestType{pointCloudMap, addIMUReading, position, addLidarReading, start} {
+			d.push(context.Background(), newTestRequest(requestType))
+		}
+		stats := d.Stats()
+		test.That(t, stats.Interactive.Pending, test.ShouldEqual, 2)
+		test.That(t, stats.SensorInsert.Pending, test.ShouldEqual, 2)
+		test.That(t, stats.Export.Pending, test.ShouldEqual, 1)
+
+		var dispatched []RequestType
+		for i := 0; i < 5; i++ {
+			pending, err := d.pop(context.Background(), nil)
+			test.That(t, err, test.ShouldBeNil)
+			dispatched = append(dispatched, pending.requestType)
+		}
+		test.That(t, dispatched, test.ShouldResemble,
+			[]RequestType{position, start, addIMUReading, addLidarReading, pointCloudMap})
+		stats = d.Stats()
+		test.That(t, stats.Interactive.Dispatched, test.ShouldEqual, 2)
+		test.That(t, stats.Export.Pending, test.ShouldEqual, 0)
+	})
+
+	t.Run("dispatches a request which waited too long behind higher priority classes first", func(t *testing.T) {
+		d := newDispatcher()
+		export := d.push(context.Background(), newTestRequest(internalState))
+		export.queuedAt = time.Now().Add(-2 * maxPriorityWait)
+		d.push(context.Background(), newTestRequest(position))
+
+		pending, err := d.pop(context.Background(), nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pending, test.ShouldEqual, export)
+		test.That(t, d.Stats().Export.MaxQueueLatency, test.ShouldBeGreaterThan, maxPriorityWait)
+	})
+
+	t.Run("dispatches the class which waited longest beyond the limit first", func(t *testing.T) {
+		d := newDispatcher()
+		export := d.push(context.Background(), newTestRequest(internalState))
+		export.queuedAt = time.Now().Add(-3 * maxPriorityWait)
+		insert := d.push(context.Background(), newTestRequest(addLidarReading))
+		insert.queuedAt = time.Now().Add(-2 * maxPriorityWait)
+		interactive := d.push(context.Background(), newTestRequest(position))
+
+		var dispatched []*pendingRequest
+		for i := 0; i < 3; i++ {
+			pending, err := d.pop(context.Background(), nil)
+			test.That(t, err, test.ShouldBeNil)
+			dispatched = append(dispatched, pending)
+		}
+		test.That(t, dispatched, test.ShouldResemble, []*pendingRequest{export, insert, interactive})
+	})
+
+	t.Run("coalesces pending map requests", func(t *testing.T) {
+		d := newDispatcher()
+		first, second, third := newTestRequest(pointCloudMap), newTestRequest(pointCloudMap), newTestRequest(internalState)
+		pending := d.push(context.Background(), first)
+		test.That(t, d.push(context.Background(), second), test.ShouldEqual, pending)
+		test.That(t, d.push(context.Background(), third), test.ShouldNotEqual, pending)
+		test.That(t, d.Stats().Export, test.ShouldResemble, QueueClassStats{Pending: 2, Coalesced: 1})
+
+		// the request stays queued until every request sharing it timed out
+		test.That(t, d.remove(pending, first.responseChan), test.ShouldBeTrue)
+		test.That(t, d.Stats().Export.Pending, test.ShouldEqual, 2)
+		test.That(t, d.remove(pending, second.responseChan), test.ShouldBeTrue)
+		test.That(t, d.Stats().Export.Pending, test.ShouldEqual, 1)
+		test.That(t, d.Stats().Export.Skipped, test.ShouldEqual, 1)
+
+		popped, err := d.pop(context.Background(), nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, popped.requestType, test.ShouldEqual, internalState)
+		test.That(t, d.remove(popped, third.responseChan), test.ShouldBeFalse)
+	})
+
+	t.Run("skips requests whose context is done by the time they are dispatched", func(t *testing.T) {
+		d := newDispatcher()
+		expiredCtx, cancelFunc := context.WithCancel(context.Background())
+		cancelFunc()
+		d.push(expiredCtx, newTestRequest(addLidarReading))
+		d.push(expiredCtx, newTestRequest(pointCloudMap))
+		// a coalesced request which is still waiting keeps the shared request alive
+		waiting := newTestRequest(pointCloudMap)
+		d.push(context.Background(), waiting)
+		d.push(context.Background(), newTestRequest(addIMUReading))
+
+		pending, err := d.pop(context.Background(), nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pending.requestType, test.ShouldEqual, addIMUReading)
+		pending, err = d.pop(context.Background(), nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pending.requestType, test.ShouldEqual, pointCloudMap)
+		test.That(t, d.finish(pending), test.ShouldResemble, []chan Response{waiting.responseChan})
+
+		stats := d.Stats()
+		test.That(t, stats.SensorInsert.Skipped, test.ShouldEqual, 1)
+		test.That(t, stats.SensorInsert.Dispatched, test.ShouldEqual, 1)
+		test.That(t, stats.Export.Skipped, test.ShouldEqual, 0)
+	})
+
+	t.Run("cancels a running request once every request waiting on it gave up", func(t *testing.T) {
+		d := newDispatcher()
+		first, second := newTestRequest(internalState), newTestRequest(internalState)
+		pending := d.push(context.Background(), first)
+		d.push(context.Background(), second)
+		// the request is cancellable as soon as it is dispatched
+		cancelled := false
+		popped, err := d.pop(context.Background(), func(*pendingRequest) func() {
+			return func() { cancelled = true }
+		})
+		test.That(t, err, test.ShouldBeNil)
+
+		test.That(t, d.remove(pending, first.responseChan), test.ShouldBeFalse)
+		test.That(t, cancelled, test.ShouldBeFalse)
+		test.That(t, d.remove(pending, second.responseChan), test.ShouldBeFalse)
+		test.That(t, cancelled, test.ShouldBeTrue)
+		test.That(t, d.finish(popped), test.ShouldBeEmpty)
+		test.That(t, d.Stats().Export.Cancelled, test.ShouldEqual, 1)
+	})
+
+	t.Run("returns the context error while waiting for a request", func(t *testing.T) {
+		d := newDispatcher()
+		ctx, cancelFunc := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancelFunc()
+		_, err := d.pop(ctx, nil)
+		test.That(t, err, test.ShouldEqual, context.DeadlineExceeded)
+	})
+}
+
+func TestCoalescedRequestsShareOneResult(t *testing.T) {
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cf := New(&CartoLibMock{}, GetTestConfig("my-lidar", "", "", true), GetTestAlgoConfig(false))
+	carto := CartoMock{}
+	// keep the C goroutine busy until both map requests are pending
+	unblock := make(chan struct{})
+	carto.PositionFunc = func() (Position, error) {
+		<-unblock
+		return Position{}, nil
+	}
+	var mapCalls atomic.Int32
+	carto.PointCloudMapFunc = func() ([]byte, error) {
+		mapCalls.Add(1)
+		return []byte("map"), nil
+	}
+	cf.carto = &carto
+	cf.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	go func() {
+		if _, err := cf.Position(cancelCtx, 5*time.Second); err != nil {
+			t.Error(err)
+		}
+	}()
+	for cf.QueueStats().Interactive.Dispatched == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	maps := make([][]byte, 2)
+	for i := range maps {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if maps[i], err = cf.PointCloudMap(cancelCtx, 5*time.Second); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	for cf.QueueStats().Export.Coalesced == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(unblock)
+	wg.Wait()
+
+	test.That(t, mapCalls.Load(), test.ShouldEqual, 1)
+	test.That(t, maps, test.ShouldResemble, [][]byte{[]byte("map"), []byte("map")})
+	test.That(t, cf.QueueStats().Export.Dispatched, test.ShouldEqual, 1)
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
+
+func TestAbandonedMapRequestIsCancelled(t *testing.T) {
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cf := New(&CartoLibMock{}, GetTestConfig("my-lidar", "", "", true), GetTestAlgoConfig(false))
+	carto := CartoMock{}
+	// like C, the map export polls the cancellation flag and stops early
+	carto.PointCloudMapFunc = func() ([]byte, error) {
+		for !carto.Cancelled() {
+			time.Sleep(time.Millisecond)
+		}
+		return nil, ErrCancelled
+	}
+	carto.PositionFunc = func() (Position, error) {
+		return Position{X: 1}, nil
+	}
+	cf.carto = &carto
+	cf.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	_, err := cf.PointCloudMap(cancelCtx, 20*time.Millisecond)
+	test.That(t, errors.Is(err, ErrTimeoutReading), test.ShouldBeTrue)
+
+	// the C goroutine is free again, and the next call is not cancelled
+	pos, err := cf.Position(cancelCtx, 5*time.Second)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pos.X, test.ShouldEqual, 1)
+	test.That(t, cf.QueueStats().Export.Cancelled, test.ShouldEqual, 1)
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
+
+func TestOnlyCallsOverrunningTheirTimeoutAreHangs(t *testing.T) {
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cf := New(&CartoLibMock{}, GetTestConfig("my-lidar", "", "", true), GetTestAlgoConfig(false))
+	carto := CartoMock{}
+	// unlike C, the final optimization does not poll the cancellation flag
+	unblock := make(chan struct{})
+	carto.RunFinalOptimizationFunc = func() error {
+		<-unblock
+		return nil
+	}
+	carto.PositionFunc = func() (Position, error) {
+		return Position{}, nil
+	}
+	cf.carto = &carto
+	cf.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	optimizationErr := make(chan error, 1)
+	go func() {
+		optimizationErr <- cf.RunFinalOptimization(cancelCtx, 100*time.Millisecond)
+	}()
+	for cf.QueueStats().Export.Dispatched == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the optimization is still within its timeout, so timing out behind it is not a hang
+	_, err := cf.Position(cancelCtx, 10*time.Millisecond)
+	test.That(t, errors.Is(err, ErrTimeoutWriting), test.ShouldBeTrue)
+	test.That(t, errors.Is(err, ErrHung), test.ShouldBeFalse)
+
+	// the optimization timed out before it ran for its whole timeout, as it waited to be dispatched
+	err = <-optimizationErr
+	test.That(t, errors.Is(err, ErrTimeoutReading), test.ShouldBeTrue)
+
+	// once the optimization overran its timeout, the calls timing out behind it report the hang
+	time.Sleep(20 * time.Millisecond)
+	_, err = cf.Position(cancelCtx, 10*time.Millisecond)
+	test.That(t, errors.Is(err, ErrTimeoutWriting), test.ShouldBeTrue)
+	test.That(t, errors.Is(err, ErrHung), test.ShouldBeTrue)
+
+	// unless the caller gave up
+	callerCtx, callerCancel := context.WithCancel(cancelCtx)
+	time.AfterFunc(10*time.Millisecond, callerCancel)
+	_, err = cf.Position(callerCtx, time.Second)
+	test.That(t, errors.Is(err, context.Canceled), test.ShouldBeTrue)
+	test.That(t, errors.Is(err, ErrHung), test.ShouldBeFalse)
+
+	close(unblock)
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
+
+func BenchmarkPositionLatencyUnderLoad(b *testing.B) {
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cf := New(&CartoLibMock{}, GetTestConfig("my-lidar", "my-imu", "", true), GetTestAlgoConfig(true))
+	carto := CartoMock{}
+	carto.AddIMUReadingFunc = func(string, s.TimedIMUReadingResponse) error {
+		time.Sleep(200 * time.Microsecond)
+		return nil
+	}
+	carto.PointCloudMapFunc = func() ([]byte, error) {
+		time.Sleep(5 * time.Millisecond)
+		return []byte("map"), nil
+	}
+	carto.PositionFunc = func() (Position, error) {
+		return Position{}, nil
+	}
+	cf.carto = &carto
+	cf.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	// a burst of IMU readings from several goroutines and a client repeatedly requesting the map
+	loadWorkers := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		loadWorkers.Add(1)
+		go func() {
+			defer loadWorkers.Done()
+			for cancelCtx.Err() == nil {
+				//nolint:errcheck
+				cf.AddIMUReading(cancelCtx, time.Minute, "my-imu", s.TimedIMUReadingResponse{})
+			}
+		}()
+	}
+	loadWorkers.Add(1)
+	go func() {
+		defer loadWorkers.Done()
+		for cancelCtx.Err() == nil {
+			//nolint:errcheck
+			cf.PointCloudMap(cancelCtx, time.Minute)
+		}
+	}()
+
+	latencies := make([]time.Duration, 0, b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		requestStart := time.Now()
+		if _, err := cf.Position(cancelCtx, time.Minute); err != nil {
+			b.Fatal(err)
+		}
+		latencies = append(latencies, time.Since(requestStart))
+	}
+	b.StopTimer()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	b.ReportMetric(float64(latencies[len(latencies)/2].Microseconds()), "p50-µs")
+	b.ReportMetric(float64(latencies[len(latencies)*99/100].Microseconds()), "p99-µs")
+
+	cancelFunc()
+	loadWorkers.Wait()
+	activeBackgroundWorkers.Wait()
+}
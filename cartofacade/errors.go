@@ -0,0 +1,118 @@
+package cartofacade
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorClass classifies the status codes returned by the cartofacade C API by how callers can react to them.
+type ErrorClass string
+
+const (
+	// ErrorClassRetryable is the class of errors after which the same call can succeed when retried.
+	ErrorClassRetryable ErrorClass = "retryable"
+	// ErrorClassInvalidInput is the class of errors caused by an invalid config or sensor reading, which fail
+	// again when retried with the same input.
+	ErrorClassInvalidInput ErrorClass = "invalid_input"
+	// ErrorClassState is the class of errors caused by calling into cartographer while it is in the wrong
+	// state, e.g. before it is started or before it has localized.
+	ErrorClassState ErrorClass = "state"
+	// ErrorClassInternal is the class of errors inside cartographer or the C API itself.
+	ErrorClassInternal ErrorClass = "internal"
+	// ErrorClassCancelled is the class of errors of requests which stopped early because every caller waiting
+	// on them gave up. Nobody is waiting for such a request anymore, so it is neither retried nor a failure
+	// of cartographer.
+	ErrorClassCancelled ErrorClass = "cancelled"
+)
+
+// StatusError is an error status code returned by the cartofacade C API. Every status code has a sentinel
+// StatusError, which can be matched with errors.Is.
+type StatusError struct {
+	// Code is the VIAM_CARTO_* status code.
+	Code int
+	// Name is the name of the status code.
+	Name  string
+	Class ErrorClass
+}
+
+func (e *StatusError) Error() string {
+	return e.Name
+}
+
+// The sentinel errors of the status codes returned by the cartofacade C API.
+var (
+	// ErrUnableToAcquireLock is the error returned from AddLidarReading, AddIMUReading,
+	// and/or AddOdometerReading when lock can't be acquired.
+	ErrUnableToAcquireLock              = &StatusError{1, "VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK", ErrorClassRetryable}
+	ErrVCInvalid                        = &StatusError{2, "VIAM_CARTO_VC_INVALID", ErrorClassState}
+	ErrOutOfMemory                      = &StatusError{3, "VIAM_CARTO_OUT_OF_MEMORY", ErrorClassInternal}
+	ErrDestructorError                  = &StatusError{4, "VIAM_CARTO_DESTRUCTOR_ERROR", ErrorClassInternal}
+	ErrLibPlatformInvalid               = &StatusError{5, "VIAM_CARTO_LIB_PLATFORM_INVALID", ErrorClassInternal}
+	ErrLibInvalid                       = &StatusError{6, "VIAM_CARTO_LIB_INVALID", ErrorClassState}
+	ErrLibNotInitialized                = &StatusError{7, "VIAM_CARTO_LIB_NOT_INITIALIZED", ErrorClassState}
+	ErrUnknownError                     = &StatusError{8, "VIAM_CARTO_UNKNOWN_ERROR", ErrorClassInternal}
+	ErrSlamModeInvalid                  = &StatusError{9, "VIAM_CARTO_SLAM_MODE_INVALID", ErrorClassInvalidInput}
+	ErrLidarConfigInvalid               = &StatusError{10, "VIAM_CARTO_LIDAR_CONFIG_INVALID", ErrorClassInvalidInput}
+	ErrComponentReferenceInvalid        = &StatusError{11, "VIAM_CARTO_COMPONENT_REFERENCE_INVALID", ErrorClassInvalidInput}
+	ErrLuaConfigNotFound                = &StatusError{12, "VIAM_CARTO_LUA_CONFIG_NOT_FOUND", ErrorClassInternal}
+	ErrInternalStateFileSystemError     = &StatusError{13, "VIAM_CARTO_INTERNAL_STATE_FILE_SYSTEM_ERROR", ErrorClassInternal}
+	ErrMapCreationError                 = &StatusError{14, "VIAM_CARTO_MAP_CREATION_ERROR", ErrorClassInternal}
+	ErrUnknownSensorName                = &StatusError{15, "VIAM_CARTO_UNKNOWN_SENSOR_NAME", ErrorClassInvalidInput}
+	ErrLidarReadingEmpty                = &StatusError{16, "VIAM_CARTO_LIDAR_READING_EMPTY", ErrorClassInvalidInput}
+	ErrLidarReadingInvalid              = &StatusError{17, "VIAM_CARTO_LIDAR_READING_INVALID", ErrorClassInvalidInput}
+	ErrGetPositionResponseInvalid       = &StatusError{18, "VIAM_CARTO_GET_POSITION_RESPONSE_INVALID", ErrorClassInternal}
+	ErrGetPositionNotInitialized        = &StatusError{19, "VIAM_CARTO_GET_POSITION_NOT_INITIALIZED", ErrorClassState}
+	ErrPointCloudMapEmpty               = &StatusError{20, "VIAM_CARTO_POINTCLOUD_MAP_EMPTY", ErrorClassState}
+	ErrGetPointCloudMapResponseInvalid  = &StatusError{21, "VIAM_CARTO_GET_POINT_CLOUD_MAP_RESPONSE_INVALID", ErrorClassInternal}
+	ErrLibAlreadyInitialized            = &StatusError{22, "VIAM_CARTO_LIB_ALREADY_INITIALIZED", ErrorClassState}
+	ErrGetInternalStateResponseInvalid  = &StatusError{23, "VIAM_CARTO_GET_INTERNAL_STATE_RESPONSE_INVALID", ErrorClassInternal}
+	ErrGetInternalStateFileWriteIOError = &StatusError{24, "VIAM_CARTO_GET_INTERNAL_STATE_FILE_WRITE_IO_ERROR", ErrorClassInternal}
+	ErrGetInternalStateFileReadIOError  = &StatusError{25, "VIAM_CARTO_GET_INTERNAL_STATE_FILE_READ_IO_ERROR", ErrorClassInternal}
+	ErrNotInInitializedState            = &StatusError{26, "VIAM_CARTO_NOT_IN_INITIALIZED_STATE", ErrorClassState}
+	ErrNotInIOInitializedState          = &StatusError{27, "VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE", ErrorClassState}
+	ErrNotInStartedState                = &StatusError{28, "VIAM_CARTO_NOT_IN_STARTED_STATE", ErrorClassState}
+	ErrNotInTerminatableState           = &StatusError{29, "VIAM_CARTO_NOT_IN_TERMINATABLE_STATE", ErrorClassState}
+	ErrIMUProvidedAndIMUEnabledMismatch = &StatusError{30, "VIAM_CARTO_IMU_PROVIDED_AND_IMU_ENABLED_MISMATCH", ErrorClassInvalidInput}
+	ErrIMUReadingEmpty                  = &StatusError{31, "VIAM_CARTO_IMU_READING_EMPTY", ErrorClassInvalidInput}
+	ErrIMUReadingInvalid                = &StatusError{32, "VIAM_CARTO_IMU_READING_INVALID", ErrorClassInvalidInput}
+	ErrOdometerReadingInvalid           = &StatusError{33, "VIAM_CARTO_ODOMETER_READING_INVALID", ErrorClassInvalidInput}
+	ErrCancelled                        = &StatusError{34, "VIAM_CARTO_CANCELLED", ErrorClassCancelled}
+	ErrGetSubmapsRequestInvalid         = &StatusError{35, "VIAM_CARTO_GET_SUBMAPS_REQUEST_INVALID", ErrorClassInternal}
+	ErrGetSubmapsResponseInvalid        = &StatusError{36, "VIAM_CARTO_GET_SUBMAPS_RESPONSE_INVALID", ErrorClassInternal}
+	ErrExportPathInvalid                = &StatusError{37, "VIAM_CARTO_EXPORT_PATH_INVALID", ErrorClassInvalidInput}
+	ErrExportFileWriteIOError           = &StatusError{38, "VIAM_CARTO_EXPORT_FILE_WRITE_IO_ERROR", ErrorClassInternal}
+)
+
+// newUnclassifiedStatusError returns the error of a status code without a sentinel error.
+func newUnclassifiedStatusError(code int) error {
+	return &StatusError{Code: code, Name: fmt.Sprintf("status code %d unclassified", code), Class: ErrorClassInternal}
+}
+
+// ErrorClassOf returns the class of the status code an error wraps, or an empty class if it does not wrap one.
+func ErrorClassOf(err error) ErrorClass {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return ""
+	}
+	return statusErr.Class
+}
+
+// IsRetryable returns whether err wraps a status code after which the same call can succeed when retried.
+func IsRetryable(err error) bool {
+	return ErrorClassOf(err) == ErrorClassRetryable
+}
+
+// IsInvalidInput returns whether err wraps a status code caused by an invalid config or sensor reading.
+func IsInvalidInput(err error) bool {
+	return ErrorClassOf(err) == ErrorClassInvalidInput
+}
+
+// IsStateError returns whether err wraps a status code caused by calling into cartographer in the wrong state.
+func IsStateError(err error) bool {
+	return ErrorClassOf(err) == ErrorClassState
+}
+
+// IsCancelled returns whether err wraps the status code of a request which stopped early after being cancelled.
+func IsCancelled(err error) bool {
+	return ErrorClassOf(err) == ErrorClassCancelled
+}
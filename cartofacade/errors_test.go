@@ -0,0 +1,44 @@
+package cartofacade
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestErrorClassification(t *testing.T) {
+	t.Run("classifies the status errors wrapped in an error", func(t *testing.T) {
+		err := fmt.Errorf("viam_carto_add_lidar_reading failed: %w", ErrUnableToAcquireLock)
+		test.That(t, errors.Is(err, ErrUnableToAcquireLock), test.ShouldBeTrue)
+		test.That(t, IsRetryable(err), test.ShouldBeTrue)
+		test.That(t, IsInvalidInput(err), test.ShouldBeFalse)
+
+		err = fmt.Errorf("viam_carto_add_imu_reading failed: %w", ErrIMUReadingInvalid)
+		test.That(t, IsInvalidInput(err), test.ShouldBeTrue)
+		test.That(t, IsRetryable(err), test.ShouldBeFalse)
+
+		test.That(t, IsStateError(ErrNotInStartedState), test.ShouldBeTrue)
+		test.That(t, ErrorClassOf(ErrOutOfMemory), test.ShouldEqual, ErrorClassInternal)
+	})
+
+	t.Run("does not retry cancelled requests", func(t *testing.T) {
+		err := fmt.Errorf("viam_carto_get_point_cloud_map failed: %w", ErrCancelled)
+		test.That(t, ErrorClassOf(err), test.ShouldEqual, ErrorClassCancelled)
+		test.That(t, IsCancelled(err), test.ShouldBeTrue)
+		test.That(t, IsRetryable(err), test.ShouldBeFalse)
+		test.That(t, IsCancelled(ErrUnableToAcquireLock), test.ShouldBeFalse)
+	})
+
+	t.Run("does not classify errors which do not wrap a status error", func(t *testing.T) {
+		test.That(t, ErrorClassOf(errors.New("VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK")), test.ShouldBeEmpty)
+		test.That(t, IsRetryable(nil), test.ShouldBeFalse)
+	})
+
+	t.Run("treats unknown status codes as internal errors", func(t *testing.T) {
+		err := newUnclassifiedStatusError(100)
+		test.That(t, err.Error(), test.ShouldEqual, "status code 100 unclassified")
+		test.That(t, ErrorClassOf(err), test.ShouldEqual, ErrorClassInternal)
+	})
+}
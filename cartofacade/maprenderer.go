@@ -0,0 +1,231 @@
+package cartofacade
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.viam.com/rdk/logging"
+)
+
+// ErrMapRendererStopped is the error returned when a fresh map is requested after the map renderer stopped.
+var ErrMapRendererStopped = errors.New("map renderer stopped")
+
+// MapRendererConfig configures when a MapRenderer renders the map.
+type MapRendererConfig struct {
+	// Interval is how often the map is rendered while nodes are added to it. Zero only renders after
+	// NodeThreshold nodes were added or when a fresh map is requested.
+	Interval time.Duration
+	// NodeThreshold is the number of nodes added since the last render after which the map is rendered.
+	// Zero only renders on the interval or when a fresh map is requested.
+	NodeThreshold int
+	// InternalTimeout is the timeout of rendering the map.
+	InternalTimeout time.Duration
+}
+
+// Enabled returns whether the map should be rendered in the background.
+func (config MapRendererConfig) Enabled() bool {
+	return config.Interval > 0 || config.NodeThreshold > 0
+}
+
+// RenderedMap is a rendered pointcloud map.
+type RenderedMap struct {
+	PointCloud []byte
+	// Generation counts the renders, starting at 1 for the first rendered map.
+	Generation uint64
+	RenderedAt time.Time
+}
+
+// MapRendererStatus is the state of the map cached by a MapRenderer and its renders.
+type MapRendererStatus struct {
+	Generation       uint64
+	RenderedAt       time.Time
+	NodesSinceRender int
+	Renders          int
+	Failures         int
+	// Err is the error the latest render failed with, if it failed.
+	Err error
+}
+
+// renderWait is the result of the next render, which requests for a fresh map wait on.
+type renderWait struct {
+	done     chan struct{}
+	rendered RenderedMap
+	err      error
+}
+
+/*
+MapRenderer renders the pointcloud map in the background and caches it, so that clients polling the map do not
+each render it on the single goroutine calling into C, stalling adding sensor readings. The map is rendered
+on an interval while nodes are added to it, after enough new nodes, or when a client requests a fresh map.
+*/
+type MapRenderer struct {
+	cf     Interface
+	config MapRendererConfig
+	logger logging.Logger
+	// trigger is signalled when a render is due before the next interval
+	trigger chan struct{}
+
+	mu               sync.Mutex
+	stopped          bool
+	latest           RenderedMap
+	nodesSinceRender int
+	nextRender       *renderWait
+	status           MapRendererStatus
+}
+
+// NewMapRenderer returns a MapRenderer which renders the map of the cartofacade.
+func NewMapRenderer(cf Interface, config MapRendererConfig, logger logging.Logger) *MapRenderer {
+	return &MapRenderer{
+		cf:      cf,
+		config:  config,
+		logger:  logger,
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+// Start renders the map in the background until ctx is done.
+func (r *MapRenderer) Start(ctx context.Context, activeBackgroundWorkers *sync.WaitGroup) {
+	activeBackgroundWorkers.Add(1)
+	go func() {
+		defer activeBackgroundWorkers.Done()
+		r.run(ctx)
+	}()
+}
+
+func (r *MapRenderer) run(ctx context.Context) {
+	var tick <-chan time.Time
+	if r.config.Interval > 0 {
+		ticker := time.NewTicker(r.config.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.stop(ctx.Err())
+			return
+		case <-tick:
+			// the map only changes when nodes are added
+			if !r.stale() {
+				continue
+			}
+		case <-r.trigger:
+		}
+		r.render(ctx)
+	}
+}
+
+// stale returns whether the cached map is missing nodes or was never rendered.
+func (r *MapRenderer) stale() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.nodesSinceRender > 0 || r.latest.Generation == 0
+}
+
+func (r *MapRenderer) render(ctx context.Context) {
+	// requests waiting before the render started are served by it, later requests wait on the next one
+	r.mu.Lock()
+	wait := r.nextRender
+	r.nextRender = nil
+	nodes := r.nodesSinceRender
+	r.nodesSinceRender = 0
+	r.mu.Unlock()
+
+	pointCloud, err := r.cf.PointCloudMap(ctx, r.config.InternalTimeout)
+
+	r.mu.Lock()
+	if err != nil {
+		// the nodes are still missing from the cached map
+		r.nodesSinceRender += nodes
+		r.status.Failures++
+		r.logger.Debugw("rendering the map failed", "error", err)
+	} else {
+		r.latest = RenderedMap{PointCloud: pointCloud, Generation: r.latest.Generation + 1, RenderedAt: time.Now()}
+		r.status.Renders++
+	}
+	r.status.Err = err
+	rendered := r.latest
+	r.mu.Unlock()
+
+	if wait != nil {
+		wait.rendered, wait.err = rendered, err
+		close(wait.done)
+	}
+}
+
+// stop fails the requests waiting on a render.
+func (r *MapRenderer) stop(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped = true
+	if r.nextRender != nil {
+		r.nextRender.err = multierr.Combine(ErrMapRendererStopped, err)
+		close(r.nextRender.done)
+		r.nextRender = nil
+	}
+}
+
+func (r *MapRenderer) signal() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// NodeAdded records that a lidar reading was added to cartographer, which adds a node to the map.
+func (r *MapRenderer) NodeAdded() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.nodesSinceRender++
+	due := r.config.NodeThreshold > 0 && r.nodesSinceRender >= r.config.NodeThreshold
+	r.mu.Unlock()
+	if due {
+		r.signal()
+	}
+}
+
+// Latest returns the latest rendered map, and false if no map was rendered yet.
+func (r *MapRenderer) Latest() (RenderedMap, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.latest, r.latest.Generation > 0
+}
+
+// Render requests a fresh render and waits for it. The returned map was rendered after the request.
+func (r *MapRenderer) Render(ctx context.Context) (RenderedMap, error) {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return RenderedMap{}, ErrMapRendererStopped
+	}
+	if r.nextRender == nil {
+		r.nextRender = &renderWait{done: make(chan struct{})}
+	}
+	wait := r.nextRender
+	r.mu.Unlock()
+	r.signal()
+
+	select {
+	case <-ctx.Done():
+		return RenderedMap{}, ctx.Err()
+	case <-wait.done:
+		return wait.rendered, wait.err
+	}
+}
+
+// Status returns the state of the cached map and its renders.
+func (r *MapRenderer) Status() MapRendererStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := r.status
+	status.Generation = r.latest.Generation
+	status.RenderedAt = r.latest.RenderedAt
+	status.NodesSinceRender = r.nodesSinceRender
+	return status
+}
@@ -0,0 +1,165 @@
+package cartofacade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+)
+
+// newTestMapRenderer returns a started MapRenderer whose renders return "map <n>", or fail while failing is set.
+func newTestMapRenderer(
+	t *testing.T,
+	config MapRendererConfig,
+	failing *atomic.Bool,
+) (*MapRenderer, context.CancelFunc, *sync.WaitGroup) {
+	var renders atomic.Int32
+	mock := &Mock{}
+	mock.PointCloudMapFunc = func(context.Context, time.Duration) ([]byte, error) {
+		if failing.Load() {
+			return nil, ErrPointCloudMapEmpty
+		}
+		return []byte(fmt.Sprintf("map %d", renders.Add(1))), nil
+	}
+	r := NewMapRenderer(mock, config, logging.NewTestLogger(t))
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	workers := &sync.WaitGroup{}
+	r.Start(ctx, workers)
+	return r, cancelFunc, workers
+}
+
+func waitForRender(r *MapRenderer, renders, failures int) MapRendererStatus {
+	for {
+		status := r.Status()
+		if status.Renders >= renders && status.Failures >= failures {
+			return status
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMapRenderer(t *testing.T) {
+	t.Run("renders the map after enough nodes were added", func(t *testing.T) {
+		r, cancelFunc, workers := newTestMapRenderer(t, MapRendererConfig{NodeThreshold: 2}, &atomic.Bool{})
+		_, ok := r.Latest()
+		test.That(t, ok, test.ShouldBeFalse)
+
+		r.NodeAdded()
+		test.That(t, r.Status().NodesSinceRender, test.ShouldEqual, 1)
+		r.NodeAdded()
+		status := waitForRender(r, 1, 0)
+		test.That(t, status.Generation, test.ShouldEqual, 1)
+		test.That(t, status.NodesSinceRender, test.ShouldEqual, 0)
+
+		rendered, ok := r.Latest()
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, string(rendered.PointCloud), test.ShouldEqual, "map 1")
+		test.That(t, rendered.RenderedAt, test.ShouldResemble, status.RenderedAt)
+
+		cancelFunc()
+		workers.Wait()
+	})
+
+	t.Run("only renders on the interval when nodes were added", func(t *testing.T) {
+		r, cancelFunc, workers := newTestMapRenderer(t, MapRendererConfig{Interval: 5 * time.Millisecond}, &atomic.Bool{})
+		// the first map is rendered on the first tick
+		waitForRender(r, 1, 0)
+		time.Sleep(50 * time.Millisecond)
+		test.That(t, r.Status().Generation, test.ShouldEqual, 1)
+
+		r.NodeAdded()
+		test.That(t, waitForRender(r, 2, 0).Generation, test.ShouldEqual, 2)
+
+		cancelFunc()
+		workers.Wait()
+	})
+
+	t.Run("keeps the previous map and the missing nodes when rendering fails", func(t *testing.T) {
+		failing := &atomic.Bool{}
+		r, cancelFunc, workers := newTestMapRenderer(t, MapRendererConfig{NodeThreshold: 1}, failing)
+		r.NodeAdded()
+		waitForRender(r, 1, 0)
+
+		failing.Store(true)
+		r.NodeAdded()
+		status := waitForRender(r, 1, 1)
+		test.That(t, status.Generation, test.ShouldEqual, 1)
+		test.That(t, status.NodesSinceRender, test.ShouldEqual, 1)
+		test.That(t, errors.Is(status.Err, ErrPointCloudMapEmpty), test.ShouldBeTrue)
+		rendered, ok := r.Latest()
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, string(rendered.PointCloud), test.ShouldEqual, "map 1")
+
+		_, err := r.Render(context.Background())
+		test.That(t, errors.Is(err, ErrPointCloudMapEmpty), test.ShouldBeTrue)
+
+		failing.Store(false)
+		rendered, err = r.Render(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, rendered.Generation, test.ShouldEqual, 2)
+		test.That(t, r.Status().Err, test.ShouldBeNil)
+
+		cancelFunc()
+		workers.Wait()
+	})
+
+	t.Run("returns a map rendered after a fresh map was requested", func(t *testing.T) {
+		r, cancelFunc, workers := newTestMapRenderer(t, MapRendererConfig{NodeThreshold: 100}, &atomic.Bool{})
+		// hold the first render until a second request waits on the next render
+		started, unblock := make(chan struct{}, 2), make(chan struct{})
+		pointCloudMapFunc := r.cf.(*Mock).PointCloudMapFunc
+		r.cf.(*Mock).PointCloudMapFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+			started <- struct{}{}
+			<-unblock
+			return pointCloudMapFunc(ctx, timeout)
+		}
+
+		var first RenderedMap
+		firstDone := make(chan struct{})
+		go func() {
+			defer close(firstDone)
+			var err error
+			if first, err = r.Render(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+		<-started
+		go func() {
+			for {
+				r.mu.Lock()
+				waiting := r.nextRender != nil
+				r.mu.Unlock()
+				if waiting {
+					close(unblock)
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}()
+
+		second, err := r.Render(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		<-firstDone
+		test.That(t, first.Generation, test.ShouldEqual, 1)
+		test.That(t, second.Generation, test.ShouldEqual, 2)
+		test.That(t, string(second.PointCloud), test.ShouldEqual, "map 2")
+
+		cancelFunc()
+		workers.Wait()
+	})
+
+	t.Run("returns an error when a fresh map is requested after stopping", func(t *testing.T) {
+		r, cancelFunc, workers := newTestMapRenderer(t, MapRendererConfig{NodeThreshold: 1}, &atomic.Bool{})
+		cancelFunc()
+		workers.Wait()
+
+		_, err := r.Render(context.Background())
+		test.That(t, err, test.ShouldBeError, ErrMapRendererStopped)
+	})
+}
@@ -0,0 +1,649 @@
+package cartofacade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.viam.com/rdk/logging"
+
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+)
+
+// DefaultMaxConsecutiveFailures is the number of consecutive hung or internally failed calls into C after which
+// the watchdog restarts cartographer.
+const DefaultMaxConsecutiveFailures = 3
+
+// NeverRestart is the MaxConsecutiveFailures which never restarts cartographer.
+const NeverRestart = -1
+
+const (
+	restartStateFilePattern = "viam_cartographer_restart_*.pbstream"
+	savedStateFilePattern   = "viam_cartographer_saved_*.pbstream"
+)
+
+var (
+	// ErrRestarting is the error returned while the watchdog restarts cartographer.
+	ErrRestarting = errors.New("cartographer is restarting after failing")
+	// ErrRestartFailed is the error returned after the watchdog failed to restart cartographer.
+	ErrRestartFailed = errors.New("cartographer failed and could not be restarted")
+	// ErrHungCallRunning is the error restarting fails with while a hung call into C is still running.
+	ErrHungCallRunning = errors.New("a hung call into cartographer is still running")
+)
+
+// WatchdogState is the state of the cartographer instance supervised by a Watchdog.
+type WatchdogState string
+
+const (
+	// WatchdogStateRunning means cartographer is running.
+	WatchdogStateRunning WatchdogState = "running"
+	// WatchdogStateRestarting means cartographer failed and is being restarted.
+	WatchdogStateRestarting WatchdogState = "restarting"
+	// WatchdogStateFailed means cartographer failed and could not be restarted.
+	WatchdogStateFailed WatchdogState = "failed"
+)
+
+// RestartSource is the map a restarted cartographer instance was initialized with.
+type RestartSource string
+
+const (
+	// RestartSourceInProcess is the internal state of the failed instance, which still responded.
+	RestartSourceInProcess RestartSource = "in_process"
+	// RestartSourceSavedState is the latest internal state saved before the instance hung.
+	RestartSourceSavedState RestartSource = "saved_internal_state"
+	// RestartSourceExistingMap is the existing map of the config.
+	RestartSourceExistingMap RestartSource = "existing_map"
+	// RestartSourceNone means the restarted instance started without a map.
+	RestartSourceNone RestartSource = "none"
+)
+
+// WatchdogConfig configures when and how a Watchdog restarts cartographer.
+type WatchdogConfig struct {
+	// MaxConsecutiveFailures is the number of consecutive hung or internally failed calls after which cartographer
+	// is restarted. Zero uses DefaultMaxConsecutiveFailures and NeverRestart never restarts.
+	MaxConsecutiveFailures int
+	// SnapshotInterval is how often the internal state is saved to restart a hung instance from.
+	// Zero only saves the internal state when it is requested.
+	SnapshotInterval time.Duration
+	// InternalTimeout is the timeout of getting the internal state.
+	InternalTimeout time.Duration
+	// HungCallTimeout is how long a hung call into C is waited for to return before restarting cartographer.
+	// Defaults to InternalTimeout.
+	HungCallTimeout time.Duration
+	// StateDir is the directory the internal state is saved and written to when restarting. Defaults to os.TempDir().
+	StateDir string
+}
+
+// WatchdogStatus is the state of the cartographer instance supervised by a Watchdog and its restarts.
+type WatchdogStatus struct {
+	State               WatchdogState
+	ConsecutiveFailures int
+	Restarts            int
+	LastRestart         time.Time
+	LastRestartReason   string
+	LastRestartSource   RestartSource
+	// SlamMode is the mode of the current instance. An instance restarted from an internal state updates it,
+	// even if the first instance was mapping.
+	SlamMode SlamMode
+	// SavedStateTime is when the internal state a hung instance would be restarted from was saved.
+	SavedStateTime time.Time
+	// Err is the error restarting failed with.
+	Err error
+}
+
+/*
+Watchdog supervises the CartoFacade. A call into C which hangs blocks every later call, as calls into C are made
+one at a time, so after too many consecutive hung or internally failed calls the watchdog replaces the instance.
+An instance which still responds is restarted from its own internal state. A hung call cannot be interrupted,
+so a hung instance is restarted from the latest saved internal state once the call returned. Two instances
+cannot call into C at the same time, so the watchdog fails instead while the call is still running.
+*/
+type Watchdog struct {
+	cartoCfg   CartoConfig
+	config     WatchdogConfig
+	logger     logging.Logger
+	newBackend func(cartoCfg CartoConfig) Interface
+
+	restartWorkers sync.WaitGroup
+
+	mu             sync.Mutex
+	ctx            context.Context
+	timeout        time.Duration
+	started        bool
+	backend        Interface
+	cancelBackend  func()
+	backendWorkers *sync.WaitGroup
+	generation     int
+	savedStatePath string
+	status         WatchdogStatus
+}
+
+// NewWatchdog returns a Watchdog which supervises CartoFacades created with the given configs.
+func NewWatchdog(
+	cartoLib CartoLibInterface,
+	cartoCfg CartoConfig,
+	cartoAlgoCfg CartoAlgoConfig,
+	config WatchdogConfig,
+	logger logging.Logger,
+) *Watchdog {
+	if config.MaxConsecutiveFailures == 0 {
+		config.MaxConsecutiveFailures = DefaultMaxConsecutiveFailures
+	}
+	if config.StateDir == "" {
+		config.StateDir = os.TempDir()
+	}
+	return &Watchdog{
+		cartoCfg: cartoCfg,
+		config:   config,
+		logger:   logger,
+		newBackend: func(cartoCfg CartoConfig) Interface {
+			cf := New(cartoLib, cartoCfg, cartoAlgoCfg)
+			return &cf
+		},
+		status: WatchdogStatus{State: WatchdogStateRunning},
+	}
+}
+
+// Status returns the state of the supervised cartographer instance and its restarts.
+func (w *Watchdog) Status() WatchdogStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+// Initialize initializes the first cartographer instance and starts supervising it until ctx is done.
+func (w *Watchdog) Initialize(ctx context.Context, timeout time.Duration, activeBackgroundWorkers *sync.WaitGroup) (SlamMode, error) {
+	w.mu.Lock()
+	w.ctx = ctx
+	w.timeout = timeout
+	if w.config.InternalTimeout == 0 {
+		w.config.InternalTimeout = timeout
+	}
+	if w.config.HungCallTimeout == 0 {
+		w.config.HungCallTimeout = w.config.InternalTimeout
+	}
+	w.mu.Unlock()
+
+	slamMode, err := w.startBackend(w.cartoCfg)
+	if err != nil {
+		return UnknownMode, err
+	}
+
+	activeBackgroundWorkers.Add(1)
+	go func() {
+		defer activeBackgroundWorkers.Done()
+		w.run(ctx)
+	}()
+	return slamMode, nil
+}
+
+// Start calls into the cartofacade C code.
+func (w *Watchdog) Start(ctx context.Context, timeout time.Duration) error {
+	if err := w.call(func(backend Interface) error { return backend.Start(ctx, timeout) }); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.started = true
+	w.mu.Unlock()
+	return nil
+}
+
+// Stop calls into the cartofacade C code.
+func (w *Watchdog) Stop(ctx context.Context, timeout time.Duration) error {
+	if err := w.call(func(backend Interface) error { return backend.Stop(ctx, timeout) }); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.started = false
+	w.mu.Unlock()
+	return nil
+}
+
+// Terminate calls into the cartofacade C code.
+func (w *Watchdog) Terminate(ctx context.Context, timeout time.Duration) error {
+	return w.call(func(backend Interface) error { return backend.Terminate(ctx, timeout) })
+}
+
+// AddLidarReading calls into the cartofacade C code.
+func (w *Watchdog) AddLidarReading(
+	ctx context.Context,
+	timeout time.Duration,
+	lidarName string,
+	currentReading s.TimedLidarReadingResponse,
+) error {
+	return w.call(func(backend Interface) error {
+		return backend.AddLidarReading(ctx, timeout, lidarName, currentReading)
+	})
+}
+
+// AddIMUReading calls into the cartofacade C code.
+func (w *Watchdog) AddIMUReading(
+	ctx context.Context,
+	timeout time.Duration,
+	movementSensorName string,
+	currentReading s.TimedIMUReadingResponse,
+) error {
+	return w.call(func(backend Interface) error {
+		return backend.AddIMUReading(ctx, timeout, movementSensorName, currentReading)
+	})
+}
+
+// AddOdometerReading calls into the cartofacade C code.
+func (w *Watchdog) AddOdometerReading(
+	ctx context.Context,
+	timeout time.Duration,
+	movementSensorName string,
+	currentReading s.TimedOdometerReadingResponse,
+) error {
+	return w.call(func(backend Interface) error {
+		return backend.AddOdometerReading(ctx, timeout, movementSensorName, currentReading)
+	})
+}
+
+// Position calls into the cartofacade C code.
+func (w *Watchdog) Position(ctx context.Context, timeout time.Duration) (Position, error) {
+	var pos Position
+	err := w.call(func(backend Interface) error {
+		var err error
+		pos, err = backend.Position(ctx, timeout)
+		return err
+	})
+	return pos, err
+}
+
+// InternalState calls into the cartofacade C code. The internal state is saved to restart a hung
+// instance from.
+func (w *Watchdog) InternalState(ctx context.Context, timeout time.Duration) ([]byte, error) {
+	var internalState []byte
+	err := w.call(func(backend Interface) error {
+		var err error
+		if internalState, err = backend.InternalState(ctx, timeout); err != nil {
+			return err
+		}
+		w.saveState(backend, func(path string) error { return os.WriteFile(path, internalState, 0o600) })
+		return nil
+	})
+	return internalState, err
+}
+
+// PointCloudMap calls into the cartofacade C code.
+func (w *Watchdog) PointCloudMap(ctx context.Context, timeout time.Duration) ([]byte, error) {
+	var pointCloud []byte
+	err := w.call(func(backend Interface) error {
+		var err error
+		pointCloud, err = backend.PointCloudMap(ctx, timeout)
+		return err
+	})
+	return pointCloud, err
+}
+
+// WritePointCloudMap calls into the cartofacade C code.
+func (w *Watchdog) WritePointCloudMap(ctx context.Context, timeout time.Duration, path string) error {
+	return w.call(func(backend Interface) error { return backend.WritePointCloudMap(ctx, timeout, path) })
+}
+
+// WriteInternalState calls into the cartofacade C code. A copy of the internal state is saved to restart a
+// hung instance from, as the caller owns the file at path.
+func (w *Watchdog) WriteInternalState(ctx context.Context, timeout time.Duration, path string) error {
+	return w.call(func(backend Interface) error {
+		if err := backend.WriteInternalState(ctx, timeout, path); err != nil {
+			return err
+		}
+		w.saveState(backend, func(savedPath string) error { return copyFile(path, savedPath) })
+		return nil
+	})
+}
+
+// Submaps calls into the cartofacade C code.
+func (w *Watchdog) Submaps(ctx context.Context, timeout time.Duration, known []Submap) ([]Submap, error) {
+	var submaps []Submap
+	err := w.call(func(backend Interface) error {
+		var err error
+		submaps, err = backend.Submaps(ctx, timeout, known)
+		return err
+	})
+	return submaps, err
+}
+
+// RunFinalOptimization calls into the cartofacade C code.
+func (w *Watchdog) RunFinalOptimization(ctx context.Context, timeout time.Duration) error {
+	return w.call(func(backend Interface) error { return backend.RunFinalOptimization(ctx, timeout) })
+}
+
+// QueueStats returns the queue stats of the current cartographer instance.
+func (w *Watchdog) QueueStats() QueueStats {
+	w.mu.Lock()
+	backend := w.backend
+	w.mu.Unlock()
+	if backend == nil {
+		return QueueStats{}
+	}
+	return backend.QueueStats()
+}
+
+func (w *Watchdog) request(
+	ctxParent context.Context,
+	requestType RequestType,
+	inputs map[RequestParamType]interface{}, timeout time.Duration,
+) (interface{}, error) {
+	var result interface{}
+	err := w.call(func(backend Interface) error {
+		var err error
+		result, err = backend.request(ctxParent, requestType, inputs, timeout)
+		return err
+	})
+	return result, err
+}
+
+func (w *Watchdog) startCGoroutine(ctx context.Context, activeBackgroundWorkers *sync.WaitGroup) {
+	w.mu.Lock()
+	backend := w.backend
+	w.mu.Unlock()
+	backend.startCGoroutine(ctx, activeBackgroundWorkers)
+}
+
+// call calls fn with the current cartographer instance, unless it is being restarted or failed to restart,
+// and restarts the instance after too many consecutive failures.
+func (w *Watchdog) call(fn func(backend Interface) error) error {
+	w.mu.Lock()
+	switch w.status.State {
+	case WatchdogStateRestarting:
+		w.mu.Unlock()
+		return ErrRestarting
+	case WatchdogStateFailed:
+		err := w.status.Err
+		w.mu.Unlock()
+		return fmt.Errorf("%w: %v", ErrRestartFailed, err)
+	case WatchdogStateRunning:
+	}
+	backend := w.backend
+	generation := w.generation
+	w.mu.Unlock()
+
+	err := fn(backend)
+	w.observe(generation, err)
+	return err
+}
+
+// observe counts the consecutive failures of an instance and starts restarting it after too many.
+func (w *Watchdog) observe(generation int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if generation != w.generation || w.status.State != WatchdogStateRunning {
+		return
+	}
+	if err == nil {
+		w.status.ConsecutiveFailures = 0
+		return
+	}
+	if !isHang(err) && ErrorClassOf(err) != ErrorClassInternal {
+		return
+	}
+	w.status.ConsecutiveFailures++
+	if w.config.MaxConsecutiveFailures == NeverRestart || w.status.ConsecutiveFailures < w.config.MaxConsecutiveFailures {
+		return
+	}
+
+	w.status.State = WatchdogStateRestarting
+	w.restartWorkers.Add(1)
+	go func(backend Interface, cancelBackend func()) {
+		defer w.restartWorkers.Done()
+		w.restart(backend, cancelBackend, err)
+	}(w.backend, w.cancelBackend)
+}
+
+// snapshot saves the internal state of the current instance to restart it from if it hangs.
+func (w *Watchdog) snapshot(ctx context.Context) error {
+	return w.call(func(backend Interface) error {
+		path, err := w.writeStateFile(savedStateFilePattern, func(path string) error {
+			return backend.WriteInternalState(ctx, w.config.InternalTimeout, path)
+		})
+		if err != nil {
+			return err
+		}
+		w.keepSavedState(backend, path)
+		return nil
+	})
+}
+
+// saveState writes the internal state of backend to a new file under StateDir with write, and keeps it to
+// restart a hung instance from. Failing to save the state is logged, as the call into C itself succeeded.
+func (w *Watchdog) saveState(backend Interface, write func(path string) error) {
+	path, err := w.writeStateFile(savedStateFilePattern, write)
+	if err != nil {
+		w.logger.Warnw("failed to save the internal state of cartographer", "error", err)
+		return
+	}
+	w.keepSavedState(backend, path)
+}
+
+// keepSavedState replaces the saved internal state with the file at path, unless backend was replaced or is
+// being restarted while its state was written, in which case the file is removed.
+func (w *Watchdog) keepSavedState(backend Interface, path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if backend != w.backend || w.status.State != WatchdogStateRunning {
+		w.removeStateFile(path)
+		return
+	}
+	if w.savedStatePath != "" {
+		w.removeStateFile(w.savedStatePath)
+	}
+	w.savedStatePath = path
+	w.status.SavedStateTime = time.Now()
+}
+
+// isHang returns whether err is a call into C which timed out while the running call into C had been running
+// for longer than its own timeout. Calls which timed out waiting behind a call still within its timeout, or
+// whose caller gave up, are not hangs.
+func isHang(err error) bool {
+	return errors.Is(err, ErrHung)
+}
+
+// restart replaces a failed cartographer instance with a new one, initialized from the best map available.
+func (w *Watchdog) restart(backend Interface, cancelBackend func(), reason error) {
+	w.mu.Lock()
+	ctx, timeout, internalTimeout, hungCallTimeout := w.ctx, w.timeout, w.config.InternalTimeout, w.config.HungCallTimeout
+	w.mu.Unlock()
+
+	hung := isHang(reason)
+	w.logger.Errorw("restarting cartographer after consecutive failures", "hung", hung, "error", reason)
+
+	cartoCfg := w.cartoCfg
+	source := RestartSourceNone
+	stopTimeout := timeout
+	if hung {
+		// the hung call cannot be interrupted, so stopping the instance waits for it to return
+		stopTimeout = hungCallTimeout
+	} else {
+		path, err := w.writeStateFile(restartStateFilePattern, func(path string) error {
+			return backend.WriteInternalState(ctx, internalTimeout, path)
+		})
+		if err != nil {
+			w.logger.Warnw("failed to get the internal state of the failed cartographer instance", "error", err)
+		} else {
+			defer w.removeStateFile(path)
+			cartoCfg.ExistingMap = path
+			source = RestartSourceInProcess
+		}
+	}
+	// a new instance must not call into C while a call of the failed instance is still running
+	err := backend.Stop(ctx, stopTimeout)
+	if !isTimeout(err) {
+		if err != nil {
+			w.logger.Warnw("failed to stop the failed cartographer instance", "error", err)
+		}
+		if err = backend.Terminate(ctx, timeout); err != nil && !isTimeout(err) {
+			w.logger.Warnw("failed to terminate the failed cartographer instance", "error", err)
+		}
+	}
+	cancelBackend()
+	if isTimeout(err) {
+		w.failWhileCallRunning(err)
+		return
+	}
+
+	// the saved state is kept, as the restarted instance may hang before its state was saved again
+	w.mu.Lock()
+	if source == RestartSourceNone && w.savedStatePath != "" {
+		cartoCfg.ExistingMap = w.savedStatePath
+		source = RestartSourceSavedState
+	}
+	w.mu.Unlock()
+
+	if source == RestartSourceNone && cartoCfg.ExistingMap != "" {
+		source = RestartSourceExistingMap
+	}
+
+	err = ctx.Err()
+	if err == nil {
+		_, err = w.startBackend(cartoCfg)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err != nil {
+		w.logger.Errorw("failed to restart cartographer", "error", err)
+		w.status.State = WatchdogStateFailed
+		w.status.Err = err
+		return
+	}
+	w.logger.Warnw("restarted cartographer", "source", source)
+	w.status.State = WatchdogStateRunning
+	w.status.ConsecutiveFailures = 0
+	w.status.Restarts++
+	w.status.LastRestart = time.Now()
+	w.status.LastRestartReason = reason.Error()
+	w.status.LastRestartSource = source
+}
+
+// failWhileCallRunning fails the watchdog instead of restarting cartographer, as a call into C of the failed
+// instance did not return in time and a new instance must not call into C while it still runs.
+func (w *Watchdog) failWhileCallRunning(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.logger.Errorw("not restarting cartographer, as a hung call into C is still running", "error", err)
+	w.status.State = WatchdogStateFailed
+	w.status.Err = fmt.Errorf("%w: %v", ErrHungCallRunning, err)
+	// the workers of the instance may never return, so they are not waited for
+	w.backendWorkers = nil
+}
+
+// isTimeout returns whether err is a call into C which timed out, so that the call into C running before
+// it may still be running.
+func isTimeout(err error) bool {
+	return errors.Is(err, ErrTimeoutWriting) || errors.Is(err, ErrTimeoutReading)
+}
+
+// writeStateFile creates a new file under StateDir and writes an internal state to it with write.
+func (w *Watchdog) writeStateFile(pattern string, write func(path string) error) (string, error) {
+	f, err := os.CreateTemp(w.config.StateDir, pattern)
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	if err := f.Close(); err != nil {
+		return "", multierr.Combine(err, os.Remove(path))
+	}
+	if err := write(path); err != nil {
+		return "", multierr.Combine(err, os.Remove(path))
+	}
+	return path, nil
+}
+
+// removeStateFile removes a file an internal state was written to.
+func (w *Watchdog) removeStateFile(path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		w.logger.Warnw("failed to remove an internal state file of cartographer", "path", path, "error", err)
+	}
+}
+
+// copyFile copies the file at src to the existing file at dst, without reading it into memory in full.
+func copyFile(src, dst string) error {
+	in, err := os.Open(filepath.Clean(src))
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(filepath.Clean(dst), os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return multierr.Combine(err, in.Close())
+	}
+	_, err = io.Copy(out, in)
+	return multierr.Combine(err, out.Close(), in.Close())
+}
+
+// startBackend initializes a new cartographer instance, starts it if the watchdog was started,
+// and makes it the current instance.
+func (w *Watchdog) startBackend(cartoCfg CartoConfig) (SlamMode, error) {
+	w.mu.Lock()
+	ctx, timeout, started := w.ctx, w.timeout, w.started
+	w.mu.Unlock()
+
+	backendCtx, cancelBackend := context.WithCancel(ctx)
+	backendWorkers := &sync.WaitGroup{}
+	backend := w.newBackend(cartoCfg)
+	slamMode, err := backend.Initialize(backendCtx, timeout, backendWorkers)
+	if err != nil {
+		cancelBackend()
+		return UnknownMode, err
+	}
+	if started {
+		if err := backend.Start(ctx, timeout); err != nil {
+			if termErr := backend.Terminate(ctx, timeout); termErr != nil {
+				w.logger.Warnw("failed to terminate the cartographer instance which failed to start", "error", termErr)
+			}
+			cancelBackend()
+			return UnknownMode, err
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.backend = backend
+	w.cancelBackend = cancelBackend
+	w.backendWorkers = backendWorkers
+	w.generation++
+	w.status.SlamMode = slamMode
+	return slamMode, nil
+}
+
+// run saves the internal state every snapshot interval until ctx is done, then waits for the restarts and the
+// workers of the current instance to stop and removes the saved internal state. The workers of an instance
+// whose hung call is still running are not waited for, as they may never return.
+func (w *Watchdog) run(ctx context.Context) {
+	var snapshots <-chan time.Time
+	if w.config.SnapshotInterval > 0 {
+		ticker := time.NewTicker(w.config.SnapshotInterval)
+		defer ticker.Stop()
+		snapshots = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			w.restartWorkers.Wait()
+			w.mu.Lock()
+			backendWorkers := w.backendWorkers
+			w.mu.Unlock()
+			if backendWorkers != nil {
+				backendWorkers.Wait()
+			}
+			w.mu.Lock()
+			if w.savedStatePath != "" {
+				w.removeStateFile(w.savedStatePath)
+				w.savedStatePath = ""
+			}
+			w.mu.Unlock()
+			return
+		case <-snapshots:
+			if err := w.snapshot(ctx); err != nil {
+				w.logger.Debugw("failed to save the internal state of cartographer", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package cartofacade
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+)
+
+// newTestWatchdog returns a Watchdog whose cartographer instances are mocks, which record the configs
+// they were created with. A mock initialized with a map updates it. Stopping a mock succeeds unless it has its own StopFunc.
+func newTestWatchdog(t *testing.T, config WatchdogConfig, newMock func(cartoCfg CartoConfig) *Mock) (*Watchdog, *[]CartoConfig) {
+	var cartoCfgs []CartoConfig
+	w := NewWatchdog(&CartoLibMock{}, GetTestConfig("my-lidar", "", "", true), GetTestAlgoConfig(false),
+		config, logging.NewTestLogger(t))
+	w.newBackend = func(cartoCfg CartoConfig) Interface {
+		cartoCfgs = append(cartoCfgs, cartoCfg)
+		mock := newMock(cartoCfg)
+		mock.InitializeFunc = func(context.Context, time.Duration, *sync.WaitGroup) (SlamMode, error) {
+			if cartoCfg.ExistingMap != "" {
+				return UpdatingMode, nil
+			}
+			return MappingMode, nil
+		}
+		mock.StartFunc = func(context.Context, time.Duration) error { return nil }
+		if mock.StopFunc == nil {
+			mock.StopFunc = func(context.Context, time.Duration) error { return nil }
+		}
+		mock.TerminateFunc = func(context.Context, time.Duration) error { return nil }
+		return mock
+	}
+	return w, &cartoCfgs
+}
+
+func waitForRestart(w *Watchdog) WatchdogStatus {
+	for w.Status().State == WatchdogStateRestarting {
+		time.Sleep(time.Millisecond)
+	}
+	return w.Status()
+}
+
+func TestWatchdog(t *testing.T) {
+	hangErr := multierr.Combine(ErrTimeoutReading, ErrHung, context.DeadlineExceeded)
+
+	t.Run("only counts consecutive hung or internally failed calls", func(t *testing.T) {
+		var positionErrs []error
+		w, _ := newTestWatchdog(t, WatchdogConfig{}, func(CartoConfig) *Mock {
+			mock := &Mock{}
+			mock.PositionFunc = func(context.Context, time.Duration) (Position, error) {
+				err := positionErrs[0]
+				positionErrs = positionErrs[1:]
+				return Position{}, err
+			}
+			return mock
+		})
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		workers := sync.WaitGroup{}
+		_, err := w.Initialize(ctx, time.Second, &workers)
+		test.That(t, err, test.ShouldBeNil)
+
+		// timing out behind a call which did not overrun its timeout, or the caller giving up, is not a hang
+		queuedErr := multierr.Combine(ErrTimeoutWriting, context.DeadlineExceeded)
+		cancelledErr := multierr.Combine(ErrTimeoutReading, context.Canceled)
+		positionErrs = []error{
+			ErrUnknownError, hangErr, nil, ErrUnknownError, ErrUnableToAcquireLock, ErrGetPositionNotInitialized,
+			queuedErr, queuedErr, cancelledErr,
+		}
+		for range positionErrs {
+			w.Position(ctx, time.Second)
+		}
+		test.That(t, w.Status(), test.ShouldResemble,
+			WatchdogStatus{State: WatchdogStateRunning, ConsecutiveFailures: 1, SlamMode: MappingMode})
+
+		cancelFunc()
+		workers.Wait()
+	})
+
+	t.Run("restarts an instance which still responds from its own internal state", func(t *testing.T) {
+		instances := 0
+		var restoredState []byte
+		w, cartoCfgs := newTestWatchdog(t, WatchdogConfig{MaxConsecutiveFailures: 2}, func(cartoCfg CartoConfig) *Mock {
+			instances++
+			failing := instances == 1
+			if !failing {
+				var err error
+				restoredState, err = os.ReadFile(cartoCfg.ExistingMap)
+				test.That(t, err, test.ShouldBeNil)
+			}
+			mock := &Mock{}
+			mock.RunFinalOptimizationFunc = func(context.Context, time.Duration) error {
+				if failing {
+					return ErrUnknownError
+				}
+				return nil
+			}
+			mock.WriteInternalStateFunc = func(_ context.Context, _ time.Duration, path string) error {
+				return os.WriteFile(path, []byte("state of the failed instance"), 0o600)
+			}
+			return mock
+		})
+		w.config.StateDir = t.TempDir()
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		workers := sync.WaitGroup{}
+		slamMode, err := w.Initialize(ctx, time.Second, &workers)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, slamMode, test.ShouldEqual, MappingMode)
+		test.That(t, w.Start(ctx, time.Second), test.ShouldBeNil)
+
+		for i := 0; i < 2; i++ {
+			test.That(t, errors.Is(w.RunFinalOptimization(ctx, time.Second), ErrUnknownError), test.ShouldBeTrue)
+		}
+		status := waitForRestart(w)
+		test.That(t, status.State, test.ShouldEqual, WatchdogStateRunning)
+		test.That(t, status.Restarts, test.ShouldEqual, 1)
+		test.That(t, status.LastRestartSource, test.ShouldEqual, RestartSourceInProcess)
+		test.That(t, status.LastRestartReason, test.ShouldEqual, ErrUnknownError.Error())
+		// the restarted instance updates the internal state of the mapping instance
+		test.That(t, status.SlamMode, test.ShouldEqual, UpdatingMode)
+
+		test.That(t, w.RunFinalOptimization(ctx, time.Second), test.ShouldBeNil)
+		test.That(t, len(*cartoCfgs), test.ShouldEqual, 2)
+		test.That(t, string(restoredState), test.ShouldEqual, "state of the failed instance")
+		restartedCfg := (*cartoCfgs)[1]
+		test.That(t, filepath.Dir(restartedCfg.ExistingMap), test.ShouldEqual, w.config.StateDir)
+		// the file is removed once the restarted instance was initialized from it
+		_, err = os.Stat(restartedCfg.ExistingMap)
+		test.That(t, errors.Is(err, os.ErrNotExist), test.ShouldBeTrue)
+
+		cancelFunc()
+		workers.Wait()
+	})
+
+	t.Run("restarts a hung instance from the latest saved internal state once its call returned", func(t *testing.T) {
+		instances := 0
+		var hungInternalStateCalls int
+		hungStopped := false
+		w, cartoCfgs := newTestWatchdog(t, WatchdogConfig{MaxConsecutiveFailures: 2}, func(cartoCfg CartoConfig) *Mock {
+			instances++
+			hung := instances == 1
+			saved := false
+			mock := &Mock{}
+			if !hung {
+				test.That(t, hungStopped, test.ShouldBeTrue)
+			}
+			mock.StopFunc = func(context.Context, time.Duration) error {
+				hungStopped = hungStopped || hung
+				return nil
+			}
+			mock.PositionFunc = func(context.Context, time.Duration) (Position, error) {
+				if hung {
+					return Position{}, hangErr
+				}
+				return Position{X: 1}, nil
+			}
+			mock.InternalStateFunc = func(context.Context, time.Duration) ([]byte, error) {
+				if hung && saved {
+					hungInternalStateCalls++
+					return nil, hangErr
+				}
+				saved = true
+				return []byte("saved state"), nil
+			}
+			return mock
+		})
+		w.config.StateDir = t.TempDir()
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		workers := sync.WaitGroup{}
+		_, err := w.Initialize(ctx, time.Second, &workers)
+		test.That(t, err, test.ShouldBeNil)
+
+		_, err = w.InternalState(ctx, time.Second)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, w.Status().SavedStateTime, test.ShouldNotResemble, time.Time{})
+
+		for i := 0; i < 2; i++ {
+			_, err := w.Position(ctx, time.Second)
+			test.That(t, errors.Is(err, ErrTimeoutReading), test.ShouldBeTrue)
+		}
+		status := waitForRestart(w)
+		test.That(t, status.Restarts, test.ShouldEqual, 1)
+		test.That(t, status.LastRestartSource, test.ShouldEqual, RestartSourceSavedState)
+		test.That(t, hungInternalStateCalls, test.ShouldEqual, 0)
+		savedState, err := os.ReadFile((*cartoCfgs)[1].ExistingMap)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, string(savedState), test.ShouldEqual, "saved state")
+
+		pos, err := w.Position(ctx, time.Second)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pos.X, test.ShouldEqual, 1)
+
+		// the saved state is kept until the watchdog stops
+		cancelFunc()
+		workers.Wait()
+		_, err = os.Stat((*cartoCfgs)[1].ExistingMap)
+		test.That(t, errors.Is(err, os.ErrNotExist), test.ShouldBeTrue)
+	})
+
+	t.Run("restarts a hung instance from the internal state last written for a caller", func(t *testing.T) {
+		instances := 0
+		w, cartoCfgs := newTestWatchdog(t, WatchdogConfig{MaxConsecutiveFailures: 1}, func(cartoCfg CartoConfig) *Mock {
+			instances++
+			hung := instances == 1
+			mock := &Mock{}
+			mock.PositionFunc = func(context.Context, time.Duration) (Position, error) {
+				if hung {
+					return Position{}, hangErr
+				}
+				return Position{}, nil
+			}
+			mock.WriteInternalStateFunc = func(_ context.Context, _ time.Duration, path string) error {
+				return os.WriteFile(path, []byte("written state"), 0o600)
+			}
+			return mock
+		})
+		w.config.StateDir = t.TempDir()
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		workers := sync.WaitGroup{}
+		_, err := w.Initialize(ctx, time.Second, &workers)
+		test.That(t, err, test.ShouldBeNil)
+
+		// the caller removes its file once it read it, so the watchdog keeps a copy
+		path := filepath.Join(t.TempDir(), "internal_state.pbstream")
+		test.That(t, os.WriteFile(path, nil, 0o600), test.ShouldBeNil)
+		test.That(t, w.WriteInternalState(ctx, time.Second, path), test.ShouldBeNil)
+		test.That(t, os.Remove(path), test.ShouldBeNil)
+		test.That(t, w.Status().SavedStateTime, test.ShouldNotResemble, time.Time{})
+
+		_, err = w.Position(ctx, time.Second)
+		test.That(t, errors.Is(err, ErrTimeoutReading), test.ShouldBeTrue)
+		status := waitForRestart(w)
+		test.That(t, status.State, test.ShouldEqual, WatchdogStateRunning)
+		test.That(t, status.LastRestartSource, test.ShouldEqual, RestartSourceSavedState)
+		restoredState, err := os.ReadFile((*cartoCfgs)[1].ExistingMap)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, string(restoredState), test.ShouldEqual, "written state")
+
+		cancelFunc()
+		workers.Wait()
+	})
+
+	t.Run("does not restart while a hung call is still running", func(t *testing.T) {
+		w, cartoCfgs := newTestWatchdog(t, WatchdogConfig{MaxConsecutiveFailures: 1}, func(cartoCfg CartoConfig) *Mock {
+			mock := &Mock{}
+			mock.PositionFunc = func(context.Context, time.Duration) (Position, error) {
+				return Position{}, hangErr
+			}
+			// stopping waits behind the hung call until it times out
+			mock.StopFunc = func(context.Context, time.Duration) error {
+				return multierr.Combine(ErrTimeoutWriting, ErrHung, context.DeadlineExceeded)
+			}
+			return mock
+		})
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		workers := sync.WaitGroup{}
+		_, err := w.Initialize(ctx, time.Second, &workers)
+		test.That(t, err, test.ShouldBeNil)
+
+		_, err = w.Position(ctx, time.Second)
+		test.That(t, errors.Is(err, ErrTimeoutReading), test.ShouldBeTrue)
+		status := waitForRestart(w)
+		test.That(t, status.State, test.ShouldEqual, WatchdogStateFailed)
+		test.That(t, status.Restarts, test.ShouldEqual, 0)
+		test.That(t, errors.Is(status.Err, ErrHungCallRunning), test.ShouldBeTrue)
+		test.That(t, len(*cartoCfgs), test.ShouldEqual, 1)
+
+		_, err = w.Position(ctx, time.Second)
+		test.That(t, errors.Is(err, ErrRestartFailed), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, ErrHungCallRunning.Error())
+
+		cancelFunc()
+		workers.Wait()
+	})
+
+	t.Run("returns a clear error after failing to restart", func(t *testing.T) {
+		instances := 0
+		w, _ := newTestWatchdog(t, WatchdogConfig{MaxConsecutiveFailures: 1}, func(cartoCfg CartoConfig) *Mock {
+			instances++
+			mock := &Mock{}
+			mock.PositionFunc = func(context.Context, time.Duration) (Position, error) {
+				return Position{}, hangErr
+			}
+			return mock
+		})
+		w.newBackend = func(newBackend func(CartoConfig) Interface) func(CartoConfig) Interface {
+			return func(cartoCfg CartoConfig) Interface {
+				backend := newBackend(cartoCfg)
+				if instances > 1 {
+					backend.(*Mock).InitializeFunc = func(context.Context, time.Duration, *sync.WaitGroup) (SlamMode, error) {
+						return UnknownMode, ErrLibNotInitialized
+					}
+				}
+				return backend
+			}
+		}(w.newBackend)
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		workers := sync.WaitGroup{}
+		_, err := w.Initialize(ctx, time.Second, &workers)
+		test.That(t, err, test.ShouldBeNil)
+
+		_, err = w.Position(ctx, time.Second)
+		test.That(t, errors.Is(err, ErrTimeoutReading), test.ShouldBeTrue)
+		status := waitForRestart(w)
+		test.That(t, status.State, test.ShouldEqual, WatchdogStateFailed)
+		test.That(t, status.LastRestartSource, test.ShouldEqual, RestartSource(""))
+		test.That(t, errors.Is(status.Err, ErrLibNotInitialized), test.ShouldBeTrue)
+
+		_, err = w.Position(ctx, time.Second)
+		test.That(t, errors.Is(err, ErrRestartFailed), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, ErrLibNotInitialized.Error())
+
+		cancelFunc()
+		workers.Wait()
+	})
+}
@@ -2,12 +2,16 @@
 package config
 
 import (
+	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"go.viam.com/rdk/logging"
 	"go.viam.com/utils"
+
+	s "github.com/viamrobotics/viam-cartographer/sensors"
 )
 
 // newError returns an error specific to a failure in the SLAM config.
@@ -28,19 +32,68 @@ type Config struct {
 
 // OptionalConfigParams holds the optional config parameters of SLAM.
 type OptionalConfigParams struct {
-	LidarDataFrequencyHz          int
-	MovementSensorName            string
-	MovementSensorDataFrequencyHz int
-	EnableMapping                 bool
-	ExistingMap                   string
+	LidarDataFrequencyHz               float64
+	LidarAccumulateScans               int
+	LidarAccumulateUntilFullCoverage   bool
+	LidarReadingFormat                 s.LidarReadingFormat
+	LidarDatasetDir                    string
+	LidarCaptureDir                    string
+	MovementSensorName                 string
+	MovementSensorDatasetDir           string
+	MovementSensorCaptureDir           string
+	MovementSensorDataFrequencyHz      float64
+	MovementSensorSampleFrequencyHz    float64
+	MovementSensorReadingTimeTolerance time.Duration
+	MovementSensorOutageTimeout        time.Duration
+	GenericMovementSensorConfig        *s.GenericSensorConfig
+	EnableMapping                      bool
+	ExistingMap                        string
+	RecordDir                          string
+	TrajectoryFile                     string
+	RecordMaxFileSizeBytes             int64
+	RecordMaxTotalSizeBytes            int64
+	IngestQueueSize                    int
+	IngestDropPolicy                   string
+	IngestReorderWindow                time.Duration
+	MaxClockSkew                       time.Duration
+	SkipStationaryScans                bool
+	StationaryTranslationMm            float64
+	StationaryRotationDeg              float64
+	StationaryAngularVelocityDegPerSec float64
+	StationaryScanChangeMm             float64
+	StationaryKeepalive                time.Duration
+	MaxConsecutiveCartoFailures        int
+	InternalStateSnapshotInterval      time.Duration
+	MapRenderInterval                  time.Duration
+	MapRenderNodeThreshold             int
 }
 
+const (
+	// movementSensorAPI is the default movement_sensor[api], a movement sensor component.
+	movementSensorAPI = "movement_sensor"
+	// genericSensorAPI is the movement_sensor[api] of a generic sensor component that reports
+	// IMU and/or odometer data through its Readings.
+	genericSensorAPI = "sensor"
+)
+
 var (
 	errCameraMustHaveName        = errors.New("\"camera[name]\" is required")
 	errLocalizationInOfflineMode = newError("\"camera[data_freq_hz]\" and enable_mapping = false." +
-		" Localization in offline mode is not supported.")
+		" Localization in offline mode requires an existing_map.")
 )
 
+// parseDataFrequencyHz parses a data_frequency_hz, which does not have to be a whole number of Hz.
+func parseDataFrequencyHz(str string) (float64, error) {
+	dataFreqHz, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(dataFreqHz) || math.IsInf(dataFreqHz, 0) {
+		return 0, errors.Errorf("%v is not a finite number", str)
+	}
+	return dataFreqHz, nil
+}
+
 // Validate creates the list of implicit dependencies.
 func (config *Config) Validate(path string) ([]string, error) {
 	var deps []string
@@ -50,44 +103,96 @@ func (config *Config) Validate(path string) ([]string, error) {
 	}
 	dataFreqHz, ok := config.Camera["data_frequency_hz"]
 	if ok {
-		dataFreqHz, err := strconv.Atoi(dataFreqHz)
+		dataFreqHz, err := parseDataFrequencyHz(dataFreqHz)
 		if err != nil {
-			return nil, errors.New("camera[data_frequency_hz] must only contain digits")
+			return nil, errors.New("camera[data_frequency_hz] must be a number")
 		}
 		if dataFreqHz < 0 {
 			return nil, errors.New("cannot specify camera[data_frequency_hz] less than zero")
 		}
 	}
-	deps = append(deps, cameraName)
+	// sensors read from a local dataset or data capture directory are not components
+	if config.Camera["dataset_dir"] == "" && config.Camera["capture_dir"] == "" {
+		deps = append(deps, cameraName)
+	}
 
 	movementSensorName, movementSensorExists := config.MovementSensor["name"]
-	if movementSensorExists && movementSensorName != "" {
+	if movementSensorExists && movementSensorName != "" &&
+		config.MovementSensor["dataset_dir"] == "" && config.MovementSensor["capture_dir"] == "" {
 		deps = append(deps, movementSensorName)
 	}
 
+	switch config.MovementSensor["api"] {
+	case "", movementSensorAPI, genericSensorAPI:
+	default:
+		return nil, errors.Errorf("movement_sensor[api] must be either %q or %q", movementSensorAPI, genericSensorAPI)
+	}
+
 	return deps, nil
 }
 
 // GetOptionalParameters sets any unset optional config parameters to the values passed to this function,
 // and returns them.
-func GetOptionalParameters(config *Config, defaultLidarDataFrequencyHz, defaultMovementSensorDataFrequencyHz int, logger logging.Logger,
+func GetOptionalParameters(config *Config, defaultLidarDataFrequencyHz, defaultMovementSensorDataFrequencyHz float64, logger logging.Logger,
 ) (OptionalConfigParams, error) {
 	var optionalConfigParams OptionalConfigParams
 
 	// Validate camera info and set defaults
 	if strCameraDataFreqHz, exists := config.Camera["data_frequency_hz"]; !exists {
 		optionalConfigParams.LidarDataFrequencyHz = defaultLidarDataFrequencyHz
-		logger.Debugf("config did not provide camera[data_frequency_hz], setting to default value of %d", defaultLidarDataFrequencyHz)
+		logger.Debugf("config did not provide camera[data_frequency_hz], setting to default value of %v", defaultLidarDataFrequencyHz)
 	} else {
-		lidarDataFreqHz, err := strconv.Atoi(strCameraDataFreqHz)
+		lidarDataFreqHz, err := parseDataFrequencyHz(strCameraDataFreqHz)
 		if err != nil {
-			return OptionalConfigParams{}, newError("camera[data_frequency_hz] must only contain digits")
+			return OptionalConfigParams{}, newError("camera[data_frequency_hz] must be a number")
 		}
 		if lidarDataFreqHz != 0 {
 			optionalConfigParams.LidarDataFrequencyHz = lidarDataFreqHz
 		}
 	}
 
+	// A local dataset or data capture directory can only be read in offline mode
+	if config.Camera["dataset_dir"] != "" && config.Camera["capture_dir"] != "" {
+		return OptionalConfigParams{}, newError("camera[dataset_dir] and camera[capture_dir] cannot both be set")
+	}
+	for _, key := range []string{"dataset_dir", "capture_dir"} {
+		if config.Camera[key] == "" {
+			continue
+		}
+		if optionalConfigParams.LidarDataFrequencyHz != 0 {
+			if _, exists := config.Camera["data_frequency_hz"]; exists {
+				return OptionalConfigParams{}, newError("camera[data_frequency_hz] must be 0 when camera[" + key + "] is set")
+			}
+			logger.Debugf("camera[%v] is set, setting camera[data_frequency_hz] to 0", key)
+		}
+		optionalConfigParams.LidarDataFrequencyHz = 0
+	}
+	optionalConfigParams.LidarDatasetDir = config.Camera["dataset_dir"]
+	optionalConfigParams.LidarCaptureDir = config.Camera["capture_dir"]
+
+	// Set up merging of partial lidar scans
+	if strAccumulateScans, exists := config.Camera["accumulate_scans"]; exists {
+		accumulateScans, err := strconv.Atoi(strAccumulateScans)
+		if err != nil || accumulateScans < 0 {
+			return OptionalConfigParams{}, newError("camera[accumulate_scans] must be a non-negative integer")
+		}
+		optionalConfigParams.LidarAccumulateScans = accumulateScans
+	}
+	if strFullCoverage, exists := config.Camera["accumulate_until_full_coverage"]; exists {
+		fullCoverage, err := strconv.ParseBool(strFullCoverage)
+		if err != nil {
+			return OptionalConfigParams{}, newError("camera[accumulate_until_full_coverage] must be true or false")
+		}
+		optionalConfigParams.LidarAccumulateUntilFullCoverage = fullCoverage
+	}
+
+	// Set up the encoding of lidar readings passed to cartographer
+	readingFormat, err := s.ParseLidarReadingFormat(config.Camera["reading_format"])
+	if err != nil {
+		return OptionalConfigParams{}, newError("camera[reading_format] must be pcd, points or points_intensity")
+	}
+	optionalConfigParams.LidarReadingFormat = readingFormat
+
 	// Validate movement sensor info and set defaults
 	if movementSensorName, exists := config.MovementSensor["name"]; exists && movementSensorName != "" {
 		optionalConfigParams.MovementSensorName = movementSensorName
@@ -99,17 +204,181 @@ func GetOptionalParameters(config *Config, defaultLidarDataFrequencyHz, defaultM
 			} else {
 				optionalConfigParams.MovementSensorDataFrequencyHz = defaultMovementSensorDataFrequencyHz
 				logger.Warnf("config did not provide movement_sensor[data_frequency_hz], "+
-					"setting to default value of %d", defaultMovementSensorDataFrequencyHz)
+					"setting to default value of %v", defaultMovementSensorDataFrequencyHz)
 			}
 		} else {
-			movementSensorDataFreqHz, err := strconv.Atoi(strMovementSensorDataFreqHz)
+			movementSensorDataFreqHz, err := parseDataFrequencyHz(strMovementSensorDataFreqHz)
 			if err != nil {
-				return OptionalConfigParams{}, newError("movement_sensor[data_frequency_hz] must only contain digits")
+				return OptionalConfigParams{}, newError("movement_sensor[data_frequency_hz] must be a number")
 			}
 			if movementSensorDataFreqHz != 0 {
 				optionalConfigParams.MovementSensorDataFrequencyHz = movementSensorDataFreqHz
 			}
 		}
+
+		if config.MovementSensor["dataset_dir"] != "" && config.MovementSensor["capture_dir"] != "" {
+			return OptionalConfigParams{}, newError("movement_sensor[dataset_dir] and movement_sensor[capture_dir] cannot both be set")
+		}
+		for _, key := range []string{"dataset_dir", "capture_dir"} {
+			if config.MovementSensor[key] != "" && optionalConfigParams.LidarDataFrequencyHz != 0 {
+				return OptionalConfigParams{}, newError("movement_sensor[" + key + "] can only be used in offline mode")
+			}
+		}
+		optionalConfigParams.MovementSensorDatasetDir = config.MovementSensor["dataset_dir"]
+		optionalConfigParams.MovementSensorCaptureDir = config.MovementSensor["capture_dir"]
+
+		// the channels of the movement sensor are sampled at the rate readings are requested by default
+		optionalConfigParams.MovementSensorSampleFrequencyHz = optionalConfigParams.MovementSensorDataFrequencyHz
+		if strSampleFreqHz, ok := config.MovementSensor["sample_frequency_hz"]; ok {
+			sampleFreqHz, err := parseDataFrequencyHz(strSampleFreqHz)
+			if err != nil || sampleFreqHz <= 0 {
+				return OptionalConfigParams{}, newError("movement_sensor[sample_frequency_hz] must be a positive number")
+			}
+			if optionalConfigParams.MovementSensorDataFrequencyHz == 0 {
+				return OptionalConfigParams{}, newError("movement_sensor[sample_frequency_hz] can only be used in online mode")
+			}
+			optionalConfigParams.MovementSensorSampleFrequencyHz = sampleFreqHz
+		}
+
+		if strTolerance, ok := config.MovementSensor["reading_time_tolerance_msec"]; ok {
+			toleranceMsec, err := strconv.Atoi(strTolerance)
+			if err != nil || toleranceMsec <= 0 {
+				return OptionalConfigParams{}, newError("movement_sensor[reading_time_tolerance_msec] must be a positive integer")
+			}
+			optionalConfigParams.MovementSensorReadingTimeTolerance = time.Duration(toleranceMsec) * time.Millisecond
+		}
+
+		if strOutageTimeout, ok := config.MovementSensor["outage_timeout_msec"]; ok {
+			outageTimeoutMsec, err := strconv.Atoi(strOutageTimeout)
+			if err != nil || outageTimeoutMsec <= 0 {
+				return OptionalConfigParams{}, newError("movement_sensor[outage_timeout_msec] must be a positive integer")
+			}
+			optionalConfigParams.MovementSensorOutageTimeout = time.Duration(outageTimeoutMsec) * time.Millisecond
+		}
+
+		if config.MovementSensor["api"] == genericSensorAPI {
+			optionalConfigParams.GenericMovementSensorConfig = &s.GenericSensorConfig{
+				LinearAccelerationKeys: splitKeys(config.MovementSensor["linear_acceleration_keys"]),
+				AngularVelocityKeys:    splitKeys(config.MovementSensor["angular_velocity_keys"]),
+				PositionKeys:           splitKeys(config.MovementSensor["position_keys"]),
+				OrientationKeys:        splitKeys(config.MovementSensor["orientation_keys"]),
+				LinearAccelerationUnit: s.LinearAccelerationUnit(config.MovementSensor["linear_acceleration_unit"]),
+				AngularVelocityUnit:    s.AngularVelocityUnit(config.MovementSensor["angular_velocity_unit"]),
+			}
+		}
+	}
+
+	// Set up recording the sensor readings to a local dataset
+	if recordDir := config.ConfigParams["record_dir"]; recordDir != "" {
+		optionalConfigParams.RecordDir = recordDir
+		for key, size := range map[string]*int64{
+			"record_max_file_size_mb":  &optionalConfigParams.RecordMaxFileSizeBytes,
+			"record_max_total_size_mb": &optionalConfigParams.RecordMaxTotalSizeBytes,
+		} {
+			strSizeMB, exists := config.ConfigParams[key]
+			if !exists {
+				continue
+			}
+			sizeMB, err := strconv.Atoi(strSizeMB)
+			if err != nil || sizeMB < 0 {
+				return OptionalConfigParams{}, newError("config_params[" + key + "] must be a non-negative integer")
+			}
+			*size = int64(sizeMB) << 20
+		}
+	}
+
+	// Set up writing the trajectory of localizing in offline mode
+	optionalConfigParams.TrajectoryFile = config.ConfigParams["trajectory_file"]
+
+	// Set up the queue between the sensor processes and cartographer in online mode
+	if strQueueSize, exists := config.ConfigParams["ingest_queue_size"]; exists {
+		queueSize, err := strconv.Atoi(strQueueSize)
+		if err != nil || queueSize <= 0 {
+			return OptionalConfigParams{}, newError("config_params[ingest_queue_size] must be a positive integer")
+		}
+		optionalConfigParams.IngestQueueSize = queueSize
+	}
+	switch dropPolicy := config.ConfigParams["ingest_drop_policy"]; dropPolicy {
+	case "", "oldest", "newest", "never":
+		optionalConfigParams.IngestDropPolicy = dropPolicy
+	default:
+		return OptionalConfigParams{}, newError("config_params[ingest_drop_policy] must be oldest, newest or never")
+	}
+	if strReorderWindow, exists := config.ConfigParams["ingest_reorder_window_msec"]; exists {
+		reorderWindowMsec, err := strconv.Atoi(strReorderWindow)
+		if err != nil || reorderWindowMsec < 0 {
+			return OptionalConfigParams{}, newError("config_params[ingest_reorder_window_msec] must be a non-negative integer")
+		}
+		optionalConfigParams.IngestReorderWindow = time.Duration(reorderWindowMsec) * time.Millisecond
+	}
+
+	// Set up detecting skewed sensor clocks
+	if strMaxClockSkew, exists := config.ConfigParams["max_clock_skew_msec"]; exists {
+		maxClockSkewMsec, err := strconv.Atoi(strMaxClockSkew)
+		if err != nil || maxClockSkewMsec <= 0 {
+			return OptionalConfigParams{}, newError("config_params[max_clock_skew_msec] must be a positive integer")
+		}
+		optionalConfigParams.MaxClockSkew = time.Duration(maxClockSkewMsec) * time.Millisecond
+	}
+
+	// Set up skipping lidar readings while the robot is stationary
+	if strSkipStationary, exists := config.ConfigParams["skip_stationary_scans"]; exists {
+		skipStationary, err := strconv.ParseBool(strSkipStationary)
+		if err != nil {
+			return OptionalConfigParams{}, newError("config_params[skip_stationary_scans] must be true or false")
+		}
+		optionalConfigParams.SkipStationaryScans = skipStationary
+	}
+	var stationaryKeepaliveSec float64
+	for key, threshold := range map[string]*float64{
+		"stationary_translation_mm":               &optionalConfigParams.StationaryTranslationMm,
+		"stationary_rotation_deg":                 &optionalConfigParams.StationaryRotationDeg,
+		"stationary_angular_velocity_deg_per_sec": &optionalConfigParams.StationaryAngularVelocityDegPerSec,
+		"stationary_scan_change_mm":               &optionalConfigParams.StationaryScanChangeMm,
+		"stationary_keepalive_sec":                &stationaryKeepaliveSec,
+	} {
+		strThreshold, exists := config.ConfigParams[key]
+		if !exists {
+			continue
+		}
+		value, err := strconv.ParseFloat(strThreshold, 64)
+		if err != nil || !(value > 0) || math.IsInf(value, 0) {
+			return OptionalConfigParams{}, newError("config_params[" + key + "] must be a positive number")
+		}
+		*threshold = value
+	}
+	optionalConfigParams.StationaryKeepalive = time.Duration(stationaryKeepaliveSec * float64(time.Second))
+
+	// Set up restarting cartographer after it hangs or fails
+	if strMaxFailures, exists := config.ConfigParams["max_consecutive_cartographer_failures"]; exists {
+		// -1 never restarts cartographer and 0 uses the default
+		maxFailures, err := strconv.Atoi(strMaxFailures)
+		if err != nil || maxFailures < -1 {
+			return OptionalConfigParams{}, newError(
+				"config_params[max_consecutive_cartographer_failures] must be -1 to never restart, 0 for the default or a positive integer")
+		}
+		optionalConfigParams.MaxConsecutiveCartoFailures = maxFailures
+	}
+	if strSnapshotInterval, exists := config.ConfigParams["internal_state_snapshot_interval_sec"]; exists {
+		snapshotIntervalSec, err := strconv.Atoi(strSnapshotInterval)
+		if err != nil || snapshotIntervalSec < 0 {
+			return OptionalConfigParams{}, newError("config_params[internal_state_snapshot_interval_sec] must be a non-negative integer")
+		}
+		optionalConfigParams.InternalStateSnapshotInterval = time.Duration(snapshotIntervalSec) * time.Second
+	}
+	if strRenderInterval, exists := config.ConfigParams["map_render_interval_sec"]; exists {
+		renderIntervalSec, err := strconv.ParseFloat(strRenderInterval, 64)
+		if err != nil || renderIntervalSec < 0 {
+			return OptionalConfigParams{}, newError("config_params[map_render_interval_sec] must be a non-negative number")
+		}
+		optionalConfigParams.MapRenderInterval = time.Duration(renderIntervalSec * float64(time.Second))
+	}
+	if strNodeThreshold, exists := config.ConfigParams["map_render_node_threshold"]; exists {
+		nodeThreshold, err := strconv.Atoi(strNodeThreshold)
+		if err != nil || nodeThreshold < 0 {
+			return OptionalConfigParams{}, newError("config_params[map_render_node_threshold] must be a non-negative integer")
+		}
+		optionalConfigParams.MapRenderNodeThreshold = nodeThreshold
 	}
 
 	// Check if apriori map exists and is in correct format
@@ -129,6 +398,12 @@ func GetOptionalParameters(config *Config, defaultLidarDataFrequencyHz, defaultM
 		optionalConfigParams.EnableMapping = *config.EnableMapping
 	}
 
+	// Default the trajectory of localizing in offline mode to a file next to the existing map
+	if optionalConfigParams.LidarDataFrequencyHz == 0 && !optionalConfigParams.EnableMapping &&
+		optionalConfigParams.ExistingMap != "" && optionalConfigParams.TrajectoryFile == "" {
+		optionalConfigParams.TrajectoryFile = strings.TrimSuffix(optionalConfigParams.ExistingMap, ".pbstream") + "_trajectory.csv"
+	}
+
 	// Validate slam mode
 	if err := validateModes(optionalConfigParams); err != nil {
 		return OptionalConfigParams{}, err
@@ -140,8 +415,21 @@ func GetOptionalParameters(config *Config, defaultLidarDataFrequencyHz, defaultM
 func validateModes(optionalConfigParams OptionalConfigParams) error {
 	offlineMode := optionalConfigParams.LidarDataFrequencyHz == 0
 	localizationMode := !optionalConfigParams.EnableMapping
-	if localizationMode && offlineMode {
+	// localizing against an existing map replays a dataset to evaluate localization
+	if localizationMode && offlineMode && optionalConfigParams.ExistingMap == "" {
 		return errLocalizationInOfflineMode
 	}
 	return nil
 }
+
+// splitKeys splits a comma separated list of readings keys, trimming surrounding whitespace.
+func splitKeys(keys string) []string {
+	if strings.TrimSpace(keys) == "" {
+		return nil
+	}
+	splitKeys := strings.Split(keys, ",")
+	for i, key := range splitKeys {
+		splitKeys[i] = strings.TrimSpace(key)
+	}
+	return splitKeys
+}
@@ -3,12 +3,15 @@ package config
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"go.viam.com/rdk/logging"
 	"go.viam.com/rdk/resource"
 	"go.viam.com/rdk/services/slam"
 	"go.viam.com/test"
 	"go.viam.com/utils"
+
+	s "github.com/viamrobotics/viam-cartographer/sensors"
 )
 
 func TestValidate(t *testing.T) {
@@ -79,6 +82,45 @@ func TestValidate(t *testing.T) {
 		test.That(t, err, test.ShouldBeError, newError("cannot specify camera[data_frequency_hz] less than zero"))
 	})
 
+	t.Run("Config with invalid movement sensor api", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["movement_sensor"] = map[string]string{
+			"name": "b",
+			"api":  "gibberish",
+		}
+		_, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("movement_sensor[api] must be either \"movement_sensor\" or \"sensor\""))
+	})
+
+	t.Run("Sensors read from a local dataset are not dependencies", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["camera"] = map[string]string{"name": "lidar", "dataset_dir": "/data/lidar"}
+		cfgService.Attributes["movement_sensor"] = map[string]string{"name": "imu", "dataset_dir": "/data/imu"}
+		cfg, err := newConfigWithoutValidate(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		deps, err := cfg.Validate(testCfgPath)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, deps, test.ShouldBeEmpty)
+
+		cfgService.Attributes["movement_sensor"] = map[string]string{"name": "imu"}
+		cfg, err = newConfigWithoutValidate(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		deps, err = cfg.Validate(testCfgPath)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, deps, test.ShouldResemble, []string{"imu"})
+	})
+
+	t.Run("Sensors read from a data capture directory are not dependencies", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["camera"] = map[string]string{"name": "lidar", "capture_dir": "/root/.viam/capture"}
+		cfgService.Attributes["movement_sensor"] = map[string]string{"name": "imu", "capture_dir": "/root/.viam/capture"}
+		cfg, err := newConfigWithoutValidate(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		deps, err := cfg.Validate(testCfgPath)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, deps, test.ShouldBeEmpty)
+	})
+
 	t.Run("All parameters e2e", func(t *testing.T) {
 		cfgService := makeCfgService()
 		cfgService.Attributes["camera"] = map[string]string{"name": "test", "data_frequency_hz": "10"}
@@ -178,6 +220,544 @@ func TestGetOptionalParameters(t *testing.T) {
 		test.That(t, optionalConfigParams.MovementSensorDataFrequencyHz, test.ShouldEqual, 2)
 		test.That(t, optionalConfigParams.LidarDataFrequencyHz, test.ShouldEqual, 2)
 		test.That(t, optionalConfigParams.EnableMapping, test.ShouldBeTrue)
+		test.That(t, optionalConfigParams.GenericMovementSensorConfig, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.MovementSensorReadingTimeTolerance, test.ShouldEqual, 0)
+	})
+
+	t.Run("Return fractional data frequencies", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["camera"] = map[string]string{
+			"name":              "testNameCamera",
+			"data_frequency_hz": "0.5",
+		}
+		cfgService.Attributes["movement_sensor"] = map[string]string{
+			"name":              "testNameSensor",
+			"data_frequency_hz": "12.5",
+		}
+
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.LidarDataFrequencyHz, test.ShouldEqual, 0.5)
+		test.That(t, optionalConfigParams.MovementSensorDataFrequencyHz, test.ShouldEqual, 12.5)
+	})
+
+	t.Run("Return movement sensor reading time tolerance", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["movement_sensor"] = map[string]string{
+			"name":                        "testNameSensor",
+			"data_frequency_hz":           "2",
+			"reading_time_tolerance_msec": "120",
+		}
+
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.MovementSensorReadingTimeTolerance, test.ShouldEqual, 120*time.Millisecond)
+
+		cfgService.Attributes["movement_sensor"].(map[string]string)["reading_time_tolerance_msec"] = "-3"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("movement_sensor[reading_time_tolerance_msec] must be a positive integer"))
+	})
+
+	t.Run("Return movement sensor sample frequency", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["movement_sensor"] = map[string]string{
+			"name":              "testNameSensor",
+			"data_frequency_hz": "2",
+		}
+
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.MovementSensorSampleFrequencyHz, test.ShouldEqual, 2)
+
+		cfgService.Attributes["movement_sensor"].(map[string]string)["sample_frequency_hz"] = "7.5"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.MovementSensorSampleFrequencyHz, test.ShouldEqual, 7.5)
+
+		cfgService.Attributes["movement_sensor"].(map[string]string)["sample_frequency_hz"] = "0"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("movement_sensor[sample_frequency_hz] must be a positive number"))
+	})
+
+	t.Run("Return movement sensor outage timeout", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["movement_sensor"] = map[string]string{
+			"name":                "testNameSensor",
+			"data_frequency_hz":   "2",
+			"outage_timeout_msec": "3000",
+		}
+
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.MovementSensorOutageTimeout, test.ShouldEqual, 3*time.Second)
+
+		cfgService.Attributes["movement_sensor"].(map[string]string)["outage_timeout_msec"] = "0"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("movement_sensor[outage_timeout_msec] must be a positive integer"))
+	})
+
+	t.Run("Return lidar accumulation parameters", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["camera"] = map[string]string{
+			"name":                           "testNameCamera",
+			"data_frequency_hz":              "20",
+			"accumulate_scans":               "4",
+			"accumulate_until_full_coverage": "true",
+		}
+
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.LidarAccumulateScans, test.ShouldEqual, 4)
+		test.That(t, optionalConfigParams.LidarAccumulateUntilFullCoverage, test.ShouldBeTrue)
+
+		cfgService.Attributes["camera"].(map[string]string)["accumulate_scans"] = "many"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("camera[accumulate_scans] must be a non-negative integer"))
+	})
+
+	t.Run("Return local dataset directories", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["camera"] = map[string]string{
+			"name":        "testNameCamera",
+			"dataset_dir": "/data/lidar",
+		}
+		cfgService.Attributes["movement_sensor"] = map[string]string{
+			"name":        "testNameSensor",
+			"dataset_dir": "/data/imu",
+		}
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.LidarDatasetDir, test.ShouldEqual, "/data/lidar")
+		test.That(t, optionalConfigParams.LidarDataFrequencyHz, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.MovementSensorDatasetDir, test.ShouldEqual, "/data/imu")
+		test.That(t, optionalConfigParams.MovementSensorDataFrequencyHz, test.ShouldEqual, 0)
+
+		cfgService.Attributes["camera"].(map[string]string)["data_frequency_hz"] = "5"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("camera[data_frequency_hz] must be 0 when camera[dataset_dir] is set"))
+
+		cfgService.Attributes["camera"] = map[string]string{
+			"name":              "testNameCamera",
+			"data_frequency_hz": "5",
+		}
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("movement_sensor[dataset_dir] can only be used in offline mode"))
+	})
+
+	t.Run("Return data capture directories", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["camera"] = map[string]string{
+			"name":        "testNameCamera",
+			"capture_dir": "/root/.viam/capture",
+		}
+		cfgService.Attributes["movement_sensor"] = map[string]string{
+			"name":        "testNameSensor",
+			"capture_dir": "/root/.viam/capture",
+		}
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.LidarCaptureDir, test.ShouldEqual, "/root/.viam/capture")
+		test.That(t, optionalConfigParams.LidarDatasetDir, test.ShouldEqual, "")
+		test.That(t, optionalConfigParams.LidarDataFrequencyHz, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.MovementSensorCaptureDir, test.ShouldEqual, "/root/.viam/capture")
+		test.That(t, optionalConfigParams.MovementSensorDataFrequencyHz, test.ShouldEqual, 0)
+
+		cfgService.Attributes["camera"].(map[string]string)["dataset_dir"] = "/data/lidar"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("camera[dataset_dir] and camera[capture_dir] cannot both be set"))
+
+		cfgService.Attributes["camera"] = map[string]string{
+			"name":              "testNameCamera",
+			"data_frequency_hz": "5",
+		}
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("movement_sensor[capture_dir] can only be used in offline mode"))
+	})
+
+	t.Run("Return recording parameters", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["config_params"] = map[string]string{
+			"mode":                     "test mode",
+			"record_dir":               "/data/recording",
+			"record_max_file_size_mb":  "2",
+			"record_max_total_size_mb": "100",
+		}
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.RecordDir, test.ShouldEqual, "/data/recording")
+		test.That(t, optionalConfigParams.RecordMaxFileSizeBytes, test.ShouldEqual, 2<<20)
+		test.That(t, optionalConfigParams.RecordMaxTotalSizeBytes, test.ShouldEqual, 100<<20)
+
+		cfgService.Attributes["config_params"].(map[string]string)["record_max_total_size_mb"] = "-1"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("config_params[record_max_total_size_mb] must be a non-negative integer"))
+	})
+
+	t.Run("Return ingest queue parameters", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["config_params"] = map[string]string{
+			"mode":               "test mode",
+			"ingest_queue_size":  "10",
+			"ingest_drop_policy": "never",
+		}
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.IngestQueueSize, test.ShouldEqual, 10)
+		test.That(t, optionalConfigParams.IngestDropPolicy, test.ShouldEqual, "never")
+
+		cfgService.Attributes["config_params"].(map[string]string)["ingest_queue_size"] = "0"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("config_params[ingest_queue_size] must be a positive integer"))
+
+		cfgService.Attributes["config_params"].(map[string]string)["ingest_queue_size"] = "10"
+		cfgService.Attributes["config_params"].(map[string]string)["ingest_drop_policy"] = "random"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("config_params[ingest_drop_policy] must be oldest, newest or never"))
+
+		cfgService.Attributes["config_params"].(map[string]string)["ingest_drop_policy"] = "never"
+		cfgService.Attributes["config_params"].(map[string]string)["ingest_reorder_window_msec"] = "-5"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("config_params[ingest_reorder_window_msec] must be a non-negative integer"))
+	})
+
+	t.Run("Return reading time validation parameters", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["config_params"] = map[string]string{
+			"mode":                       "test mode",
+			"ingest_reorder_window_msec": "200",
+			"max_clock_skew_msec":        "500",
+		}
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.IngestReorderWindow, test.ShouldEqual, 200*time.Millisecond)
+		test.That(t, optionalConfigParams.MaxClockSkew, test.ShouldEqual, 500*time.Millisecond)
+
+		cfgService.Attributes["config_params"].(map[string]string)["max_clock_skew_msec"] = "0"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("config_params[max_clock_skew_msec] must be a positive integer"))
+	})
+
+	t.Run("Return stationary scan parameters", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["config_params"] = map[string]string{
+			"mode":                      "test mode",
+			"skip_stationary_scans":     "true",
+			"stationary_translation_mm": "10",
+			"stationary_keepalive_sec":  "2.5",
+		}
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.SkipStationaryScans, test.ShouldBeTrue)
+		test.That(t, optionalConfigParams.StationaryTranslationMm, test.ShouldEqual, 10)
+		test.That(t, optionalConfigParams.StationaryRotationDeg, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.StationaryKeepalive, test.ShouldEqual, 2500*time.Millisecond)
+
+		cfgService.Attributes["config_params"].(map[string]string)["skip_stationary_scans"] = "yes please"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("config_params[skip_stationary_scans] must be true or false"))
+
+		cfgService.Attributes["config_params"].(map[string]string)["skip_stationary_scans"] = "true"
+		cfgService.Attributes["config_params"].(map[string]string)["stationary_rotation_deg"] = "-1"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("config_params[stationary_rotation_deg] must be a positive number"))
+	})
+
+	t.Run("Return cartographer restart parameters", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["config_params"] = map[string]string{
+			"mode":                                  "test mode",
+			"max_consecutive_cartographer_failures": "-1",
+			"internal_state_snapshot_interval_sec":  "60",
+		}
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.MaxConsecutiveCartoFailures, test.ShouldEqual, -1)
+		test.That(t, optionalConfigParams.InternalStateSnapshotInterval, test.ShouldEqual, time.Minute)
+
+		cfgService.Attributes["config_params"].(map[string]string)["internal_state_snapshot_interval_sec"] = "often"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError,
+			newError("config_params[internal_state_snapshot_interval_sec] must be a non-negative integer"))
+
+		cfgService.Attributes["config_params"].(map[string]string)["internal_state_snapshot_interval_sec"] = "60"
+		cfgService.Attributes["config_params"].(map[string]string)["max_consecutive_cartographer_failures"] = "-5"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError(
+			"config_params[max_consecutive_cartographer_failures] must be -1 to never restart, 0 for the default or a positive integer"))
+	})
+
+	t.Run("Return map render interval and node threshold", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["config_params"] = map[string]string{
+			"mode":                      "test mode",
+			"map_render_interval_sec":   "2.5",
+			"map_render_node_threshold": "20",
+		}
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.MapRenderInterval, test.ShouldEqual, 2500*time.Millisecond)
+		test.That(t, optionalConfigParams.MapRenderNodeThreshold, test.ShouldEqual, 20)
+
+		cfgService.Attributes["config_params"].(map[string]string)["map_render_node_threshold"] = "-1"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError,
+			newError("config_params[map_render_node_threshold] must be a non-negative integer"))
+	})
+
+	t.Run("Return lidar reading format", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.LidarReadingFormat, test.ShouldEqual, s.LidarReadingFormatPCD)
+
+		cfgService.Attributes["camera"] = map[string]string{
+			"name":              "testNameCamera",
+			"data_frequency_hz": "20",
+			"reading_format":    "points",
+		}
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.LidarReadingFormat, test.ShouldEqual, s.LidarReadingFormatPoints)
+
+		cfgService.Attributes["camera"].(map[string]string)["reading_format"] = "ply"
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("camera[reading_format] must be pcd, points or points_intensity"))
+	})
+
+	t.Run("Return generic movement sensor config", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["movement_sensor"] = map[string]string{
+			"name":                     "testNameSensor",
+			"data_frequency_hz":        "2",
+			"api":                      "sensor",
+			"linear_acceleration_keys": "acc_x, acc_y, acc_z",
+			"angular_velocity_keys":    "gyro.x,gyro.y,gyro.z",
+			"angular_velocity_unit":    "rad_per_sec",
+		}
+
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.GenericMovementSensorConfig, test.ShouldResemble, &s.GenericSensorConfig{
+			LinearAccelerationKeys: []string{"acc_x", "acc_y", "acc_z"},
+			AngularVelocityKeys:    []string{"gyro.x", "gyro.y", "gyro.z"},
+			AngularVelocityUnit:    s.RadiansPerSec,
+		})
 	})
 
 	t.Run("Pass invalid existing map", func(t *testing.T) {
@@ -196,7 +776,39 @@ func TestGetOptionalParameters(t *testing.T) {
 
 	t.Run("config that puts cartographer in offline mode and in localization mode", func(t *testing.T) {
 		cfgService := makeCfgService()
-		cfgService.Attributes["existing_map"] = "test-file.pbstream"
+		cfgService.Attributes["existing_map"] = "/maps/test-file.pbstream"
+		cfgService.Attributes["enable_mapping"] = false
+		cfgService.Attributes["camera"] = map[string]string{
+			"name":              "testcam",
+			"data_frequency_hz": "0",
+		}
+
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.LidarDataFrequencyHz, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.EnableMapping, test.ShouldBeFalse)
+		test.That(t, optionalConfigParams.TrajectoryFile, test.ShouldEqual, "/maps/test-file_trajectory.csv")
+
+		cfgService.Attributes["config_params"] = map[string]string{"mode": "2d", "trajectory_file": "/results/run1.csv"}
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.TrajectoryFile, test.ShouldEqual, "/results/run1.csv")
+	})
+
+	t.Run("config that puts cartographer in offline mode and in localization mode without an existing map", func(t *testing.T) {
+		cfgService := makeCfgService()
 		cfgService.Attributes["enable_mapping"] = false
 		cfgService.Attributes["camera"] = map[string]string{
 			"name":              "testcam",
@@ -234,7 +846,20 @@ func sensorAttributeTestHelper(
 			1000,
 			1000,
 			logger)
-		test.That(t, err, test.ShouldBeError, newError("camera[data_frequency_hz] must only contain digits"))
+		test.That(t, err, test.ShouldBeError, newError("camera[data_frequency_hz] must be a number"))
+
+		cfgService.Attributes["camera"] = map[string]string{
+			"name":              "a",
+			"data_frequency_hz": "NaN",
+		}
+		cfg, err = newConfigWithoutValidate(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("camera[data_frequency_hz] must be a number"))
 	})
 
 	t.Run("Unit test return error if movement sensor data frequency is invalid", func(t *testing.T) {
@@ -254,7 +879,7 @@ func sensorAttributeTestHelper(
 			1000,
 			1000,
 			logger)
-		test.That(t, err, test.ShouldBeError, newError("movement_sensor[data_frequency_hz] must only contain digits"))
+		test.That(t, err, test.ShouldBeError, newError("movement_sensor[data_frequency_hz] must be a number"))
 	})
 }
 
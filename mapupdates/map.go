@@ -0,0 +1,95 @@
+package mapupdates
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/pointcloud"
+)
+
+// Map is the client side copy of the pointcloud map, patched with the updates of the DoCommand.
+type Map struct {
+	epoch    string
+	revision uint64
+	submaps  map[SubmapID][]byte
+}
+
+// NewMap returns an empty Map, whose first update is a full update.
+func NewMap() *Map {
+	return &Map{submaps: map[SubmapID][]byte{}}
+}
+
+// Revision returns the revision of the map, zero before the first update was applied.
+func (m *Map) Revision() uint64 {
+	return m.revision
+}
+
+// Request returns the DoCommand request for the update from the revision of the map.
+func (m *Map) Request() map[string]interface{} {
+	return Request(m.revision, m.epoch)
+}
+
+// Apply patches the map with an update. A full update replaces the map, any other update must apply to
+// the revision of the map.
+func (m *Map) Apply(update Update) error {
+	if update.Since == 0 {
+		m.submaps = map[SubmapID][]byte{}
+	} else if update.Since != m.revision || update.Epoch != m.epoch {
+		return ErrUpdateNotApplicable
+	}
+
+	for _, id := range update.Removed {
+		delete(m.submaps, id)
+	}
+	for _, submap := range update.Submaps {
+		m.submaps[submap.ID] = submap.PointCloud
+	}
+	m.epoch = update.Epoch
+	m.revision = update.Revision
+	return nil
+}
+
+// PCD returns the points of every submap merged into one PCD. Where submaps overlap, the point with the
+// higher confidence, encoded in the blue channel, is kept.
+func (m *Map) PCD() ([]byte, error) {
+	ids := make([]SubmapID, 0, len(m.submaps))
+	for id := range m.submaps {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return less(ids[i], ids[j]) })
+
+	merged := pointcloud.New()
+	for _, id := range ids {
+		pc, err := pointcloud.ReadPCD(bytes.NewReader(m.submaps[id]))
+		if err != nil {
+			return nil, err
+		}
+
+		var setErr error
+		pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+			if existing, ok := merged.At(p.X, p.Y, p.Z); ok && confidence(existing) >= confidence(d) {
+				return true
+			}
+			setErr = merged.Set(p, d)
+			return setErr == nil
+		})
+		if setErr != nil {
+			return nil, setErr
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pointcloud.ToPCD(merged, &buf, pointcloud.PCDBinary); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func confidence(d pointcloud.Data) uint8 {
+	if d == nil || !d.HasColor() {
+		return 0
+	}
+	_, _, b := d.RGB255()
+	return b
+}
@@ -0,0 +1,313 @@
+// Package mapupdates contains functionality to serve and apply incremental updates of the pointcloud map,
+// which only carry the submaps added, changed or removed since a revision of the map.
+package mapupdates
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Command can be used to get the submaps of the pointcloud map changed since a revision.
+	Command = "map_changes_since"
+
+	revisionKey     = "revision"
+	epochKey        = "epoch"
+	sinceKey        = "since"
+	submapsKey      = "submaps"
+	removedKey      = "removed"
+	trajectoryIDKey = "trajectory_id"
+	submapIndexKey  = "submap_index"
+	pcdKey          = "pcd"
+)
+
+var (
+	errArgsNotAMap          = errors.New("could not parse provided arguments as a map")
+	errRevisionNotAnInteger = errors.New("could not parse provided revision as a non-negative integer")
+	errEpochNotAString      = errors.New("could not parse provided epoch as a string")
+	errUpdateNotAMap        = errors.New("could not parse provided update as a map")
+	errSubmapsNotASlice     = errors.New("could not parse provided submaps as a slice")
+	errSubmapNotAMap        = errors.New("could not parse provided submap as a map")
+	errSubmapIDNotAnInteger = errors.New("could not parse provided submap id as integers")
+	errPCDNotBase64         = errors.New("could not parse provided pcd as a base64 string")
+
+	// ErrUpdateNotApplicable is the error returned when an update is applied to a map of another revision.
+	ErrUpdateNotApplicable = errors.New("update does not apply to the revision of the map")
+)
+
+// SubmapID identifies a submap of the map.
+type SubmapID struct {
+	TrajectoryID int
+	SubmapIndex  int
+}
+
+// Submap is a submap of the map and its points.
+type Submap struct {
+	ID SubmapID
+	// PointCloud is the PCD of the submap, nil when passed to Tracker.Update if the submap did not change.
+	PointCloud []byte
+}
+
+// Update holds the submaps added, changed or removed between two revisions of the map.
+type Update struct {
+	// Epoch identifies the Tracker the revisions count the changes of. Revisions of different epochs are
+	// not comparable.
+	Epoch string
+	// Since is the revision the update applies to. Zero is a full update holding every submap of the map.
+	Since uint64
+	// Revision is the revision of the map after applying the update.
+	Revision uint64
+	// Submaps are the submaps added or changed since the revision.
+	Submaps []Submap
+	// Removed are the submaps removed since the revision.
+	Removed []SubmapID
+}
+
+type trackedSubmap struct {
+	revision   uint64
+	pointCloud []byte
+}
+
+/*
+Tracker counts the revisions of the map, incremented whenever submaps are added, changed or removed, and
+keeps the latest points of every submap, so that clients holding an older revision are only sent the
+submaps which changed since.
+*/
+type Tracker struct {
+	mu       sync.Mutex
+	epoch    string
+	revision uint64
+	submaps  map[SubmapID]trackedSubmap
+	// removed holds the revision each submap which is no longer in the map was removed at
+	removed map[SubmapID]uint64
+}
+
+// NewTracker returns a Tracker of a map without submaps, with a new epoch.
+func NewTracker() *Tracker {
+	epoch := make([]byte, 8)
+	if _, err := rand.Read(epoch); err != nil {
+		// the epoch only needs to differ between trackers
+		binary.BigEndian.PutUint64(epoch, uint64(time.Now().UnixNano()))
+	}
+	return &Tracker{
+		epoch:   hex.EncodeToString(epoch),
+		submaps: map[SubmapID]trackedSubmap{},
+		removed: map[SubmapID]uint64{},
+	}
+}
+
+// Update records every submap of the map. Submaps with points were added or changed, submaps without
+// points are unchanged and submaps which are missing were removed. It returns the revision of the map.
+func (t *Tracker) Update(submaps []Submap) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	next := t.revision + 1
+	changed := false
+	present := map[SubmapID]struct{}{}
+	for _, submap := range submaps {
+		present[submap.ID] = struct{}{}
+		if submap.PointCloud == nil {
+			continue
+		}
+		t.submaps[submap.ID] = trackedSubmap{revision: next, pointCloud: submap.PointCloud}
+		delete(t.removed, submap.ID)
+		changed = true
+	}
+	for id := range t.submaps {
+		if _, ok := present[id]; !ok {
+			delete(t.submaps, id)
+			t.removed[id] = next
+			changed = true
+		}
+	}
+
+	if changed {
+		t.revision = next
+	}
+	return t.revision
+}
+
+// Since returns the update from the given revision of the epoch to the latest revision. It returns a full
+// update if the revision is zero, of another epoch or newer than the latest revision.
+func (t *Tracker) Since(revision uint64, epoch string) Update {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if epoch != t.epoch || revision > t.revision {
+		revision = 0
+	}
+	update := Update{Epoch: t.epoch, Since: revision, Revision: t.revision, Submaps: []Submap{}, Removed: []SubmapID{}}
+	for id, submap := range t.submaps {
+		if submap.revision > revision {
+			update.Submaps = append(update.Submaps, Submap{ID: id, PointCloud: submap.pointCloud})
+		}
+	}
+	if revision > 0 {
+		for id, removedAt := range t.removed {
+			if removedAt > revision {
+				update.Removed = append(update.Removed, id)
+			}
+		}
+	}
+
+	sort.Slice(update.Submaps, func(i, j int) bool { return less(update.Submaps[i].ID, update.Submaps[j].ID) })
+	sort.Slice(update.Removed, func(i, j int) bool { return less(update.Removed[i], update.Removed[j]) })
+	return update
+}
+
+func less(a, b SubmapID) bool {
+	if a.TrajectoryID != b.TrajectoryID {
+		return a.TrajectoryID < b.TrajectoryID
+	}
+	return a.SubmapIndex < b.SubmapIndex
+}
+
+// Request returns the DoCommand request for the update from the given revision of the epoch.
+func Request(revision uint64, epoch string) map[string]interface{} {
+	return map[string]interface{}{Command: map[string]interface{}{
+		revisionKey: float64(revision),
+		epochKey:    epoch,
+	}}
+}
+
+// ParseRequest parses the arguments of the DoCommand into the revision and epoch the update is requested
+// from. Missing arguments request a full update.
+func ParseRequest(args interface{}) (uint64, string, error) {
+	argsMap, ok := args.(map[string]interface{})
+	if !ok {
+		return 0, "", errArgsNotAMap
+	}
+
+	var revision uint64
+	if value, ok := argsMap[revisionKey]; ok {
+		number, err := parseInt(value)
+		if err != nil || number < 0 {
+			return 0, "", errRevisionNotAnInteger
+		}
+		revision = uint64(number)
+	}
+
+	var epoch string
+	if value, ok := argsMap[epochKey]; ok {
+		if epoch, ok = value.(string); !ok {
+			return 0, "", errEpochNotAString
+		}
+	}
+	return revision, epoch, nil
+}
+
+// Response returns the update encoded as the response of the DoCommand, with the PCDs as base64 strings.
+func (u Update) Response() map[string]interface{} {
+	submaps := []interface{}{}
+	for _, submap := range u.Submaps {
+		resp := submapIDResponse(submap.ID)
+		resp[pcdKey] = base64.StdEncoding.EncodeToString(submap.PointCloud)
+		submaps = append(submaps, resp)
+	}
+	removed := []interface{}{}
+	for _, id := range u.Removed {
+		removed = append(removed, submapIDResponse(id))
+	}
+	return map[string]interface{}{
+		epochKey:    u.Epoch,
+		sinceKey:    float64(u.Since),
+		revisionKey: float64(u.Revision),
+		submapsKey:  submaps,
+		removedKey:  removed,
+	}
+}
+
+func submapIDResponse(id SubmapID) map[string]interface{} {
+	return map[string]interface{}{
+		trajectoryIDKey: float64(id.TrajectoryID),
+		submapIndexKey:  float64(id.SubmapIndex),
+	}
+}
+
+// ParseUpdate parses the response of the DoCommand into an Update.
+func ParseUpdate(resp interface{}) (Update, error) {
+	respMap, ok := resp.(map[string]interface{})
+	if !ok {
+		return Update{}, errUpdateNotAMap
+	}
+
+	epoch, ok := respMap[epochKey].(string)
+	if !ok {
+		return Update{}, errEpochNotAString
+	}
+	since, err := parseInt(respMap[sinceKey])
+	if err != nil || since < 0 {
+		return Update{}, errRevisionNotAnInteger
+	}
+	revision, err := parseInt(respMap[revisionKey])
+	if err != nil || revision < 0 {
+		return Update{}, errRevisionNotAnInteger
+	}
+	update := Update{Epoch: epoch, Since: uint64(since), Revision: uint64(revision)}
+
+	submaps, ok := respMap[submapsKey].([]interface{})
+	if !ok {
+		return Update{}, errSubmapsNotASlice
+	}
+	for _, submap := range submaps {
+		id, submapMap, err := parseSubmapID(submap)
+		if err != nil {
+			return Update{}, err
+		}
+		encoded, ok := submapMap[pcdKey].(string)
+		if !ok {
+			return Update{}, errPCDNotBase64
+		}
+		pointCloud, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return Update{}, errPCDNotBase64
+		}
+		update.Submaps = append(update.Submaps, Submap{ID: id, PointCloud: pointCloud})
+	}
+
+	removed, ok := respMap[removedKey].([]interface{})
+	if !ok {
+		return Update{}, errSubmapsNotASlice
+	}
+	for _, submap := range removed {
+		id, _, err := parseSubmapID(submap)
+		if err != nil {
+			return Update{}, err
+		}
+		update.Removed = append(update.Removed, id)
+	}
+	return update, nil
+}
+
+func parseSubmapID(submap interface{}) (SubmapID, map[string]interface{}, error) {
+	submapMap, ok := submap.(map[string]interface{})
+	if !ok {
+		return SubmapID{}, nil, errSubmapNotAMap
+	}
+	trajectoryID, err := parseInt(submapMap[trajectoryIDKey])
+	if err != nil {
+		return SubmapID{}, nil, errSubmapIDNotAnInteger
+	}
+	submapIndex, err := parseInt(submapMap[submapIndexKey])
+	if err != nil {
+		return SubmapID{}, nil, errSubmapIDNotAnInteger
+	}
+	return SubmapID{TrajectoryID: int(trajectoryID), SubmapIndex: int(submapIndex)}, submapMap, nil
+}
+
+// parseInt parses a number decoded from a DoCommand, which are float64, into an integer.
+func parseInt(value interface{}) (int64, error) {
+	number, ok := value.(float64)
+	if !ok || number != math.Trunc(number) {
+		return 0, errors.New("not an integer")
+	}
+	return int64(number), nil
+}
@@ -0,0 +1,210 @@
+package mapupdates
+
+import (
+	"bytes"
+	"image/color"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/test"
+)
+
+// testPCD returns a PCD with a point at each given x with the given confidence.
+func testPCD(t *testing.T, confidence uint8, xs ...float64) []byte {
+	t.Helper()
+	pc := pointcloud.New()
+	for _, x := range xs {
+		test.That(t, pc.Set(r3.Vector{X: x}, pointcloud.NewColoredData(color.NRGBA{B: confidence, R: 255})), test.ShouldBeNil)
+	}
+	var buf bytes.Buffer
+	test.That(t, pointcloud.ToPCD(pc, &buf, pointcloud.PCDBinary), test.ShouldBeNil)
+	return buf.Bytes()
+}
+
+var (
+	first  = SubmapID{TrajectoryID: 0, SubmapIndex: 0}
+	second = SubmapID{TrajectoryID: 0, SubmapIndex: 1}
+	third  = SubmapID{TrajectoryID: 1, SubmapIndex: 0}
+)
+
+func TestTracker(t *testing.T) {
+	t.Run("only returns the submaps changed since a revision", func(t *testing.T) {
+		tracker := NewTracker()
+		test.That(t, tracker.Update([]Submap{{ID: first, PointCloud: []byte("a")}}), test.ShouldEqual, 1)
+		epoch := tracker.Since(0, "").Epoch
+		// unchanged submaps do not increment the revision
+		test.That(t, tracker.Update([]Submap{{ID: first}}), test.ShouldEqual, 1)
+		test.That(t, tracker.Update([]Submap{{ID: first}, {ID: second, PointCloud: []byte("b")}}), test.ShouldEqual, 2)
+
+		update := tracker.Since(1, epoch)
+		test.That(t, update, test.ShouldResemble, Update{
+			Epoch:    epoch,
+			Since:    1,
+			Revision: 2,
+			Submaps:  []Submap{{ID: second, PointCloud: []byte("b")}},
+			Removed:  []SubmapID{},
+		})
+
+		update = tracker.Since(2, epoch)
+		test.That(t, update.Submaps, test.ShouldBeEmpty)
+		test.That(t, update.Revision, test.ShouldEqual, 2)
+	})
+
+	t.Run("returns the submaps removed since a revision", func(t *testing.T) {
+		tracker := NewTracker()
+		tracker.Update([]Submap{{ID: first, PointCloud: []byte("a")}, {ID: second, PointCloud: []byte("b")}})
+		epoch := tracker.Since(0, "").Epoch
+		test.That(t, tracker.Update([]Submap{{ID: second}, {ID: third, PointCloud: []byte("c")}}), test.ShouldEqual, 2)
+
+		update := tracker.Since(1, epoch)
+		test.That(t, update.Submaps, test.ShouldResemble, []Submap{{ID: third, PointCloud: []byte("c")}})
+		test.That(t, update.Removed, test.ShouldResemble, []SubmapID{first})
+
+		// a submap which is added back is no longer removed
+		tracker.Update([]Submap{{ID: first, PointCloud: []byte("d")}, {ID: second}, {ID: third}})
+		update = tracker.Since(1, epoch)
+		test.That(t, update.Removed, test.ShouldBeEmpty)
+		test.That(t, len(update.Submaps), test.ShouldEqual, 2)
+	})
+
+	t.Run("returns a full update for revisions of another epoch or which are unknown", func(t *testing.T) {
+		tracker := NewTracker()
+		tracker.Update([]Submap{{ID: first, PointCloud: []byte("a")}})
+		tracker.Update([]Submap{{ID: second, PointCloud: []byte("b")}})
+		epoch := tracker.Since(0, "").Epoch
+		test.That(t, NewTracker().Since(0, "").Epoch, test.ShouldNotEqual, epoch)
+
+		for _, update := range []Update{tracker.Since(1, "other"), tracker.Since(3, epoch), tracker.Since(0, epoch)} {
+			test.That(t, update.Since, test.ShouldEqual, 0)
+			test.That(t, update.Revision, test.ShouldEqual, 2)
+			test.That(t, update.Submaps, test.ShouldResemble, []Submap{{ID: second, PointCloud: []byte("b")}})
+			test.That(t, update.Removed, test.ShouldBeEmpty)
+		}
+	})
+}
+
+func TestParseRequest(t *testing.T) {
+	for _, tc := range []struct {
+		msg string
+		cmd interface{}
+		err error
+	}{
+		{msg: "errors if the arguments are not a map", cmd: "hello", err: errArgsNotAMap},
+		{msg: "errors if the revision is not a number", cmd: map[string]interface{}{revisionKey: "1"}, err: errRevisionNotAnInteger},
+		{msg: "errors if the revision is not an integer", cmd: map[string]interface{}{revisionKey: 1.5}, err: errRevisionNotAnInteger},
+		{msg: "errors if the revision is negative", cmd: map[string]interface{}{revisionKey: -1.0}, err: errRevisionNotAnInteger},
+		{msg: "errors if the epoch is not a string", cmd: map[string]interface{}{epochKey: 1.0}, err: errEpochNotAString},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			_, _, err := ParseRequest(tc.cmd)
+			test.That(t, err, test.ShouldBeError, tc.err)
+		})
+	}
+
+	t.Run("parses a request built by Request", func(t *testing.T) {
+		revision, epoch, err := ParseRequest(Request(3, "abc")[Command])
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, revision, test.ShouldEqual, 3)
+		test.That(t, epoch, test.ShouldEqual, "abc")
+	})
+
+	t.Run("requests a full update without arguments", func(t *testing.T) {
+		revision, epoch, err := ParseRequest(map[string]interface{}{})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, revision, test.ShouldEqual, 0)
+		test.That(t, epoch, test.ShouldBeEmpty)
+	})
+}
+
+func TestParseUpdate(t *testing.T) {
+	t.Run("parses the response of an update", func(t *testing.T) {
+		update := Update{
+			Epoch:    "abc",
+			Since:    1,
+			Revision: 3,
+			Submaps:  []Submap{{ID: second, PointCloud: []byte("b")}},
+			Removed:  []SubmapID{first},
+		}
+		parsed, err := ParseUpdate(update.Response())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, parsed, test.ShouldResemble, update)
+	})
+
+	t.Run("errors if the response is malformed", func(t *testing.T) {
+		_, err := ParseUpdate("hello")
+		test.That(t, err, test.ShouldBeError, errUpdateNotAMap)
+
+		resp := Update{Epoch: "abc", Submaps: []Submap{{ID: first}}}.Response()
+		resp[submapsKey].([]interface{})[0].(map[string]interface{})[pcdKey] = "not base64!"
+		_, err = ParseUpdate(resp)
+		test.That(t, err, test.ShouldBeError, errPCDNotBase64)
+
+		resp = Update{Epoch: "abc"}.Response()
+		resp[removedKey] = []interface{}{map[string]interface{}{trajectoryIDKey: 0.0}}
+		_, err = ParseUpdate(resp)
+		test.That(t, err, test.ShouldBeError, errSubmapIDNotAnInteger)
+	})
+}
+
+func TestMap(t *testing.T) {
+	t.Run("patches the map with the updates of a tracker", func(t *testing.T) {
+		tracker := NewTracker()
+		m := NewMap()
+		apply := func() {
+			revision, epoch, err := ParseRequest(m.Request()[Command])
+			test.That(t, err, test.ShouldBeNil)
+			update, err := ParseUpdate(tracker.Since(revision, epoch).Response())
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, m.Apply(update), test.ShouldBeNil)
+		}
+
+		tracker.Update([]Submap{{ID: first, PointCloud: testPCD(t, 50, 1, 2)}, {ID: second, PointCloud: testPCD(t, 50, 3)}})
+		apply()
+		test.That(t, m.Revision(), test.ShouldEqual, 1)
+
+		tracker.Update([]Submap{{ID: second}, {ID: third, PointCloud: testPCD(t, 50, 4)}})
+		apply()
+		test.That(t, m.Revision(), test.ShouldEqual, 2)
+
+		pcd, err := m.PCD()
+		test.That(t, err, test.ShouldBeNil)
+		pc, err := pointcloud.ReadPCD(bytes.NewReader(pcd))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pc.Size(), test.ShouldEqual, 2)
+		_, ok := pc.At(1, 0, 0)
+		test.That(t, ok, test.ShouldBeFalse)
+		_, ok = pc.At(4, 0, 0)
+		test.That(t, ok, test.ShouldBeTrue)
+	})
+
+	t.Run("keeps the more confident point where submaps overlap", func(t *testing.T) {
+		m := NewMap()
+		test.That(t, m.Apply(Update{
+			Epoch:    "abc",
+			Revision: 1,
+			Submaps: []Submap{
+				{ID: first, PointCloud: testPCD(t, 90, 1)},
+				{ID: second, PointCloud: testPCD(t, 40, 1, 2)},
+			},
+		}), test.ShouldBeNil)
+
+		pcd, err := m.PCD()
+		test.That(t, err, test.ShouldBeNil)
+		pc, err := pointcloud.ReadPCD(bytes.NewReader(pcd))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pc.Size(), test.ShouldEqual, 2)
+		d, ok := pc.At(1, 0, 0)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, confidence(d), test.ShouldEqual, 90)
+	})
+
+	t.Run("rejects updates of another revision or epoch", func(t *testing.T) {
+		m := NewMap()
+		test.That(t, m.Apply(Update{Epoch: "abc", Revision: 2}), test.ShouldBeNil)
+		test.That(t, m.Apply(Update{Epoch: "abc", Since: 1, Revision: 3}), test.ShouldBeError, ErrUpdateNotApplicable)
+		test.That(t, m.Apply(Update{Epoch: "def", Since: 2, Revision: 3}), test.ShouldBeError, ErrUpdateNotApplicable)
+		test.That(t, m.Apply(Update{Epoch: "abc", Since: 2, Revision: 3}), test.ShouldBeNil)
+		test.That(t, m.Revision(), test.ShouldEqual, 3)
+	})
+}
@@ -0,0 +1,68 @@
+package sensorprocess
+
+import (
+	"context"
+	"sync"
+)
+
+// IngestGate pauses and resumes adding sensor readings to the cartofacade without stopping the sensor
+// processes. It is safe for concurrent use, and a nil IngestGate never pauses.
+type IngestGate struct {
+	mu sync.Mutex
+	// resumed is open while ingestion is paused and closed once it is resumed, or nil if it is not paused.
+	resumed chan struct{}
+}
+
+// NewIngestGate returns a new IngestGate which is not paused.
+func NewIngestGate() *IngestGate {
+	return &IngestGate{}
+}
+
+// Pause pauses ingestion. Readings which are currently being added are still added.
+func (gate *IngestGate) Pause() {
+	gate.mu.Lock()
+	defer gate.mu.Unlock()
+	if gate.resumed == nil {
+		gate.resumed = make(chan struct{})
+	}
+}
+
+// Resume resumes a paused ingestion.
+func (gate *IngestGate) Resume() {
+	gate.mu.Lock()
+	defer gate.mu.Unlock()
+	if gate.resumed != nil {
+		close(gate.resumed)
+		gate.resumed = nil
+	}
+}
+
+// Paused returns whether ingestion is paused.
+func (gate *IngestGate) Paused() bool {
+	if gate == nil {
+		return false
+	}
+	gate.mu.Lock()
+	defer gate.mu.Unlock()
+	return gate.resumed != nil
+}
+
+// wait blocks while ingestion is paused. Returns whether it was paused, or the context error if the
+// context is done before ingestion is resumed.
+func (gate *IngestGate) wait(ctx context.Context) (bool, error) {
+	if gate == nil {
+		return false, nil
+	}
+	gate.mu.Lock()
+	resumed := gate.resumed
+	gate.mu.Unlock()
+	if resumed == nil {
+		return false, nil
+	}
+	select {
+	case <-ctx.Done():
+		return true, ctx.Err()
+	case <-resumed:
+		return true, nil
+	}
+}
@@ -0,0 +1,63 @@
+package sensorprocess
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestIngestGate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("a nil gate never pauses", func(t *testing.T) {
+		var gate *IngestGate
+		test.That(t, gate.Paused(), test.ShouldBeFalse)
+		paused, err := gate.wait(ctx)
+		test.That(t, paused, test.ShouldBeFalse)
+		test.That(t, err, test.ShouldBeNil)
+	})
+
+	t.Run("does not block while not paused", func(t *testing.T) {
+		gate := NewIngestGate()
+		gate.Resume()
+		test.That(t, gate.Paused(), test.ShouldBeFalse)
+		paused, err := gate.wait(ctx)
+		test.That(t, paused, test.ShouldBeFalse)
+		test.That(t, err, test.ShouldBeNil)
+	})
+
+	t.Run("blocks while paused until resumed", func(t *testing.T) {
+		gate := NewIngestGate()
+		gate.Pause()
+		gate.Pause()
+		test.That(t, gate.Paused(), test.ShouldBeTrue)
+
+		done := make(chan bool)
+		go func() {
+			paused, err := gate.wait(ctx)
+			test.That(t, err, test.ShouldBeNil)
+			done <- paused
+		}()
+		select {
+		case <-done:
+			t.Fatal("wait returned while paused")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		gate.Resume()
+		test.That(t, <-done, test.ShouldBeTrue)
+		test.That(t, gate.Paused(), test.ShouldBeFalse)
+	})
+
+	t.Run("returns the context error if the context is done while paused", func(t *testing.T) {
+		gate := NewIngestGate()
+		gate.Pause()
+		cancelCtx, cancelFunc := context.WithCancel(ctx)
+		cancelFunc()
+		paused, err := gate.wait(cancelCtx)
+		test.That(t, paused, test.ShouldBeTrue)
+		test.That(t, err, test.ShouldEqual, context.Canceled)
+	})
+}
@@ -0,0 +1,356 @@
+package sensorprocess
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.viam.com/utils/perf/statz"
+	"go.viam.com/utils/perf/statz/units"
+
+	"github.com/viamrobotics/viam-cartographer/cartofacade"
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+)
+
+// DefaultIngestQueueCapacity is the default number of readings the ingest queue holds.
+const DefaultIngestQueueCapacity = 50
+
+// dropWarningInterval is how often dropped readings are logged as a warning, with the number of readings
+// dropped since the last warning.
+const dropWarningInterval = 10 * time.Second
+
+// ErrIngestQueueFull denotes that a reading was dropped because the ingest queue was full.
+var ErrIngestQueueFull = errors.New("ingest queue is full")
+
+var ingestReadings = statz.NewCounter2[string, string]("viamcartographer/ingest_readings", statz.MetricConfig{
+	Description: "The number of sensor readings queued, dropped and inserted into cartographer",
+	Unit:        units.Dimensionless,
+	Labels: []statz.Label{
+		{Name: "sensor", Description: "The sensor type (lidar|movement_sensor)."},
+		{Name: "event", Description: "What happened to the reading (queued|dropped|inserted)."},
+	},
+})
+
+// DropPolicy decides which reading is dropped when the ingest queue is full.
+type DropPolicy string
+
+const (
+	// DropPolicyOldest drops the queued reading with the earliest reading time to make room for the new one.
+	DropPolicyOldest DropPolicy = "oldest"
+	// DropPolicyNewest drops the new reading.
+	DropPolicyNewest DropPolicy = "newest"
+	// DropPolicyNever blocks the sensor process until there is room for the new reading.
+	DropPolicyNever DropPolicy = "never"
+)
+
+// IngestQueueConfig configures the ingest queue.
+type IngestQueueConfig struct {
+	// Capacity is the number of readings the queue holds. Zero uses the default.
+	Capacity int
+	// DropPolicy decides which reading is dropped when the queue is full. Empty uses DropPolicyOldest.
+	DropPolicy DropPolicy
+	// ReorderWindow holds every reading in the queue for at least this long, so that readings which arrive
+	// late are still added in reading time order. Zero adds readings as soon as they are queued.
+	ReorderWindow time.Duration
+}
+
+// IngestCounts counts what happened to the readings of a sensor.
+type IngestCounts struct {
+	Queued   uint64
+	Dropped  uint64
+	Inserted uint64
+}
+
+// IngestQueueStats is a snapshot of the counters of the ingest queue.
+type IngestQueueStats struct {
+	Length         int
+	Lidar          IngestCounts
+	MovementSensor IngestCounts
+}
+
+// queuedReading is a lidar or movement sensor reading waiting to be added to the cartofacade.
+type queuedReading struct {
+	sensorType     sensorType
+	readingTime    time.Time
+	lidar          s.TimedLidarReadingResponse
+	movementSensor s.TimedMovementSensorReadingResponse
+	// neutral is set for neutral movement sensor readings added while the movement sensor is out, which are
+	// not recorded
+	neutral bool
+}
+
+// heldReading is a reading in the ingest queue together with the time it was queued.
+type heldReading struct {
+	queuedReading
+	queuedAt time.Time
+}
+
+// IngestQueue is a bounded queue of sensor readings ordered by reading time, which decouples polling
+// the sensors from adding their readings to the cartofacade in online mode.
+type IngestQueue struct {
+	config IngestQueueConfig
+
+	mu       sync.Mutex
+	readings []heldReading
+	// changed is closed and replaced whenever readings are queued or removed
+	changed              chan struct{}
+	lidarCounts          IngestCounts
+	movementSensorCounts IngestCounts
+	// droppedSinceWarning counts the readings dropped since lastDropWarning
+	droppedSinceWarning int
+	lastDropWarning     time.Time
+}
+
+// NewIngestQueue returns a new, empty IngestQueue.
+func NewIngestQueue(config IngestQueueConfig) *IngestQueue {
+	if config.Capacity <= 0 {
+		config.Capacity = DefaultIngestQueueCapacity
+	}
+	if config.DropPolicy == "" {
+		config.DropPolicy = DropPolicyOldest
+	}
+	return &IngestQueue{config: config, changed: make(chan struct{})}
+}
+
+// Stats returns the current length and counters of the queue.
+func (q *IngestQueue) Stats() IngestQueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return IngestQueueStats{
+		Length:         len(q.readings),
+		Lidar:          q.lidarCounts,
+		MovementSensor: q.movementSensorCounts,
+	}
+}
+
+// push queues a reading in reading time order. If the queue is full the drop policy decides which reading
+// is dropped, and that reading is returned. With DropPolicyNever it blocks until there is room or the
+// context is done.
+func (q *IngestQueue) push(ctx context.Context, reading queuedReading) (*queuedReading, error) {
+	q.mu.Lock()
+	for len(q.readings) >= q.config.Capacity && q.config.DropPolicy == DropPolicyNever {
+		changed := q.changed
+		q.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+		q.mu.Lock()
+	}
+	defer q.mu.Unlock()
+
+	var dropped *queuedReading
+	if len(q.readings) >= q.config.Capacity {
+		if q.config.DropPolicy == DropPolicyNewest {
+			q.countDropped(reading)
+			return &reading, nil
+		}
+		oldest := q.readings[0].queuedReading
+		q.readings = q.readings[1:]
+		q.countDropped(oldest)
+		dropped = &oldest
+	}
+
+	// readings with the same time keep the order they were queued in
+	i := sort.Search(len(q.readings), func(i int) bool {
+		return q.readings[i].readingTime.After(reading.readingTime)
+	})
+	q.readings = append(q.readings, heldReading{})
+	copy(q.readings[i+1:], q.readings[i:])
+	q.readings[i] = heldReading{queuedReading: reading, queuedAt: time.Now()}
+	q.counts(reading.sensorType).Queued++
+	ingestReadings.Inc(reading.sensorType.String(), "queued")
+	q.notify()
+	return dropped, nil
+}
+
+// countDropForWarning counts a dropped reading and returns the number of readings dropped since the last
+// warning once dropWarningInterval passed since it, or zero if it is not time to warn yet.
+func (q *IngestQueue) countDropForWarning(now time.Time) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.droppedSinceWarning++
+	if !q.lastDropWarning.IsZero() && now.Sub(q.lastDropWarning) < dropWarningInterval {
+		return 0
+	}
+	dropped := q.droppedSinceWarning
+	q.droppedSinceWarning = 0
+	q.lastDropWarning = now
+	return dropped
+}
+
+// pop removes and returns the reading with the earliest reading time once it was held for the reorder
+// window. Blocks until such a reading is queued or the context is done.
+func (q *IngestQueue) pop(ctx context.Context) (queuedReading, error) {
+	q.mu.Lock()
+	for len(q.readings) == 0 || time.Since(q.readings[0].queuedAt) < q.config.ReorderWindow {
+		changed := q.changed
+		// wake up once the earliest reading was held for the reorder window
+		var held <-chan time.Time
+		if len(q.readings) > 0 {
+			held = time.After(q.config.ReorderWindow - time.Since(q.readings[0].queuedAt))
+		}
+		q.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return queuedReading{}, ctx.Err()
+		case <-changed:
+		case <-held:
+		}
+		q.mu.Lock()
+	}
+	defer q.mu.Unlock()
+
+	reading := q.readings[0].queuedReading
+	q.readings = q.readings[1:]
+	q.notify()
+	return reading, nil
+}
+
+// done counts a popped reading as inserted, or as dropped if it could not be added to the cartofacade.
+func (q *IngestQueue) done(reading queuedReading, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err != nil {
+		q.countDropped(reading)
+		return
+	}
+	q.counts(reading.sensorType).Inserted++
+	ingestReadings.Inc(reading.sensorType.String(), "inserted")
+}
+
+func (q *IngestQueue) countDropped(reading queuedReading) {
+	q.counts(reading.sensorType).Dropped++
+	ingestReadings.Inc(reading.sensorType.String(), "dropped")
+}
+
+func (q *IngestQueue) counts(sensorType sensorType) *IngestCounts {
+	if sensorType == lidar {
+		return &q.lidarCounts
+	}
+	return &q.movementSensorCounts
+}
+
+func (q *IngestQueue) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// StartIngest adds the readings of the ingest queue to the cartofacade in reading time order. Readings
+// are retried while the cartofacade is locked, so lock contention fills the queue instead of dropping
+// readings. Stops when the context is Done.
+func (config *Config) StartIngest(ctx context.Context) {
+	for {
+		reading, err := config.IngestQueue.pop(ctx)
+		if err != nil {
+			return
+		}
+		config.IngestQueue.done(reading, config.insertQueuedReading(ctx, reading))
+	}
+}
+
+// insertQueuedReading adds a queued reading to the cartofacade and records it.
+func (config *Config) insertQueuedReading(ctx context.Context, reading queuedReading) error {
+	if reading.sensorType == lidar {
+		if err := config.validateLidarReadingTime(reading.lidar); err != nil {
+			config.recordLidarReading(reading.lidar, err)
+			return err
+		}
+		err := config.retryWhileLocked(ctx, func() error {
+			return config.tryAddLidarReading(ctx, reading.lidar)
+		})
+		if err != nil && ctx.Err() == nil {
+			config.Logger.Warnw("Skipping lidar reading due to "+addErrorReason(err), "error", err)
+		}
+		config.recordLidarReading(reading.lidar, err)
+		return err
+	}
+
+	if err := config.validateMovementSensorReadingTime(reading.movementSensor); err != nil {
+		if !reading.neutral {
+			config.recordMovementSensorReading(reading.movementSensor, err, err)
+		}
+		return err
+	}
+	var imuErr, odometerErr error
+	// neutral readings carry no odometer reading
+	if config.MovementSensor.Properties().OdometerSupported && reading.movementSensor.TimedOdometerResponse != nil {
+		odometerErr = config.retryWhileLocked(ctx, func() error {
+			return config.tryAddOdometerReading(ctx, *reading.movementSensor.TimedOdometerResponse)
+		})
+		if odometerErr != nil && ctx.Err() == nil {
+			config.Logger.Warnw("Skipping odometer sensor reading due to "+addErrorReason(odometerErr), "error", odometerErr)
+		}
+	}
+	if config.MovementSensor.Properties().IMUSupported {
+		imuErr = config.retryWhileLocked(ctx, func() error {
+			return config.tryAddIMUReading(ctx, *reading.movementSensor.TimedIMUResponse)
+		})
+		if imuErr != nil && ctx.Err() == nil {
+			config.Logger.Warnw("Skipping IMU sensor reading due to "+addErrorReason(imuErr), "error", imuErr)
+		}
+	}
+	if !reading.neutral {
+		config.recordMovementSensorReading(reading.movementSensor, imuErr, odometerErr)
+	}
+	if odometerErr != nil {
+		return odometerErr
+	}
+	return imuErr
+}
+
+// retryWhileLocked calls add until it returns an error other than lock contention in the cartofacade,
+// or the context is done.
+func (config *Config) retryWhileLocked(ctx context.Context, add func() error) error {
+	var backoff retryBackoff
+	for {
+		err := add()
+		if !cartofacade.IsRetryable(err) {
+			return err
+		}
+		backoff.sleep(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// queueLidarReading queues a lidar reading to be added to the cartofacade.
+func (config *Config) queueLidarReading(ctx context.Context, reading s.TimedLidarReadingResponse) {
+	config.queueReading(ctx, queuedReading{sensorType: lidar, readingTime: reading.ReadingTime, lidar: reading})
+}
+
+// queueMovementSensorReading queues a movement sensor reading to be added to the cartofacade.
+func (config *Config) queueMovementSensorReading(ctx context.Context, reading s.TimedMovementSensorReadingResponse) {
+	// order by the IMU time if it is supported, like the offline sensor process does
+	var readingTime time.Time
+	if config.MovementSensor.Properties().IMUSupported {
+		readingTime = reading.TimedIMUResponse.ReadingTime
+	} else {
+		readingTime = reading.TimedOdometerResponse.ReadingTime
+	}
+	config.queueReading(ctx, queuedReading{sensorType: movementSensor, readingTime: readingTime, movementSensor: reading})
+}
+
+// queueReading queues a reading and records the reading the drop policy dropped, if any. Dropped readings
+// are logged as a warning at most once per dropWarningInterval.
+func (config *Config) queueReading(ctx context.Context, reading queuedReading) {
+	dropped, err := config.IngestQueue.push(ctx, reading)
+	if err != nil || dropped == nil || dropped.neutral {
+		return
+	}
+	config.Logger.Debugw("Dropping sensor reading", "sensor", dropped.sensorType.String(),
+		"reading_time", dropped.readingTime, "error", ErrIngestQueueFull)
+	if count := config.IngestQueue.countDropForWarning(time.Now()); count > 0 {
+		config.Logger.Warnw("Dropped sensor readings since the last warning, as cartographer cannot keep up",
+			"dropped", count, "drop_policy", config.IngestQueue.config.DropPolicy, "error", ErrIngestQueueFull)
+	}
+	if dropped.sensorType == lidar {
+		config.recordLidarReading(dropped.lidar, ErrIngestQueueFull)
+	} else {
+		config.recordMovementSensorReading(dropped.movementSensor, ErrIngestQueueFull, ErrIngestQueueFull)
+	}
+}
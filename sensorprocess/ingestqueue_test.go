@@ -0,0 +1,213 @@
+package sensorprocess
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viamrobotics/viam-cartographer/cartofacade"
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+	"github.com/viamrobotics/viam-cartographer/sensors/inject"
+)
+
+func TestIngestQueue(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now().UTC()
+
+	lidarReading := func(offset time.Duration) queuedReading {
+		return queuedReading{sensorType: lidar, readingTime: start.Add(offset)}
+	}
+	movementSensorReading := func(offset time.Duration) queuedReading {
+		return queuedReading{sensorType: movementSensor, readingTime: start.Add(offset)}
+	}
+
+	t.Run("returns the readings in reading time order", func(t *testing.T) {
+		q := NewIngestQueue(IngestQueueConfig{})
+		for _, reading := range []queuedReading{
+			lidarReading(200 * time.Millisecond),
+			movementSensorReading(100 * time.Millisecond),
+			lidarReading(0),
+		} {
+			dropped, err := q.push(ctx, reading)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, dropped, test.ShouldBeNil)
+		}
+		test.That(t, q.Stats(), test.ShouldResemble, IngestQueueStats{
+			Length:         3,
+			Lidar:          IngestCounts{Queued: 2},
+			MovementSensor: IngestCounts{Queued: 1},
+		})
+
+		for _, expected := range []queuedReading{
+			lidarReading(0),
+			movementSensorReading(100 * time.Millisecond),
+			lidarReading(200 * time.Millisecond),
+		} {
+			reading, err := q.pop(ctx)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, reading, test.ShouldResemble, expected)
+		}
+		test.That(t, q.Stats().Length, test.ShouldEqual, 0)
+	})
+
+	t.Run("drops the oldest reading when full", func(t *testing.T) {
+		q := NewIngestQueue(IngestQueueConfig{Capacity: 2, DropPolicy: DropPolicyOldest})
+		_, err := q.push(ctx, lidarReading(0))
+		test.That(t, err, test.ShouldBeNil)
+		_, err = q.push(ctx, movementSensorReading(100*time.Millisecond))
+		test.That(t, err, test.ShouldBeNil)
+
+		dropped, err := q.push(ctx, movementSensorReading(200*time.Millisecond))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, *dropped, test.ShouldResemble, lidarReading(0))
+		test.That(t, q.Stats(), test.ShouldResemble, IngestQueueStats{
+			Length:         2,
+			Lidar:          IngestCounts{Queued: 1, Dropped: 1},
+			MovementSensor: IngestCounts{Queued: 2},
+		})
+	})
+
+	t.Run("drops the newest reading when full", func(t *testing.T) {
+		q := NewIngestQueue(IngestQueueConfig{Capacity: 1, DropPolicy: DropPolicyNewest})
+		_, err := q.push(ctx, lidarReading(0))
+		test.That(t, err, test.ShouldBeNil)
+
+		dropped, err := q.push(ctx, lidarReading(100*time.Millisecond))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, *dropped, test.ShouldResemble, lidarReading(100*time.Millisecond))
+		test.That(t, q.Stats().Lidar, test.ShouldResemble, IngestCounts{Queued: 1, Dropped: 1})
+
+		reading, err := q.pop(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading, test.ShouldResemble, lidarReading(0))
+	})
+
+	t.Run("blocks until there is room when never dropping", func(t *testing.T) {
+		q := NewIngestQueue(IngestQueueConfig{Capacity: 1, DropPolicy: DropPolicyNever})
+		_, err := q.push(ctx, lidarReading(0))
+		test.That(t, err, test.ShouldBeNil)
+
+		cancelCtx, cancelFunc := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancelFunc()
+		_, err = q.push(cancelCtx, lidarReading(100*time.Millisecond))
+		test.That(t, err, test.ShouldEqual, context.DeadlineExceeded)
+
+		pushed := make(chan error)
+		go func() {
+			_, err := q.push(ctx, lidarReading(200*time.Millisecond))
+			pushed <- err
+		}()
+		reading, err := q.pop(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading, test.ShouldResemble, lidarReading(0))
+		test.That(t, <-pushed, test.ShouldBeNil)
+		test.That(t, q.Stats().Lidar, test.ShouldResemble, IngestCounts{Queued: 2})
+	})
+
+	t.Run("holds readings for the reorder window so that late readings are added in order", func(t *testing.T) {
+		q := NewIngestQueue(IngestQueueConfig{ReorderWindow: 50 * time.Millisecond})
+		_, err := q.push(ctx, lidarReading(100*time.Millisecond))
+		test.That(t, err, test.ShouldBeNil)
+
+		cancelCtx, cancelFunc := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancelFunc()
+		_, err = q.pop(cancelCtx)
+		test.That(t, err, test.ShouldEqual, context.DeadlineExceeded)
+
+		// arrives late, but within the window
+		_, err = q.push(ctx, movementSensorReading(0))
+		test.That(t, err, test.ShouldBeNil)
+		for _, expected := range []queuedReading{movementSensorReading(0), lidarReading(100 * time.Millisecond)} {
+			reading, err := q.pop(ctx)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, reading, test.ShouldResemble, expected)
+		}
+	})
+
+	t.Run("warns about dropped readings at most once per interval", func(t *testing.T) {
+		q := NewIngestQueue(IngestQueueConfig{})
+		start := time.Now()
+		test.That(t, q.countDropForWarning(start), test.ShouldEqual, 1)
+		test.That(t, q.countDropForWarning(start.Add(time.Second)), test.ShouldEqual, 0)
+		test.That(t, q.countDropForWarning(start.Add(2*time.Second)), test.ShouldEqual, 0)
+		test.That(t, q.countDropForWarning(start.Add(dropWarningInterval)), test.ShouldEqual, 3)
+		test.That(t, q.countDropForWarning(start.Add(dropWarningInterval+time.Second)), test.ShouldEqual, 0)
+	})
+
+	t.Run("returns the context error when popping from an empty queue", func(t *testing.T) {
+		q := NewIngestQueue(IngestQueueConfig{})
+		cancelCtx, cancelFunc := context.WithCancel(ctx)
+		cancelFunc()
+		_, err := q.pop(cancelCtx)
+		test.That(t, err, test.ShouldEqual, context.Canceled)
+	})
+}
+
+func TestStartIngest(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	start := time.Now().UTC()
+
+	injectLidar := inject.TimedLidar{}
+	injectLidar.NameFunc = func() string { return "good_lidar" }
+	injectLidar.DataFrequencyHzFunc = func() float64 { return 5 }
+
+	t.Run("retries readings while the cartofacade is locked and drops them on other errors", func(t *testing.T) {
+		var mu sync.Mutex
+		var attempts int
+		var added []time.Time
+		cf := cartofacade.Mock{}
+		cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration, lidarName string,
+			currentReading s.TimedLidarReadingResponse,
+		) error {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts++
+			switch {
+			case attempts <= 2:
+				return cartofacade.ErrUnableToAcquireLock
+			case currentReading.ReadingTime.Equal(start.Add(time.Second)):
+				return errUnknown
+			default:
+				added = append(added, currentReading.ReadingTime)
+				return nil
+			}
+		}
+
+		config := Config{
+			Logger:      logger,
+			CartoFacade: &cf,
+			IsOnline:    true,
+			Lidar:       &injectLidar,
+			IngestQueue: NewIngestQueue(IngestQueueConfig{}),
+			Timeout:     10 * time.Second,
+		}
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		defer cancelFunc()
+
+		for _, offset := range []time.Duration{2 * time.Second, time.Second, 0} {
+			config.queueLidarReading(ctx, s.TimedLidarReadingResponse{ReadingTime: start.Add(offset)})
+		}
+
+		done := make(chan struct{})
+		go func() {
+			config.StartIngest(ctx)
+			close(done)
+		}()
+		for config.IngestQueue.Stats().Lidar.Inserted+config.IngestQueue.Stats().Lidar.Dropped < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		cancelFunc()
+		<-done
+
+		test.That(t, config.IngestQueue.Stats(), test.ShouldResemble, IngestQueueStats{
+			Lidar: IngestCounts{Queued: 3, Dropped: 1, Inserted: 2},
+		})
+		mu.Lock()
+		defer mu.Unlock()
+		test.That(t, added, test.ShouldResemble, []time.Time{start, start.Add(2 * time.Second)})
+	})
+}
@@ -0,0 +1,194 @@
+package sensorprocess
+
+import (
+	"sync"
+	"time"
+
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+)
+
+// JobPhase is the phase an offline job is in.
+type JobPhase string
+
+const (
+	// JobPhaseIngest is the phase in which the sensor readings are added to cartographer.
+	JobPhaseIngest JobPhase = "ingest"
+	// JobPhaseFinalOptimization is the phase in which the final optimization runs after all readings were added.
+	JobPhaseFinalOptimization JobPhase = "final_optimization"
+	// JobPhaseDone is the phase of a job that finished.
+	JobPhaseDone JobPhase = "done"
+	// JobPhaseFailed is the phase of a job that was ended by an error.
+	JobPhaseFailed JobPhase = "failed"
+	// JobPhaseCancelled is the phase of a job that was cancelled before it finished.
+	JobPhaseCancelled JobPhase = "cancelled"
+)
+
+// JobStatus is a snapshot of the progress of an offline job.
+type JobStatus struct {
+	Phase                           JobPhase
+	LidarReadingsProcessed          uint64
+	MovementSensorReadingsProcessed uint64
+	// DatasetTimeCovered is the time from the first to the latest processed reading of the dataset.
+	DatasetTimeCovered time.Duration
+	// DatasetTimeTotal is the time span of the whole dataset, or zero if it is not known.
+	DatasetTimeTotal time.Duration
+	// Elapsed is the wall-clock time since the job started.
+	Elapsed time.Duration
+	// ReadingsPerSecond is the number of processed readings per wall-clock second.
+	ReadingsPerSecond float64
+	// ETA is the estimated wall-clock time until all readings are processed, or zero if it is not known.
+	ETA time.Duration
+	// SkippedFiles is the number of dataset files skipped so far because they cannot be read.
+	SkippedFiles uint64
+	// Err is the error that ended the job, if any.
+	Err error
+}
+
+// JobProgress tracks the progress of an offline job. It is safe for concurrent use, and a nil JobProgress
+// tracks nothing.
+type JobProgress struct {
+	mu                     sync.Mutex
+	phase                  JobPhase
+	startTime              time.Time
+	datasetStart           time.Time
+	datasetEnd             time.Time
+	latestReadingTime      time.Time
+	lidarReadings          uint64
+	movementSensorReadings uint64
+	skippedFileCounters    []s.SkippedFileCounter
+	err                    error
+}
+
+// NewJobProgress returns a new JobProgress of a job in the ingest phase.
+func NewJobProgress() *JobProgress {
+	return &JobProgress{phase: JobPhaseIngest, startTime: time.Now()}
+}
+
+// Status returns the current status of the job.
+func (p *JobProgress) Status() JobStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := JobStatus{
+		Phase:                           p.phase,
+		LidarReadingsProcessed:          p.lidarReadings,
+		MovementSensorReadingsProcessed: p.movementSensorReadings,
+		Elapsed:                         time.Since(p.startTime),
+		Err:                             p.err,
+	}
+	for _, counter := range p.skippedFileCounters {
+		status.SkippedFiles += counter.SkippedFiles()
+	}
+	if !p.datasetStart.IsZero() && !p.latestReadingTime.IsZero() {
+		status.DatasetTimeCovered = p.latestReadingTime.Sub(p.datasetStart)
+	}
+	if !p.datasetStart.IsZero() && !p.datasetEnd.IsZero() {
+		status.DatasetTimeTotal = p.datasetEnd.Sub(p.datasetStart)
+	}
+	if seconds := status.Elapsed.Seconds(); seconds > 0 {
+		status.ReadingsPerSecond = float64(p.lidarReadings+p.movementSensorReadings) / seconds
+	}
+	// the remaining dataset time is assumed to be processed at the same rate as the covered dataset time
+	if p.phase == JobPhaseIngest && status.DatasetTimeCovered > 0 && status.DatasetTimeTotal > status.DatasetTimeCovered {
+		remaining := float64(status.DatasetTimeTotal-status.DatasetTimeCovered) / float64(status.DatasetTimeCovered)
+		status.ETA = time.Duration(remaining * float64(status.Elapsed))
+	}
+	return status
+}
+
+// setDataset sets the time span of the dataset from the first reading and, if the lidar knows it, the
+// end of its dataset. The files skipped by the sensors are counted from then on.
+func (p *JobProgress) setDataset(firstReadingTime time.Time, lidar s.TimedLidar, movementSensor s.TimedMovementSensor) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.datasetStart = firstReadingTime
+	if spanner, ok := lidar.(s.DatasetTimeSpanner); ok {
+		_, p.datasetEnd = spanner.DatasetTimeSpan()
+	}
+	p.skippedFileCounters = nil
+	for _, sensor := range []interface{}{lidar, movementSensor} {
+		if counter, ok := sensor.(s.SkippedFileCounter); ok {
+			p.skippedFileCounters = append(p.skippedFileCounters, counter)
+		}
+	}
+}
+
+// addLidarReading counts a lidar reading that was added to cartographer.
+func (p *JobProgress) addLidarReading(readingTime time.Time) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lidarReadings++
+	p.updateLatestReadingTime(readingTime)
+}
+
+// skipLidarReading covers the time of a lidar reading that was skipped without adding it to cartographer.
+func (p *JobProgress) skipLidarReading(readingTime time.Time) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.updateLatestReadingTime(readingTime)
+}
+
+// addMovementSensorReading counts a movement sensor reading that was added to cartographer.
+func (p *JobProgress) addMovementSensorReading(readingTime time.Time) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.movementSensorReadings++
+	p.updateLatestReadingTime(readingTime)
+}
+
+func (p *JobProgress) updateLatestReadingTime(readingTime time.Time) {
+	if readingTime.After(p.latestReadingTime) {
+		p.latestReadingTime = readingTime
+	}
+}
+
+// Cancel marks a running job as cancelled. Returns false if the job already ended.
+func (p *JobProgress) Cancel() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ended() {
+		return false
+	}
+	p.phase = JobPhaseCancelled
+	return true
+}
+
+// setPhase moves the job to the given phase, unless it already failed or was cancelled.
+func (p *JobProgress) setPhase(phase JobPhase) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.phase != JobPhaseFailed && p.phase != JobPhaseCancelled {
+		p.phase = phase
+	}
+}
+
+// fail records the error that ended the job, unless it was cancelled.
+func (p *JobProgress) fail(err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.phase != JobPhaseCancelled {
+		p.phase = JobPhaseFailed
+		p.err = err
+	}
+}
+
+func (p *JobProgress) ended() bool {
+	return p.phase == JobPhaseDone || p.phase == JobPhaseFailed || p.phase == JobPhaseCancelled
+}
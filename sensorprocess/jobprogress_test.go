@@ -0,0 +1,117 @@
+package sensorprocess
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+
+	"github.com/viamrobotics/viam-cartographer/sensors/inject"
+)
+
+// datasetLidar is a lidar replaying a dataset with a known time span.
+type datasetLidar struct {
+	inject.TimedLidar
+	start, end time.Time
+}
+
+func (lidar *datasetLidar) DatasetTimeSpan() (time.Time, time.Time) {
+	return lidar.start, lidar.end
+}
+
+// skippingMovementSensor is a movement sensor replaying a dataset which skipped unreadable files.
+type skippingMovementSensor struct {
+	inject.TimedMovementSensor
+	skipped uint64
+}
+
+func (ms *skippingMovementSensor) SkippedFiles() uint64 {
+	return ms.skipped
+}
+
+func TestJobProgress(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("a nil progress tracks nothing", func(t *testing.T) {
+		var progress *JobProgress
+		progress.setDataset(start, &inject.TimedLidar{}, nil)
+		progress.addLidarReading(start)
+		progress.addMovementSensorReading(start)
+		progress.setPhase(JobPhaseDone)
+		progress.fail(errUnknown)
+	})
+
+	t.Run("reports the dataset time covered and an ETA once the dataset span is known", func(t *testing.T) {
+		progress := NewJobProgress()
+		progress.setDataset(start, &datasetLidar{start: start, end: start.Add(100 * time.Second)}, nil)
+		progress.addLidarReading(start)
+		progress.addMovementSensorReading(start.Add(25 * time.Second))
+		progress.addLidarReading(start.Add(20 * time.Second))
+
+		status := progress.Status()
+		test.That(t, status.Phase, test.ShouldEqual, JobPhaseIngest)
+		test.That(t, status.LidarReadingsProcessed, test.ShouldEqual, 2)
+		test.That(t, status.MovementSensorReadingsProcessed, test.ShouldEqual, 1)
+		test.That(t, status.DatasetTimeCovered, test.ShouldEqual, 25*time.Second)
+		test.That(t, status.DatasetTimeTotal, test.ShouldEqual, 100*time.Second)
+		test.That(t, status.ReadingsPerSecond, test.ShouldBeGreaterThan, 0)
+		// three quarters of the dataset remain, which take three times as long as the first quarter
+		test.That(t, status.ETA, test.ShouldBeGreaterThanOrEqualTo, 3*status.Elapsed)
+		test.That(t, status.Err, test.ShouldBeNil)
+
+		progress.setPhase(JobPhaseFinalOptimization)
+		status = progress.Status()
+		test.That(t, status.Phase, test.ShouldEqual, JobPhaseFinalOptimization)
+		test.That(t, status.ETA, test.ShouldEqual, 0)
+	})
+
+	t.Run("the total dataset time is unknown for sensors without a known span", func(t *testing.T) {
+		progress := NewJobProgress()
+		progress.setDataset(start, &inject.TimedLidar{}, nil)
+		progress.addLidarReading(start.Add(time.Second))
+
+		status := progress.Status()
+		test.That(t, status.DatasetTimeCovered, test.ShouldEqual, time.Second)
+		test.That(t, status.DatasetTimeTotal, test.ShouldEqual, 0)
+		test.That(t, status.ETA, test.ShouldEqual, 0)
+	})
+
+	t.Run("reports the files skipped by the sensors", func(t *testing.T) {
+		progress := NewJobProgress()
+		test.That(t, progress.Status().SkippedFiles, test.ShouldEqual, 0)
+		progress.setDataset(start, &inject.TimedLidar{}, &skippingMovementSensor{skipped: 2})
+		test.That(t, progress.Status().SkippedFiles, test.ShouldEqual, 2)
+	})
+
+	t.Run("a failed job keeps its error and phase", func(t *testing.T) {
+		progress := NewJobProgress()
+		err := errors.New("cartofacade error")
+		progress.fail(err)
+		progress.setPhase(JobPhaseDone)
+
+		status := progress.Status()
+		test.That(t, status.Phase, test.ShouldEqual, JobPhaseFailed)
+		test.That(t, status.Err, test.ShouldEqual, err)
+	})
+
+	t.Run("a cancelled job stays cancelled", func(t *testing.T) {
+		progress := NewJobProgress()
+		test.That(t, progress.Cancel(), test.ShouldBeTrue)
+		progress.fail(context.Canceled)
+		progress.setPhase(JobPhaseDone)
+
+		status := progress.Status()
+		test.That(t, status.Phase, test.ShouldEqual, JobPhaseCancelled)
+		test.That(t, status.Err, test.ShouldBeNil)
+		test.That(t, progress.Cancel(), test.ShouldBeFalse)
+	})
+
+	t.Run("an ended job cannot be cancelled", func(t *testing.T) {
+		progress := NewJobProgress()
+		progress.setPhase(JobPhaseDone)
+		test.That(t, progress.Cancel(), test.ShouldBeFalse)
+		test.That(t, progress.Status().Phase, test.ShouldEqual, JobPhaseDone)
+	})
+}
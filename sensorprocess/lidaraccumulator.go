@@ -0,0 +1,182 @@
+package sensorprocess
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/spatialmath"
+
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+)
+
+const (
+	// coverageBins is the number of angular bins around the lidar used to estimate coverage.
+	coverageBins = 36
+	// fullCoverageFraction is the fraction of angular bins that must contain a point for a sweep
+	// to be considered a full 360° coverage.
+	fullCoverageFraction = 0.9
+	// maxAccumulatedScans bounds the number of readings merged while waiting for full coverage.
+	maxAccumulatedScans = 20
+)
+
+// LidarAccumulationConfig configures merging consecutive partial lidar readings into one reading.
+type LidarAccumulationConfig struct {
+	// NumScans is the number of consecutive readings merged into one. Zero disables the count limit.
+	NumScans int
+	// UntilFullCoverage merges readings until their points cover a full 360° around the lidar.
+	UntilFullCoverage bool
+}
+
+// accumulatedReading is a partial lidar reading together with the odometer pose at the time it was taken.
+type accumulatedReading struct {
+	pointCloud pointcloud.PointCloud
+	reading    s.TimedLidarReadingResponse
+	pose       spatialmath.Pose
+}
+
+// LidarAccumulator merges consecutive partial lidar readings into a single reading. If odometry is
+// available the partial readings are motion compensated into the frame of the most recent one.
+type LidarAccumulator struct {
+	config   LidarAccumulationConfig
+	readings []accumulatedReading
+	bins     [coverageBins]bool
+	odometry atomic.Pointer[s.TimedOdometerReadingResponse]
+}
+
+// NewLidarAccumulator returns a new LidarAccumulator, or nil if the config does not enable accumulation.
+func NewLidarAccumulator(config LidarAccumulationConfig) *LidarAccumulator {
+	if config.NumScans <= 1 && !config.UntilFullCoverage {
+		return nil
+	}
+	return &LidarAccumulator{config: config}
+}
+
+// UpdateOdometry stores the latest odometer reading, which is used to motion compensate the
+// readings accumulated afterwards.
+func (acc *LidarAccumulator) UpdateOdometry(reading s.TimedOdometerReadingResponse) {
+	acc.odometry.Store(&reading)
+}
+
+// Add adds a lidar reading to the accumulator. Once enough readings have been accumulated it returns
+// the merged reading and true, and starts a new accumulation.
+func (acc *LidarAccumulator) Add(reading s.TimedLidarReadingResponse) (s.TimedLidarReadingResponse, bool, error) {
+	pc, err := s.DecodeLidarReading(reading)
+	if err != nil {
+		return s.TimedLidarReadingResponse{}, false, errors.Wrap(err, "failed to parse lidar reading for accumulation")
+	}
+
+	var pose spatialmath.Pose
+	if odometry := acc.odometry.Load(); odometry != nil {
+		pose = spatialmath.NewPose(spatialmath.GeoPointToPoint(odometry.Position, geo.NewPoint(0, 0)), odometry.Orientation)
+	}
+	acc.readings = append(acc.readings, accumulatedReading{pointCloud: pc, reading: reading, pose: pose})
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		angle := math.Atan2(p.Y, p.X) + math.Pi
+		acc.bins[int(angle/(2*math.Pi)*coverageBins)%coverageBins] = true
+		return true
+	})
+
+	if !acc.ready() {
+		return s.TimedLidarReadingResponse{}, false, nil
+	}
+
+	merged, err := acc.merge()
+	acc.Reset()
+	if err != nil {
+		return s.TimedLidarReadingResponse{}, false, err
+	}
+	return merged, true, nil
+}
+
+// Reset discards the readings accumulated so far.
+func (acc *LidarAccumulator) Reset() {
+	acc.readings = nil
+	acc.bins = [coverageBins]bool{}
+}
+
+// ready returns whether the accumulated readings should be merged.
+func (acc *LidarAccumulator) ready() bool {
+	if acc.config.NumScans > 1 && len(acc.readings) >= acc.config.NumScans {
+		return true
+	}
+	if acc.config.UntilFullCoverage {
+		covered := 0
+		for _, hit := range acc.bins {
+			if hit {
+				covered++
+			}
+		}
+		return float64(covered) >= fullCoverageFraction*coverageBins || len(acc.readings) >= maxAccumulatedScans
+	}
+	return false
+}
+
+// merge combines the accumulated readings into one reading with the time of the most recent reading.
+// Readings with a known pose are transformed into the frame of the most recent reading. The merged
+// reading keeps the format of the most recent reading, except that polar readings are merged into points
+// and that the intensity is preserved as sensors.IntensityPreservingFormat describes.
+func (acc *LidarAccumulator) merge() (s.TimedLidarReadingResponse, error) {
+	last := acc.readings[len(acc.readings)-1]
+	merged := pointcloud.New()
+	for _, partial := range acc.readings {
+		var transform spatialmath.Pose
+		if partial.pose != nil && last.pose != nil {
+			transform = spatialmath.Compose(spatialmath.PoseInverse(last.pose), partial.pose)
+		}
+
+		var setErr error
+		partial.pointCloud.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+			if transform != nil {
+				p = spatialmath.Compose(transform, spatialmath.NewPoseFromPoint(p)).Point()
+			}
+			setErr = merged.Set(p, d)
+			return setErr == nil
+		})
+		if setErr != nil {
+			return s.TimedLidarReadingResponse{}, errors.Wrap(setErr, "failed to merge lidar readings")
+		}
+	}
+
+	format := last.reading.Format
+	if format == s.LidarReadingFormatPolar {
+		format = s.LidarReadingFormatPoints
+	}
+	format = s.IntensityPreservingFormat(merged, format)
+	reading, err := s.EncodeLidarReading(merged, format)
+	if err != nil {
+		return s.TimedLidarReadingResponse{}, err
+	}
+	return s.TimedLidarReadingResponse{
+		Reading:            reading,
+		ReadingTime:        last.reading.ReadingTime,
+		TestIsReplaySensor: last.reading.TestIsReplaySensor,
+		Format:             format,
+	}, nil
+}
+
+// accumulateLidarReading passes the reading through the lidar accumulator, if one is configured.
+// Returns false if the reading was accumulated and nothing should be added to the cartofacade yet.
+func (config *Config) accumulateLidarReading(reading s.TimedLidarReadingResponse) (s.TimedLidarReadingResponse, bool, error) {
+	if config.LidarAccumulator == nil {
+		return reading, true, nil
+	}
+	return config.LidarAccumulator.Add(reading)
+}
+
+// updateLidarAccumulatorOdometry forwards an odometer reading to the lidar accumulator, if one is configured.
+func (config *Config) updateLidarAccumulatorOdometry(reading s.TimedMovementSensorReadingResponse) {
+	if config.LidarAccumulator != nil && reading.TimedOdometerResponse != nil {
+		config.LidarAccumulator.UpdateOdometry(*reading.TimedOdometerResponse)
+	}
+}
+
+// resetLidarAccumulator discards the partial readings of the lidar accumulator, if one is configured.
+func (config *Config) resetLidarAccumulator() {
+	if config.LidarAccumulator != nil {
+		config.LidarAccumulator.Reset()
+	}
+}
@@ -0,0 +1,178 @@
+package sensorprocess
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/test"
+
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+)
+
+func toTestLidarReading(t *testing.T, readingTime time.Time, points ...r3.Vector) s.TimedLidarReadingResponse {
+	t.Helper()
+	pc := pointcloud.New()
+	for _, p := range points {
+		test.That(t, pc.Set(p, pointcloud.NewBasicData()), test.ShouldBeNil)
+	}
+	buf := new(bytes.Buffer)
+	test.That(t, pointcloud.ToPCD(pc, buf, pointcloud.PCDBinary), test.ShouldBeNil)
+	return s.TimedLidarReadingResponse{Reading: buf.Bytes(), ReadingTime: readingTime}
+}
+
+func fromTestLidarReading(t *testing.T, reading s.TimedLidarReadingResponse) []r3.Vector {
+	t.Helper()
+	pc, err := pointcloud.ReadPCD(bytes.NewReader(reading.Reading))
+	test.That(t, err, test.ShouldBeNil)
+	var points []r3.Vector
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		points = append(points, p)
+		return true
+	})
+	return points
+}
+
+func containsPoint(points []r3.Vector, expected r3.Vector) bool {
+	for _, p := range points {
+		if p.Sub(expected).Norm() < 1e-3 {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLidarAccumulator(t *testing.T) {
+	start := time.Now().UTC()
+
+	t.Run("accumulation is disabled by default", func(t *testing.T) {
+		test.That(t, NewLidarAccumulator(LidarAccumulationConfig{}), test.ShouldBeNil)
+		test.That(t, NewLidarAccumulator(LidarAccumulationConfig{NumScans: 1}), test.ShouldBeNil)
+	})
+
+	t.Run("merges a fixed number of readings", func(t *testing.T) {
+		acc := NewLidarAccumulator(LidarAccumulationConfig{NumScans: 2})
+		test.That(t, acc, test.ShouldNotBeNil)
+
+		_, ready, err := acc.Add(toTestLidarReading(t, start, r3.Vector{X: 1000}))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, ready, test.ShouldBeFalse)
+
+		merged, ready, err := acc.Add(toTestLidarReading(t, start.Add(100*time.Millisecond), r3.Vector{Y: 1000}))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, ready, test.ShouldBeTrue)
+		test.That(t, merged.ReadingTime, test.ShouldEqual, start.Add(100*time.Millisecond))
+		points := fromTestLidarReading(t, merged)
+		test.That(t, len(points), test.ShouldEqual, 2)
+		test.That(t, containsPoint(points, r3.Vector{X: 1000}), test.ShouldBeTrue)
+		test.That(t, containsPoint(points, r3.Vector{Y: 1000}), test.ShouldBeTrue)
+
+		// a new accumulation starts after the merged reading was returned
+		_, ready, err = acc.Add(toTestLidarReading(t, start.Add(200*time.Millisecond), r3.Vector{X: 1000}))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, ready, test.ShouldBeFalse)
+	})
+
+	t.Run("discards the accumulated readings on reset", func(t *testing.T) {
+		acc := NewLidarAccumulator(LidarAccumulationConfig{NumScans: 2})
+		_, ready, err := acc.Add(toTestLidarReading(t, start, r3.Vector{X: 1000}))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, ready, test.ShouldBeFalse)
+
+		acc.Reset()
+		_, ready, err = acc.Add(toTestLidarReading(t, start.Add(100*time.Millisecond), r3.Vector{Y: 1000}))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, ready, test.ShouldBeFalse)
+
+		merged, ready, err := acc.Add(toTestLidarReading(t, start.Add(200*time.Millisecond), r3.Vector{X: -1000}))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, ready, test.ShouldBeTrue)
+		points := fromTestLidarReading(t, merged)
+		test.That(t, len(points), test.ShouldEqual, 2)
+		test.That(t, containsPoint(points, r3.Vector{X: 1000}), test.ShouldBeFalse)
+	})
+
+	t.Run("merges readings until they cover a full circle", func(t *testing.T) {
+		acc := NewLidarAccumulator(LidarAccumulationConfig{UntilFullCoverage: true})
+
+		var firstHalf, secondHalf []r3.Vector
+		for i := 0; i < coverageBins; i++ {
+			angle := (float64(i) + 0.5) * 2 * math.Pi / coverageBins
+			p := r3.Vector{X: 1000 * math.Cos(angle), Y: 1000 * math.Sin(angle)}
+			if i < coverageBins/2 {
+				firstHalf = append(firstHalf, p)
+			} else {
+				secondHalf = append(secondHalf, p)
+			}
+		}
+
+		_, ready, err := acc.Add(toTestLidarReading(t, start, firstHalf...))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, ready, test.ShouldBeFalse)
+
+		merged, ready, err := acc.Add(toTestLidarReading(t, start.Add(50*time.Millisecond), secondHalf...))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, ready, test.ShouldBeTrue)
+		test.That(t, len(fromTestLidarReading(t, merged)), test.ShouldEqual, coverageBins)
+	})
+
+	t.Run("motion compensates readings with the latest odometry", func(t *testing.T) {
+		acc := NewLidarAccumulator(LidarAccumulationConfig{NumScans: 2})
+
+		acc.UpdateOdometry(s.TimedOdometerReadingResponse{
+			Position:    geo.NewPoint(0, 0),
+			Orientation: &spatialmath.OrientationVectorDegrees{OZ: 1, Theta: 0},
+		})
+		_, ready, err := acc.Add(toTestLidarReading(t, start, r3.Vector{X: 1000}))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, ready, test.ShouldBeFalse)
+
+		// the robot turned 90 degrees counterclockwise between the readings
+		acc.UpdateOdometry(s.TimedOdometerReadingResponse{
+			Position:    geo.NewPoint(0, 0),
+			Orientation: &spatialmath.OrientationVectorDegrees{OZ: 1, Theta: 90},
+		})
+		merged, ready, err := acc.Add(toTestLidarReading(t, start.Add(100*time.Millisecond), r3.Vector{X: 1000}))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, ready, test.ShouldBeTrue)
+
+		points := fromTestLidarReading(t, merged)
+		test.That(t, len(points), test.ShouldEqual, 2)
+		test.That(t, containsPoint(points, r3.Vector{X: 1000}), test.ShouldBeTrue)
+		test.That(t, containsPoint(points, r3.Vector{Y: -1000}), test.ShouldBeTrue)
+	})
+
+	t.Run("merges points readings into a points reading", func(t *testing.T) {
+		acc := NewLidarAccumulator(LidarAccumulationConfig{NumScans: 2})
+		for i, p := range []r3.Vector{{X: 1000}, {Y: 1000}} {
+			pc := pointcloud.New()
+			test.That(t, pc.Set(p, nil), test.ShouldBeNil)
+			reading, err := s.EncodeLidarReading(pc, s.LidarReadingFormatPoints)
+			test.That(t, err, test.ShouldBeNil)
+
+			merged, ready, err := acc.Add(s.TimedLidarReadingResponse{
+				Reading:     reading,
+				ReadingTime: start.Add(time.Duration(i) * 100 * time.Millisecond),
+				Format:      s.LidarReadingFormatPoints,
+			})
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, ready, test.ShouldEqual, i == 1)
+			if ready {
+				test.That(t, merged.Format, test.ShouldEqual, s.LidarReadingFormatPoints)
+				test.That(t, len(merged.Reading), test.ShouldEqual, 2*12)
+			}
+		}
+	})
+
+	t.Run("returns an error for readings that are not a PCD", func(t *testing.T) {
+		acc := NewLidarAccumulator(LidarAccumulationConfig{NumScans: 2})
+		_, ready, err := acc.Add(s.TimedLidarReadingResponse{Reading: []byte("not a pcd"), ReadingTime: start})
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, ready, test.ShouldBeFalse)
+	})
+}
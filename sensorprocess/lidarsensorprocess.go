@@ -4,7 +4,6 @@ package sensorprocess
 import (
 	"context"
 	"errors"
-	"math"
 	"time"
 
 	"go.viam.com/rdk/components/camera/replaypcd"
@@ -21,8 +20,16 @@ func (config *Config) StartLidar(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		default:
-			if err := config.addLidarReadingInOnline(ctx); err != nil {
-				config.Logger.Warn(err)
+			paused, err := config.Gate.wait(ctx)
+			if err != nil {
+				return
+			}
+			// partial readings taken before the pause do not belong to the readings taken after it
+			if paused {
+				config.resetLidarAccumulator()
+			}
+			if err := config.addLidarReadingInOnline(ctx); err != nil && ctx.Err() == nil {
+				config.sensorReadingFailed(ctx, config.LidarHealth, config.Lidar.Name(), err)
 			}
 		}
 	}
@@ -39,49 +46,110 @@ func (config *Config) addLidarReadingInOnline(ctx context.Context) error {
 		}
 		return err
 	}
+	config.sensorReadingSucceeded(config.LidarHealth, config.Lidar.Name(), lidarReading.Reading)
+
+	// merge partial readings before they get added to cartographer
+	accumulatedReading, ready, err := config.accumulateLidarReading(lidarReading)
+	if err != nil {
+		return err
+	}
+	// skip the reading while the robot is stationary
+	if ready && config.gateLidarReading(accumulatedReading) {
+		config.bridgeMovementSensorOutage(ctx, accumulatedReading.ReadingTime)
+		// add lidar data to cartographer, or queue it to be added
+		if config.IngestQueue != nil {
+			config.queueLidarReading(ctx, accumulatedReading)
+		} else {
+			config.tryAddLidarReadingOnce(ctx, accumulatedReading)
+		}
+	}
 
-	// add lidar data to cartographer and sleep remainder of time interval
-	timeToSleep := config.tryAddLidarReadingOnce(ctx, lidarReading)
+	// wait for the next poll, unless the reading is from a replay sensor
 	if !lidarReading.TestIsReplaySensor {
-		time.Sleep(time.Duration(timeToSleep) * time.Millisecond)
-		config.Logger.Debugf("lidar sleep for %vms", timeToSleep)
+		return config.LidarScheduler.wait(ctx)
 	}
 	return nil
 }
 
+// addLidarReadingInOffline adds a lidar reading of the dataset to cartographer, unless it is accumulated, goes
+// back in time, is skipped while the robot is stationary or is rejected by cartographer as invalid. Returns
+// an error if the context is done or the reading could not be added.
+func (config *Config) addLidarReadingInOffline(ctx context.Context, reading s.TimedLidarReadingResponse) error {
+	accumulatedReading, ready, err := config.accumulateLidarReading(reading)
+	if err != nil {
+		config.Logger.Warn(err)
+		return nil
+	}
+	if !ready {
+		return nil
+	}
+	if err := config.validateLidarReadingTime(accumulatedReading); err != nil {
+		config.recordLidarReading(accumulatedReading, err)
+		config.Progress.skipLidarReading(accumulatedReading.ReadingTime)
+		return nil
+	}
+	if !config.gateLidarReading(accumulatedReading) {
+		config.Progress.skipLidarReading(accumulatedReading.ReadingTime)
+		return nil
+	}
+	if err := config.tryAddLidarReadingUntilSuccess(ctx, accumulatedReading); err != nil {
+		if cartofacade.IsInvalidInput(err) {
+			config.Progress.skipLidarReading(accumulatedReading.ReadingTime)
+			return nil
+		}
+		return err
+	}
+	config.Progress.addLidarReading(accumulatedReading.ReadingTime)
+	config.recordTrajectoryPose(ctx, accumulatedReading.ReadingTime)
+	return nil
+}
+
 // tryAddLidarReadingUntilSuccess adds a reading to the cartofacade and retries on error (offline mode). While add lidar
 // reading fails, keep trying to add the same reading - in offline mode we want to process each reading so if we cannot
-// acquire the lock we should try again.
+// acquire the lock we should try again. A reading cartographer rejects as invalid would be rejected again, so its
+// error is returned instead, as is any error which retrying cannot fix or which persists for maxRetryDuration.
 func (config *Config) tryAddLidarReadingUntilSuccess(ctx context.Context, reading s.TimedLidarReadingResponse) error {
+	var backoff retryBackoff
 	for {
 		select {
 		case <-ctx.Done():
+			config.recordLidarReading(reading, ctx.Err())
 			return ctx.Err()
 		default:
-			if err := config.tryAddLidarReading(ctx, reading); err != nil {
-				if !errors.Is(err, cartofacade.ErrUnableToAcquireLock) {
-					config.Logger.Warnw("Retrying sensor reading due to error from cartofacade", "error", err)
-				}
-			} else {
+			err := config.tryAddLidarReading(ctx, reading)
+			switch {
+			case err == nil:
+				config.recordLidarReading(reading, nil)
 				return nil
+			case cartofacade.IsInvalidInput(err):
+				config.Logger.Warnw("Skipping lidar reading due to "+addErrorReason(err), "error", err)
+				config.recordLidarReading(reading, err)
+				return err
+			case !isTransientAddError(err) || backoff.exhausted():
+				config.Logger.Errorw("Failed to add lidar reading due to "+addErrorReason(err), "error", err)
+				config.recordLidarReading(reading, err)
+				return err
 			}
+			backoff.sleep(ctx)
 		}
 	}
 }
 
-// tryAddLidarReadingOnce adds a reading to the carto facade and does not retry. Returns remainder of time interval.
-func (config *Config) tryAddLidarReadingOnce(ctx context.Context, reading s.TimedLidarReadingResponse) int {
-	startTime := time.Now().UTC()
-
-	if err := config.tryAddLidarReading(ctx, reading); err != nil {
-		if errors.Is(err, cartofacade.ErrUnableToAcquireLock) {
-			config.Logger.Debugw("Skipping lidar reading due to lock contention in cartofacade", "error", err)
+// tryAddLidarReadingOnce adds a reading to the carto facade and does not retry.
+func (config *Config) tryAddLidarReadingOnce(ctx context.Context, reading s.TimedLidarReadingResponse) {
+	if err := config.validateLidarReadingTime(reading); err != nil {
+		config.recordLidarReading(reading, err)
+		return
+	}
+	err := config.tryAddLidarReading(ctx, reading)
+	if err != nil {
+		if cartofacade.IsRetryable(err) {
+			config.Logger.Debugw("Skipping lidar reading due to "+addErrorReason(err), "error", err)
 		} else {
-			config.Logger.Warnw("Skipping lidar reading due to error from cartofacade", "error", err)
+			config.Logger.Warnw("Skipping lidar reading due to "+addErrorReason(err), "error", err)
 		}
 	}
-	timeElapsedMs := int(time.Since(startTime).Milliseconds())
-	return int(math.Max(0, float64(1000/config.Lidar.DataFrequencyHz()-timeElapsedMs)))
+	config.recordLidarReading(reading, err)
 }
 
 // tryAddLidarReading tries to add a reading to the carto facade.
@@ -91,6 +159,7 @@ func (config *Config) tryAddLidarReading(ctx context.Context, reading s.TimedLid
 		config.Logger.Debugf("%v \t | LIDAR | Failure \t \t | %v \n", reading.ReadingTime, reading.ReadingTime.Unix())
 	} else {
 		config.Logger.Debugf("%v \t | LIDAR | Success \t \t | %v \n", reading.ReadingTime, reading.ReadingTime.Unix())
+		config.MapRenderer.NodeAdded()
 	}
 	return err
 }
@@ -29,7 +29,7 @@ func TestStartLidar(t *testing.T) {
 		cancelCtx, cancelFunc := context.WithCancel(context.Background())
 
 		lidar, imu := s.FinishedReplayLidar, s.NoMovementSensor
-		replaySensor, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, imu), string(lidar), 5, logger)
+		replaySensor, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, imu), string(lidar), 5, s.LidarReadingFormatPCD, logger)
 		test.That(t, err, test.ShouldBeNil)
 
 		config.Lidar = replaySensor
@@ -44,10 +44,10 @@ func TestAddLidarReadingInOnline(t *testing.T) {
 	logger := logging.NewTestLogger(t)
 	cf := cartofacade.Mock{}
 
-	dataFrequencyHz := 5
+	dataFrequencyHz := 5.0
 	injectLidar := inject.TimedLidar{}
 	injectLidar.NameFunc = func() string { return "good_lidar" }
-	injectLidar.DataFrequencyHzFunc = func() int { return dataFrequencyHz }
+	injectLidar.DataFrequencyHzFunc = func() float64 { return dataFrequencyHz }
 
 	config := Config{
 		Logger:      logger,
@@ -77,7 +77,7 @@ func TestTryAddLidarReadingUntilSuccess(t *testing.T) {
 		return nil
 	}
 
-	dataFrequencyHz := 0
+	dataFrequencyHz := 0.0
 
 	lidarReading := s.TimedLidarReadingResponse{
 		Reading:     []byte("12345"),
@@ -85,7 +85,7 @@ func TestTryAddLidarReadingUntilSuccess(t *testing.T) {
 	}
 
 	injectLidar := inject.TimedLidar{}
-	injectLidar.DataFrequencyHzFunc = func() int { return dataFrequencyHz }
+	injectLidar.DataFrequencyHzFunc = func() float64 { return dataFrequencyHz }
 
 	config := Config{
 		Logger:      logger,
@@ -97,7 +97,7 @@ func TestTryAddLidarReadingUntilSuccess(t *testing.T) {
 
 	t.Run("replay lidar adds sensor data until success", func(t *testing.T) {
 		lidar, imu := s.ReplayLidar, s.NoMovementSensor
-		replaySensor, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, imu), string(lidar), dataFrequencyHz, logger)
+		replaySensor, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, imu), string(lidar), dataFrequencyHz, s.LidarReadingFormatPCD, logger)
 		test.That(t, err, test.ShouldBeNil)
 
 		var calls []addLidarReadingArgs
@@ -135,6 +135,23 @@ func TestTryAddLidarReadingUntilSuccess(t *testing.T) {
 			test.That(t, call.currentReading.ReadingTime, test.ShouldEqual, firstTimestamp)
 		}
 	})
+
+	t.Run("does not retry readings cartographer rejects as invalid", func(t *testing.T) {
+		calls := 0
+		cf.AddLidarReadingFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+			sensorName string,
+			currentReading s.TimedLidarReadingResponse,
+		) error {
+			calls++
+			return cartofacade.ErrLidarReadingInvalid
+		}
+
+		err := config.tryAddLidarReadingUntilSuccess(context.Background(), lidarReading)
+		test.That(t, errors.Is(err, cartofacade.ErrLidarReadingInvalid), test.ShouldBeTrue)
+		test.That(t, calls, test.ShouldEqual, 1)
+	})
 }
 
 func TestTryAddLidarReadingOnce(t *testing.T) {
@@ -145,10 +162,10 @@ func TestTryAddLidarReadingOnce(t *testing.T) {
 		ReadingTime: time.Now().UTC(),
 	}
 
-	dataFrequencyHz := 5
+	dataFrequencyHz := 5.0
 	injectLidar := inject.TimedLidar{}
 	injectLidar.NameFunc = func() string { return "good_lidar" }
-	injectLidar.DataFrequencyHzFunc = func() int { return dataFrequencyHz }
+	injectLidar.DataFrequencyHzFunc = func() float64 { return dataFrequencyHz }
 
 	config := Config{
 		Logger:      logger,
@@ -157,97 +174,52 @@ func TestTryAddLidarReadingOnce(t *testing.T) {
 		Lidar:       &injectLidar,
 		Timeout:     10 * time.Second,
 	}
-	t.Run("when AddLidarReading blocks for more than the data rate and succeeds, time to sleep is 0", func(t *testing.T) {
-		cf.AddLidarReadingFunc = func(
-			ctx context.Context,
-			timeout time.Duration,
-			sensorName string,
-			currentReading s.TimedLidarReadingResponse,
-		) error {
-			time.Sleep(1 * time.Second)
-			return nil
-		}
-
-		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), reading)
-		test.That(t, timeToSleep, test.ShouldEqual, 0)
-	})
-
-	t.Run("when AddLidarReading is slower than data rate and returns a lock error, time to sleep is 0", func(t *testing.T) {
-		cf.AddLidarReadingFunc = func(
-			ctx context.Context,
-			timeout time.Duration,
-			sensorName string,
-			currentReading s.TimedLidarReadingResponse,
-		) error {
-			time.Sleep(1 * time.Second)
-			return cartofacade.ErrUnableToAcquireLock
-		}
-
-		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), reading)
-		test.That(t, timeToSleep, test.ShouldEqual, 0)
-	})
-
-	t.Run("when AddLidarReading blocks for more than the date rate "+
-		"and returns an unexpected error, time to sleep is 0", func(t *testing.T) {
-		cf.AddLidarReadingFunc = func(
-			ctx context.Context,
-			timeout time.Duration,
-			sensorName string,
-			currentReading s.TimedLidarReadingResponse,
-		) error {
-			time.Sleep(1 * time.Second)
-			return errUnknown
-		}
-
-		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), reading)
-		test.That(t, timeToSleep, test.ShouldEqual, 0)
-	})
-
-	t.Run("when AddLidarReading is faster than the date rate and succeeds, time to sleep is <= date rate", func(t *testing.T) {
+	t.Run("when AddLidarReading succeeds, the reading is added once", func(t *testing.T) {
+		var calls int
 		cf.AddLidarReadingFunc = func(
 			ctx context.Context,
 			timeout time.Duration,
 			sensorName string,
 			currentReading s.TimedLidarReadingResponse,
 		) error {
+			calls++
 			return nil
 		}
 
-		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), reading)
-		test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
-		test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.Lidar.DataFrequencyHz())
+		config.tryAddLidarReadingOnce(context.Background(), reading)
+		test.That(t, calls, test.ShouldEqual, 1)
 	})
 
-	t.Run("when AddLidarReading is faster than the date rate "+
-		"and returns lock error, time to sleep is <= date rate", func(t *testing.T) {
+	t.Run("when AddLidarReading returns a lock error, the reading is not retried", func(t *testing.T) {
+		var calls int
 		cf.AddLidarReadingFunc = func(
 			ctx context.Context,
 			timeout time.Duration,
 			sensorName string,
 			currentReading s.TimedLidarReadingResponse,
 		) error {
+			calls++
 			return cartofacade.ErrUnableToAcquireLock
 		}
 
-		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), reading)
-		test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
-		test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.Lidar.DataFrequencyHz())
+		config.tryAddLidarReadingOnce(context.Background(), reading)
+		test.That(t, calls, test.ShouldEqual, 1)
 	})
 
-	t.Run("when AddLidarReading is faster than date rate "+
-		"and returns an unexpected error, time to sleep is <= date rate", func(t *testing.T) {
+	t.Run("when AddLidarReading returns an unexpected error, the reading is not retried", func(t *testing.T) {
+		var calls int
 		cf.AddLidarReadingFunc = func(
 			ctx context.Context,
 			timeout time.Duration,
 			sensorName string,
 			currentReading s.TimedLidarReadingResponse,
 		) error {
+			calls++
 			return errUnknown
 		}
 
-		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), reading)
-		test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
-		test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.Lidar.DataFrequencyHz())
+		config.tryAddLidarReadingOnce(context.Background(), reading)
+		test.That(t, calls, test.ShouldEqual, 1)
 	})
 }
 
@@ -259,10 +231,10 @@ func TestTryAddLidarReading(t *testing.T) {
 		ReadingTime: time.Now().UTC(),
 	}
 
-	dataFrequencyHz := 5
+	dataFrequencyHz := 5.0
 	injectLidar := inject.TimedLidar{}
 	injectLidar.NameFunc = func() string { return "good_lidar" }
-	injectLidar.DataFrequencyHzFunc = func() int { return dataFrequencyHz }
+	injectLidar.DataFrequencyHzFunc = func() float64 { return dataFrequencyHz }
 
 	config := Config{
 		Logger:      logger,
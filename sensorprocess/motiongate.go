@@ -0,0 +1,244 @@
+package sensorprocess
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/spatialmath"
+
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+)
+
+const (
+	// DefaultStationaryTranslationMm is the default odometer translation, since the last added lidar reading,
+	// above which the robot is moving.
+	DefaultStationaryTranslationMm = 20.
+	// DefaultStationaryRotationDeg is the default odometer rotation, since the last added lidar reading, above
+	// which the robot is moving.
+	DefaultStationaryRotationDeg = 1.
+	// DefaultStationaryAngularVelocityDegPerSec is the default IMU angular velocity above which the robot is moving.
+	DefaultStationaryAngularVelocityDegPerSec = 2.
+	// DefaultStationaryScanChangeMm is the default mean change of the range around the lidar, since the last
+	// added lidar reading, above which the robot is moving.
+	DefaultStationaryScanChangeMm = 50.
+	// DefaultStationaryKeepalive is the default time between the lidar readings added while the robot is stationary.
+	DefaultStationaryKeepalive = 5 * time.Second
+)
+
+// MotionGateConfig configures skipping lidar readings while the robot is stationary. Zero thresholds select
+// their defaults.
+type MotionGateConfig struct {
+	// Enabled enables the motion gate.
+	Enabled bool
+	// TranslationMm and RotationDeg are the odometer pose change, since the last added lidar reading, above
+	// which the robot is moving.
+	TranslationMm float64
+	RotationDeg   float64
+	// AngularVelocityDegPerSec is the IMU angular velocity above which the robot is moving.
+	AngularVelocityDegPerSec float64
+	// ScanChangeMm is the mean change of the range around the lidar, since the last added lidar reading, above
+	// which the robot is moving.
+	ScanChangeMm float64
+	// Keepalive is the time, in reading time, between the lidar readings added while the robot is stationary.
+	Keepalive time.Duration
+}
+
+// MotionGateStats is a snapshot of the readings passed and skipped by the motion gate.
+type MotionGateStats struct {
+	// Stationary is whether the robot was stationary at the latest lidar reading.
+	Stationary bool
+	// PassedReadings counts the lidar readings which were added to cartographer.
+	PassedReadings uint64
+	// SkippedReadings counts the lidar readings which were skipped because the robot was stationary.
+	SkippedReadings uint64
+}
+
+// scanProfile is the mean range around the lidar in angular bins, which is compared between lidar
+// readings to detect that the robot moved.
+type scanProfile struct {
+	ranges [coverageBins]float64
+	counts [coverageBins]int
+}
+
+// MotionGate skips lidar readings while the robot is stationary, which would otherwise grow the pose graph
+// and trigger optimizations without adding anything to the map. The robot is moving if the odometer pose
+// changed, the IMU measured a rotation or the lidar reading changed since the last added lidar reading.
+// While the robot is stationary, lidar readings are only added at the keepalive interval. It is safe for
+// concurrent use, and a nil MotionGate passes every reading.
+type MotionGate struct {
+	config MotionGateConfig
+
+	mu sync.Mutex
+	// odometerPose is the latest odometer pose and addedOdometerPose the one at the last added lidar reading.
+	odometerPose      spatialmath.Pose
+	addedOdometerPose spatialmath.Pose
+	// rotated is whether the IMU measured a rotation since the last added lidar reading.
+	rotated          bool
+	addedProfile     *scanProfile
+	addedReadingTime time.Time
+	stationary       bool
+	passed           uint64
+	skipped          uint64
+}
+
+// NewMotionGate returns a new MotionGate, or nil if the config does not enable it.
+func NewMotionGate(config MotionGateConfig) *MotionGate {
+	if !config.Enabled {
+		return nil
+	}
+	if config.TranslationMm == 0 {
+		config.TranslationMm = DefaultStationaryTranslationMm
+	}
+	if config.RotationDeg == 0 {
+		config.RotationDeg = DefaultStationaryRotationDeg
+	}
+	if config.AngularVelocityDegPerSec == 0 {
+		config.AngularVelocityDegPerSec = DefaultStationaryAngularVelocityDegPerSec
+	}
+	if config.ScanChangeMm == 0 {
+		config.ScanChangeMm = DefaultStationaryScanChangeMm
+	}
+	if config.Keepalive == 0 {
+		config.Keepalive = DefaultStationaryKeepalive
+	}
+	return &MotionGate{config: config}
+}
+
+// Stats returns the readings passed and skipped so far.
+func (gate *MotionGate) Stats() MotionGateStats {
+	if gate == nil {
+		return MotionGateStats{}
+	}
+	gate.mu.Lock()
+	defer gate.mu.Unlock()
+	return MotionGateStats{
+		Stationary:      gate.stationary,
+		PassedReadings:  gate.passed,
+		SkippedReadings: gate.skipped,
+	}
+}
+
+// updateMovementSensor records the motion measured by a movement sensor reading.
+func (gate *MotionGate) updateMovementSensor(reading s.TimedMovementSensorReadingResponse) {
+	if gate == nil {
+		return
+	}
+	gate.mu.Lock()
+	defer gate.mu.Unlock()
+	if odometry := reading.TimedOdometerResponse; odometry != nil {
+		gate.odometerPose = spatialmath.NewPose(
+			spatialmath.GeoPointToPoint(odometry.Position, geo.NewPoint(0, 0)), odometry.Orientation)
+	}
+	if imu := reading.TimedIMUResponse; imu != nil {
+		angularVelocityDegPerSec := r3.Vector(imu.AngularVelocity).Norm() * 180 / math.Pi
+		if angularVelocityDegPerSec > gate.config.AngularVelocityDegPerSec {
+			gate.rotated = true
+		}
+	}
+}
+
+// allow returns whether a lidar reading should be added to cartographer, and whether the robot started or
+// stopped moving with this reading. The first reading is always added.
+func (gate *MotionGate) allow(reading s.TimedLidarReadingResponse) (bool, bool) {
+	if gate == nil {
+		return true, false
+	}
+	// a reading which cannot be parsed has no profile, and is compared as a changed scan
+	var profile *scanProfile
+	if pc, err := s.DecodeLidarReading(reading); err == nil {
+		profile = newScanProfile(pc)
+	}
+
+	gate.mu.Lock()
+	defer gate.mu.Unlock()
+	wasStationary := gate.stationary
+	gate.stationary = !gate.addedReadingTime.IsZero() && !gate.moved(profile)
+	changed := gate.stationary != wasStationary
+	if gate.stationary && reading.ReadingTime.Sub(gate.addedReadingTime) < gate.config.Keepalive {
+		gate.skipped++
+		return false, changed
+	}
+
+	gate.passed++
+	gate.addedOdometerPose = gate.odometerPose
+	gate.rotated = false
+	gate.addedProfile = profile
+	gate.addedReadingTime = reading.ReadingTime
+	return true, changed
+}
+
+// moved returns whether the robot moved since the last added lidar reading. Must be called with the lock held.
+func (gate *MotionGate) moved(profile *scanProfile) bool {
+	if gate.rotated {
+		return true
+	}
+	if (gate.odometerPose == nil) != (gate.addedOdometerPose == nil) {
+		return true
+	}
+	if gate.odometerPose != nil {
+		delta := spatialmath.PoseBetween(gate.addedOdometerPose, gate.odometerPose)
+		if delta.Point().Norm() > gate.config.TranslationMm ||
+			delta.Orientation().AxisAngles().Theta*180/math.Pi > gate.config.RotationDeg {
+			return true
+		}
+	}
+	if profile == nil || gate.addedProfile == nil {
+		return true
+	}
+	return profile.change(gate.addedProfile) > gate.config.ScanChangeMm
+}
+
+// newScanProfile returns the mean range around the lidar of a point cloud.
+func newScanProfile(pc pointcloud.PointCloud) *scanProfile {
+	var profile scanProfile
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		angle := math.Atan2(p.Y, p.X) + math.Pi
+		bin := int(angle/(2*math.Pi)*coverageBins) % coverageBins
+		profile.ranges[bin] += math.Hypot(p.X, p.Y)
+		profile.counts[bin]++
+		return true
+	})
+	for bin, count := range profile.counts {
+		if count > 0 {
+			profile.ranges[bin] /= float64(count)
+		}
+	}
+	return &profile
+}
+
+// change returns the mean change of the range between two profiles over the bins both of them cover, or
+// infinity if they do not cover a common bin.
+func (profile *scanProfile) change(other *scanProfile) float64 {
+	var sum float64
+	var bins int
+	for bin := range profile.ranges {
+		if profile.counts[bin] == 0 || other.counts[bin] == 0 {
+			continue
+		}
+		sum += math.Abs(profile.ranges[bin] - other.ranges[bin])
+		bins++
+	}
+	if bins == 0 {
+		return math.Inf(1)
+	}
+	return sum / float64(bins)
+}
+
+// gateLidarReading returns whether a lidar reading should be added to cartographer, skipping it while the
+// robot is stationary if a motion gate is configured.
+func (config *Config) gateLidarReading(reading s.TimedLidarReadingResponse) bool {
+	allowed, changed := config.MotionGate.allow(reading)
+	if changed {
+		if !config.MotionGate.Stats().Stationary {
+			config.Logger.Debugw("Robot is moving, adding every lidar reading", "reading_time", reading.ReadingTime)
+		} else {
+			config.Logger.Debugw("Robot is stationary, skipping lidar readings until it moves",
+				"reading_time", reading.ReadingTime, "keepalive", config.MotionGate.config.Keepalive)
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,98 @@
+package sensorprocess
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/test"
+
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+)
+
+func TestMotionGate(t *testing.T) {
+	start := time.Now().UTC()
+	room := []r3.Vector{{X: 1000}, {Y: 1000}, {X: -1000}, {Y: -1000}}
+	odometerReading := func(lng float64) s.TimedMovementSensorReadingResponse {
+		return s.TimedMovementSensorReadingResponse{
+			TimedOdometerResponse: &s.TimedOdometerReadingResponse{
+				Position:    geo.NewPoint(0, lng),
+				Orientation: spatialmath.NewZeroOrientation(),
+			},
+		}
+	}
+
+	t.Run("the motion gate is disabled by default and a nil gate passes every reading", func(t *testing.T) {
+		gate := NewMotionGate(MotionGateConfig{})
+		test.That(t, gate, test.ShouldBeNil)
+		allowed, _ := gate.allow(toTestLidarReading(t, start, room...))
+		test.That(t, allowed, test.ShouldBeTrue)
+		test.That(t, gate.Stats(), test.ShouldResemble, MotionGateStats{})
+	})
+
+	t.Run("skips unchanged scans until the keepalive interval passed", func(t *testing.T) {
+		gate := NewMotionGate(MotionGateConfig{Enabled: true, Keepalive: time.Second})
+
+		allowed, changed := gate.allow(toTestLidarReading(t, start, room...))
+		test.That(t, allowed, test.ShouldBeTrue)
+		test.That(t, changed, test.ShouldBeFalse)
+
+		allowed, changed = gate.allow(toTestLidarReading(t, start.Add(500*time.Millisecond), room...))
+		test.That(t, allowed, test.ShouldBeFalse)
+		test.That(t, changed, test.ShouldBeTrue)
+
+		allowed, changed = gate.allow(toTestLidarReading(t, start.Add(time.Second), room...))
+		test.That(t, allowed, test.ShouldBeTrue)
+		test.That(t, changed, test.ShouldBeFalse)
+		test.That(t, gate.Stats(), test.ShouldResemble, MotionGateStats{Stationary: true, PassedReadings: 2, SkippedReadings: 1})
+	})
+
+	t.Run("passes a scan which changed", func(t *testing.T) {
+		gate := NewMotionGate(MotionGateConfig{Enabled: true})
+		gate.allow(toTestLidarReading(t, start, room...))
+
+		moved := []r3.Vector{{X: 800}, {Y: 1000}, {X: -1200}, {Y: -1000}}
+		allowed, _ := gate.allow(toTestLidarReading(t, start.Add(100*time.Millisecond), moved...))
+		test.That(t, allowed, test.ShouldBeTrue)
+		test.That(t, gate.Stats().Stationary, test.ShouldBeFalse)
+	})
+
+	t.Run("passes a scan after the odometer moved", func(t *testing.T) {
+		gate := NewMotionGate(MotionGateConfig{Enabled: true})
+		gate.updateMovementSensor(odometerReading(0))
+		gate.allow(toTestLidarReading(t, start, room...))
+
+		// well below the translation threshold
+		gate.updateMovementSensor(odometerReading(1e-9))
+		allowed, _ := gate.allow(toTestLidarReading(t, start.Add(100*time.Millisecond), room...))
+		test.That(t, allowed, test.ShouldBeFalse)
+
+		gate.updateMovementSensor(odometerReading(1e-5))
+		allowed, _ = gate.allow(toTestLidarReading(t, start.Add(200*time.Millisecond), room...))
+		test.That(t, allowed, test.ShouldBeTrue)
+		test.That(t, gate.Stats(), test.ShouldResemble, MotionGateStats{PassedReadings: 2, SkippedReadings: 1})
+	})
+
+	t.Run("passes a scan after the IMU measured a rotation", func(t *testing.T) {
+		gate := NewMotionGate(MotionGateConfig{Enabled: true, AngularVelocityDegPerSec: 10})
+		gate.allow(toTestLidarReading(t, start, room...))
+
+		gate.updateMovementSensor(s.TimedMovementSensorReadingResponse{
+			TimedIMUResponse: &s.TimedIMUReadingResponse{AngularVelocity: spatialmath.AngularVelocity{Z: 0.1}},
+		})
+		allowed, _ := gate.allow(toTestLidarReading(t, start.Add(100*time.Millisecond), room...))
+		test.That(t, allowed, test.ShouldBeFalse)
+
+		gate.updateMovementSensor(s.TimedMovementSensorReadingResponse{
+			TimedIMUResponse: &s.TimedIMUReadingResponse{AngularVelocity: spatialmath.AngularVelocity{Z: 0.5}},
+		})
+		allowed, _ = gate.allow(toTestLidarReading(t, start.Add(200*time.Millisecond), room...))
+		test.That(t, allowed, test.ShouldBeTrue)
+
+		// the rotation only counts until the next added reading
+		allowed, _ = gate.allow(toTestLidarReading(t, start.Add(300*time.Millisecond), room...))
+		test.That(t, allowed, test.ShouldBeFalse)
+	})
+}
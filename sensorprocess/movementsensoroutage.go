@@ -0,0 +1,149 @@
+package sensorprocess
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/r3"
+
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+)
+
+const (
+	// DefaultMovementSensorOutageTimeout is the default time without a movement sensor reading after which
+	// the movement sensor is considered out.
+	DefaultMovementSensorOutageTimeout = 5 * time.Second
+	// standardGravity is the linear acceleration, in m/s^2, of a neutral IMU reading of a stationary sensor.
+	standardGravity = 9.80665
+)
+
+// MovementSensorOutageStatus is a snapshot of an outage of the movement sensor.
+type MovementSensorOutageStatus struct {
+	// Out is whether the movement sensor is out.
+	Out bool
+	// Since is the start of the current outage, or zero if the movement sensor is not out.
+	Since time.Time
+	// NeutralReadings counts the gravity-only IMU readings added in place of the movement sensor.
+	NeutralReadings uint64
+}
+
+// MovementSensorOutage detects that the movement sensor stopped returning readings mid-session. Cartographer
+// keeps waiting for IMU data once it is configured to use it, so while the movement sensor is out, IMU
+// readings of gravity only are added at the times of the lidar readings. These carry no motion, so the
+// lidar alone keeps the trajectory going. Odometry is not added, as cartographer does not wait for it and
+// repeating the last pose would tell it that the robot stands still. It is safe for concurrent use, and a
+// nil MovementSensorOutage never detects an outage.
+type MovementSensorOutage struct {
+	timeout time.Duration
+
+	mu              sync.Mutex
+	lastReadingTime time.Time
+	since           time.Time
+	neutralReadings uint64
+}
+
+// NewMovementSensorOutage returns a new MovementSensorOutage, which detects an outage after timeout without
+// a movement sensor reading. A zero timeout selects DefaultMovementSensorOutageTimeout.
+func NewMovementSensorOutage(timeout time.Duration) *MovementSensorOutage {
+	if timeout == 0 {
+		timeout = DefaultMovementSensorOutageTimeout
+	}
+	return &MovementSensorOutage{timeout: timeout, lastReadingTime: time.Now()}
+}
+
+// Status returns the current outage of the movement sensor.
+func (outage *MovementSensorOutage) Status() MovementSensorOutageStatus {
+	if outage == nil {
+		return MovementSensorOutageStatus{}
+	}
+	outage.mu.Lock()
+	defer outage.mu.Unlock()
+	return MovementSensorOutageStatus{
+		Out:             !outage.since.IsZero(),
+		Since:           outage.since,
+		NeutralReadings: outage.neutralReadings,
+	}
+}
+
+// recordReading records a reading of the movement sensor. Returns whether it ended an outage.
+func (outage *MovementSensorOutage) recordReading(reading s.TimedMovementSensorReadingResponse) bool {
+	if outage == nil {
+		return false
+	}
+	outage.mu.Lock()
+	defer outage.mu.Unlock()
+	outage.lastReadingTime = time.Now()
+	ended := !outage.since.IsZero()
+	outage.since = time.Time{}
+	return ended
+}
+
+// check returns whether the movement sensor is out, and whether this call started the outage.
+func (outage *MovementSensorOutage) check() (bool, bool) {
+	if outage == nil {
+		return false, false
+	}
+	outage.mu.Lock()
+	defer outage.mu.Unlock()
+	if !outage.since.IsZero() {
+		return true, false
+	}
+	if time.Since(outage.lastReadingTime) < outage.timeout {
+		return false, false
+	}
+	outage.since = time.Now()
+	return true, true
+}
+
+// neutralReading returns an IMU reading of gravity only at readingTime, without an odometer reading.
+func (outage *MovementSensorOutage) neutralReading(readingTime time.Time) s.TimedMovementSensorReadingResponse {
+	outage.mu.Lock()
+	defer outage.mu.Unlock()
+	outage.neutralReadings++
+	return s.TimedMovementSensorReadingResponse{
+		TimedIMUResponse: &s.TimedIMUReadingResponse{
+			LinearAcceleration: r3.Vector{Z: standardGravity},
+			ReadingTime:        readingTime,
+		},
+	}
+}
+
+// recordMovementSensorOutageReading records a reading of the movement sensor and logs the end of an outage.
+func (config *Config) recordMovementSensorOutageReading(reading s.TimedMovementSensorReadingResponse) {
+	if config.MovementSensorOutage.recordReading(reading) {
+		config.Logger.Infow("Movement sensor is back, adding its readings again",
+			"sensor", config.MovementSensor.Name())
+	}
+}
+
+// bridgeMovementSensorOutage adds a gravity-only IMU reading at the time of a lidar reading if the movement
+// sensor is out, so that cartographer does not wait for IMU data which is not coming. Neutral readings are
+// not recorded.
+func (config *Config) bridgeMovementSensorOutage(ctx context.Context, readingTime time.Time) {
+	out, started := config.MovementSensorOutage.check()
+	if !out {
+		return
+	}
+	if started {
+		config.Logger.Warnw("Movement sensor is out, continuing with the lidar only until it is back",
+			"sensor", config.MovementSensor.Name(), "timeout", config.MovementSensorOutage.timeout)
+	}
+	if !config.MovementSensor.Properties().IMUSupported {
+		return
+	}
+
+	reading := config.MovementSensorOutage.neutralReading(readingTime)
+	if config.IngestQueue != nil {
+		config.queueReading(ctx, queuedReading{
+			sensorType:     movementSensor,
+			readingTime:    readingTime,
+			movementSensor: reading,
+			neutral:        true,
+		})
+		return
+	}
+	if err := config.tryAddIMUReading(ctx, *reading.TimedIMUResponse); err != nil {
+		config.Logger.Debugw("Skipping neutral IMU reading due to error from cartofacade", "error", err)
+	}
+}
@@ -0,0 +1,115 @@
+package sensorprocess
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viamrobotics/viam-cartographer/cartofacade"
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+	"github.com/viamrobotics/viam-cartographer/sensors/inject"
+)
+
+func TestMovementSensorOutage(t *testing.T) {
+	t.Run("a nil outage never starts", func(t *testing.T) {
+		var outage *MovementSensorOutage
+		out, started := outage.check()
+		test.That(t, out, test.ShouldBeFalse)
+		test.That(t, started, test.ShouldBeFalse)
+		test.That(t, outage.recordReading(s.TimedMovementSensorReadingResponse{}), test.ShouldBeFalse)
+		test.That(t, outage.Status(), test.ShouldResemble, MovementSensorOutageStatus{})
+	})
+
+	t.Run("starts after the timeout without a reading and ends with the next reading", func(t *testing.T) {
+		outage := NewMovementSensorOutage(20 * time.Millisecond)
+		out, _ := outage.check()
+		test.That(t, out, test.ShouldBeFalse)
+
+		time.Sleep(30 * time.Millisecond)
+		out, started := outage.check()
+		test.That(t, out, test.ShouldBeTrue)
+		test.That(t, started, test.ShouldBeTrue)
+		out, started = outage.check()
+		test.That(t, out, test.ShouldBeTrue)
+		test.That(t, started, test.ShouldBeFalse)
+		test.That(t, outage.Status().Out, test.ShouldBeTrue)
+		test.That(t, outage.Status().Since.IsZero(), test.ShouldBeFalse)
+
+		test.That(t, outage.recordReading(s.TimedMovementSensorReadingResponse{}), test.ShouldBeTrue)
+		out, _ = outage.check()
+		test.That(t, out, test.ShouldBeFalse)
+		test.That(t, outage.Status().Out, test.ShouldBeFalse)
+	})
+
+	t.Run("neutral readings are gravity-only IMU readings without odometry", func(t *testing.T) {
+		outage := NewMovementSensorOutage(0)
+		test.That(t, outage.timeout, test.ShouldEqual, DefaultMovementSensorOutageTimeout)
+
+		outage.recordReading(s.TimedMovementSensorReadingResponse{
+			TimedOdometerResponse: &s.TimedOdometerReadingResponse{
+				Position:    s.TestPosition,
+				Orientation: s.TestOrientation,
+				ReadingTime: time.Now().UTC().Add(-time.Second),
+			},
+		})
+		readingTime := time.Now().UTC()
+		reading := outage.neutralReading(readingTime)
+		test.That(t, reading.TimedIMUResponse.LinearAcceleration, test.ShouldResemble, r3.Vector{Z: standardGravity})
+		test.That(t, reading.TimedIMUResponse.ReadingTime, test.ShouldEqual, readingTime)
+		test.That(t, reading.TimedOdometerResponse, test.ShouldBeNil)
+		test.That(t, outage.Status().NeutralReadings, test.ShouldEqual, 1)
+	})
+}
+
+func TestBridgeMovementSensorOutage(t *testing.T) {
+	injectMovementSensor := inject.TimedMovementSensor{}
+	injectMovementSensor.NameFunc = func() string { return "good_imu" }
+	injectMovementSensor.PropertiesFunc = func() s.MovementSensorProperties {
+		return s.MovementSensorProperties{IMUSupported: true, OdometerSupported: true}
+	}
+
+	var imuReadings []s.TimedIMUReadingResponse
+	var odometerReadings []s.TimedOdometerReadingResponse
+	cf := cartofacade.Mock{}
+	cf.AddIMUReadingFunc = func(ctx context.Context, timeout time.Duration, sensorName string,
+		currentReading s.TimedIMUReadingResponse,
+	) error {
+		imuReadings = append(imuReadings, currentReading)
+		return nil
+	}
+	cf.AddOdometerReadingFunc = func(ctx context.Context, timeout time.Duration, sensorName string,
+		currentReading s.TimedOdometerReadingResponse,
+	) error {
+		odometerReadings = append(odometerReadings, currentReading)
+		return nil
+	}
+
+	config := Config{
+		Logger:               logging.NewTestLogger(t),
+		CartoFacade:          &cf,
+		IsOnline:             true,
+		MovementSensor:       &injectMovementSensor,
+		MovementSensorOutage: NewMovementSensorOutage(20 * time.Millisecond),
+		Timeout:              10 * time.Second,
+	}
+	readingTime := time.Now().UTC()
+
+	config.bridgeMovementSensorOutage(context.Background(), readingTime)
+	test.That(t, imuReadings, test.ShouldBeEmpty)
+
+	time.Sleep(30 * time.Millisecond)
+	config.bridgeMovementSensorOutage(context.Background(), readingTime)
+	test.That(t, len(imuReadings), test.ShouldEqual, 1)
+	test.That(t, imuReadings[0].ReadingTime, test.ShouldEqual, readingTime)
+	test.That(t, imuReadings[0].AngularVelocity, test.ShouldResemble, s.TimedIMUReadingResponse{}.AngularVelocity)
+	// the last pose is not repeated, which would tell cartographer that the robot stands still
+	test.That(t, odometerReadings, test.ShouldBeEmpty)
+
+	config.recordMovementSensorOutageReading(s.TimedMovementSensorReadingResponse{})
+	config.bridgeMovementSensorOutage(context.Background(), readingTime)
+	test.That(t, len(imuReadings), test.ShouldEqual, 1)
+}
@@ -4,7 +4,6 @@ package sensorprocess
 import (
 	"context"
 	"errors"
-	"math"
 	"time"
 
 	replaymovementsensor "go.viam.com/rdk/components/movementsensor/replay"
@@ -21,8 +20,11 @@ func (config *Config) StartMovementSensor(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		default:
-			if err := config.addMovementSensorReadingInOnline(ctx); err != nil {
-				config.Logger.Warn(err)
+			if _, err := config.Gate.wait(ctx); err != nil {
+				return
+			}
+			if err := config.addMovementSensorReadingInOnline(ctx); err != nil && ctx.Err() == nil {
+				config.sensorReadingFailed(ctx, config.MovementSensorHealth, config.MovementSensor.Name(), err)
 			}
 		}
 	}
@@ -39,87 +41,143 @@ func (config *Config) addMovementSensorReadingInOnline(ctx context.Context) erro
 		}
 		return err
 	}
+	config.sensorReadingSucceeded(config.MovementSensorHealth, config.MovementSensor.Name(), nil)
+	config.recordMovementSensorOutageReading(movementSensorReading)
+	config.updateLidarAccumulatorOdometry(movementSensorReading)
+	config.MotionGate.updateMovementSensor(movementSensorReading)
 
-	// add movement sensor data to cartographer and sleep remainder of time interval
-	timeToSleep := config.tryAddMovementSensorReadingOnce(ctx, movementSensorReading)
+	// add movement sensor data to cartographer, or queue it to be added
+	if config.IngestQueue != nil {
+		config.queueMovementSensorReading(ctx, movementSensorReading)
+	} else {
+		config.tryAddMovementSensorReadingOnce(ctx, movementSensorReading)
+	}
 
+	// wait for the next poll, unless the reading is from a replay sensor
 	if !movementSensorReading.TestIsReplaySensor {
-		time.Sleep(time.Duration(timeToSleep) * time.Millisecond)
-		config.Logger.Debugf("movement sensor sleep for %vms", timeToSleep)
+		return config.MovementSensorScheduler.wait(ctx)
 	}
+	return nil
+}
 
+// addMovementSensorReadingInOffline adds a movement sensor reading of the dataset to cartographer, unless it
+// goes back in time. Returns an error if the context is done or the reading could not be added.
+func (config *Config) addMovementSensorReadingInOffline(ctx context.Context, reading s.TimedMovementSensorReadingResponse,
+	readingTime time.Time,
+) error {
+	if err := config.validateMovementSensorReadingTime(reading); err != nil {
+		config.recordMovementSensorReading(reading, err, err)
+		return nil
+	}
+	if err := config.tryAddMovementSensorReadingUntilSuccess(ctx, reading); err != nil {
+		return err
+	}
+	config.Progress.addMovementSensorReading(readingTime)
+	config.updateLidarAccumulatorOdometry(reading)
+	config.MotionGate.updateMovementSensor(reading)
 	return nil
 }
 
 // tryAddMovementSensorReadingUntilSuccess adds a reading to the cartofacade and retries on error (offline mode).
 // While add sensor reading fails, keep trying to add the same reading - in offline mode we want to
-// process each reading so if we cannot acquire the lock we should try again.
+// process each reading so if we cannot acquire the lock we should try again. A channel cartographer rejects as
+// invalid would be rejected again, so it is not retried and its error is recorded. Any error which retrying cannot
+// fix or which persists for maxRetryDuration is returned.
 func (config *Config) tryAddMovementSensorReadingUntilSuccess(ctx context.Context, reading s.TimedMovementSensorReadingResponse) error {
 	var imuDone, odometerDone bool
-	// set IMU as done since it is not supported: we won't attempt to add IMU data to cartographer
-	if !config.MovementSensor.Properties().IMUSupported {
+	// set IMU as done since it is not supported or was dropped while the replayed dataset was recorded: we
+	// won't attempt to add IMU data to cartographer
+	if !config.MovementSensor.Properties().IMUSupported || reading.TimedIMUResponse == nil {
 		imuDone = true
 	}
-	// set odometer as done since it is not supported: we won't attempt to add odometer data to cartographer
-	if !config.MovementSensor.Properties().OdometerSupported {
+	// set odometer as done since it is not supported or was dropped while the replayed dataset was recorded:
+	// we won't attempt to add odometer data to cartographer
+	if !config.MovementSensor.Properties().OdometerSupported || reading.TimedOdometerResponse == nil {
 		odometerDone = true
 	}
+	// the errors of the channels cartographer rejected as invalid
+	var imuErr, odometerErr error
+	// fail records the channels which could not be added as dropped and returns err
+	fail := func(err error) error {
+		if !imuDone {
+			imuErr = err
+		}
+		if !odometerDone {
+			odometerErr = err
+		}
+		config.recordMovementSensorReading(reading, imuErr, odometerErr)
+		return err
+	}
+	var backoff retryBackoff
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return fail(ctx.Err())
 		default:
 			if !odometerDone {
-				if err := config.tryAddOdometerReading(ctx, *reading.TimedOdometerResponse); err != nil {
-					if !errors.Is(err, cartofacade.ErrUnableToAcquireLock) {
-						config.Logger.Warnw("Retrying odometer sensor reading due to error from cartofacade", "error", err)
-					}
-				} else {
+				err := config.tryAddOdometerReading(ctx, *reading.TimedOdometerResponse)
+				switch {
+				case err == nil:
+					odometerDone = true
+				case cartofacade.IsInvalidInput(err):
+					config.Logger.Warnw("Skipping odometer sensor reading due to "+addErrorReason(err), "error", err)
+					odometerErr = err
 					odometerDone = true
+				case !isTransientAddError(err) || backoff.exhausted():
+					config.Logger.Errorw("Failed to add odometer sensor reading due to "+addErrorReason(err), "error", err)
+					return fail(err)
 				}
 			}
 			if !imuDone {
-				if err := config.tryAddIMUReading(ctx, *reading.TimedIMUResponse); err != nil {
-					if !errors.Is(err, cartofacade.ErrUnableToAcquireLock) {
-						config.Logger.Warnw("Retrying IMU sensor reading due to error from cartofacade", "error", err)
-					}
-				} else {
+				err := config.tryAddIMUReading(ctx, *reading.TimedIMUResponse)
+				switch {
+				case err == nil:
 					imuDone = true
+				case cartofacade.IsInvalidInput(err):
+					config.Logger.Warnw("Skipping IMU sensor reading due to "+addErrorReason(err), "error", err)
+					imuErr = err
+					imuDone = true
+				case !isTransientAddError(err) || backoff.exhausted():
+					config.Logger.Errorw("Failed to add IMU sensor reading due to "+addErrorReason(err), "error", err)
+					return fail(err)
 				}
 			}
 			if imuDone && odometerDone {
+				config.recordMovementSensorReading(reading, imuErr, odometerErr)
 				return nil
 			}
+			backoff.sleep(ctx)
 		}
 	}
 }
 
-// tryAddMovementSensorReadingOnce adds a reading to the carto facade and does not retry. Returns remainder of time interval.
-func (config *Config) tryAddMovementSensorReadingOnce(ctx context.Context, reading s.TimedMovementSensorReadingResponse) int {
-	startTime := time.Now().UTC()
-
+// tryAddMovementSensorReadingOnce adds a reading to the carto facade and does not retry.
+func (config *Config) tryAddMovementSensorReadingOnce(ctx context.Context, reading s.TimedMovementSensorReadingResponse) {
+	if err := config.validateMovementSensorReadingTime(reading); err != nil {
+		config.recordMovementSensorReading(reading, err, err)
+		return
+	}
+	var imuErr, odometerErr error
 	if config.MovementSensor.Properties().OdometerSupported {
-		if err := config.tryAddOdometerReading(ctx, *reading.TimedOdometerResponse); err != nil {
-			if errors.Is(err, cartofacade.ErrUnableToAcquireLock) {
-				config.Logger.Debugw("Skipping odometer sensor reading due to lock contention in cartofacade", "error", err)
+		if odometerErr = config.tryAddOdometerReading(ctx, *reading.TimedOdometerResponse); odometerErr != nil {
+			if cartofacade.IsRetryable(odometerErr) {
+				config.Logger.Debugw("Skipping odometer sensor reading due to "+addErrorReason(odometerErr), "error", odometerErr)
 			} else {
-				config.Logger.Warnw("Skipping odometer sensor reading due to error from cartofacade", "error", err)
+				config.Logger.Warnw("Skipping odometer sensor reading due to "+addErrorReason(odometerErr), "error", odometerErr)
 			}
 		}
 	}
 
 	if config.MovementSensor.Properties().IMUSupported {
-		if err := config.tryAddIMUReading(ctx, *reading.TimedIMUResponse); err != nil {
-			if errors.Is(err, cartofacade.ErrUnableToAcquireLock) {
-				config.Logger.Debugw("Skipping IMU sensor reading due to lock contention in cartofacade", "error", err)
+		if imuErr = config.tryAddIMUReading(ctx, *reading.TimedIMUResponse); imuErr != nil {
+			if cartofacade.IsRetryable(imuErr) {
+				config.Logger.Debugw("Skipping IMU sensor reading due to "+addErrorReason(imuErr), "error", imuErr)
 			} else {
-				config.Logger.Warnw("Skipping IMU sensor reading due to error from cartofacade", "error", err)
+				config.Logger.Warnw("Skipping IMU sensor reading due to "+addErrorReason(imuErr), "error", imuErr)
 			}
 		}
 	}
-
-	timeElapsedMs := int(time.Since(startTime).Milliseconds())
-	return int(math.Max(0, float64(1000/config.MovementSensor.DataFrequencyHz()-timeElapsedMs)))
+	config.recordMovementSensorReading(reading, imuErr, odometerErr)
 }
 
 // tryAddIMUReading tries to add an IMU reading to the carto facade.
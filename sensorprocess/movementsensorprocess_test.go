@@ -22,7 +22,7 @@ func TestStartMovementSensor(t *testing.T) {
 	cf := cartofacade.Mock{}
 
 	injectLidar := inject.TimedLidar{}
-	injectLidar.DataFrequencyHzFunc = func() int { return 5 }
+	injectLidar.DataFrequencyHzFunc = func() float64 { return 5 }
 
 	config := Config{
 		Logger:      logger,
@@ -36,7 +36,7 @@ func TestStartMovementSensor(t *testing.T) {
 		cancelCtx, cancelFunc := context.WithCancel(context.Background())
 
 		lidar, imu := s.NoLidar, s.FinishedReplayIMU
-		replaySensor, err := s.NewMovementSensor(context.Background(), s.SetupDeps(lidar, imu), string(imu), 20, logger)
+		replaySensor, err := s.NewMovementSensor(context.Background(), s.SetupDeps(lidar, imu), string(imu), 20, 0, nil, logger)
 		test.That(t, err, test.ShouldBeNil)
 
 		config.MovementSensor = replaySensor
@@ -53,7 +53,7 @@ func TestAddMovementSensorReadingInOnline(t *testing.T) {
 
 	injectMovementSensor := inject.TimedMovementSensor{}
 	injectMovementSensor.NameFunc = func() string { return "good_movement_sensor" }
-	injectMovementSensor.DataFrequencyHzFunc = func() int { return 20 }
+	injectMovementSensor.DataFrequencyHzFunc = func() float64 { return 20 }
 
 	config := Config{
 		Logger:         logger,
@@ -171,12 +171,12 @@ func TestTryAddMovementSensorReadingOnce(t *testing.T) {
 	cf := cartofacade.Mock{}
 
 	injectLidar := inject.TimedLidar{}
-	injectLidar.DataFrequencyHzFunc = func() int { return 5 }
+	injectLidar.DataFrequencyHzFunc = func() float64 { return 5 }
 
 	movementSensorName := "good_movement_sensor"
 	injectMovementSensor := inject.TimedMovementSensor{}
 	injectMovementSensor.NameFunc = func() string { return movementSensorName }
-	injectMovementSensor.DataFrequencyHzFunc = func() int { return 20 }
+	injectMovementSensor.DataFrequencyHzFunc = func() float64 { return 20 }
 
 	config := Config{
 		Logger:         logger,
@@ -231,11 +231,11 @@ func TestTryAddIMUReading(t *testing.T) {
 	}
 
 	injectLidar := inject.TimedLidar{}
-	injectLidar.DataFrequencyHzFunc = func() int { return 5 }
+	injectLidar.DataFrequencyHzFunc = func() float64 { return 5 }
 
 	injectImu := inject.TimedMovementSensor{}
 	injectImu.NameFunc = func() string { return "good_imu" }
-	injectImu.DataFrequencyHzFunc = func() int { return 20 }
+	injectImu.DataFrequencyHzFunc = func() float64 { return 20 }
 	injectImu.PropertiesFunc = func() s.MovementSensorProperties {
 		return s.MovementSensorProperties{
 			IMUSupported: true,
@@ -292,11 +292,11 @@ func TestTryAddOdometerReading(t *testing.T) {
 	}
 
 	injectLidar := inject.TimedLidar{}
-	injectLidar.DataFrequencyHzFunc = func() int { return 5 }
+	injectLidar.DataFrequencyHzFunc = func() float64 { return 5 }
 
 	injectOdometer := inject.TimedMovementSensor{}
 	injectOdometer.NameFunc = func() string { return "good_odometer" }
-	injectOdometer.DataFrequencyHzFunc = func() int { return 20 }
+	injectOdometer.DataFrequencyHzFunc = func() float64 { return 20 }
 	injectOdometer.PropertiesFunc = func() s.MovementSensorProperties {
 		return s.MovementSensorProperties{
 			OdometerSupported: true,
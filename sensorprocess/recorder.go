@@ -0,0 +1,200 @@
+package sensorprocess
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+)
+
+const (
+	// DefaultRecorderMaxFileSizeBytes is the default size after which the recorder starts a new JSON lines file.
+	DefaultRecorderMaxFileSizeBytes = 64 << 20
+	// recorderTimeFormat is the format of the timestamps in the names of recorded files. It keeps all
+	// digits of the reading times and sorts in time order.
+	recorderTimeFormat = "2006-01-02T15:04:05.000000000Z"
+)
+
+// RecorderConfig configures recording the readings added to cartographer to a local dataset directory.
+type RecorderConfig struct {
+	// Dir is the directory the dataset is written to. It is created if it does not exist.
+	Dir string
+	// MaxFileSizeBytes is the size after which a new JSON lines file is started. Zero uses the default.
+	MaxFileSizeBytes int64
+	// MaxTotalSizeBytes is the size of all written files after which recording stops. Zero disables the limit.
+	MaxTotalSizeBytes int64
+}
+
+// Recorder writes every reading added to cartographer, and whether it was accepted or dropped, to a local
+// dataset directory. Lidar readings are written as files named <lidar>_data_<timestamp>.<format>, e.g.
+// .pcd, and all readings are logged as s.DatasetRecords to rotated JSON lines files, so the directory can be
+// replayed with s.LocalDatasetLidar and s.LocalDatasetMovementSensor.
+type Recorder struct {
+	config    RecorderConfig
+	startTime string
+	logger    logging.Logger
+
+	mu        sync.Mutex
+	file      *os.File
+	fileIndex int
+	fileSize  int64
+	totalSize int64
+	full      bool
+}
+
+// NewRecorder returns a new Recorder that writes to the directory of the config.
+func NewRecorder(config RecorderConfig, logger logging.Logger) (*Recorder, error) {
+	if config.Dir == "" {
+		return nil, errors.New("recorder directory must be set")
+	}
+	if err := os.MkdirAll(config.Dir, 0o750); err != nil {
+		return nil, errors.Wrapf(err, "error creating recorder directory %v", config.Dir)
+	}
+	if config.MaxFileSizeBytes <= 0 {
+		config.MaxFileSizeBytes = DefaultRecorderMaxFileSizeBytes
+	}
+	return &Recorder{
+		config:    config,
+		startTime: time.Now().UTC().Format(recorderTimeFormat),
+		logger:    logger,
+	}, nil
+}
+
+// RecordLidarReading records a lidar reading that was added to cartographer with the given error. The
+// reading is written as it was passed to cartographer, in a file whose extension is the name of its format.
+func (r *Recorder) RecordLidarReading(name string, reading s.TimedLidarReadingResponse, addErr error) error {
+	data := reading.Reading
+	file := name + "_data_" + reading.ReadingTime.UTC().Format(recorderTimeFormat) + "." + reading.Format.String()
+	record := s.DatasetRecord{
+		Sensor: name,
+		Lidar:  s.NewDatasetLidarRecord(reading, file, addErr),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.reserve(int64(len(data))) {
+		return nil
+	}
+	if err := os.WriteFile(filepath.Join(r.config.Dir, file), data, 0o600); err != nil {
+		return errors.Wrapf(err, "error writing recorded lidar reading %v", file)
+	}
+	return r.writeRecord(record)
+}
+
+// RecordMovementSensorReading records the IMU and odometer readings of a movement sensor that were added to
+// cartographer with the given errors. A nil reading was not added and is not recorded.
+func (r *Recorder) RecordMovementSensorReading(name string,
+	imuReading *s.TimedIMUReadingResponse, imuErr error,
+	odometerReading *s.TimedOdometerReadingResponse, odometerErr error,
+) error {
+	if imuReading == nil && odometerReading == nil {
+		return nil
+	}
+	record := s.DatasetRecord{Sensor: name}
+	if imuReading != nil {
+		record.IMU = s.NewDatasetIMURecord(*imuReading, imuErr)
+	}
+	if odometerReading != nil {
+		record.Odometer = s.NewDatasetOdometerRecord(*odometerReading, odometerErr)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.writeRecord(record)
+}
+
+// Close closes the JSON lines file that is currently written.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// writeRecord appends a record to the current JSON lines file, starting a new file once the current one
+// reached its maximum size.
+func (r *Recorder) writeRecord(record s.DatasetRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if !r.reserve(int64(len(line))) {
+		return nil
+	}
+
+	if r.file != nil && r.fileSize+int64(len(line)) > r.config.MaxFileSizeBytes {
+		if err := r.file.Close(); err != nil {
+			return err
+		}
+		r.file = nil
+	}
+	if r.file == nil {
+		r.fileIndex++
+		path := filepath.Join(r.config.Dir, fmt.Sprintf("readings_%v_%04d.jsonl", r.startTime, r.fileIndex))
+		if r.file, err = os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600); err != nil {
+			return errors.Wrapf(err, "error creating recorder file %v", path)
+		}
+		r.fileSize = 0
+	}
+	n, err := r.file.Write(line)
+	r.fileSize += int64(n)
+	return err
+}
+
+// reserve accounts for writing size bytes. Returns false, and stops recording, if the total size limit
+// would be exceeded.
+func (r *Recorder) reserve(size int64) bool {
+	if r.full {
+		return false
+	}
+	if r.config.MaxTotalSizeBytes > 0 && r.totalSize+size > r.config.MaxTotalSizeBytes {
+		r.full = true
+		r.logger.Warnf("recorder reached its size limit of %d bytes, stopping recording to %v",
+			r.config.MaxTotalSizeBytes, r.config.Dir)
+		return false
+	}
+	r.totalSize += size
+	return true
+}
+
+// recordLidarReading records a lidar reading that was added to the cartofacade, if a recorder is configured.
+func (config *Config) recordLidarReading(reading s.TimedLidarReadingResponse, err error) {
+	if config.Recorder == nil {
+		return
+	}
+	if err := config.Recorder.RecordLidarReading(config.Lidar.Name(), reading, err); err != nil {
+		config.Logger.Warnw("Failed to record lidar reading", "error", err)
+	}
+}
+
+// recordMovementSensorReading records the supported channels of a movement sensor reading that was added
+// to the cartofacade, if a recorder is configured.
+func (config *Config) recordMovementSensorReading(reading s.TimedMovementSensorReadingResponse, imuErr, odometerErr error) {
+	if config.Recorder == nil {
+		return
+	}
+	var imuReading *s.TimedIMUReadingResponse
+	if config.MovementSensor.Properties().IMUSupported {
+		imuReading = reading.TimedIMUResponse
+	}
+	var odometerReading *s.TimedOdometerReadingResponse
+	if config.MovementSensor.Properties().OdometerSupported {
+		odometerReading = reading.TimedOdometerResponse
+	}
+	if err := config.Recorder.RecordMovementSensorReading(config.MovementSensor.Name(),
+		imuReading, imuErr, odometerReading, odometerErr); err != nil {
+		config.Logger.Warnw("Failed to record movement sensor reading", "error", err)
+	}
+}
@@ -0,0 +1,204 @@
+package sensorprocess
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/rdk/components/camera/replaypcd"
+	replaymovementsensor "go.viam.com/rdk/components/movementsensor/replay"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/test"
+
+	"github.com/viamrobotics/viam-cartographer/cartofacade"
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+	"github.com/viamrobotics/viam-cartographer/sensors/inject"
+)
+
+func readTestRecords(t *testing.T, dir string) []s.DatasetRecord {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	test.That(t, err, test.ShouldBeNil)
+	var records []s.DatasetRecord
+	for _, file := range files {
+		f, err := os.Open(file)
+		test.That(t, err, test.ShouldBeNil)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var record s.DatasetRecord
+			test.That(t, json.Unmarshal(scanner.Bytes(), &record), test.ShouldBeNil)
+			records = append(records, record)
+		}
+		test.That(t, f.Close(), test.ShouldBeNil)
+	}
+	return records
+}
+
+func TestRecorder(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+
+	t.Run("Records accepted and dropped readings which can be replayed", func(t *testing.T) {
+		dir := t.TempDir()
+		recorder, err := NewRecorder(RecorderConfig{Dir: filepath.Join(dir, "session")}, logger)
+		test.That(t, err, test.ShouldBeNil)
+
+		cf := cartofacade.Mock{}
+		cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration, sensorName string,
+			currentReading s.TimedLidarReadingResponse,
+		) error {
+			if currentReading.ReadingTime.Equal(start.Add(time.Second)) {
+				return errUnknown
+			}
+			return nil
+		}
+		cf.AddIMUReadingFunc = func(ctx context.Context, timeout time.Duration, sensorName string,
+			currentReading s.TimedIMUReadingResponse,
+		) error {
+			return cartofacade.ErrUnableToAcquireLock
+		}
+		cf.AddOdometerReadingFunc = func(ctx context.Context, timeout time.Duration, sensorName string,
+			currentReading s.TimedOdometerReadingResponse,
+		) error {
+			return nil
+		}
+
+		injectLidar := inject.TimedLidar{}
+		injectLidar.NameFunc = func() string { return "lidar" }
+		injectLidar.DataFrequencyHzFunc = func() float64 { return 5 }
+		injectMovementSensor := inject.TimedMovementSensor{}
+		injectMovementSensor.NameFunc = func() string { return "ms" }
+		injectMovementSensor.DataFrequencyHzFunc = func() float64 { return 20 }
+		injectMovementSensor.PropertiesFunc = func() s.MovementSensorProperties {
+			return s.MovementSensorProperties{IMUSupported: true, OdometerSupported: true}
+		}
+
+		config := Config{
+			Logger:         logger,
+			CartoFacade:    &cf,
+			IsOnline:       true,
+			Lidar:          &injectLidar,
+			MovementSensor: &injectMovementSensor,
+			Recorder:       recorder,
+			Timeout:        10 * time.Second,
+		}
+
+		pc := pointcloud.New()
+		test.That(t, pc.Set(r3.Vector{X: 1000, Y: 2000}, pointcloud.NewBasicData().SetIntensity(700)), test.ShouldBeNil)
+		intensityReading, err := s.EncodeLidarReading(pc, s.LidarReadingFormatPointsIntensity)
+		test.That(t, err, test.ShouldBeNil)
+		lidarReadings := []s.TimedLidarReadingResponse{
+			toTestLidarReading(t, start, r3.Vector{X: 1000}, r3.Vector{Y: 2000}),
+			toTestLidarReading(t, start.Add(time.Second), r3.Vector{X: -1000}),
+			{
+				Reading:     intensityReading,
+				ReadingTime: start.Add(2 * time.Second),
+				Format:      s.LidarReadingFormatPointsIntensity,
+			},
+		}
+		for _, reading := range lidarReadings {
+			config.tryAddLidarReadingOnce(ctx, reading)
+		}
+
+		imuReading := s.TimedIMUReadingResponse{
+			LinearAcceleration: r3.Vector{X: 0.1, Y: -9.81, Z: 1.0 / 3},
+			AngularVelocity:    spatialmath.AngularVelocity{Z: 0.7},
+			ReadingTime:        start.Add(500 * time.Millisecond),
+		}
+		odometerReading := s.TimedOdometerReadingResponse{
+			Position:    geo.NewPoint(40.7, -73.9),
+			Orientation: &spatialmath.Quaternion{Real: 0.8, Imag: -0.2, Jmag: 0.5, Kmag: -0.1},
+			ReadingTime: start.Add(400 * time.Millisecond),
+		}
+		config.tryAddMovementSensorReadingOnce(ctx, s.TimedMovementSensorReadingResponse{
+			TimedIMUResponse:      &imuReading,
+			TimedOdometerResponse: &odometerReading,
+		})
+		test.That(t, recorder.Close(), test.ShouldBeNil)
+
+		records := readTestRecords(t, filepath.Join(dir, "session"))
+		test.That(t, len(records), test.ShouldEqual, 4)
+		test.That(t, records[0].Sensor, test.ShouldEqual, "lidar")
+		test.That(t, records[0].Lidar.Accepted, test.ShouldBeTrue)
+		test.That(t, records[0].Lidar.Format, test.ShouldEqual, "pcd")
+		test.That(t, records[1].Lidar.Accepted, test.ShouldBeFalse)
+		test.That(t, records[1].Lidar.Error, test.ShouldEqual, errUnknown.Error())
+		test.That(t, records[2].Lidar.Accepted, test.ShouldBeTrue)
+		test.That(t, records[2].Lidar.Format, test.ShouldEqual, "points_intensity")
+		test.That(t, filepath.Ext(records[2].Lidar.File), test.ShouldEqual, ".points_intensity")
+		test.That(t, records[3].Sensor, test.ShouldEqual, "ms")
+		test.That(t, records[3].IMU.Accepted, test.ShouldBeFalse)
+		test.That(t, records[3].IMU.Error, test.ShouldEqual, cartofacade.ErrUnableToAcquireLock.Error())
+		test.That(t, records[3].Odometer.Accepted, test.ShouldBeTrue)
+
+		// the recorded session replays the exact accepted readings in their original format, and skips
+		// the dropped ones
+		replayLidar, err := s.NewLocalDatasetLidar("lidar", filepath.Join(dir, "session"), logger)
+		test.That(t, err, test.ShouldBeNil)
+		for _, expected := range []s.TimedLidarReadingResponse{lidarReadings[0], lidarReadings[2]} {
+			reading, err := replayLidar.TimedLidarReading(ctx)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, reading.Reading, test.ShouldResemble, expected.Reading)
+			test.That(t, reading.ReadingTime, test.ShouldEqual, expected.ReadingTime)
+			test.That(t, reading.Format, test.ShouldEqual, expected.Format)
+		}
+		_, err = replayLidar.TimedLidarReading(ctx)
+		test.That(t, errors.Is(err, replaypcd.ErrEndOfDataset), test.ShouldBeTrue)
+
+		replayMovementSensor, err := s.NewLocalDatasetMovementSensor("ms", filepath.Join(dir, "session"))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, replayMovementSensor.Properties(), test.ShouldResemble,
+			s.MovementSensorProperties{IMUSupported: true, OdometerSupported: true})
+		reading, err := replayMovementSensor.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading.TimedIMUResponse, test.ShouldBeNil)
+		test.That(t, reading.TimedOdometerResponse.ReadingTime, test.ShouldEqual, odometerReading.ReadingTime)
+		test.That(t, reading.TimedOdometerResponse.Position, test.ShouldResemble, odometerReading.Position)
+		test.That(t, reading.TimedOdometerResponse.Orientation.Quaternion(), test.ShouldResemble,
+			odometerReading.Orientation.Quaternion())
+		_, err = replayMovementSensor.TimedMovementSensorReading(ctx)
+		test.That(t, errors.Is(err, replaymovementsensor.ErrEndOfDataset), test.ShouldBeTrue)
+	})
+
+	t.Run("Rotates the JSON lines files and stops at the size limit", func(t *testing.T) {
+		dir := t.TempDir()
+		recorder, err := NewRecorder(RecorderConfig{Dir: dir, MaxFileSizeBytes: 1, MaxTotalSizeBytes: 1000}, logger)
+		test.That(t, err, test.ShouldBeNil)
+
+		for i := 0; i < 20; i++ {
+			imuReading := s.TimedIMUReadingResponse{ReadingTime: start.Add(time.Duration(i) * time.Millisecond)}
+			test.That(t, recorder.RecordMovementSensorReading("imu", &imuReading, nil, nil, nil), test.ShouldBeNil)
+		}
+		test.That(t, recorder.Close(), test.ShouldBeNil)
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+		test.That(t, err, test.ShouldBeNil)
+		records := readTestRecords(t, dir)
+		test.That(t, len(records), test.ShouldBeGreaterThan, 0)
+		test.That(t, len(records), test.ShouldBeLessThan, 20)
+		test.That(t, len(files), test.ShouldEqual, len(records))
+
+		var totalSize int64
+		for _, file := range files {
+			info, err := os.Stat(file)
+			test.That(t, err, test.ShouldBeNil)
+			totalSize += info.Size()
+		}
+		test.That(t, totalSize, test.ShouldBeLessThanOrEqualTo, 1000)
+	})
+
+	t.Run("Failed creation without a directory", func(t *testing.T) {
+		_, err := NewRecorder(RecorderConfig{}, logger)
+		test.That(t, err, test.ShouldBeError)
+	})
+}
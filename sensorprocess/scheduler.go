@@ -0,0 +1,124 @@
+package sensorprocess
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SchedulerStats is a snapshot of how closely a Scheduler kept to its polling rate.
+type SchedulerStats struct {
+	// TargetFrequencyHz is the configured polling rate.
+	TargetFrequencyHz float64
+	// ActualFrequencyHz is the average polling rate since the first poll.
+	ActualFrequencyHz float64
+	// Samples is the number of polls the scheduler started.
+	Samples uint64
+	// MissedDeadlines counts the polls which ran past the start of the next poll.
+	MissedDeadlines uint64
+	// MeanJitter and MaxJitter are the mean and maximum difference between the time between polls and
+	// the polling period.
+	MeanJitter time.Duration
+	MaxJitter  time.Duration
+}
+
+// Scheduler paces polling a sensor at a fixed rate. Unlike sleeping the remainder of each interval, it keeps
+// the polls on a fixed grid of deadlines, so time spent polling does not add up to a drift, and it supports
+// rates which are not a whole number of Hz. A nil Scheduler does not pace the polls.
+type Scheduler struct {
+	frequencyHz float64
+	period      time.Duration
+
+	mu sync.Mutex
+	// next is the deadline of the next poll, or zero before the first poll
+	next            time.Time
+	firstSample     time.Time
+	lastSample      time.Time
+	samples         uint64
+	missedDeadlines uint64
+	jitterSum       time.Duration
+	maxJitter       time.Duration
+}
+
+// NewScheduler returns a Scheduler which polls at dataFrequencyHz, which must be positive.
+func NewScheduler(dataFrequencyHz float64) *Scheduler {
+	return &Scheduler{
+		frequencyHz: dataFrequencyHz,
+		period:      time.Duration(float64(time.Second) / dataFrequencyHz),
+	}
+}
+
+// Stats returns the polling statistics of the scheduler.
+func (s *Scheduler) Stats() SchedulerStats {
+	if s == nil {
+		return SchedulerStats{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := SchedulerStats{
+		TargetFrequencyHz: s.frequencyHz,
+		Samples:           s.samples,
+		MissedDeadlines:   s.missedDeadlines,
+		MaxJitter:         s.maxJitter,
+	}
+	if s.samples > 1 {
+		stats.MeanJitter = s.jitterSum / time.Duration(s.samples-1)
+		stats.ActualFrequencyHz = float64(s.samples-1) / s.lastSample.Sub(s.firstSample).Seconds()
+	}
+	return stats
+}
+
+// wait is called after each poll and blocks until the deadline of the next poll. If the poll ran past
+// that deadline it returns immediately and the deadlines which passed are skipped, like a time.Ticker
+// drops ticks. Returns the context error if the context is done first.
+func (s *Scheduler) wait(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	now := time.Now()
+	if s.next.IsZero() {
+		s.next = now.Add(s.period)
+	}
+	if now.After(s.next) {
+		s.missedDeadlines++
+		s.next = s.next.Add((now.Sub(s.next)/s.period + 1) * s.period)
+		s.recordSample(now)
+		s.mu.Unlock()
+		return nil
+	}
+	deadline := s.next
+	s.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next = deadline.Add(s.period)
+	s.recordSample(time.Now())
+	return nil
+}
+
+// recordSample records the start of a poll. Must be called with the lock held.
+func (s *Scheduler) recordSample(sampleTime time.Time) {
+	if s.samples == 0 {
+		s.firstSample = sampleTime
+	} else {
+		jitter := sampleTime.Sub(s.lastSample) - s.period
+		if jitter < 0 {
+			jitter = -jitter
+		}
+		s.jitterSum += jitter
+		if jitter > s.maxJitter {
+			s.maxJitter = jitter
+		}
+	}
+	s.lastSample = sampleTime
+	s.samples++
+}
@@ -0,0 +1,65 @@
+package sensorprocess
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("a nil scheduler does not wait", func(t *testing.T) {
+		var scheduler *Scheduler
+		test.That(t, scheduler.wait(ctx), test.ShouldBeNil)
+		test.That(t, scheduler.Stats(), test.ShouldResemble, SchedulerStats{})
+	})
+
+	t.Run("keeps the polls on a grid of deadlines at a fractional rate", func(t *testing.T) {
+		scheduler := NewScheduler(12.5)
+		test.That(t, scheduler.period, test.ShouldEqual, 80*time.Millisecond)
+
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			// time spent polling does not delay the next poll
+			time.Sleep(10 * time.Millisecond)
+			test.That(t, scheduler.wait(ctx), test.ShouldBeNil)
+		}
+		test.That(t, time.Since(start), test.ShouldBeBetween, 5*80*time.Millisecond, 5*80*time.Millisecond+50*time.Millisecond)
+
+		stats := scheduler.Stats()
+		test.That(t, stats.TargetFrequencyHz, test.ShouldEqual, 12.5)
+		test.That(t, stats.Samples, test.ShouldEqual, 5)
+		test.That(t, stats.MissedDeadlines, test.ShouldEqual, 0)
+		test.That(t, stats.ActualFrequencyHz, test.ShouldAlmostEqual, 12.5, 2)
+		test.That(t, stats.MaxJitter, test.ShouldBeLessThan, 40*time.Millisecond)
+		test.That(t, stats.MeanJitter, test.ShouldBeLessThanOrEqualTo, stats.MaxJitter)
+	})
+
+	t.Run("polls immediately after a missed deadline and skips the deadlines which passed", func(t *testing.T) {
+		scheduler := NewScheduler(20)
+		test.That(t, scheduler.wait(ctx), test.ShouldBeNil)
+
+		// the poll takes more than two periods
+		time.Sleep(120 * time.Millisecond)
+		start := time.Now()
+		test.That(t, scheduler.wait(ctx), test.ShouldBeNil)
+		test.That(t, time.Since(start), test.ShouldBeLessThan, 10*time.Millisecond)
+		test.That(t, scheduler.next.After(time.Now()), test.ShouldBeTrue)
+
+		stats := scheduler.Stats()
+		test.That(t, stats.Samples, test.ShouldEqual, 2)
+		test.That(t, stats.MissedDeadlines, test.ShouldEqual, 1)
+		test.That(t, stats.MaxJitter, test.ShouldBeGreaterThanOrEqualTo, 70*time.Millisecond)
+	})
+
+	t.Run("returns the context error if the context is done before the deadline", func(t *testing.T) {
+		scheduler := NewScheduler(0.5)
+		cancelCtx, cancelFunc := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancelFunc()
+		test.That(t, scheduler.wait(cancelCtx), test.ShouldEqual, context.DeadlineExceeded)
+		test.That(t, scheduler.Stats().Samples, test.ShouldEqual, 0)
+	})
+}
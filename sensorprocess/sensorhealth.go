@@ -0,0 +1,188 @@
+package sensorprocess
+
+import (
+	"context"
+	"hash/maphash"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// failedAfterConsecutiveFailures is the number of consecutive failed readings after which a sensor is failed.
+	failedAfterConsecutiveFailures = 10
+	// frozenAfterIdenticalReadings is the number of consecutive identical readings after which a sensor is
+	// considered frozen.
+	frozenAfterIdenticalReadings = 5
+	// minSensorBackoff is the time waited before polling a sensor again after its first failed reading.
+	minSensorBackoff = 100 * time.Millisecond
+	// maxSensorBackoff bounds the time waited between polls of a failing sensor, which doubles with every failure.
+	maxSensorBackoff = 5 * time.Second
+)
+
+// ErrSensorFrozen denotes that a sensor keeps returning identical readings.
+var ErrSensorFrozen = errors.New("sensor keeps returning identical readings")
+
+// SensorHealthState describes whether a sensor returns usable readings.
+type SensorHealthState string
+
+const (
+	// SensorHealthy means the last reading of the sensor succeeded.
+	SensorHealthy SensorHealthState = "healthy"
+	// SensorDegraded means the last readings of the sensor failed or were identical.
+	SensorDegraded SensorHealthState = "degraded"
+	// SensorFailed means the sensor failed failedAfterConsecutiveFailures readings in a row.
+	SensorFailed SensorHealthState = "failed"
+)
+
+// SensorHealthStatus is a snapshot of the health of a sensor.
+type SensorHealthStatus struct {
+	State               SensorHealthState
+	ConsecutiveFailures int
+	// IdenticalReadings counts the consecutive readings identical to the one before them.
+	IdenticalReadings int
+	// LastReadingTime is the time of the last successful reading, or zero if there was none.
+	LastReadingTime time.Time
+	// Err is the error of the last failed reading, or ErrSensorFrozen if the sensor is frozen.
+	Err error
+}
+
+// SensorHealth tracks the health of a sensor from the outcome of its readings. It is safe for concurrent
+// use, and a nil SensorHealth tracks nothing.
+type SensorHealth struct {
+	mu                  sync.Mutex
+	consecutiveFailures int
+	identicalReadings   int
+	seed                maphash.Seed
+	lastReadingHash     uint64
+	lastReadingTime     time.Time
+	lastErr             error
+}
+
+// NewSensorHealth returns a new SensorHealth of a healthy sensor.
+func NewSensorHealth() *SensorHealth {
+	return &SensorHealth{seed: maphash.MakeSeed()}
+}
+
+// Status returns the current health of the sensor.
+func (health *SensorHealth) Status() SensorHealthStatus {
+	if health == nil {
+		return SensorHealthStatus{State: SensorHealthy}
+	}
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	status := SensorHealthStatus{
+		State:               health.state(),
+		ConsecutiveFailures: health.consecutiveFailures,
+		IdenticalReadings:   health.identicalReadings,
+		LastReadingTime:     health.lastReadingTime,
+		Err:                 health.lastErr,
+	}
+	if status.ConsecutiveFailures == 0 && status.IdenticalReadings >= frozenAfterIdenticalReadings {
+		status.Err = ErrSensorFrozen
+	}
+	return status
+}
+
+// recordSuccess records a successful reading, and returns the states of the sensor before and after it.
+// A nil reading is not checked for being identical to the previous one.
+func (health *SensorHealth) recordSuccess(reading []byte) (SensorHealthState, SensorHealthState) {
+	if health == nil {
+		return SensorHealthy, SensorHealthy
+	}
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	before := health.state()
+	if reading != nil {
+		hash := maphash.Bytes(health.seed, reading)
+		if !health.lastReadingTime.IsZero() && hash == health.lastReadingHash {
+			health.identicalReadings++
+		} else {
+			health.identicalReadings = 0
+		}
+		health.lastReadingHash = hash
+	}
+	health.consecutiveFailures = 0
+	health.lastErr = nil
+	health.lastReadingTime = time.Now()
+	return before, health.state()
+}
+
+// recordFailure records a failed reading, and returns the states of the sensor before and after it.
+func (health *SensorHealth) recordFailure(err error) (SensorHealthState, SensorHealthState) {
+	if health == nil {
+		return SensorHealthy, SensorHealthy
+	}
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	before := health.state()
+	health.consecutiveFailures++
+	health.lastErr = err
+	return before, health.state()
+}
+
+// backoff returns the time to wait before polling the sensor again, which doubles with every consecutive
+// failure up to maxSensorBackoff.
+func (health *SensorHealth) backoff() time.Duration {
+	if health == nil {
+		return 0
+	}
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	if health.consecutiveFailures == 0 {
+		return 0
+	}
+	wait := minSensorBackoff
+	for i := 1; i < health.consecutiveFailures && wait < maxSensorBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxSensorBackoff)
+}
+
+// state derives the state of the sensor. Must be called with the lock held.
+func (health *SensorHealth) state() SensorHealthState {
+	switch {
+	case health.consecutiveFailures >= failedAfterConsecutiveFailures:
+		return SensorFailed
+	case health.consecutiveFailures > 0, health.identicalReadings >= frozenAfterIdenticalReadings:
+		return SensorDegraded
+	default:
+		return SensorHealthy
+	}
+}
+
+// sensorReadingFailed records a failed reading of a sensor, logs it and waits out the backoff of the sensor.
+// Only changes of the health state are logged as warnings, so a failing sensor does not flood the logs.
+func (config *Config) sensorReadingFailed(ctx context.Context, health *SensorHealth, sensorName string, err error) {
+	before, after := health.recordFailure(err)
+	if health == nil || before != after {
+		config.Logger.Warnw("Sensor health changed", "sensor", sensorName, "state", after, "error", err)
+	} else {
+		config.Logger.Debugw("Failed to get sensor reading", "sensor", sensorName, "error", err)
+	}
+
+	wait := health.backoff()
+	if wait == 0 {
+		return
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// sensorReadingSucceeded records a successful reading of a sensor and logs changes of its health state.
+func (config *Config) sensorReadingSucceeded(health *SensorHealth, sensorName string, reading []byte) {
+	before, after := health.recordSuccess(reading)
+	if before == after {
+		return
+	}
+	if after == SensorHealthy {
+		config.Logger.Infow("Sensor recovered", "sensor", sensorName)
+	} else {
+		config.Logger.Warnw("Sensor health changed", "sensor", sensorName, "state", after, "error", ErrSensorFrozen)
+	}
+}
@@ -0,0 +1,103 @@
+package sensorprocess
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+)
+
+func TestSensorHealth(t *testing.T) {
+	t.Run("a nil sensor health is always healthy", func(t *testing.T) {
+		var health *SensorHealth
+		health.recordFailure(errUnknown)
+		test.That(t, health.Status(), test.ShouldResemble, SensorHealthStatus{State: SensorHealthy})
+		test.That(t, health.backoff(), test.ShouldEqual, 0)
+	})
+
+	t.Run("degrades on a failed reading, fails after consecutive failures and recovers on success", func(t *testing.T) {
+		health := NewSensorHealth()
+		test.That(t, health.Status().State, test.ShouldEqual, SensorHealthy)
+
+		before, after := health.recordFailure(errUnknown)
+		test.That(t, before, test.ShouldEqual, SensorHealthy)
+		test.That(t, after, test.ShouldEqual, SensorDegraded)
+		test.That(t, health.Status().Err, test.ShouldEqual, errUnknown)
+
+		for i := 1; i < failedAfterConsecutiveFailures; i++ {
+			_, after = health.recordFailure(errUnknown)
+		}
+		test.That(t, after, test.ShouldEqual, SensorFailed)
+		test.That(t, health.Status().ConsecutiveFailures, test.ShouldEqual, failedAfterConsecutiveFailures)
+
+		before, after = health.recordSuccess([]byte("reading"))
+		test.That(t, before, test.ShouldEqual, SensorFailed)
+		test.That(t, after, test.ShouldEqual, SensorHealthy)
+		status := health.Status()
+		test.That(t, status.ConsecutiveFailures, test.ShouldEqual, 0)
+		test.That(t, status.Err, test.ShouldBeNil)
+		test.That(t, status.LastReadingTime.IsZero(), test.ShouldBeFalse)
+	})
+
+	t.Run("degrades when the readings are identical", func(t *testing.T) {
+		health := NewSensorHealth()
+		health.recordSuccess([]byte("frozen"))
+		for i := 1; i < frozenAfterIdenticalReadings; i++ {
+			_, after := health.recordSuccess([]byte("frozen"))
+			test.That(t, after, test.ShouldEqual, SensorHealthy)
+		}
+		_, after := health.recordSuccess([]byte("frozen"))
+		test.That(t, after, test.ShouldEqual, SensorDegraded)
+		test.That(t, health.Status().Err, test.ShouldBeError, ErrSensorFrozen)
+
+		_, after = health.recordSuccess([]byte("moving"))
+		test.That(t, after, test.ShouldEqual, SensorHealthy)
+		test.That(t, health.Status().IdenticalReadings, test.ShouldEqual, 0)
+	})
+
+	t.Run("does not compare readings which are not given", func(t *testing.T) {
+		health := NewSensorHealth()
+		for i := 0; i <= frozenAfterIdenticalReadings; i++ {
+			health.recordSuccess(nil)
+		}
+		test.That(t, health.Status().State, test.ShouldEqual, SensorHealthy)
+	})
+
+	t.Run("doubles the backoff with every consecutive failure up to the cap", func(t *testing.T) {
+		health := NewSensorHealth()
+		test.That(t, health.backoff(), test.ShouldEqual, 0)
+		health.recordFailure(errUnknown)
+		test.That(t, health.backoff(), test.ShouldEqual, minSensorBackoff)
+		health.recordFailure(errUnknown)
+		test.That(t, health.backoff(), test.ShouldEqual, 2*minSensorBackoff)
+		for i := 0; i < 20; i++ {
+			health.recordFailure(errUnknown)
+		}
+		test.That(t, health.backoff(), test.ShouldEqual, maxSensorBackoff)
+		health.recordSuccess(nil)
+		test.That(t, health.backoff(), test.ShouldEqual, 0)
+	})
+}
+
+func TestSensorReadingFailed(t *testing.T) {
+	config := Config{Logger: logging.NewTestLogger(t)}
+	health := NewSensorHealth()
+
+	t.Run("waits out the backoff of the sensor", func(t *testing.T) {
+		start := time.Now()
+		config.sensorReadingFailed(context.Background(), health, "good_lidar", errUnknown)
+		test.That(t, time.Since(start), test.ShouldBeGreaterThanOrEqualTo, minSensorBackoff)
+		test.That(t, health.Status().State, test.ShouldEqual, SensorDegraded)
+	})
+
+	t.Run("stops waiting when the context is done", func(t *testing.T) {
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		cancelFunc()
+		start := time.Now()
+		config.sensorReadingFailed(ctx, health, "good_lidar", errUnknown)
+		test.That(t, time.Since(start), test.ShouldBeLessThan, minSensorBackoff)
+		test.That(t, health.Status().ConsecutiveFailures, test.ShouldEqual, 2)
+	})
+}
@@ -23,6 +23,13 @@ const (
 	movementSensor
 )
 
+func (t sensorType) String() string {
+	if t == lidar {
+		return "lidar"
+	}
+	return "movement_sensor"
+}
+
 type offlineSensorReadingTime struct {
 	sensorType  sensorType
 	readingTime time.Time
@@ -33,14 +40,92 @@ type Config struct {
 	CartoFacade cartofacade.Interface
 	IsOnline    bool
 
-	Lidar          s.TimedLidar
-	MovementSensor s.TimedMovementSensor
+	Lidar            s.TimedLidar
+	MovementSensor   s.TimedMovementSensor
+	LidarAccumulator *LidarAccumulator
+	Recorder         *Recorder
+	Progress         *JobProgress
+	Gate             *IngestGate
+	IngestQueue      *IngestQueue
+	// Trajectory records the pose after every lidar reading in offline mode.
+	Trajectory *Trajectory
+	// LidarScheduler and MovementSensorScheduler pace polling the sensors in online mode.
+	LidarScheduler          *Scheduler
+	MovementSensorScheduler *Scheduler
+	// LidarHealth and MovementSensorHealth track failing and frozen sensors in online mode.
+	LidarHealth          *SensorHealth
+	MovementSensorHealth *SensorHealth
+	// TimestampValidator rejects readings which go back in time and detects skewed sensor clocks.
+	TimestampValidator *TimestampValidator
+	// MotionGate skips lidar readings while the robot is stationary.
+	MotionGate *MotionGate
+	// MovementSensorOutage adds gravity-only IMU readings while the movement sensor is out in online mode.
+	MovementSensorOutage *MovementSensorOutage
+	// MapRenderer is told about every added lidar reading, to render the map once enough nodes were added.
+	MapRenderer *cartofacade.MapRenderer
 
 	Timeout         time.Duration
 	InternalTimeout time.Duration
 	Logger          logging.Logger
 }
 
+const (
+	// minRetryWait is the time waited before the first retry of a reading the cartofacade did not add.
+	minRetryWait = time.Millisecond
+	// maxRetryWait bounds the time waited between retries, which doubles with every retry.
+	maxRetryWait = 100 * time.Millisecond
+	// maxRetryDuration bounds how long a reading is retried in offline mode before its error fails the job.
+	maxRetryDuration = time.Minute
+)
+
+// addErrorReason explains why a reading could not be added to the cartofacade, by the class of the error.
+func addErrorReason(err error) string {
+	switch cartofacade.ErrorClassOf(err) {
+	case cartofacade.ErrorClassRetryable:
+		return "lock contention in cartofacade"
+	case cartofacade.ErrorClassInvalidInput:
+		return "cartographer rejecting it as invalid"
+	case cartofacade.ErrorClassState:
+		return "cartographer not being ready for it"
+	default:
+		return "error from cartofacade"
+	}
+}
+
+// isTransientAddError returns whether a reading could not be added to the cartofacade only because cartographer
+// was locked, busy with another call, not ready for it or restarting, so that retrying it can succeed.
+func isTransientAddError(err error) bool {
+	return cartofacade.IsRetryable(err) || cartofacade.IsStateError(err) ||
+		errors.Is(err, cartofacade.ErrTimeoutWriting) || errors.Is(err, cartofacade.ErrTimeoutReading) ||
+		errors.Is(err, cartofacade.ErrRestarting)
+}
+
+// retryBackoff waits between retries of adding a reading to the cartofacade, so that retrying
+// while cartographer is locked does not keep a CPU core busy.
+type retryBackoff struct {
+	wait  time.Duration
+	start time.Time
+}
+
+// exhausted returns whether the reading was retried for maxRetryDuration since the first retry.
+func (backoff *retryBackoff) exhausted() bool {
+	return !backoff.start.IsZero() && time.Since(backoff.start) >= maxRetryDuration
+}
+
+// sleep waits before the next retry, or until the context is done.
+func (backoff *retryBackoff) sleep(ctx context.Context) {
+	if backoff.start.IsZero() {
+		backoff.start = time.Now()
+	}
+	backoff.wait = min(max(2*backoff.wait, minRetryWait), maxRetryWait)
+	timer := time.NewTimer(backoff.wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
 // getInitialMovementSensorReading gets the initial movement sensor reading.
 // It discards all movement sensor readings that were recorded before the first lidar reading.
 func (config *Config) getInitialMovementSensorReading(ctx context.Context,
@@ -56,13 +141,14 @@ func (config *Config) getInitialMovementSensorReading(ctx context.Context,
 			return s.TimedMovementSensorReadingResponse{}, err
 		}
 
+		// the IMU and odometer are synchronized separately, so use the earlier of their reading times. Replayed
+		// readings leave out the channels which were dropped while the dataset was recorded
 		var readingTime time.Time
-		if config.MovementSensor.Properties().OdometerSupported {
-			// we can assume that the odometer reading time is earlier than the imu reading
-			// time, since the odometer reading is taken before the imu reading
+		if config.MovementSensor.Properties().OdometerSupported && movementSensorReading.TimedOdometerResponse != nil {
 			readingTime = movementSensorReading.TimedOdometerResponse.ReadingTime
-		} else {
-			// we reach this case if the odometer is not supported
+		}
+		if config.MovementSensor.Properties().IMUSupported && movementSensorReading.TimedIMUResponse != nil &&
+			(readingTime.IsZero() || movementSensorReading.TimedIMUResponse.ReadingTime.Before(readingTime)) {
 			readingTime = movementSensorReading.TimedIMUResponse.ReadingTime
 		}
 
@@ -80,8 +166,9 @@ func (config *Config) StartOfflineSensorProcess(ctx context.Context) bool {
 	lidarReading, err := config.Lidar.TimedLidarReading(ctx)
 	if err != nil {
 		config.Logger.Warn(err)
-		return strings.Contains(err.Error(), replaypcd.ErrEndOfDataset.Error())
+		return config.endOfflineSensorProcess(err, strings.Contains(err.Error(), replaypcd.ErrEndOfDataset.Error()))
 	}
+	config.Progress.setDataset(lidarReading.ReadingTime, config.Lidar, config.MovementSensor)
 
 	var movementSensorReading s.TimedMovementSensorReadingResponse
 	if config.MovementSensor != nil && (config.MovementSensor.Properties().IMUSupported ||
@@ -90,7 +177,7 @@ func (config *Config) StartOfflineSensorProcess(ctx context.Context) bool {
 		movementSensorReading, err = config.getInitialMovementSensorReading(ctx, lidarReading)
 		if err != nil {
 			config.Logger.Warn(err)
-			return strings.Contains(err.Error(), replaymovementsensor.ErrEndOfDataset.Error())
+			return config.endOfflineSensorProcess(err, strings.Contains(err.Error(), replaymovementsensor.ErrEndOfDataset.Error()))
 		}
 	}
 
@@ -100,6 +187,11 @@ func (config *Config) StartOfflineSensorProcess(ctx context.Context) bool {
 		case <-ctx.Done():
 			return false
 		default:
+			// hold the next reading while ingestion is paused
+			if _, err := config.Gate.wait(ctx); err != nil {
+				return false
+			}
+
 			// create a map of supported sensors and their reading time stamps
 			readingTimes := []offlineSensorReadingTime{
 				{sensorType: lidar, readingTime: lidarReading.ReadingTime},
@@ -108,13 +200,15 @@ func (config *Config) StartOfflineSensorProcess(ctx context.Context) bool {
 			// taken before the lidar time stamp, but the imu time stamp was taken after the lidar time
 			// stamp, we'll want to prioritize adding the lidar measurement before adding the movement
 			// sensor measurement
-			if config.MovementSensor != nil && config.MovementSensor.Properties().IMUSupported {
+			if config.MovementSensor != nil && config.MovementSensor.Properties().IMUSupported &&
+				movementSensorReading.TimedIMUResponse != nil {
 				readingTimes = append(readingTimes,
 					offlineSensorReadingTime{
 						sensorType:  movementSensor,
 						readingTime: movementSensorReading.TimedIMUResponse.ReadingTime,
 					})
-			} else if config.MovementSensor != nil && config.MovementSensor.Properties().OdometerSupported {
+			} else if config.MovementSensor != nil && config.MovementSensor.Properties().OdometerSupported &&
+				movementSensorReading.TimedOdometerResponse != nil {
 				readingTimes = append(readingTimes,
 					offlineSensorReadingTime{
 						sensorType:  movementSensor,
@@ -136,7 +230,11 @@ func (config *Config) StartOfflineSensorProcess(ctx context.Context) bool {
 			// insert the reading with the earliest time stamp
 			switch readingTimes[0].sensorType {
 			case lidar:
-				if err := config.tryAddLidarReadingUntilSuccess(ctx, lidarReading); err != nil {
+				if err := config.addLidarReadingInOffline(ctx, lidarReading); err != nil {
+					// adding the reading only failed the job if it did not stop because the context is done
+					if ctx.Err() == nil {
+						config.endOfflineSensorProcess(err, false)
+					}
 					return false
 				}
 
@@ -147,10 +245,13 @@ func (config *Config) StartOfflineSensorProcess(ctx context.Context) bool {
 					if lidarEndOfDataSetReached {
 						config.runFinalOptimization(ctx)
 					}
-					return lidarEndOfDataSetReached
+					return config.endOfflineSensorProcess(err, lidarEndOfDataSetReached)
 				}
 			case movementSensor:
-				if err := config.tryAddMovementSensorReadingUntilSuccess(ctx, movementSensorReading); err != nil {
+				if err := config.addMovementSensorReadingInOffline(ctx, movementSensorReading, readingTimes[0].readingTime); err != nil {
+					if ctx.Err() == nil {
+						config.endOfflineSensorProcess(err, false)
+					}
 					return false
 				}
 				movementSensorReading, err = config.MovementSensor.TimedMovementSensorReading(ctx)
@@ -160,7 +261,7 @@ func (config *Config) StartOfflineSensorProcess(ctx context.Context) bool {
 					if msEndOfDataSetReached {
 						config.runFinalOptimization(ctx)
 					}
-					return msEndOfDataSetReached
+					return config.endOfflineSensorProcess(err, msEndOfDataSetReached)
 				}
 			}
 		}
@@ -169,7 +270,29 @@ func (config *Config) StartOfflineSensorProcess(ctx context.Context) bool {
 
 func (config *Config) runFinalOptimization(ctx context.Context) {
 	config.Logger.Info("Beginning final optimization")
+	config.Progress.setPhase(JobPhaseFinalOptimization)
 	if err := config.CartoFacade.RunFinalOptimization(ctx, config.InternalTimeout); err != nil {
 		config.Logger.Error("Failed to finish processing all sensor readings: ", err)
+		config.Progress.fail(err)
+	}
+}
+
+// endOfflineSensorProcess records how the offline sensor process ended: the job is done once the end of
+// a dataset was reached and the trajectory, if any, was written. Any other error ended it early. Returns
+// whether the job is done.
+func (config *Config) endOfflineSensorProcess(err error, endOfDatasetReached bool) bool {
+	if endOfDatasetReached && config.Trajectory != nil {
+		if err = config.Trajectory.Write(); err != nil {
+			config.Logger.Errorw("Failed to write trajectory", "error", err)
+			endOfDatasetReached = false
+		} else {
+			config.Logger.Infow("Wrote trajectory", "path", config.Trajectory.Path(), "poses", len(config.Trajectory.Poses()))
+		}
+	}
+	if endOfDatasetReached {
+		config.Progress.setPhase(JobPhaseDone)
+	} else {
+		config.Progress.fail(err)
 	}
+	return endOfDatasetReached
 }
@@ -50,11 +50,11 @@ func TestStartOfflineSensorProcess(t *testing.T) {
 
 	injectLidar := inject.TimedLidar{}
 	injectLidar.NameFunc = func() string { return "good_lidar" }
-	injectLidar.DataFrequencyHzFunc = func() int { return 0 }
+	injectLidar.DataFrequencyHzFunc = func() float64 { return 0 }
 
 	injectMovementSensor := inject.TimedMovementSensor{}
 	injectMovementSensor.NameFunc = func() string { return "good_movement_sensor" }
-	injectMovementSensor.DataFrequencyHzFunc = func() int { return 0 }
+	injectMovementSensor.DataFrequencyHzFunc = func() float64 { return 0 }
 
 	config := Config{
 		Logger:      logger,
@@ -117,15 +117,40 @@ func TestStartOfflineSensorProcess(t *testing.T) {
 		}
 
 		lidar, ms := s.FinishedReplayLidar, s.NoMovementSensor
-		dataFrequencyHz := 0
-		replaySensor, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, ms), string(lidar), dataFrequencyHz, logger)
+		dataFrequencyHz := 0.0
+		replaySensor, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, ms), string(lidar), dataFrequencyHz, s.LidarReadingFormatPCD, logger)
 		test.That(t, err, test.ShouldBeNil)
 
 		config.Lidar = replaySensor
 		config.MovementSensor = nil
+		config.Progress = NewJobProgress()
 
 		endOfDataSetReached := config.StartOfflineSensorProcess(context.Background())
 		test.That(t, endOfDataSetReached, test.ShouldBeTrue)
+		status := config.Progress.Status()
+		test.That(t, status.Phase, test.ShouldEqual, JobPhaseFailed)
+		test.That(t, status.Err, test.ShouldBeError, errors.New("test error"))
+	})
+
+	t.Run("fails the job when a reading cannot be added", func(t *testing.T) {
+		cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration,
+			sensorName string, currentReading s.TimedLidarReadingResponse,
+		) error {
+			return cartofacade.ErrUnknownError
+		}
+		injectLidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+			return lidarReading, nil
+		}
+
+		config.Lidar = &injectLidar
+		config.MovementSensor = nil
+		config.Progress = NewJobProgress()
+
+		endOfDataSetReached := config.StartOfflineSensorProcess(context.Background())
+		test.That(t, endOfDataSetReached, test.ShouldBeFalse)
+		status := config.Progress.Status()
+		test.That(t, status.Phase, test.ShouldEqual, JobPhaseFailed)
+		test.That(t, errors.Is(status.Err, cartofacade.ErrUnknownError), test.ShouldBeTrue)
 	})
 
 	t.Run("successful data insertion", func(t *testing.T) {
@@ -301,8 +326,15 @@ func TestStartOfflineSensorProcess(t *testing.T) {
 				expectedCountAddedIMUData := countItemsInList(tt.expectedDataInsertions, "imu")
 				expectedCountAddedOdometerData := countItemsInList(tt.expectedDataInsertions, "odometer")
 
+				config.Progress = NewJobProgress()
 				endOfDataSetReached := config.StartOfflineSensorProcess(context.Background())
 				test.That(t, endOfDataSetReached, test.ShouldBeTrue)
+				status := config.Progress.Status()
+				test.That(t, status.Phase, test.ShouldEqual, JobPhaseDone)
+				test.That(t, status.Err, test.ShouldBeNil)
+				test.That(t, status.LidarReadingsProcessed, test.ShouldEqual, expectedCountAddedLidarData)
+				test.That(t, status.MovementSensorReadingsProcessed, test.ShouldEqual,
+					max(expectedCountAddedIMUData, expectedCountAddedOdometerData))
 				test.That(t, countAddedLidarData, test.ShouldEqual, expectedCountAddedLidarData)
 				test.That(t, countAddedIMUData, test.ShouldEqual, expectedCountAddedIMUData)
 				test.That(t, countAddedOdometerData, test.ShouldEqual, expectedCountAddedOdometerData)
@@ -336,11 +368,11 @@ func TestGetInitialMovementSensorReading(t *testing.T) {
 
 	injectLidar := inject.TimedLidar{}
 	injectLidar.NameFunc = func() string { return "good_lidar" }
-	injectLidar.DataFrequencyHzFunc = func() int { return 0 }
+	injectLidar.DataFrequencyHzFunc = func() float64 { return 0 }
 
 	injectMovementSensor := inject.TimedMovementSensor{}
 	injectMovementSensor.NameFunc = func() string { return "good_movement_sensor" }
-	injectMovementSensor.DataFrequencyHzFunc = func() int { return 0 }
+	injectMovementSensor.DataFrequencyHzFunc = func() float64 { return 0 }
 
 	config := Config{
 		Logger:      logger,
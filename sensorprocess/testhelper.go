@@ -59,9 +59,9 @@ func validAddLidarReadingInOnlineTestHelper(
 	testLidar s.TestSensor,
 ) {
 	logger := logging.NewTestLogger(t)
-	dataFrequencyHz := 5
+	dataFrequencyHz := 5.0
 
-	lidar, err := s.NewLidar(context.Background(), s.SetupDeps(testLidar, s.NoMovementSensor), string(testLidar), dataFrequencyHz, logger)
+	lidar, err := s.NewLidar(context.Background(), s.SetupDeps(testLidar, s.NoMovementSensor), string(testLidar), dataFrequencyHz, s.LidarReadingFormatPCD, logger)
 	test.That(t, err, test.ShouldBeNil)
 
 	var calls []addLidarReadingArgs
@@ -130,10 +130,10 @@ func invalidAddLidarReadingInOnlineTestHelper(
 	cartoFacadeMock cartofacade.Mock,
 	config Config,
 	testLidar s.TestSensor,
-	lidarDataFrequencyHz int,
+	lidarDataFrequencyHz float64,
 ) {
 	logger := logging.NewTestLogger(t)
-	lidar, err := s.NewLidar(context.Background(), s.SetupDeps(testLidar, s.NoMovementSensor), string(testLidar), lidarDataFrequencyHz, logger)
+	lidar, err := s.NewLidar(context.Background(), s.SetupDeps(testLidar, s.NoMovementSensor), string(testLidar), lidarDataFrequencyHz, s.LidarReadingFormatPCD, logger)
 	test.That(t, err, test.ShouldBeNil)
 
 	var calls []addLidarReadingArgs
@@ -167,9 +167,9 @@ func validAddMovementSensorReadingInOnlineTestHelper(
 	testMovementSensor s.TestSensor,
 ) ([]addIMUReadingArgs, []addOdometerReadingArgs) {
 	logger := logging.NewTestLogger(t)
-	dataFrequencyHz := 100
+	dataFrequencyHz := 100.0
 	movementSensor, err := s.NewMovementSensor(context.Background(), s.SetupDeps(s.NoLidar, testMovementSensor),
-		string(testMovementSensor), dataFrequencyHz, logger)
+		string(testMovementSensor), dataFrequencyHz, 0, nil, logger)
 	test.That(t, err, test.ShouldBeNil)
 
 	var imuCalls []addIMUReadingArgs
@@ -284,10 +284,10 @@ func invalidAddMovementSensorReadingInOnlineTestHelper(
 	testMovementSensor s.TestSensor,
 ) {
 	logger := logging.NewTestLogger(t)
-	lidarFrequencyHz := 10
-	movementSensorFrequencyHz := 10
+	lidarFrequencyHz := 10.0
+	movementSensorFrequencyHz := 10.0
 	movementSensor, err := s.NewMovementSensor(context.Background(), s.SetupDeps(s.NoLidar, testMovementSensor),
-		string(testMovementSensor), movementSensorFrequencyHz, logger)
+		string(testMovementSensor), movementSensorFrequencyHz, 0, nil, logger)
 	test.That(t, err, test.ShouldBeNil)
 
 	var imuCalls []addIMUReadingArgs
@@ -324,7 +324,7 @@ func invalidAddMovementSensorReadingInOnlineTestHelper(
 	config.CartoFacade = &cartoFacadeMock
 
 	injectLidar := inject.TimedLidar{}
-	injectLidar.DataFrequencyHzFunc = func() int { return lidarFrequencyHz }
+	injectLidar.DataFrequencyHzFunc = func() float64 { return lidarFrequencyHz }
 	config.Lidar = &injectLidar
 
 	config.MovementSensor = movementSensor
@@ -343,9 +343,9 @@ func validAddMovementSensorReadingUntilSuccessTestHelper(
 	testMovementSensor s.TestSensor,
 ) {
 	logger := logging.NewTestLogger(t)
-	dataFrequencyHz := 0
+	dataFrequencyHz := 0.0
 	movementSensor, err := s.NewMovementSensor(context.Background(), s.SetupDeps(s.NoLidar, testMovementSensor),
-		string(testMovementSensor), dataFrequencyHz, logger)
+		string(testMovementSensor), dataFrequencyHz, 0, nil, logger)
 	test.That(t, err, test.ShouldBeNil)
 
 	var imuCalls []addIMUReadingArgs
@@ -362,7 +362,7 @@ func validAddMovementSensorReadingUntilSuccessTestHelper(
 		}
 		imuCalls = append(imuCalls, args)
 		if len(imuCalls) == 1 {
-			return errUnknown
+			return cartofacade.ErrNotInStartedState
 		}
 		if len(imuCalls) == 2 {
 			return cartofacade.ErrUnableToAcquireLock
@@ -384,7 +384,7 @@ func validAddMovementSensorReadingUntilSuccessTestHelper(
 		}
 		odometerCalls = append(odometerCalls, args)
 		if len(odometerCalls) == 1 {
-			return errUnknown
+			return cartofacade.ErrNotInStartedState
 		}
 		if len(odometerCalls) == 2 {
 			return cartofacade.ErrUnableToAcquireLock
@@ -478,7 +478,7 @@ func tryAddMovementSensorReadingOnceTestHelper(
 			return nil
 		}
 
-		t.Run("when AddIMUReading blocks for more than the date rate and succeeds, time to sleep is 0", func(t *testing.T) {
+		t.Run("when AddIMUReading succeeds, the reading is added once", func(t *testing.T) {
 			var imuCalls []addIMUReadingArgs
 			cf.AddIMUReadingFunc = func(
 				ctx context.Context,
@@ -486,7 +486,6 @@ func tryAddMovementSensorReadingOnceTestHelper(
 				sensorName string,
 				currentReading s.TimedIMUReadingResponse,
 			) error {
-				time.Sleep(1 * time.Second)
 				args := addIMUReadingArgs{
 					timeout:        timeout,
 					sensorName:     sensorName,
@@ -496,8 +495,7 @@ func tryAddMovementSensorReadingOnceTestHelper(
 				return nil
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
-			test.That(t, timeToSleep, test.ShouldEqual, 0)
+			config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
 
 			if config.MovementSensor.Properties().IMUSupported {
 				test.That(t, len(imuCalls), test.ShouldEqual, 1)
@@ -511,80 +509,36 @@ func tryAddMovementSensorReadingOnceTestHelper(
 			}
 		})
 
-		t.Run("when AddIMUReading is slower than date rate and returns a lock error, time to sleep is 0", func(t *testing.T) {
-			cf.AddIMUReadingFunc = func(
-				ctx context.Context,
-				timeout time.Duration,
-				sensorName string,
-				currentReading s.TimedIMUReadingResponse,
-			) error {
-				time.Sleep(1 * time.Second)
-				return cartofacade.ErrUnableToAcquireLock
-			}
-
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
-			test.That(t, timeToSleep, test.ShouldEqual, 0)
-		})
-
-		t.Run("when AddIMUReading blocks for more than the date rate and returns an unexpected error, time to sleep is 0", func(t *testing.T) {
-			cf.AddIMUReadingFunc = func(
-				ctx context.Context,
-				timeout time.Duration,
-				sensorName string,
-				currentReading s.TimedIMUReadingResponse,
-			) error {
-				time.Sleep(1 * time.Second)
-				return errUnknown
-			}
-
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
-			test.That(t, timeToSleep, test.ShouldEqual, 0)
-		})
-
-		t.Run("when AddIMUReading is faster than the date rate and succeeds, time to sleep is <= date rate", func(t *testing.T) {
-			cf.AddIMUReadingFunc = func(
-				ctx context.Context,
-				timeout time.Duration,
-				sensorName string,
-				currentReading s.TimedIMUReadingResponse,
-			) error {
-				return nil
-			}
-
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
-			test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
-			test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.MovementSensor.DataFrequencyHz())
-		})
-
-		t.Run("when AddIMUReading is faster than the date rate and returns a lock error, time to sleep is <= date rate", func(t *testing.T) {
+		t.Run("when AddIMUReading returns a lock error, the reading is not retried", func(t *testing.T) {
+			var calls int
 			cf.AddIMUReadingFunc = func(
 				ctx context.Context,
 				timeout time.Duration,
 				sensorName string,
 				currentReading s.TimedIMUReadingResponse,
 			) error {
+				calls++
 				return cartofacade.ErrUnableToAcquireLock
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
-			test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
-			test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.MovementSensor.DataFrequencyHz())
+			config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+			test.That(t, calls, test.ShouldEqual, 1)
 		})
 
-		t.Run("when AddIMUReading or AddOdometerReading are faster than date rate "+
-			"and returns an unexpected error, time to sleep is <= date rate", func(t *testing.T) {
+		t.Run("when AddIMUReading returns an unexpected error, the reading is not retried", func(t *testing.T) {
+			var calls int
 			cf.AddIMUReadingFunc = func(
 				ctx context.Context,
 				timeout time.Duration,
 				sensorName string,
 				currentReading s.TimedIMUReadingResponse,
 			) error {
+				calls++
 				return errUnknown
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
-			test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
-			test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.MovementSensor.DataFrequencyHz())
+			config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+			test.That(t, calls, test.ShouldEqual, 1)
 		})
 	}
 
@@ -600,7 +554,7 @@ func tryAddMovementSensorReadingOnceTestHelper(
 			return errUnknown
 		}
 
-		t.Run("when AddOdometerReading blocks for more than the date rate and succeeds, time to sleep is 0", func(t *testing.T) {
+		t.Run("when AddOdometerReading succeeds, the reading is added once", func(t *testing.T) {
 			var odometerCalls []addOdometerReadingArgs
 			cf.AddOdometerReadingFunc = func(
 				ctx context.Context,
@@ -608,7 +562,6 @@ func tryAddMovementSensorReadingOnceTestHelper(
 				sensorName string,
 				currentReading s.TimedOdometerReadingResponse,
 			) error {
-				time.Sleep(1 * time.Second)
 				args := addOdometerReadingArgs{
 					timeout:        timeout,
 					sensorName:     sensorName,
@@ -618,8 +571,7 @@ func tryAddMovementSensorReadingOnceTestHelper(
 				return nil
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
-			test.That(t, timeToSleep, test.ShouldEqual, 0)
+			config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
 
 			if config.MovementSensor.Properties().OdometerSupported {
 				test.That(t, len(odometerCalls), test.ShouldEqual, 1)
@@ -635,82 +587,36 @@ func tryAddMovementSensorReadingOnceTestHelper(
 			}
 		})
 
-		t.Run("when AddOdometerReading is slower than date rate and returns a lock error, time to sleep is 0", func(t *testing.T) {
-			cf.AddOdometerReadingFunc = func(
-				ctx context.Context,
-				timeout time.Duration,
-				sensorName string,
-				currentReading s.TimedOdometerReadingResponse,
-			) error {
-				time.Sleep(1 * time.Second)
-				return cartofacade.ErrUnableToAcquireLock
-			}
-
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
-			test.That(t, timeToSleep, test.ShouldEqual, 0)
-		})
-
-		t.Run("when AddOdometerReading blocks for more than the date rate and returns an unexpected error, "+
-			"time to sleep is 0", func(t *testing.T) {
-			cf.AddOdometerReadingFunc = func(
-				ctx context.Context,
-				timeout time.Duration,
-				sensorName string,
-				currentReading s.TimedOdometerReadingResponse,
-			) error {
-				time.Sleep(1 * time.Second)
-				return errUnknown
-			}
-
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
-			test.That(t, timeToSleep, test.ShouldEqual, 0)
-		})
-
-		t.Run("when AddOdometerReading are faster than the date rate and succeeds, time to sleep is <= date rate", func(t *testing.T) {
-			cf.AddOdometerReadingFunc = func(
-				ctx context.Context,
-				timeout time.Duration,
-				sensorName string,
-				currentReading s.TimedOdometerReadingResponse,
-			) error {
-				return nil
-			}
-
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
-			test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
-			test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.MovementSensor.DataFrequencyHz())
-		})
-
-		t.Run("when AddOdometerReading are faster than the date rate and returns a lock error, "+
-			"time to sleep is <= date rate", func(t *testing.T) {
+		t.Run("when AddOdometerReading returns a lock error, the reading is not retried", func(t *testing.T) {
+			var calls int
 			cf.AddOdometerReadingFunc = func(
 				ctx context.Context,
 				timeout time.Duration,
 				sensorName string,
 				currentReading s.TimedOdometerReadingResponse,
 			) error {
+				calls++
 				return cartofacade.ErrUnableToAcquireLock
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
-			test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
-			test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.MovementSensor.DataFrequencyHz())
+			config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+			test.That(t, calls, test.ShouldEqual, 1)
 		})
 
-		t.Run("when AddOdometerReading are faster than date rate "+
-			"and returns an unexpected error, time to sleep is <= date rate", func(t *testing.T) {
+		t.Run("when AddOdometerReading returns an unexpected error, the reading is not retried", func(t *testing.T) {
+			var calls int
 			cf.AddOdometerReadingFunc = func(
 				ctx context.Context,
 				timeout time.Duration,
 				sensorName string,
 				currentReading s.TimedOdometerReadingResponse,
 			) error {
+				calls++
 				return errUnknown
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
-			test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
-			test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.MovementSensor.DataFrequencyHz())
+			config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+			test.That(t, calls, test.ShouldEqual, 1)
 		})
 	}
 }
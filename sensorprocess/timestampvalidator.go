@@ -0,0 +1,177 @@
+package sensorprocess
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+)
+
+// DefaultMaxClockSkew is the default time by which a reading may lag behind the other sensor, or lie in the
+// future, before the sensor clocks are considered skewed.
+const DefaultMaxClockSkew = 2 * time.Second
+
+// ErrReadingOutOfOrder denotes that a reading was rejected because its reading time is not after the reading
+// time of the previous reading of the same sensor.
+var ErrReadingOutOfOrder = errors.New("reading time is not after the previous reading of the sensor")
+
+// TimestampAnomalies counts the reading time anomalies of a sensor.
+type TimestampAnomalies struct {
+	// OutOfOrder counts the readings rejected because they went back in time.
+	OutOfOrder uint64
+	// Skewed counts the readings which were added although their reading time was skewed.
+	Skewed uint64
+}
+
+// TimestampValidatorStats is a snapshot of the reading time anomalies of the sensors.
+type TimestampValidatorStats struct {
+	Lidar          TimestampAnomalies
+	MovementSensor TimestampAnomalies
+}
+
+// channelTime is the reading time of one channel of a sensor reading: lidar, imu or odometer.
+type channelTime struct {
+	channel     string
+	readingTime time.Time
+}
+
+// timestampCheck is the result of validating the reading times of a sensor reading.
+type timestampCheck struct {
+	// err is set if the reading was rejected.
+	err error
+	// skew explains why the reading time is skewed, or is empty if it is not.
+	skew string
+	// skewChanged is set if the sensor started or stopped being skewed with this reading.
+	skewChanged bool
+}
+
+// TimestampValidator validates the reading times of the sensor readings before they are added to cartographer,
+// which requires increasing reading times per sensor and fails with opaque errors otherwise. Readings which
+// go back in time are rejected. Readings which lag behind the other sensor, or in online mode lie in the
+// future, by more than the maximum clock skew are counted and logged, but still added. It is safe for
+// concurrent use, and a nil TimestampValidator accepts every reading.
+type TimestampValidator struct {
+	maxSkew        time.Duration
+	checkWallClock bool
+
+	mu     sync.Mutex
+	latest map[string]time.Time
+	skewed map[sensorType]bool
+	stats  TimestampValidatorStats
+}
+
+// NewTimestampValidator returns a new TimestampValidator. A zero maxSkew selects DefaultMaxClockSkew. Reading
+// times are only compared to the wall clock in online mode, as offline datasets were recorded in the past.
+func NewTimestampValidator(maxSkew time.Duration, online bool) *TimestampValidator {
+	if maxSkew == 0 {
+		maxSkew = DefaultMaxClockSkew
+	}
+	return &TimestampValidator{
+		maxSkew:        maxSkew,
+		checkWallClock: online,
+		latest:         map[string]time.Time{},
+		skewed:         map[sensorType]bool{},
+	}
+}
+
+// Stats returns the reading time anomalies counted so far.
+func (v *TimestampValidator) Stats() TimestampValidatorStats {
+	if v == nil {
+		return TimestampValidatorStats{}
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.stats
+}
+
+// check validates the reading times of the channels of a sensor reading, and records them as the latest
+// reading times of those channels if the reading is accepted.
+func (v *TimestampValidator) check(sensor sensorType, channels []channelTime) timestampCheck {
+	if v == nil || len(channels) == 0 {
+		return timestampCheck{}
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	anomalies := &v.stats.Lidar
+	if sensor == movementSensor {
+		anomalies = &v.stats.MovementSensor
+	}
+
+	var readingTime time.Time
+	for _, c := range channels {
+		if previous, ok := v.latest[c.channel]; ok && !c.readingTime.After(previous) {
+			anomalies.OutOfOrder++
+			return timestampCheck{err: errors.Wrapf(ErrReadingOutOfOrder,
+				"%v reading time %v is %v behind the previous %v reading time %v",
+				c.channel, c.readingTime, previous.Sub(c.readingTime), c.channel, previous)}
+		}
+		if c.readingTime.After(readingTime) {
+			readingTime = c.readingTime
+		}
+	}
+
+	var skew string
+	if ahead := time.Until(readingTime); v.checkWallClock && ahead > v.maxSkew {
+		skew = "reading time is " + ahead.String() + " in the future"
+	}
+	var otherSensorTime time.Time
+	for channel, latest := range v.latest {
+		if (channel == "lidar") != (sensor == lidar) && latest.After(otherSensorTime) {
+			otherSensorTime = latest
+		}
+	}
+	if behind := otherSensorTime.Sub(readingTime); !otherSensorTime.IsZero() && behind > v.maxSkew {
+		skew = "reading time is " + behind.String() + " behind the latest reading of the other sensor"
+	}
+	for _, c := range channels {
+		v.latest[c.channel] = c.readingTime
+	}
+	if skew != "" {
+		anomalies.Skewed++
+	}
+	wasSkewed := v.skewed[sensor]
+	v.skewed[sensor] = skew != ""
+	return timestampCheck{skew: skew, skewChanged: wasSkewed != (skew != "")}
+}
+
+// validateLidarReadingTime validates the reading time of a lidar reading before it is added to cartographer.
+// Returns an error if the reading has to be rejected.
+func (config *Config) validateLidarReadingTime(reading s.TimedLidarReadingResponse) error {
+	return config.validateReadingTime(lidar, []channelTime{{channel: "lidar", readingTime: reading.ReadingTime}})
+}
+
+// validateMovementSensorReadingTime validates the reading times of the supported channels of a movement sensor
+// reading before it is added to cartographer. Returns an error if the reading has to be rejected.
+func (config *Config) validateMovementSensorReadingTime(reading s.TimedMovementSensorReadingResponse) error {
+	var channels []channelTime
+	// replayed readings leave out the IMU reading if it was dropped while the dataset was recorded
+	if config.MovementSensor.Properties().IMUSupported && reading.TimedIMUResponse != nil {
+		channels = append(channels, channelTime{channel: "imu", readingTime: reading.TimedIMUResponse.ReadingTime})
+	}
+	// readings added while the movement sensor is out carry no odometer reading
+	if config.MovementSensor.Properties().OdometerSupported && reading.TimedOdometerResponse != nil {
+		channels = append(channels, channelTime{channel: "odometer", readingTime: reading.TimedOdometerResponse.ReadingTime})
+	}
+	return config.validateReadingTime(movementSensor, channels)
+}
+
+func (config *Config) validateReadingTime(sensor sensorType, channels []channelTime) error {
+	result := config.TimestampValidator.check(sensor, channels)
+	if result.err != nil {
+		config.Logger.Warnw("Rejecting sensor reading which goes back in time, cartographer requires increasing "+
+			"reading times per sensor", "sensor", sensor.String(), "error", result.err)
+		return result.err
+	}
+	switch {
+	case result.skewChanged && result.skew != "":
+		config.Logger.Warnw("Sensor reading times are skewed, check the clocks of the sensors and the machine running "+
+			"cartographer", "sensor", sensor.String(), "skew", result.skew)
+	case result.skewChanged:
+		config.Logger.Infow("Sensor reading times are no longer skewed", "sensor", sensor.String())
+	case result.skew != "":
+		config.Logger.Debugw("Sensor reading time is skewed", "sensor", sensor.String(), "skew", result.skew)
+	}
+	return nil
+}
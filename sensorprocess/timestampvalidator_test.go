@@ -0,0 +1,107 @@
+package sensorprocess
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viamrobotics/viam-cartographer/cartofacade"
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+	"github.com/viamrobotics/viam-cartographer/sensors/inject"
+)
+
+func TestTimestampValidator(t *testing.T) {
+	start := time.Now().UTC()
+	lidarTime := func(offset time.Duration) []channelTime {
+		return []channelTime{{channel: "lidar", readingTime: start.Add(offset)}}
+	}
+	imuTime := func(offset time.Duration) []channelTime {
+		return []channelTime{{channel: "imu", readingTime: start.Add(offset)}}
+	}
+
+	t.Run("a nil validator accepts every reading", func(t *testing.T) {
+		var v *TimestampValidator
+		test.That(t, v.check(lidar, lidarTime(0)), test.ShouldResemble, timestampCheck{})
+		test.That(t, v.check(lidar, lidarTime(-time.Second)), test.ShouldResemble, timestampCheck{})
+		test.That(t, v.Stats(), test.ShouldResemble, TimestampValidatorStats{})
+	})
+
+	t.Run("rejects readings which do not go forward in time per sensor", func(t *testing.T) {
+		v := NewTimestampValidator(0, true)
+		test.That(t, v.check(lidar, lidarTime(0)).err, test.ShouldBeNil)
+		test.That(t, v.check(movementSensor, imuTime(-100*time.Millisecond)).err, test.ShouldBeNil)
+		test.That(t, v.check(lidar, lidarTime(200*time.Millisecond)).err, test.ShouldBeNil)
+
+		result := v.check(lidar, lidarTime(100*time.Millisecond))
+		test.That(t, errors.Is(result.err, ErrReadingOutOfOrder), test.ShouldBeTrue)
+		test.That(t, result.err.Error(), test.ShouldContainSubstring, "is 100ms behind the previous lidar reading time")
+		result = v.check(lidar, lidarTime(200*time.Millisecond))
+		test.That(t, errors.Is(result.err, ErrReadingOutOfOrder), test.ShouldBeTrue)
+
+		// the rejected readings did not move the latest reading time
+		test.That(t, v.check(lidar, lidarTime(150*time.Millisecond)).err, test.ShouldNotBeNil)
+		test.That(t, v.check(lidar, lidarTime(300*time.Millisecond)).err, test.ShouldBeNil)
+		test.That(t, v.Stats(), test.ShouldResemble, TimestampValidatorStats{Lidar: TimestampAnomalies{OutOfOrder: 3}})
+	})
+
+	t.Run("counts readings which lag behind the other sensor or lie in the future", func(t *testing.T) {
+		v := NewTimestampValidator(time.Second, true)
+		test.That(t, v.check(lidar, lidarTime(0)), test.ShouldResemble, timestampCheck{})
+
+		result := v.check(movementSensor, imuTime(-2*time.Second))
+		test.That(t, result.err, test.ShouldBeNil)
+		test.That(t, result.skew, test.ShouldEqual, "reading time is 2s behind the latest reading of the other sensor")
+		test.That(t, result.skewChanged, test.ShouldBeTrue)
+		result = v.check(movementSensor, imuTime(-1500*time.Millisecond))
+		test.That(t, result.skew, test.ShouldNotBeEmpty)
+		test.That(t, result.skewChanged, test.ShouldBeFalse)
+		result = v.check(movementSensor, imuTime(0))
+		test.That(t, result, test.ShouldResemble, timestampCheck{skewChanged: true})
+
+		result = v.check(lidar, lidarTime(time.Hour))
+		test.That(t, result.skew, test.ShouldContainSubstring, "in the future")
+		test.That(t, v.Stats(), test.ShouldResemble, TimestampValidatorStats{
+			Lidar:          TimestampAnomalies{Skewed: 1},
+			MovementSensor: TimestampAnomalies{Skewed: 2},
+		})
+
+		// offline datasets are not compared to the wall clock
+		v = NewTimestampValidator(time.Second, false)
+		test.That(t, v.check(lidar, lidarTime(time.Hour)), test.ShouldResemble, timestampCheck{})
+	})
+}
+
+func TestValidateReadingTimeInOffline(t *testing.T) {
+	start := time.Date(2021, 8, 24, 14, 0, 0, 0, time.UTC)
+	injectLidar := inject.TimedLidar{}
+	injectLidar.NameFunc = func() string { return "good_lidar" }
+
+	var added []time.Time
+	cf := cartofacade.Mock{}
+	cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration, lidarName string,
+		currentReading s.TimedLidarReadingResponse,
+	) error {
+		added = append(added, currentReading.ReadingTime)
+		return nil
+	}
+
+	config := Config{
+		Logger:             logging.NewTestLogger(t),
+		CartoFacade:        &cf,
+		Lidar:              &injectLidar,
+		Progress:           NewJobProgress(),
+		TimestampValidator: NewTimestampValidator(0, false),
+		Timeout:            10 * time.Second,
+	}
+	for _, offset := range []time.Duration{0, time.Second, 500 * time.Millisecond, 2 * time.Second} {
+		err := config.addLidarReadingInOffline(context.Background(), s.TimedLidarReadingResponse{ReadingTime: start.Add(offset)})
+		test.That(t, err, test.ShouldBeNil)
+	}
+	test.That(t, added, test.ShouldResemble, []time.Time{start, start.Add(time.Second), start.Add(2 * time.Second)})
+	test.That(t, config.Progress.Status().LidarReadingsProcessed, test.ShouldEqual, 3)
+	test.That(t, config.TimestampValidator.Stats().Lidar.OutOfOrder, test.ShouldEqual, 1)
+}
@@ -0,0 +1,108 @@
+package sensorprocess
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+
+	"github.com/viamrobotics/viam-cartographer/cartofacade"
+)
+
+// trajectoryHeader is the header of a written trajectory. Positions are in millimeters and orientations
+// are quaternions, as returned by the cartofacade.
+var trajectoryHeader = []string{"reading_time", "x", "y", "z", "real", "imag", "jmag", "kmag"}
+
+// TrajectoryPose is the pose cartographer estimated after adding a lidar reading.
+type TrajectoryPose struct {
+	ReadingTime time.Time
+	Position    cartofacade.Position
+}
+
+// Trajectory records the pose after every lidar reading of an offline job, and writes it to a CSV file
+// once the job is done. It is safe for concurrent use, and a nil Trajectory records nothing.
+type Trajectory struct {
+	path string
+
+	mu    sync.Mutex
+	poses []TrajectoryPose
+}
+
+// NewTrajectory returns a new, empty Trajectory which is written to path.
+func NewTrajectory(path string) *Trajectory {
+	return &Trajectory{path: path}
+}
+
+// Path returns the path of the file the trajectory is written to.
+func (trajectory *Trajectory) Path() string {
+	return trajectory.path
+}
+
+// Poses returns the recorded poses in the order they were recorded.
+func (trajectory *Trajectory) Poses() []TrajectoryPose {
+	if trajectory == nil {
+		return nil
+	}
+	trajectory.mu.Lock()
+	defer trajectory.mu.Unlock()
+	return append([]TrajectoryPose(nil), trajectory.poses...)
+}
+
+func (trajectory *Trajectory) add(pose TrajectoryPose) {
+	trajectory.mu.Lock()
+	defer trajectory.mu.Unlock()
+	trajectory.poses = append(trajectory.poses, pose)
+}
+
+// Write writes the recorded poses to the file of the trajectory, replacing it if it exists.
+func (trajectory *Trajectory) Write() error {
+	if err := os.MkdirAll(filepath.Dir(trajectory.path), 0o750); err != nil {
+		return errors.Wrapf(err, "error creating trajectory directory %v", filepath.Dir(trajectory.path))
+	}
+	file, err := os.OpenFile(filepath.Clean(trajectory.path), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return errors.Wrapf(err, "error creating trajectory file %v", trajectory.path)
+	}
+
+	formatFloat := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	writer := csv.NewWriter(file)
+	if err := writer.Write(trajectoryHeader); err != nil {
+		return multierr.Combine(err, file.Close())
+	}
+	for _, pose := range trajectory.Poses() {
+		if err := writer.Write([]string{
+			pose.ReadingTime.UTC().Format(time.RFC3339Nano),
+			formatFloat(pose.Position.X),
+			formatFloat(pose.Position.Y),
+			formatFloat(pose.Position.Z),
+			formatFloat(pose.Position.Real),
+			formatFloat(pose.Position.Imag),
+			formatFloat(pose.Position.Jmag),
+			formatFloat(pose.Position.Kmag),
+		}); err != nil {
+			return multierr.Combine(err, file.Close())
+		}
+	}
+	writer.Flush()
+	return multierr.Combine(writer.Error(), file.Close())
+}
+
+// recordTrajectoryPose records the current pose as the pose of the lidar reading at readingTime, if a
+// trajectory is recorded. Readings before cartographer localized itself have no pose and are skipped.
+func (config *Config) recordTrajectoryPose(ctx context.Context, readingTime time.Time) {
+	if config.Trajectory == nil {
+		return
+	}
+	position, err := config.CartoFacade.Position(ctx, config.Timeout)
+	if err != nil {
+		config.Logger.Debugw("Skipping trajectory pose of lidar reading", "reading_time", readingTime, "error", err)
+		return
+	}
+	config.Trajectory.add(TrajectoryPose{ReadingTime: readingTime, Position: position})
+}
@@ -0,0 +1,76 @@
+package sensorprocess
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viamrobotics/viam-cartographer/cartofacade"
+)
+
+func TestTrajectory(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	readingTime := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+
+	t.Run("records the pose after each lidar reading and skips readings without a pose", func(t *testing.T) {
+		positions := []cartofacade.Position{{X: 1, Y: 2, Real: 1}}
+		cf := cartofacade.Mock{}
+		cf.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+			if len(positions) == 0 {
+				return cartofacade.Position{}, errUnknown
+			}
+			position := positions[0]
+			positions = positions[1:]
+			return position, nil
+		}
+		config := Config{
+			Logger:      logger,
+			CartoFacade: &cf,
+			Trajectory:  NewTrajectory(filepath.Join(t.TempDir(), "trajectory.csv")),
+		}
+
+		config.recordTrajectoryPose(context.Background(), readingTime)
+		config.recordTrajectoryPose(context.Background(), readingTime.Add(time.Second))
+		test.That(t, config.Trajectory.Poses(), test.ShouldResemble, []TrajectoryPose{
+			{ReadingTime: readingTime, Position: cartofacade.Position{X: 1, Y: 2, Real: 1}},
+		})
+	})
+
+	t.Run("writes the poses as CSV", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "results", "trajectory.csv")
+		trajectory := NewTrajectory(path)
+		trajectory.add(TrajectoryPose{
+			ReadingTime: readingTime,
+			Position:    cartofacade.Position{X: 1.5, Y: -2, Real: 0.5, Kmag: 0.25},
+		})
+		test.That(t, trajectory.Write(), test.ShouldBeNil)
+
+		contents, err := os.ReadFile(filepath.Clean(path))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, string(contents), test.ShouldEqual,
+			"reading_time,x,y,z,real,imag,jmag,kmag\n"+
+				"2024-05-01T12:00:00.0000005Z,1.5,-2,0,0.5,0,0,0.25\n")
+	})
+
+	t.Run("the job is only done once the trajectory is written", func(t *testing.T) {
+		config := Config{
+			Logger:     logger,
+			Progress:   NewJobProgress(),
+			Trajectory: NewTrajectory(filepath.Join(t.TempDir(), "trajectory.csv")),
+		}
+		test.That(t, config.endOfflineSensorProcess(errUnknown, true), test.ShouldBeTrue)
+		_, err := os.Stat(config.Trajectory.Path())
+		test.That(t, err, test.ShouldBeNil)
+
+		// a directory cannot be written as the trajectory file
+		config.Trajectory = NewTrajectory(t.TempDir())
+		config.Progress = NewJobProgress()
+		test.That(t, config.endOfflineSensorProcess(errUnknown, true), test.ShouldBeFalse)
+		test.That(t, config.Progress.Status().Phase, test.ShouldEqual, JobPhaseFailed)
+	})
+}
@@ -0,0 +1,526 @@
+package sensors
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"github.com/pkg/errors"
+	datasyncpb "go.viam.com/api/app/datasync/v1"
+	"go.viam.com/rdk/components/camera/replaypcd"
+	replaymovementsensor "go.viam.com/rdk/components/movementsensor/replay"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/services/datamanager/datacapture"
+	"go.viam.com/rdk/spatialmath"
+	rdkutils "go.viam.com/rdk/utils"
+	"go.viam.com/utils"
+)
+
+// The data capture methods whose capture files are read.
+const (
+	captureMethodNextPointCloud     = "NextPointCloud"
+	captureMethodLinearAcceleration = "LinearAcceleration"
+	captureMethodAngularVelocity    = "AngularVelocity"
+	captureMethodPosition           = "Position"
+	captureMethodOrientation        = "Orientation"
+)
+
+// captureFile is a data capture file of a component method together with the time of its first reading.
+type captureFile struct {
+	path      string
+	firstTime time.Time
+}
+
+// captureReading is a single reading of a data capture file.
+type captureReading struct {
+	readingTime time.Time
+	data        *datasyncpb.SensorData
+}
+
+// SkippedFileCounter is implemented by sensors that replay data capture files and skip the files they
+// cannot read.
+type SkippedFileCounter interface {
+	// SkippedFiles returns the number of files skipped so far.
+	SkippedFiles() uint64
+}
+
+// captureDirectory is a data capture directory. Files that cannot be read are logged and skipped, so that one
+// corrupt file, e.g. one the data manager was still writing when the robot lost power, does not prevent
+// replaying the rest of the directory.
+type captureDirectory struct {
+	path    string
+	logger  logging.Logger
+	skipped atomic.Uint64
+}
+
+func newCaptureDirectory(path string, logger logging.Logger) *captureDirectory {
+	return &captureDirectory{path: path, logger: logger}
+}
+
+// skip logs and counts a data capture file that cannot be read.
+func (dir *captureDirectory) skip(path string, err error) {
+	dir.logger.Warnf("skipping data capture file %v which cannot be read: %v", path, err)
+	dir.skipped.Add(1)
+}
+
+// listFiles returns the completed data capture files below the directory that were captured from the
+// given method of the named component, sorted by the time of their first reading.
+func (dir *captureDirectory) listFiles(componentName, method string) ([]captureFile, error) {
+	var files []captureFile
+	err := filepath.WalkDir(dir.path, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(path) != datacapture.FileExt {
+			return nil
+		}
+		f, err := os.Open(filepath.Clean(path))
+		if err != nil {
+			dir.skip(path, err)
+			return nil
+		}
+		defer utils.UncheckedErrorFunc(f.Close)
+		file, err := datacapture.ReadFile(f)
+		if err != nil {
+			dir.skip(path, err)
+			return nil
+		}
+		md := file.ReadMetadata()
+		if md.GetComponentName() != componentName || md.GetMethodName() != method {
+			return nil
+		}
+		first, err := file.ReadNext()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			dir.skip(path, err)
+			return nil
+		}
+		files = append(files, captureFile{path: path, firstTime: captureReadingTime(first)})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading data capture directory %v", dir.path)
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].firstTime.Before(files[j].firstTime)
+	})
+	return files, nil
+}
+
+// readFile returns the readings of a data capture file as readCaptureFile does, and false if the file
+// cannot be read and was skipped.
+func (dir *captureDirectory) readFile(path string) ([]captureReading, bool) {
+	readings, err := readCaptureFile(path)
+	if err != nil {
+		dir.skip(path, err)
+		return nil, false
+	}
+	return readings, true
+}
+
+// readCaptureFile returns all readings of a data capture file sorted by time.
+func readCaptureFile(path string) ([]captureReading, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening data capture file %v", path)
+	}
+	defer utils.UncheckedErrorFunc(f.Close)
+	file, err := datacapture.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var readings []captureReading
+	for {
+		data, err := file.ReadNext()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading data capture file %v", path)
+		}
+		readings = append(readings, captureReading{readingTime: captureReadingTime(data), data: data})
+	}
+	sort.SliceStable(readings, func(i, j int) bool {
+		return readings[i].readingTime.Before(readings[j].readingTime)
+	})
+	return readings, nil
+}
+
+// captureReadingTime returns the time a reading was requested at, which is the time used by the replay
+// sensors, or the time it was received if the request time is missing.
+func captureReadingTime(data *datasyncpb.SensorData) time.Time {
+	if timeRequested := data.GetMetadata().GetTimeRequested(); timeRequested != nil {
+		return timeRequested.AsTime()
+	}
+	return data.GetMetadata().GetTimeReceived().AsTime()
+}
+
+// CaptureDatasetLidar is a lidar that replays the NextPointCloud data capture files of a lidar, as written
+// by the data manager to its capture directory. The files are read one at a time in time order, and files
+// that cannot be read are skipped.
+type CaptureDatasetLidar struct {
+	name     string
+	dir      *captureDirectory
+	lastTime time.Time
+	mu       sync.Mutex
+	files    []captureFile
+	next     int
+	readings []captureReading
+}
+
+// NewCaptureDatasetLidar returns a new CaptureDatasetLidar that reads the point clouds captured from the
+// named lidar below captureDir.
+func NewCaptureDatasetLidar(name, captureDir string, logger logging.Logger) (*CaptureDatasetLidar, error) {
+	dir := newCaptureDirectory(captureDir, logger)
+	files, err := dir.listFiles(name, captureMethodNextPointCloud)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the first reading time of each file is known, so the last readable file tells when the dataset ends
+	var lastReadings []captureReading
+	for len(files) > 0 && len(lastReadings) == 0 {
+		var ok bool
+		if lastReadings, ok = dir.readFile(files[len(files)-1].path); !ok {
+			files = files[:len(files)-1]
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.Errorf("capture directory %v does not contain any readable %v data captured from %v",
+			captureDir, captureMethodNextPointCloud, name)
+	}
+	logger.Infof("found %d point cloud capture files of %v in capture directory %v, skipped %d which cannot be read",
+		len(files), name, captureDir, dir.skipped.Load())
+	return &CaptureDatasetLidar{
+		name:     name,
+		dir:      dir,
+		lastTime: lastReadings[len(lastReadings)-1].readingTime,
+		files:    files,
+	}, nil
+}
+
+// Name returns the name of the lidar.
+func (lidar *CaptureDatasetLidar) Name() string {
+	return lidar.name
+}
+
+// DataFrequencyHz returns 0, as captured data can only be used in offline mode.
+func (lidar *CaptureDatasetLidar) DataFrequencyHz() float64 {
+	return 0
+}
+
+// DatasetTimeSpan returns the times of the first and the last captured point cloud.
+func (lidar *CaptureDatasetLidar) DatasetTimeSpan() (time.Time, time.Time) {
+	return lidar.files[0].firstTime, lidar.lastTime
+}
+
+// SkippedFiles returns the number of capture files skipped so far because they cannot be read.
+func (lidar *CaptureDatasetLidar) SkippedFiles() uint64 {
+	return lidar.dir.skipped.Load()
+}
+
+// TimedLidarReading returns the next captured point cloud, or replaypcd.ErrEndOfDataset once all point
+// clouds have been returned.
+func (lidar *CaptureDatasetLidar) TimedLidarReading(ctx context.Context) (TimedLidarReadingResponse, error) {
+	lidar.mu.Lock()
+	defer lidar.mu.Unlock()
+	for len(lidar.readings) == 0 {
+		if lidar.next >= len(lidar.files) {
+			return TimedLidarReadingResponse{}, replaypcd.ErrEndOfDataset
+		}
+		lidar.readings, _ = lidar.dir.readFile(lidar.files[lidar.next].path)
+		lidar.next++
+	}
+	reading := lidar.readings[0]
+	lidar.readings = lidar.readings[1:]
+	return TimedLidarReadingResponse{
+		Reading:            reading.data.GetBinary(),
+		ReadingTime:        reading.readingTime,
+		TestIsReplaySensor: true,
+	}, nil
+}
+
+// timedOrientation is a single timestamped orientation sample.
+type timedOrientation struct {
+	readingTime time.Time
+	orientation spatialmath.Orientation
+}
+
+// timedPosition is a single timestamped position sample.
+type timedPosition struct {
+	readingTime time.Time
+	position    *geo.Point
+}
+
+// CaptureDatasetMovementSensor is a movement sensor that replays the LinearAcceleration, AngularVelocity,
+// Position and Orientation data capture files of a movement sensor, as written by the data manager to its
+// capture directory. The channels of a movement sensor are captured independently, so IMU readings are
+// returned at the times of the linear acceleration readings with the angular velocity interpolated, and
+// odometer readings carry the nearest position and orientation within the reading time tolerance.
+type CaptureDatasetMovementSensor struct {
+	name         string
+	properties   MovementSensorProperties
+	mu           sync.Mutex
+	readings     []TimedMovementSensorReadingResponse
+	skippedFiles uint64
+}
+
+// NewCaptureDatasetMovementSensor returns a new CaptureDatasetMovementSensor that reads the data captured
+// from the named movement sensor below captureDir. The captured data is small enough to be loaded at once.
+func NewCaptureDatasetMovementSensor(name, captureDir string, readingTimeTolerance time.Duration,
+	logger logging.Logger,
+) (*CaptureDatasetMovementSensor, error) {
+	if readingTimeTolerance <= 0 {
+		readingTimeTolerance = DefaultMovementSensorReadingTimeTolerance
+	}
+
+	dir := newCaptureDirectory(captureDir, logger)
+	linAcc, err := dir.readVectors(name, captureMethodLinearAcceleration, "linear_acceleration")
+	if err != nil {
+		return nil, err
+	}
+	angVel, err := dir.readVectors(name, captureMethodAngularVelocity, "angular_velocity")
+	if err != nil {
+		return nil, err
+	}
+	positions, err := dir.readPositions(name)
+	if err != nil {
+		return nil, err
+	}
+	orientations, err := dir.readOrientations(name)
+	if err != nil {
+		return nil, err
+	}
+
+	properties := MovementSensorProperties{
+		IMUSupported:      len(linAcc) > 0 && len(angVel) > 0,
+		OdometerSupported: len(positions) > 0 && len(orientations) > 0,
+	}
+	if !properties.IMUSupported && !properties.OdometerSupported {
+		return nil, errors.Errorf("capture directory %v does not contain both linear acceleration and angular velocity "+
+			"or both position and orientation data captured from %v", captureDir, name)
+	}
+
+	// the readings are returned at the times of the linear acceleration readings if the IMU is supported,
+	// else at the times of the position readings
+	var readingTimes []time.Time
+	if properties.IMUSupported {
+		for _, sample := range linAcc {
+			readingTimes = append(readingTimes, sample.readingTime)
+		}
+	} else {
+		for _, sample := range positions {
+			readingTimes = append(readingTimes, sample.readingTime)
+		}
+	}
+
+	var readings []TimedMovementSensorReadingResponse
+	var dropped int
+	for i, readingTime := range readingTimes {
+		reading := TimedMovementSensorReadingResponse{TestIsReplaySensor: true}
+		if properties.IMUSupported {
+			angVelSample, ok := seriesSampleAt(angVel, readingTime, readingTimeTolerance)
+			if !ok {
+				dropped++
+				continue
+			}
+			reading.TimedIMUResponse = &TimedIMUReadingResponse{
+				LinearAcceleration: linAcc[i].vector,
+				AngularVelocity:    spatialmath.AngularVelocity(angVelSample),
+				ReadingTime:        readingTime,
+			}
+		}
+		if properties.OdometerSupported {
+			p := sort.Search(len(positions), func(j int) bool { return !positions[j].readingTime.Before(readingTime) })
+			p = nearestIndex(len(positions), p, func(j int) time.Time { return positions[j].readingTime }, readingTime)
+			o := sort.Search(len(orientations), func(j int) bool { return !orientations[j].readingTime.Before(readingTime) })
+			o = nearestIndex(len(orientations), o, func(j int) time.Time { return orientations[j].readingTime }, readingTime)
+			if absDuration(positions[p].readingTime.Sub(readingTime)) > readingTimeTolerance ||
+				absDuration(orientations[o].readingTime.Sub(readingTime)) > readingTimeTolerance {
+				dropped++
+				continue
+			}
+			reading.TimedOdometerResponse = &TimedOdometerReadingResponse{
+				Position:    positions[p].position,
+				Orientation: orientations[o].orientation,
+				ReadingTime: readingTime,
+			}
+		}
+		readings = append(readings, reading)
+	}
+	logger.Infof("found %d movement sensor readings of %v in capture directory %v, dropped %d which could not be "+
+		"synchronized within %v, skipped %d capture files which cannot be read",
+		len(readings), name, captureDir, dropped, readingTimeTolerance, dir.skipped.Load())
+	return &CaptureDatasetMovementSensor{
+		name:         name,
+		properties:   properties,
+		readings:     readings,
+		skippedFiles: dir.skipped.Load(),
+	}, nil
+}
+
+// Name returns the name of the movement sensor.
+func (ms *CaptureDatasetMovementSensor) Name() string {
+	return ms.name
+}
+
+// DataFrequencyHz returns 0, as captured data can only be used in offline mode.
+func (ms *CaptureDatasetMovementSensor) DataFrequencyHz() float64 {
+	return 0
+}
+
+// Properties returns whether IMU and odometer data was captured.
+func (ms *CaptureDatasetMovementSensor) Properties() MovementSensorProperties {
+	return ms.properties
+}
+
+// SkippedFiles returns the number of capture files that were skipped because they cannot be read.
+func (ms *CaptureDatasetMovementSensor) SkippedFiles() uint64 {
+	return ms.skippedFiles
+}
+
+// TimedMovementSensorReading returns the next reading, or replaymovementsensor.ErrEndOfDataset once all
+// readings have been returned.
+func (ms *CaptureDatasetMovementSensor) TimedMovementSensorReading(ctx context.Context) (TimedMovementSensorReadingResponse, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if len(ms.readings) == 0 {
+		return TimedMovementSensorReadingResponse{}, replaymovementsensor.ErrEndOfDataset
+	}
+	reading := ms.readings[0]
+	ms.readings = ms.readings[1:]
+	return reading, nil
+}
+
+// readMethod returns the struct readings of all readable data capture files of a method, sorted by time.
+func (dir *captureDirectory) readMethod(componentName, method string) ([]captureReading, error) {
+	files, err := dir.listFiles(componentName, method)
+	if err != nil {
+		return nil, err
+	}
+	var readings []captureReading
+	for _, file := range files {
+		fileReadings, _ := dir.readFile(file.path)
+		readings = append(readings, fileReadings...)
+	}
+	sort.SliceStable(readings, func(i, j int) bool {
+		return readings[i].readingTime.Before(readings[j].readingTime)
+	})
+	return readings, nil
+}
+
+// readVectors reads the vectors stored under key in the readings of a method. Angular velocities
+// are converted from deg/s to rad/s.
+func (dir *captureDirectory) readVectors(componentName, method, key string) ([]timedVector, error) {
+	readings, err := dir.readMethod(componentName, method)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]timedVector, 0, len(readings))
+	for _, reading := range readings {
+		values, err := captureFields(reading.data, key, "x", "y", "z")
+		if err != nil {
+			return nil, err
+		}
+		vector := r3.Vector{X: values[0], Y: values[1], Z: values[2]}
+		if method == captureMethodAngularVelocity {
+			vector = r3.Vector{X: rdkutils.DegToRad(vector.X), Y: rdkutils.DegToRad(vector.Y), Z: rdkutils.DegToRad(vector.Z)}
+		}
+		samples = append(samples, timedVector{readingTime: reading.readingTime, vector: vector})
+	}
+	return samples, nil
+}
+
+// readPositions reads the captured positions of a movement sensor.
+func (dir *captureDirectory) readPositions(componentName string) ([]timedPosition, error) {
+	readings, err := dir.readMethod(componentName, captureMethodPosition)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]timedPosition, 0, len(readings))
+	for _, reading := range readings {
+		values, err := captureFields(reading.data, "coordinate", "latitude", "longitude")
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, timedPosition{readingTime: reading.readingTime, position: geo.NewPoint(values[0], values[1])})
+	}
+	return samples, nil
+}
+
+// readOrientations reads the captured orientations of a movement sensor, which are orientation
+// vectors in degrees.
+func (dir *captureDirectory) readOrientations(componentName string) ([]timedOrientation, error) {
+	readings, err := dir.readMethod(componentName, captureMethodOrientation)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]timedOrientation, 0, len(readings))
+	for _, reading := range readings {
+		values, err := captureFields(reading.data, "orientation", "o_x", "o_y", "o_z", "theta")
+		if err != nil {
+			return nil, err
+		}
+		orientation := &spatialmath.OrientationVectorDegrees{OX: values[0], OY: values[1], OZ: values[2], Theta: values[3]}
+		samples = append(samples, timedOrientation{readingTime: reading.readingTime, orientation: orientation})
+	}
+	return samples, nil
+}
+
+// captureFields returns the numeric fields of the object stored under key in a struct reading. The data
+// manager omits fields with a zero value, so missing fields are zero.
+func captureFields(data *datasyncpb.SensorData, key string, fields ...string) ([]float64, error) {
+	object, ok := data.GetStruct().AsMap()[key].(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("captured reading does not contain %q", key)
+	}
+	values := make([]float64, len(fields))
+	for i, field := range fields {
+		value, exists := object[field]
+		if !exists {
+			continue
+		}
+		if values[i], ok = value.(float64); !ok {
+			return nil, errors.Errorf("captured reading has a non-numeric %v.%v", key, field)
+		}
+	}
+	return values, nil
+}
+
+// seriesSampleAt returns the value of a channel, sorted by time, at time t as channelBuffer.sampleAt does.
+func seriesSampleAt(samples []timedVector, t time.Time, tolerance time.Duration) (r3.Vector, bool) {
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].readingTime.After(t) })
+	buffer := channelBuffer{samples: samples[max(0, i-1):min(len(samples), i+1)]}
+	sample, _, ok := buffer.sampleAt(t, tolerance)
+	return sample.vector, ok
+}
+
+// nearestIndex returns the index of the sample nearest to t, given the index i of the first sample at or
+// after t in a series of n time sorted samples.
+func nearestIndex(n, i int, timeAt func(int) time.Time, t time.Time) int {
+	if i == n {
+		return n - 1
+	}
+	if i > 0 && t.Sub(timeAt(i-1)) < timeAt(i).Sub(t) {
+		return i - 1
+	}
+	return i
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,232 @@
+package sensors_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	datasyncpb "go.viam.com/api/app/datasync/v1"
+	commonpb "go.viam.com/api/common/v1"
+	movementsensorpb "go.viam.com/api/component/movementsensor/v1"
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/components/camera/replaypcd"
+	"go.viam.com/rdk/components/movementsensor"
+	replaymovementsensor "go.viam.com/rdk/components/movementsensor/replay"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/datamanager/datacapture"
+	rdkutils "go.viam.com/rdk/utils"
+	"go.viam.com/test"
+	"go.viam.com/utils/protoutils"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+)
+
+// capturedReading is a reading written to a test data capture file, either binary or a struct.
+type capturedReading struct {
+	readingTime time.Time
+	binary      []byte
+	reading     interface{}
+}
+
+// writeCaptureFile writes a data capture file like the data manager does, into the directory it uses for
+// the method of the component.
+func writeCaptureFile(t *testing.T, captureDir string, api resource.API, name, method string, readings []capturedReading) {
+	t.Helper()
+	dir := filepath.Join(captureDir, api.String(), name, method)
+	test.That(t, os.MkdirAll(dir, 0o700), test.ShouldBeNil)
+	md, err := datacapture.BuildCaptureMetadata(api, name, method, nil, nil)
+	test.That(t, err, test.ShouldBeNil)
+	f, err := datacapture.NewFile(dir, md)
+	test.That(t, err, test.ShouldBeNil)
+	for _, reading := range readings {
+		sensorData := &datasyncpb.SensorData{
+			Metadata: &datasyncpb.SensorMetadata{
+				TimeRequested: timestamppb.New(reading.readingTime),
+				TimeReceived:  timestamppb.New(reading.readingTime.Add(time.Millisecond)),
+			},
+		}
+		if reading.binary != nil {
+			sensorData.Data = &datasyncpb.SensorData_Binary{Binary: reading.binary}
+		} else {
+			pbReading, err := protoutils.StructToStructPbIgnoreOmitEmpty(reading.reading)
+			test.That(t, err, test.ShouldBeNil)
+			sensorData.Data = &datasyncpb.SensorData_Struct{Struct: pbReading}
+		}
+		test.That(t, f.WriteNext(sensorData), test.ShouldBeNil)
+	}
+	test.That(t, f.Close(), test.ShouldBeNil)
+}
+
+func TestCaptureDatasetLidar(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Failed creation without point clouds of the lidar", func(t *testing.T) {
+		dir := t.TempDir()
+		writeCaptureFile(t, dir, camera.API, "other_lidar", "NextPointCloud",
+			[]capturedReading{{readingTime: start, binary: []byte("pcd")}})
+		_, err := s.NewCaptureDatasetLidar("lidar", dir, logger)
+		test.That(t, err, test.ShouldBeError)
+	})
+
+	t.Run("Returns the captured point clouds in time order until the end of the dataset", func(t *testing.T) {
+		dir := t.TempDir()
+		writeCaptureFile(t, dir, camera.API, "lidar", "NextPointCloud", []capturedReading{
+			{readingTime: start.Add(200 * time.Millisecond), binary: []byte("third")},
+			{readingTime: start, binary: []byte("first")},
+		})
+		writeCaptureFile(t, filepath.Join(dir, "older"), camera.API, "lidar", "NextPointCloud", []capturedReading{
+			{readingTime: start.Add(-time.Second), binary: []byte("zeroth")},
+		})
+		writeCaptureFile(t, dir, camera.API, "other_lidar", "NextPointCloud", []capturedReading{
+			{readingTime: start.Add(100 * time.Millisecond), binary: []byte("other")},
+		})
+
+		lidar, err := s.NewCaptureDatasetLidar("lidar", dir, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, lidar.Name(), test.ShouldEqual, "lidar")
+		test.That(t, lidar.DataFrequencyHz(), test.ShouldEqual, 0)
+
+		for _, expected := range []capturedReading{
+			{readingTime: start.Add(-time.Second), binary: []byte("zeroth")},
+			{readingTime: start, binary: []byte("first")},
+			{readingTime: start.Add(200 * time.Millisecond), binary: []byte("third")},
+		} {
+			reading, err := lidar.TimedLidarReading(ctx)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, reading.Reading, test.ShouldResemble, expected.binary)
+			test.That(t, reading.ReadingTime.Equal(expected.readingTime), test.ShouldBeTrue)
+			test.That(t, reading.TestIsReplaySensor, test.ShouldBeTrue)
+		}
+
+		_, err = lidar.TimedLidarReading(ctx)
+		test.That(t, errors.Is(err, replaypcd.ErrEndOfDataset), test.ShouldBeTrue)
+	})
+
+	t.Run("Skips and counts capture files which cannot be read", func(t *testing.T) {
+		dir := t.TempDir()
+		writeCaptureFile(t, dir, camera.API, "lidar", "NextPointCloud", []capturedReading{
+			{readingTime: start, binary: []byte("first")},
+		})
+		corruptPath := filepath.Join(dir, "corrupt"+datacapture.FileExt)
+		test.That(t, os.WriteFile(corruptPath, []byte("not a capture file"), 0o600), test.ShouldBeNil)
+
+		lidar, err := s.NewCaptureDatasetLidar("lidar", dir, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, lidar.SkippedFiles(), test.ShouldEqual, 1)
+
+		reading, err := lidar.TimedLidarReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading.Reading, test.ShouldResemble, []byte("first"))
+		_, err = lidar.TimedLidarReading(ctx)
+		test.That(t, errors.Is(err, replaypcd.ErrEndOfDataset), test.ShouldBeTrue)
+	})
+
+	t.Run("Failed creation if no capture file of the lidar can be read", func(t *testing.T) {
+		dir := t.TempDir()
+		corruptPath := filepath.Join(dir, "corrupt"+datacapture.FileExt)
+		test.That(t, os.WriteFile(corruptPath, []byte("not a capture file"), 0o600), test.ShouldBeNil)
+		_, err := s.NewCaptureDatasetLidar("lidar", dir, logger)
+		test.That(t, err, test.ShouldBeError)
+	})
+}
+
+func TestCaptureDatasetMovementSensor(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	linearAcceleration := func(readingTime time.Time, x float64) capturedReading {
+		return capturedReading{readingTime: readingTime, reading: movementsensorpb.GetLinearAccelerationResponse{
+			LinearAcceleration: &commonpb.Vector3{X: x, Y: 1, Z: 9.8},
+		}}
+	}
+	angularVelocity := func(readingTime time.Time, z float64) capturedReading {
+		return capturedReading{readingTime: readingTime, reading: movementsensorpb.GetAngularVelocityResponse{
+			AngularVelocity: &commonpb.Vector3{Z: z},
+		}}
+	}
+
+	t.Run("Failed creation without IMU or odometer data", func(t *testing.T) {
+		dir := t.TempDir()
+		writeCaptureFile(t, dir, movementsensor.API, "imu", "LinearAcceleration",
+			[]capturedReading{linearAcceleration(start, 0)})
+		_, err := s.NewCaptureDatasetMovementSensor("imu", dir, 0, logger)
+		test.That(t, err, test.ShouldBeError)
+	})
+
+	t.Run("Returns IMU readings with interpolated angular velocity", func(t *testing.T) {
+		dir := t.TempDir()
+		writeCaptureFile(t, dir, movementsensor.API, "imu", "LinearAcceleration", []capturedReading{
+			linearAcceleration(start.Add(25*time.Millisecond), 1),
+			linearAcceleration(start.Add(75*time.Millisecond), 2),
+			// too far from any angular velocity reading to be synchronized
+			linearAcceleration(start.Add(time.Second), 3),
+		})
+		writeCaptureFile(t, dir, movementsensor.API, "imu", "AngularVelocity", []capturedReading{
+			angularVelocity(start, 0),
+			angularVelocity(start.Add(50*time.Millisecond), 90),
+			angularVelocity(start.Add(100*time.Millisecond), 180),
+		})
+
+		ms, err := s.NewCaptureDatasetMovementSensor("imu", dir, 50*time.Millisecond, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, ms.Name(), test.ShouldEqual, "imu")
+		test.That(t, ms.DataFrequencyHz(), test.ShouldEqual, 0)
+		test.That(t, ms.Properties(), test.ShouldResemble, s.MovementSensorProperties{IMUSupported: true})
+
+		reading, err := ms.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading.TimedOdometerResponse, test.ShouldBeNil)
+		test.That(t, reading.TimedIMUResponse.ReadingTime.Equal(start.Add(25*time.Millisecond)), test.ShouldBeTrue)
+		test.That(t, reading.TimedIMUResponse.LinearAcceleration, test.ShouldResemble, r3.Vector{X: 1, Y: 1, Z: 9.8})
+		test.That(t, reading.TimedIMUResponse.AngularVelocity.Z, test.ShouldAlmostEqual, rdkutils.DegToRad(45))
+
+		reading, err = ms.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading.TimedIMUResponse.LinearAcceleration.X, test.ShouldEqual, 2)
+		test.That(t, reading.TimedIMUResponse.AngularVelocity.Z, test.ShouldAlmostEqual, rdkutils.DegToRad(135))
+
+		_, err = ms.TimedMovementSensorReading(ctx)
+		test.That(t, errors.Is(err, replaymovementsensor.ErrEndOfDataset), test.ShouldBeTrue)
+	})
+
+	t.Run("Returns odometer readings with the nearest position and orientation", func(t *testing.T) {
+		dir := t.TempDir()
+		writeCaptureFile(t, dir, movementsensor.API, "odometer", "Position", []capturedReading{
+			{readingTime: start, reading: movementsensorpb.GetPositionResponse{
+				Coordinate: &commonpb.GeoPoint{Latitude: 40.7, Longitude: -73.9},
+			}},
+		})
+		writeCaptureFile(t, dir, movementsensor.API, "odometer", "Orientation", []capturedReading{
+			{readingTime: start.Add(-40 * time.Millisecond), reading: movementsensorpb.GetOrientationResponse{
+				Orientation: &commonpb.Orientation{OZ: 1, Theta: 10},
+			}},
+			{readingTime: start.Add(10 * time.Millisecond), reading: movementsensorpb.GetOrientationResponse{
+				Orientation: &commonpb.Orientation{OZ: 1, Theta: 90},
+			}},
+		})
+
+		ms, err := s.NewCaptureDatasetMovementSensor("odometer", dir, 0, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, ms.Properties(), test.ShouldResemble, s.MovementSensorProperties{OdometerSupported: true})
+
+		reading, err := ms.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading.TimedIMUResponse, test.ShouldBeNil)
+		test.That(t, reading.TimedOdometerResponse.ReadingTime.Equal(start), test.ShouldBeTrue)
+		test.That(t, reading.TimedOdometerResponse.Position.Lat(), test.ShouldEqual, 40.7)
+		test.That(t, reading.TimedOdometerResponse.Position.Lng(), test.ShouldEqual, -73.9)
+		test.That(t, reading.TimedOdometerResponse.Orientation.OrientationVectorDegrees().Theta, test.ShouldAlmostEqual, 90)
+
+		_, err = ms.TimedMovementSensorReading(ctx)
+		test.That(t, errors.Is(err, replaymovementsensor.ErrEndOfDataset), test.ShouldBeTrue)
+	})
+}
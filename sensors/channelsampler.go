@@ -0,0 +1,254 @@
+package sensors
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/spatialmath"
+)
+
+// channelBufferSize is the number of samples kept per channel of a movement sensor. Only the most
+// recent samples are needed to interpolate a channel at the time of the latest sample of the other.
+const channelBufferSize = 8
+
+// errNoNewSample denotes that a channel has not been sampled since the last synchronized sample.
+var errNoNewSample = errors.New("no new sample since the last synchronized sample")
+
+// IMUSampleStats counts how the synchronized IMU samples of a movement sensor were produced.
+type IMUSampleStats struct {
+	// Emitted is the number of IMU samples returned.
+	Emitted uint64
+	// Interpolated is the number of emitted IMU samples for which a channel had to be interpolated.
+	Interpolated uint64
+	// Dropped is the number of IMU samples that could not be synchronized within the time tolerance.
+	Dropped uint64
+}
+
+// imuSampleCounters are the concurrency safe counters behind IMUSampleStats.
+type imuSampleCounters struct {
+	emitted      atomic.Uint64
+	interpolated atomic.Uint64
+	dropped      atomic.Uint64
+}
+
+func (c *imuSampleCounters) stats() IMUSampleStats {
+	return IMUSampleStats{
+		Emitted:      c.emitted.Load(),
+		Interpolated: c.interpolated.Load(),
+		Dropped:      c.dropped.Load(),
+	}
+}
+
+// timedVector is a single timestamped sample of a channel.
+type timedVector struct {
+	readingTime time.Time
+	vector      r3.Vector
+	// orientation is only set for samples of the Orientation channel
+	orientation spatialmath.Orientation
+}
+
+// channelBuffer holds the most recent samples of one channel in the order they were polled.
+type channelBuffer struct {
+	samples []timedVector
+}
+
+// add appends a sample, dropping the oldest sample once the buffer is full.
+func (b *channelBuffer) add(sample timedVector) {
+	if len(b.samples) == channelBufferSize {
+		b.samples = b.samples[1:]
+	}
+	b.samples = append(b.samples, sample)
+}
+
+// newest returns the time of the most recent sample, and false if the buffer is empty.
+func (b *channelBuffer) newest() (time.Time, bool) {
+	if len(b.samples) == 0 {
+		return time.Time{}, false
+	}
+	return b.samples[len(b.samples)-1].readingTime, true
+}
+
+// sampleAt returns the value of the channel at the requested time. If the time lies between two
+// samples the value is linearly interpolated, otherwise the nearest sample is used as long as it is
+// within the tolerance. The second return value reports whether interpolation was needed, the
+// third whether a value could be determined at all.
+func (b *channelBuffer) sampleAt(t time.Time, tolerance time.Duration) (timedVector, bool, bool) {
+	if len(b.samples) == 0 {
+		return timedVector{}, false, false
+	}
+
+	// find the most recent sample at or before t
+	before := -1
+	for i := len(b.samples) - 1; i >= 0; i-- {
+		if !b.samples[i].readingTime.After(t) {
+			before = i
+			break
+		}
+	}
+
+	switch {
+	case before == -1:
+		// all samples are later than t
+		oldest := b.samples[0]
+		if oldest.readingTime.Sub(t) <= tolerance {
+			return oldest, false, true
+		}
+		return timedVector{}, false, false
+	case b.samples[before].readingTime.Equal(t):
+		return b.samples[before], false, true
+	case before == len(b.samples)-1:
+		// all samples are earlier than t
+		newest := b.samples[before]
+		if t.Sub(newest.readingTime) <= tolerance {
+			return newest, false, true
+		}
+		return timedVector{}, false, false
+	default:
+		return interpolate(b.samples[before], b.samples[before+1], t), true, true
+	}
+}
+
+// interpolate linearly interpolates between the samples a and b, with a earlier than b, at time t.
+// Orientations are interpolated along the shortest rotation between them.
+func interpolate(a, b timedVector, t time.Time) timedVector {
+	span := b.readingTime.Sub(a.readingTime)
+	if span <= 0 {
+		return a
+	}
+	fraction := float64(t.Sub(a.readingTime)) / float64(span)
+	sample := timedVector{readingTime: t, vector: a.vector.Add(b.vector.Sub(a.vector).Mul(fraction))}
+	if a.orientation != nil && b.orientation != nil {
+		sample.orientation = spatialmath.Interpolate(
+			spatialmath.NewPoseFromOrientation(a.orientation),
+			spatialmath.NewPoseFromOrientation(b.orientation),
+			fraction,
+		).Orientation()
+	}
+	return sample
+}
+
+// channelSampler polls a single channel of a movement sensor into its buffer.
+type channelSampler struct {
+	channel string
+	read    func(ctx context.Context) (timedVector, error)
+
+	mu     sync.Mutex
+	buffer channelBuffer
+	// err is the error of the latest poll, nil if it succeeded
+	err error
+}
+
+func newChannelSampler(channel string, read func(ctx context.Context) (timedVector, error)) *channelSampler {
+	return &channelSampler{channel: channel, read: read}
+}
+
+// poll reads the channel once and buffers the sample.
+func (cs *channelSampler) poll(ctx context.Context) error {
+	sample, err := cs.read(ctx)
+	if err != nil {
+		err = errors.Wrapf(err, "could not obtain %v", cs.channel)
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.err = err
+	if err == nil {
+		cs.buffer.add(sample)
+	}
+	return err
+}
+
+// run polls the channel every period until the context is done, calling polled after every poll.
+func (cs *channelSampler) run(ctx context.Context, period time.Duration, polled func()) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		if err := cs.poll(ctx); err != nil && ctx.Err() != nil {
+			return
+		}
+		polled()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newest returns the time of the most recent sample of the channel.
+func (cs *channelSampler) newest() (time.Time, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.buffer.newest()
+}
+
+// channelPair synchronizes the samples of two channels which make up one reading, e.g. the
+// LinearAcceleration and AngularVelocity of an IMU.
+type channelPair struct {
+	first, second *channelSampler
+	// synchronized is the time of the last sample returned by the pair. It is only accessed by the reader
+	// of the movement sensor.
+	synchronized time.Time
+}
+
+/*
+synchronize returns the samples of both channels at the time of the older of their most recent samples,
+interpolating the other channel from its buffer. If requireNew is set, it returns errNoNewSample unless
+that time is after the last synchronized sample. It returns ErrNoValidReadingObtained if a channel has no
+sample within the reading time tolerance, and the error of the latest poll of a channel if it failed.
+The caller marks the samples as synchronized with markSynchronized once they are returned.
+*/
+func (p *channelPair) synchronize(tolerance time.Duration, requireNew bool) (timedVector, timedVector, bool, error) {
+	p.first.mu.Lock()
+	defer p.first.mu.Unlock()
+	p.second.mu.Lock()
+	defer p.second.mu.Unlock()
+
+	if p.first.err != nil {
+		return timedVector{}, timedVector{}, false, p.first.err
+	}
+	if p.second.err != nil {
+		return timedVector{}, timedVector{}, false, p.second.err
+	}
+
+	firstNewest, firstOk := p.first.buffer.newest()
+	secondNewest, secondOk := p.second.buffer.newest()
+	if !firstOk || !secondOk {
+		return timedVector{}, timedVector{}, false, errNoNewSample
+	}
+	sampleTime := firstNewest
+	if secondNewest.Before(sampleTime) {
+		sampleTime = secondNewest
+	}
+	if requireNew && !sampleTime.After(p.synchronized) {
+		return timedVector{}, timedVector{}, false, errNoNewSample
+	}
+
+	first, firstInterpolated, firstOk := p.first.buffer.sampleAt(sampleTime, tolerance)
+	second, secondInterpolated, secondOk := p.second.buffer.sampleAt(sampleTime, tolerance)
+	if !firstOk || !secondOk {
+		return timedVector{}, timedVector{}, false, ErrNoValidReadingObtained
+	}
+	first.readingTime, second.readingTime = sampleTime, sampleTime
+	return first, second, firstInterpolated || secondInterpolated, nil
+}
+
+// markSynchronized records the time of the last sample returned by the pair.
+func (p *channelPair) markSynchronized(t time.Time) {
+	p.synchronized = t
+}
+
+// lagging returns the channel whose most recent sample is the older one.
+func (p *channelPair) lagging() *channelSampler {
+	firstNewest, _ := p.first.newest()
+	secondNewest, _ := p.second.newest()
+	if secondNewest.Before(firstNewest) {
+		return p.second
+	}
+	return p.first
+}
@@ -0,0 +1,157 @@
+package sensors
+
+import (
+	"time"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/spatialmath"
+)
+
+// DatasetRecord is a line of a JSON lines file of a local dataset. It holds a reading that was passed
+// to cartographer together with whether cartographer accepted it. Lidar records refer to the file
+// holding the reading, movement sensor records hold the IMU and/or odometer reading itself.
+type DatasetRecord struct {
+	Sensor   string                 `json:"sensor"`
+	Lidar    *DatasetLidarRecord    `json:"lidar,omitempty"`
+	IMU      *DatasetIMURecord      `json:"imu,omitempty"`
+	Odometer *DatasetOdometerRecord `json:"odometer,omitempty"`
+}
+
+// DatasetStatus tells whether cartographer accepted a reading, or the error it was dropped with.
+type DatasetStatus struct {
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// NewDatasetStatus returns the status of a reading that was added to cartographer with the given error.
+func NewDatasetStatus(err error) DatasetStatus {
+	if err != nil {
+		return DatasetStatus{Error: err.Error()}
+	}
+	return DatasetStatus{Accepted: true}
+}
+
+// DatasetVector is a vector of a movement sensor record.
+type DatasetVector struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// DatasetQuaternion is an orientation of an odometer record.
+type DatasetQuaternion struct {
+	Real float64 `json:"real"`
+	Imag float64 `json:"imag"`
+	Jmag float64 `json:"jmag"`
+	Kmag float64 `json:"kmag"`
+}
+
+// DatasetLidarRecord is the record of a lidar reading stored in File, relative to the dataset directory.
+// File holds the reading as it was passed to cartographer, encoded in Format. Records without a format
+// refer to PCD files.
+type DatasetLidarRecord struct {
+	Time           time.Time `json:"time"`
+	File           string    `json:"file"`
+	Format         string    `json:"format,omitempty"`
+	AngleMin       float32   `json:"angle_min,omitempty"`
+	AngleIncrement float32   `json:"angle_increment,omitempty"`
+	DatasetStatus
+}
+
+// NewDatasetLidarRecord returns the record of a lidar reading stored in file that was added to cartographer
+// with the given error.
+func NewDatasetLidarRecord(reading TimedLidarReadingResponse, file string, err error) *DatasetLidarRecord {
+	return &DatasetLidarRecord{
+		Time:           reading.ReadingTime,
+		File:           file,
+		Format:         reading.Format.String(),
+		AngleMin:       reading.AngleMin,
+		AngleIncrement: reading.AngleIncrement,
+		DatasetStatus:  NewDatasetStatus(err),
+	}
+}
+
+// LidarReadingFormat returns the format of the file of the record.
+func (record *DatasetLidarRecord) LidarReadingFormat() (LidarReadingFormat, error) {
+	if record.Format == "" {
+		return LidarReadingFormatPCD, nil
+	}
+	for format, name := range lidarReadingFormatNames {
+		if name == record.Format {
+			return format, nil
+		}
+	}
+	return LidarReadingFormatPCD, errors.Errorf("unknown lidar reading format %q of dataset file %v", record.Format, record.File)
+}
+
+// DatasetIMURecord is the record of an IMU reading, with linear acceleration in m/s^2 and angular
+// velocity in rad/s.
+type DatasetIMURecord struct {
+	Time               time.Time     `json:"time"`
+	LinearAcceleration DatasetVector `json:"linear_acceleration"`
+	AngularVelocity    DatasetVector `json:"angular_velocity"`
+	DatasetStatus
+}
+
+// DatasetOdometerRecord is the record of an odometer reading.
+type DatasetOdometerRecord struct {
+	Time        time.Time         `json:"time"`
+	Latitude    float64           `json:"latitude"`
+	Longitude   float64           `json:"longitude"`
+	Orientation DatasetQuaternion `json:"orientation"`
+	DatasetStatus
+}
+
+// NewDatasetIMURecord returns the record of an IMU reading that was added to cartographer with the given error.
+func NewDatasetIMURecord(reading TimedIMUReadingResponse, err error) *DatasetIMURecord {
+	return &DatasetIMURecord{
+		Time:               reading.ReadingTime,
+		LinearAcceleration: DatasetVector(reading.LinearAcceleration),
+		AngularVelocity:    DatasetVector(reading.AngularVelocity),
+		DatasetStatus:      NewDatasetStatus(err),
+	}
+}
+
+// TimedIMUReadingResponse returns the IMU reading of the record.
+func (record *DatasetIMURecord) TimedIMUReadingResponse() TimedIMUReadingResponse {
+	return TimedIMUReadingResponse{
+		LinearAcceleration: r3.Vector(record.LinearAcceleration),
+		AngularVelocity:    spatialmath.AngularVelocity(record.AngularVelocity),
+		ReadingTime:        record.Time,
+	}
+}
+
+// NewDatasetOdometerRecord returns the record of an odometer reading that was added to cartographer with
+// the given error. A missing position or orientation is recorded as the origin or the identity.
+func NewDatasetOdometerRecord(reading TimedOdometerReadingResponse, err error) *DatasetOdometerRecord {
+	record := &DatasetOdometerRecord{
+		Time:          reading.ReadingTime,
+		Orientation:   DatasetQuaternion{Real: 1},
+		DatasetStatus: NewDatasetStatus(err),
+	}
+	if reading.Position != nil {
+		record.Latitude = reading.Position.Lat()
+		record.Longitude = reading.Position.Lng()
+	}
+	if reading.Orientation != nil {
+		q := reading.Orientation.Quaternion()
+		record.Orientation = DatasetQuaternion{Real: q.Real, Imag: q.Imag, Jmag: q.Jmag, Kmag: q.Kmag}
+	}
+	return record
+}
+
+// TimedOdometerReadingResponse returns the odometer reading of the record.
+func (record *DatasetOdometerRecord) TimedOdometerReadingResponse() TimedOdometerReadingResponse {
+	return TimedOdometerReadingResponse{
+		Position: geo.NewPoint(record.Latitude, record.Longitude),
+		Orientation: &spatialmath.Quaternion{
+			Real: record.Orientation.Real,
+			Imag: record.Orientation.Imag,
+			Jmag: record.Orientation.Jmag,
+			Kmag: record.Orientation.Kmag,
+		},
+		ReadingTime: record.Time,
+	}
+}
@@ -0,0 +1,324 @@
+package sensors
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/spatialmath"
+	rdkutils "go.viam.com/rdk/utils"
+	"go.viam.com/rdk/utils/contextutils"
+)
+
+// LinearAccelerationUnit is the unit a generic sensor reports linear acceleration in.
+type LinearAccelerationUnit string
+
+// AngularVelocityUnit is the unit a generic sensor reports angular velocity in.
+type AngularVelocityUnit string
+
+const (
+	// MetersPerSecSquared denotes linear acceleration values in m/s^2.
+	MetersPerSecSquared LinearAccelerationUnit = "m_per_sec_squared"
+	// StandardGravity denotes linear acceleration values in multiples of standard gravity (g).
+	StandardGravity LinearAccelerationUnit = "g"
+
+	// DegreesPerSec denotes angular velocity values in deg/s.
+	DegreesPerSec AngularVelocityUnit = "deg_per_sec"
+	// RadiansPerSec denotes angular velocity values in rad/s.
+	RadiansPerSec AngularVelocityUnit = "rad_per_sec"
+
+	standardGravityMetersPerSecSquared = 9.80665
+	readingsKeySeparator               = "."
+)
+
+var (
+	// ErrGenericSensorNeitherIMUNorOdometer denotes that the provided generic sensor config does neither map
+	// IMU nor odometer readings.
+	ErrGenericSensorNeitherIMUNorOdometer = errors.New("generic 'movement_sensor' must either map both " +
+		"linear_acceleration_keys and angular_velocity_keys, or both position_keys and orientation_keys")
+	// ErrGenericSensorMissingReading denotes that a configured key is missing from the readings of a generic sensor.
+	ErrGenericSensorMissingReading = errors.New("generic sensor readings are missing a configured key")
+)
+
+// GenericSensorConfig describes how the Readings of a generic sensor component map onto IMU
+// and odometer data. Keys may address nested readings by joining the map keys with a '.'.
+type GenericSensorConfig struct {
+	// LinearAccelerationKeys are the x, y and z keys of the linear acceleration.
+	LinearAccelerationKeys []string
+	// AngularVelocityKeys are the x, y and z keys of the angular velocity.
+	AngularVelocityKeys []string
+	// PositionKeys are the latitude and longitude keys of the position.
+	PositionKeys []string
+	// OrientationKeys are the real, i, j and k keys of the orientation quaternion.
+	OrientationKeys []string
+
+	LinearAccelerationUnit LinearAccelerationUnit
+	AngularVelocityUnit    AngularVelocityUnit
+}
+
+// GenericMovementSensor represents a generic sensor component that reports IMU and/or odometer
+// data through its Readings.
+type GenericMovementSensor struct {
+	name               string
+	dataFrequencyHz    float64
+	imuSupported       bool
+	odometerSupported  bool
+	config             GenericSensorConfig
+	sensor             sensor.Sensor
+	testIsReplaySensor bool
+}
+
+// Name returns the name of the generic sensor.
+func (gms *GenericMovementSensor) Name() string {
+	return gms.name
+}
+
+// DataFrequencyHz returns the data rate in Hz of the generic sensor.
+func (gms *GenericMovementSensor) DataFrequencyHz() float64 {
+	return gms.dataFrequencyHz
+}
+
+// TimedMovementSensorReading returns data from the generic sensor and the time the reading is from & whether
+// it was a replay sensor or not. IMU and odometer data are taken from a single call to Readings, so they
+// always share the same reading time.
+func (gms *GenericMovementSensor) TimedMovementSensorReading(ctx context.Context) (TimedMovementSensorReadingResponse, error) {
+	ctxWithMetadata, md := contextutils.ContextWithMetadata(ctx)
+	readings, err := gms.sensor.Readings(ctxWithMetadata, make(map[string]interface{}))
+	if err != nil {
+		return TimedMovementSensorReadingResponse{}, errors.Wrap(err, "could not obtain Readings")
+	}
+
+	readingTime := time.Now().UTC()
+	if timeRequestedMetadata, ok := md[contextutils.TimeRequestedMetadataKey]; ok {
+		gms.testIsReplaySensor = true
+		if readingTime, err = time.Parse(time.RFC3339Nano, timeRequestedMetadata[0]); err != nil {
+			return TimedMovementSensorReadingResponse{}, errors.Wrap(err, replayTimestampErrorMessage)
+		}
+	}
+
+	var response TimedMovementSensorReadingResponse
+	if gms.imuSupported {
+		if response.TimedIMUResponse, err = gms.toTimedIMUReadingResponse(readings, readingTime); err != nil {
+			return TimedMovementSensorReadingResponse{}, err
+		}
+	}
+	if gms.odometerSupported {
+		if response.TimedOdometerResponse, err = gms.toTimedOdometerReadingResponse(readings, readingTime); err != nil {
+			return TimedMovementSensorReadingResponse{}, err
+		}
+	}
+	response.TestIsReplaySensor = gms.testIsReplaySensor
+	return response, nil
+}
+
+func (gms *GenericMovementSensor) toTimedIMUReadingResponse(readings map[string]interface{}, readingTime time.Time,
+) (*TimedIMUReadingResponse, error) {
+	linAcc, err := lookupReadings(readings, gms.config.LinearAccelerationKeys)
+	if err != nil {
+		return nil, err
+	}
+	angVel, err := lookupReadings(readings, gms.config.AngularVelocityKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	linAccScale := 1.0
+	if gms.config.LinearAccelerationUnit == StandardGravity {
+		linAccScale = standardGravityMetersPerSecSquared
+	}
+	// We set the angular velocity values in radians/s instead of deg/s
+	toRadPerSec := rdkutils.DegToRad
+	if gms.config.AngularVelocityUnit == RadiansPerSec {
+		toRadPerSec = func(v float64) float64 { return v }
+	}
+
+	return &TimedIMUReadingResponse{
+		LinearAcceleration: r3.Vector{X: linAcc[0], Y: linAcc[1], Z: linAcc[2]}.Mul(linAccScale),
+		AngularVelocity: spatialmath.AngularVelocity{
+			X: toRadPerSec(angVel[0]),
+			Y: toRadPerSec(angVel[1]),
+			Z: toRadPerSec(angVel[2]),
+		},
+		ReadingTime: readingTime,
+	}, nil
+}
+
+func (gms *GenericMovementSensor) toTimedOdometerReadingResponse(readings map[string]interface{}, readingTime time.Time,
+) (*TimedOdometerReadingResponse, error) {
+	position, err := lookupReadings(readings, gms.config.PositionKeys)
+	if err != nil {
+		return nil, err
+	}
+	orientation, err := lookupReadings(readings, gms.config.OrientationKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TimedOdometerReadingResponse{
+		Position: geo.NewPoint(position[0], position[1]),
+		Orientation: &spatialmath.Quaternion{
+			Real: orientation[0],
+			Imag: orientation[1],
+			Jmag: orientation[2],
+			Kmag: orientation[3],
+		},
+		ReadingTime: readingTime,
+	}, nil
+}
+
+// Properties returns MovementSensorProperties, which holds information about whether or not an IMU
+// and/or odometer are mapped from the generic sensor's readings.
+func (gms *GenericMovementSensor) Properties() MovementSensorProperties {
+	return MovementSensorProperties{
+		IMUSupported:      gms.imuSupported,
+		OdometerSupported: gms.odometerSupported,
+	}
+}
+
+// newGenericMovementSensor returns a new generic movement sensor after validating the config
+// against a first set of readings.
+func newGenericMovementSensor(
+	ctx context.Context,
+	deps resource.Dependencies,
+	sensorName string,
+	dataFrequencyHz float64,
+	config GenericSensorConfig,
+) (TimedMovementSensor, error) {
+	genericSensor, err := sensor.FromDependencies(deps, sensorName)
+	if err != nil {
+		return &GenericMovementSensor{}, errors.Wrapf(err, "error getting generic sensor \"%v\" for slam service", sensorName)
+	}
+
+	imuSupported, odometerSupported, err := validateGenericSensorConfig(config)
+	if err != nil {
+		return &GenericMovementSensor{}, errors.Wrapf(err, "error configuring generic sensor \"%v\" for slam service", sensorName)
+	}
+
+	readings, err := genericSensor.Readings(ctx, make(map[string]interface{}))
+	if err != nil {
+		return &GenericMovementSensor{}, errors.Wrapf(err, "error getting readings from generic sensor \"%v\" for slam service", sensorName)
+	}
+	configuredKeys := [][]string{
+		config.LinearAccelerationKeys, config.AngularVelocityKeys,
+		config.PositionKeys, config.OrientationKeys,
+	}
+	for _, keys := range configuredKeys {
+		if _, err := lookupReadings(readings, keys); err != nil {
+			return &GenericMovementSensor{}, errors.Wrapf(err, "error validating readings of generic sensor \"%v\" for slam service", sensorName)
+		}
+	}
+
+	if config.LinearAccelerationUnit == "" {
+		config.LinearAccelerationUnit = MetersPerSecSquared
+	}
+	if config.AngularVelocityUnit == "" {
+		config.AngularVelocityUnit = DegreesPerSec
+	}
+
+	return &GenericMovementSensor{
+		name:              sensorName,
+		dataFrequencyHz:   dataFrequencyHz,
+		imuSupported:      imuSupported,
+		odometerSupported: odometerSupported,
+		config:            config,
+		sensor:            genericSensor,
+	}, nil
+}
+
+// validateGenericSensorConfig checks that the keys and units of the config are well formed, and returns
+// whether the config maps IMU and/or odometer data.
+func validateGenericSensorConfig(config GenericSensorConfig) (bool, bool, error) {
+	expectedNumKeys := []struct {
+		name string
+		keys []string
+		num  int
+	}{
+		{name: "linear_acceleration_keys", keys: config.LinearAccelerationKeys, num: 3},
+		{name: "angular_velocity_keys", keys: config.AngularVelocityKeys, num: 3},
+		{name: "position_keys", keys: config.PositionKeys, num: 2},
+		{name: "orientation_keys", keys: config.OrientationKeys, num: 4},
+	}
+	for _, expected := range expectedNumKeys {
+		if len(expected.keys) != 0 && len(expected.keys) != expected.num {
+			return false, false, errors.Errorf("%v must contain exactly %d keys, got %d", expected.name, expected.num, len(expected.keys))
+		}
+	}
+
+	switch config.LinearAccelerationUnit {
+	case "", MetersPerSecSquared, StandardGravity:
+	default:
+		return false, false, errors.Errorf("linear_acceleration_unit must be one of %q or %q, got %q",
+			MetersPerSecSquared, StandardGravity, config.LinearAccelerationUnit)
+	}
+	switch config.AngularVelocityUnit {
+	case "", DegreesPerSec, RadiansPerSec:
+	default:
+		return false, false, errors.Errorf("angular_velocity_unit must be one of %q or %q, got %q",
+			DegreesPerSec, RadiansPerSec, config.AngularVelocityUnit)
+	}
+
+	hasLinAcc, hasAngVel := len(config.LinearAccelerationKeys) > 0, len(config.AngularVelocityKeys) > 0
+	hasPosition, hasOrientation := len(config.PositionKeys) > 0, len(config.OrientationKeys) > 0
+	if hasLinAcc != hasAngVel || hasPosition != hasOrientation {
+		return false, false, ErrGenericSensorNeitherIMUNorOdometer
+	}
+
+	imuSupported := hasLinAcc && hasAngVel
+	odometerSupported := hasPosition && hasOrientation
+	if !imuSupported && !odometerSupported {
+		return false, false, ErrGenericSensorNeitherIMUNorOdometer
+	}
+	return imuSupported, odometerSupported, nil
+}
+
+// lookupReadings returns the numeric values of the given keys in the readings.
+func lookupReadings(readings map[string]interface{}, keys []string) ([]float64, error) {
+	values := make([]float64, 0, len(keys))
+	for _, key := range keys {
+		value, err := lookupReading(readings, key)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// lookupReading returns the numeric value of a key in the readings. Nested maps are traversed
+// by splitting the key on '.'.
+func lookupReading(readings map[string]interface{}, key string) (float64, error) {
+	var current interface{} = readings
+	for _, part := range strings.Split(key, readingsKeySeparator) {
+		nested, ok := current.(map[string]interface{})
+		if !ok {
+			return 0, errors.Wrapf(ErrGenericSensorMissingReading, "key %q", key)
+		}
+		if current, ok = nested[part]; !ok {
+			return 0, errors.Wrapf(ErrGenericSensorMissingReading, "key %q", key)
+		}
+	}
+
+	switch value := current.(type) {
+	case float64:
+		return value, nil
+	case float32:
+		return float64(value), nil
+	case int:
+		return float64(value), nil
+	case int32:
+		return float64(value), nil
+	case int64:
+		return float64(value), nil
+	case uint32:
+		return float64(value), nil
+	case uint64:
+		return float64(value), nil
+	default:
+		return 0, errors.Errorf("generic sensor reading %q has non-numeric type %T", key, current)
+	}
+}
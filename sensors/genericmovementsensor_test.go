@@ -0,0 +1,178 @@
+package sensors_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/spatialmath"
+	rdkutils "go.viam.com/rdk/utils"
+	"go.viam.com/test"
+
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+)
+
+func TestNewGenericMovementSensor(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	t.Run("Failed generic sensor creation with non-existing generic sensor", func(t *testing.T) {
+		lidar, genericSensor := s.GoodLidar, s.GibberishMovementSensor
+		deps := s.SetupDeps(lidar, genericSensor)
+		cfg := s.TestGenericSensorConfig
+		actualMs, err := s.NewMovementSensor(ctx, deps, string(genericSensor), testDataFrequencyHz, 0, &cfg, logger)
+		test.That(t, err, test.ShouldBeError,
+			errors.New("error getting generic sensor \""+string(genericSensor)+"\" for slam service: "+
+				"Resource missing from dependencies. Resource: rdk:component:sensor/"+string(genericSensor)))
+		test.That(t, actualMs, test.ShouldResemble, &s.GenericMovementSensor{})
+	})
+
+	t.Run("Failed generic sensor creation with a config that maps neither IMU nor odometer data", func(t *testing.T) {
+		lidar, genericSensor := s.GoodLidar, s.GoodGenericSensor
+		deps := s.SetupDeps(lidar, genericSensor)
+		cfg := s.GenericSensorConfig{LinearAccelerationKeys: s.TestGenericSensorConfig.LinearAccelerationKeys}
+		_, err := s.NewMovementSensor(ctx, deps, string(genericSensor), testDataFrequencyHz, 0, &cfg, logger)
+		test.That(t, errors.Is(err, s.ErrGenericSensorNeitherIMUNorOdometer), test.ShouldBeTrue)
+
+		cfg = s.GenericSensorConfig{}
+		_, err = s.NewMovementSensor(ctx, deps, string(genericSensor), testDataFrequencyHz, 0, &cfg, logger)
+		test.That(t, errors.Is(err, s.ErrGenericSensorNeitherIMUNorOdometer), test.ShouldBeTrue)
+	})
+
+	t.Run("Failed generic sensor creation with the wrong number of keys", func(t *testing.T) {
+		lidar, genericSensor := s.GoodLidar, s.GoodGenericSensor
+		deps := s.SetupDeps(lidar, genericSensor)
+		cfg := s.TestGenericSensorConfig
+		cfg.PositionKeys = []string{"lat"}
+		_, err := s.NewMovementSensor(ctx, deps, string(genericSensor), testDataFrequencyHz, 0, &cfg, logger)
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "position_keys must contain exactly 2 keys, got 1")
+	})
+
+	t.Run("Failed generic sensor creation with an invalid unit", func(t *testing.T) {
+		lidar, genericSensor := s.GoodLidar, s.GoodGenericSensor
+		deps := s.SetupDeps(lidar, genericSensor)
+		cfg := s.TestGenericSensorConfig
+		cfg.AngularVelocityUnit = "rpm"
+		_, err := s.NewMovementSensor(ctx, deps, string(genericSensor), testDataFrequencyHz, 0, &cfg, logger)
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "angular_velocity_unit must be one of")
+	})
+
+	t.Run("Failed generic sensor creation with a key that is missing from the readings", func(t *testing.T) {
+		lidar, genericSensor := s.GoodLidar, s.GoodGenericSensor
+		deps := s.SetupDeps(lidar, genericSensor)
+		cfg := s.TestGenericSensorConfig
+		cfg.AngularVelocityKeys = []string{"gyro.x", "gyro.y", "gyro.w"}
+		_, err := s.NewMovementSensor(ctx, deps, string(genericSensor), testDataFrequencyHz, 0, &cfg, logger)
+		test.That(t, errors.Is(err, s.ErrGenericSensorMissingReading), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "gyro.w")
+	})
+
+	t.Run("Failed generic sensor creation with erroring readings", func(t *testing.T) {
+		lidar, genericSensor := s.GoodLidar, s.GenericSensorWithErroringReadings
+		deps := s.SetupDeps(lidar, genericSensor)
+		cfg := s.TestGenericSensorConfig
+		_, err := s.NewMovementSensor(ctx, deps, string(genericSensor), testDataFrequencyHz, 0, &cfg, logger)
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err.Error(), test.ShouldContainSubstring, s.InvalidSensorTestErrMsg)
+	})
+
+	t.Run("Successful generic sensor creation that supports an IMU and an odometer", func(t *testing.T) {
+		lidar, genericSensor := s.GoodLidar, s.GoodGenericSensor
+		deps := s.SetupDeps(lidar, genericSensor)
+		cfg := s.TestGenericSensorConfig
+		actualMs, err := s.NewMovementSensor(ctx, deps, string(genericSensor), testDataFrequencyHz, 0, &cfg, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, actualMs.Name(), test.ShouldEqual, string(genericSensor))
+		test.That(t, actualMs.DataFrequencyHz(), test.ShouldEqual, testDataFrequencyHz)
+		test.That(t, actualMs.Properties().IMUSupported, test.ShouldBeTrue)
+		test.That(t, actualMs.Properties().OdometerSupported, test.ShouldBeTrue)
+	})
+
+	t.Run("Successful generic sensor creation that supports only an IMU", func(t *testing.T) {
+		lidar, genericSensor := s.GoodLidar, s.GoodGenericSensor
+		deps := s.SetupDeps(lidar, genericSensor)
+		cfg := s.TestGenericSensorConfig
+		cfg.PositionKeys, cfg.OrientationKeys = nil, nil
+		actualMs, err := s.NewMovementSensor(ctx, deps, string(genericSensor), testDataFrequencyHz, 0, &cfg, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, actualMs.Properties().IMUSupported, test.ShouldBeTrue)
+		test.That(t, actualMs.Properties().OdometerSupported, test.ShouldBeFalse)
+
+		actualReading, err := actualMs.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, actualReading.TimedIMUResponse, test.ShouldNotBeNil)
+		test.That(t, actualReading.TimedOdometerResponse, test.ShouldBeNil)
+	})
+}
+
+func TestGenericMovementSensorReading(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	t.Run("when a live generic sensor succeeds, returns current time in UTC and the reading", func(t *testing.T) {
+		lidar, genericSensor := s.GoodLidar, s.GoodGenericSensor
+		deps := s.SetupDeps(lidar, genericSensor)
+		cfg := s.TestGenericSensorConfig
+		actualMs, err := s.NewMovementSensor(ctx, deps, string(genericSensor), testDataFrequencyHz, 0, &cfg, logger)
+		test.That(t, err, test.ShouldBeNil)
+
+		beforeReading := time.Now().UTC()
+		time.Sleep(time.Millisecond)
+
+		actualReading, err := actualMs.TimedMovementSensorReading(ctx)
+
+		time.Sleep(time.Millisecond)
+		afterReading := time.Now().UTC()
+
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, actualReading.TimedIMUResponse.LinearAcceleration, test.ShouldResemble, s.TestLinAcc)
+		test.That(t, actualReading.TimedIMUResponse.AngularVelocity, test.ShouldResemble,
+			spatialmath.AngularVelocity{
+				X: rdkutils.DegToRad(s.TestAngVel.X),
+				Y: rdkutils.DegToRad(s.TestAngVel.Y),
+				Z: rdkutils.DegToRad(s.TestAngVel.Z),
+			})
+		test.That(t, actualReading.TimedOdometerResponse.Position, test.ShouldResemble, s.TestPosition)
+		test.That(t, actualReading.TimedOdometerResponse.Orientation, test.ShouldResemble, s.TestOrientation)
+		test.That(t, actualReading.TimedIMUResponse.ReadingTime.After(beforeReading), test.ShouldBeTrue)
+		test.That(t, actualReading.TimedIMUResponse.ReadingTime.Before(afterReading), test.ShouldBeTrue)
+		test.That(t, actualReading.TimedIMUResponse.ReadingTime.Location(), test.ShouldEqual, time.UTC)
+		test.That(t, actualReading.TimedOdometerResponse.ReadingTime, test.ShouldEqual, actualReading.TimedIMUResponse.ReadingTime)
+		test.That(t, actualReading.TestIsReplaySensor, test.ShouldBeFalse)
+	})
+
+	t.Run("when the generic sensor reports in g and rad/s, converts the reading", func(t *testing.T) {
+		lidar, genericSensor := s.GoodLidar, s.GoodGenericSensor
+		deps := s.SetupDeps(lidar, genericSensor)
+		cfg := s.TestGenericSensorConfig
+		cfg.LinearAccelerationUnit = s.StandardGravity
+		cfg.AngularVelocityUnit = s.RadiansPerSec
+		actualMs, err := s.NewMovementSensor(ctx, deps, string(genericSensor), testDataFrequencyHz, 0, &cfg, logger)
+		test.That(t, err, test.ShouldBeNil)
+
+		actualReading, err := actualMs.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, actualReading.TimedIMUResponse.LinearAcceleration, test.ShouldResemble, s.TestLinAcc.Mul(9.80665))
+		test.That(t, actualReading.TimedIMUResponse.AngularVelocity, test.ShouldResemble, s.TestAngVel)
+	})
+
+	t.Run("when a replay generic sensor succeeds, returns the replay timestamp", func(t *testing.T) {
+		lidar, genericSensor := s.GoodLidar, s.ReplayGenericSensor
+		deps := s.SetupDeps(lidar, genericSensor)
+		cfg := s.TestGenericSensorConfig
+		actualMs, err := s.NewMovementSensor(ctx, deps, string(genericSensor), testDataFrequencyHz, 0, &cfg, logger)
+		test.That(t, err, test.ShouldBeNil)
+
+		actualReading, err := actualMs.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		expectedTime, err := time.Parse(time.RFC3339Nano, s.TestTimestamp)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, actualReading.TimedIMUResponse.ReadingTime, test.ShouldEqual, expectedTime)
+		test.That(t, actualReading.TimedOdometerResponse.ReadingTime, test.ShouldEqual, expectedTime)
+		test.That(t, actualReading.TestIsReplaySensor, test.ShouldBeTrue)
+	})
+}
@@ -11,7 +11,7 @@ import (
 type TimedLidar struct {
 	s.Lidar
 	NameFunc              func() string
-	DataFrequencyHzFunc   func() int
+	DataFrequencyHzFunc   func() float64
 	TimedLidarReadingFunc func(ctx context.Context) (s.TimedLidarReadingResponse, error)
 }
 
@@ -24,7 +24,7 @@ func (tls *TimedLidar) Name() string {
 }
 
 // DataFrequencyHz calls the injected DataFrequencyHz or the real version.
-func (tls *TimedLidar) DataFrequencyHz() int {
+func (tls *TimedLidar) DataFrequencyHz() float64 {
 	if tls.DataFrequencyHzFunc == nil {
 		return tls.Lidar.DataFrequencyHz()
 	}
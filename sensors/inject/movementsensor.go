@@ -10,7 +10,7 @@ import (
 type TimedMovementSensor struct {
 	s.MovementSensor
 	NameFunc                       func() string
-	DataFrequencyHzFunc            func() int
+	DataFrequencyHzFunc            func() float64
 	TimedMovementSensorReadingFunc func(ctx context.Context) (s.TimedMovementSensorReadingResponse, error)
 	PropertiesFunc                 func() s.MovementSensorProperties
 }
@@ -24,7 +24,7 @@ func (tms *TimedMovementSensor) Name() string {
 }
 
 // DataFrequencyHz calls the injected DataFrequencyHz or the real version.
-func (tms *TimedMovementSensor) DataFrequencyHz() int {
+func (tms *TimedMovementSensor) DataFrequencyHz() float64 {
 	if tms.DataFrequencyHzFunc == nil {
 		return tms.MovementSensor.DataFrequencyHz()
 	}
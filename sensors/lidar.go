@@ -1,7 +1,6 @@
 package sensors
 
 import (
-	"bytes"
 	"context"
 	"time"
 
@@ -9,7 +8,6 @@ import (
 	"go.opencensus.io/trace"
 	"go.viam.com/rdk/components/camera"
 	"go.viam.com/rdk/logging"
-	"go.viam.com/rdk/pointcloud"
 	"go.viam.com/rdk/resource"
 	"go.viam.com/rdk/utils/contextutils"
 )
@@ -18,7 +16,7 @@ import (
 // rom a replay sensor.
 type TimedLidar interface {
 	Name() string
-	DataFrequencyHz() int
+	DataFrequencyHz() float64
 	TimedLidarReading(ctx context.Context) (TimedLidarReadingResponse, error)
 }
 
@@ -28,12 +26,18 @@ type TimedLidarReadingResponse struct {
 	Reading            []byte
 	ReadingTime        time.Time
 	TestIsReplaySensor bool
+	// Format is the encoding of Reading, PCD by default.
+	Format LidarReadingFormat
+	// AngleMin and AngleIncrement, in radians, describe the ranges of a LidarReadingFormatPolar reading.
+	AngleMin       float32
+	AngleIncrement float32
 }
 
 // Lidar represents a LIDAR sensor.
 type Lidar struct {
 	name            string
-	dataFrequencyHz int
+	dataFrequencyHz float64
+	readingFormat   LidarReadingFormat
 	Lidar           camera.Camera
 }
 
@@ -42,8 +46,8 @@ func (lidar Lidar) Name() string {
 	return lidar.name
 }
 
-// DataFrequencyHz returns the data rate in ms of the lidar.
-func (lidar Lidar) DataFrequencyHz() int {
+// DataFrequencyHz returns the data rate in Hz of the lidar.
+func (lidar Lidar) DataFrequencyHz() float64 {
 	return lidar.dataFrequencyHz
 }
 
@@ -59,9 +63,10 @@ func (lidar Lidar) TimedLidarReading(ctx context.Context) (TimedLidarReadingResp
 	}
 	readingTime := time.Now().UTC()
 
-	buf := new(bytes.Buffer)
-	if err = pointcloud.ToPCD(readingPc, buf, pointcloud.PCDBinary); err != nil {
-		return TimedLidarReadingResponse{}, errors.Wrap(err, "ToPCD error")
+	format := IntensityPreservingFormat(readingPc, lidar.readingFormat)
+	reading, err := EncodeLidarReading(readingPc, format)
+	if err != nil {
+		return TimedLidarReadingResponse{}, err
 	}
 
 	if timeRequestedMetadata, ok := md[contextutils.TimeRequestedMetadataKey]; ok {
@@ -70,7 +75,12 @@ func (lidar Lidar) TimedLidarReading(ctx context.Context) (TimedLidarReadingResp
 			return TimedLidarReadingResponse{}, errors.Wrap(err, replayTimestampErrorMessage)
 		}
 	}
-	return TimedLidarReadingResponse{Reading: buf.Bytes(), ReadingTime: readingTime, TestIsReplaySensor: testIsReplaySensor}, nil
+	return TimedLidarReadingResponse{
+		Reading:            reading,
+		ReadingTime:        readingTime,
+		TestIsReplaySensor: testIsReplaySensor,
+		Format:             format,
+	}, nil
 }
 
 // NewLidar returns a new Lidar.
@@ -78,7 +88,8 @@ func NewLidar(
 	ctx context.Context,
 	deps resource.Dependencies,
 	cameraName string,
-	dataFrequencyHz int,
+	dataFrequencyHz float64,
+	readingFormat LidarReadingFormat,
 	logger logging.Logger,
 ) (TimedLidar, error) {
 	_, span := trace.StartSpan(ctx, "viamcartographer::sensors::NewLidar")
@@ -102,6 +113,7 @@ func NewLidar(
 	return Lidar{
 		name:            cameraName,
 		dataFrequencyHz: dataFrequencyHz,
+		readingFormat:   readingFormat,
 		Lidar:           lidar,
 	}, nil
 }
@@ -17,7 +17,7 @@ func TestNewLidar(t *testing.T) {
 
 	t.Run("No lidar provided", func(t *testing.T) {
 		lidar, imu := s.NoLidar, s.NoMovementSensor
-		actualLidar, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, logger)
+		actualLidar, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, s.LidarReadingFormatPCD, logger)
 		test.That(t, err, test.ShouldBeError,
 			errors.New("error getting lidar camera "+
 				" for slam service: Resource missing from dependencies. Resource: rdk:component:camera/"))
@@ -26,7 +26,7 @@ func TestNewLidar(t *testing.T) {
 
 	t.Run("Failed lidar creation with non-existing sensor", func(t *testing.T) {
 		lidar, imu := s.GibberishLidar, s.NoMovementSensor
-		actualLidar, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, logger)
+		actualLidar, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, s.LidarReadingFormatPCD, logger)
 		test.That(t, err, test.ShouldBeError,
 			errors.New("error getting lidar camera "+
 				"gibberish_lidar for slam service: Resource missing from dependencies. Resource: rdk:component:camera/gibberish_lidar"))
@@ -35,7 +35,7 @@ func TestNewLidar(t *testing.T) {
 
 	t.Run("Successful lidar creation", func(t *testing.T) {
 		lidar, imu := s.GoodLidar, s.NoMovementSensor
-		actualLidar, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, logger)
+		actualLidar, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, s.LidarReadingFormatPCD, logger)
 		test.That(t, actualLidar.Name(), test.ShouldEqual, string(lidar))
 		test.That(t, err, test.ShouldBeNil)
 
@@ -50,19 +50,19 @@ func TestTimedLidarSensorReading(t *testing.T) {
 	ctx := context.Background()
 
 	lidar, imu := s.LidarWithErroringFunctions, s.NoMovementSensor
-	lidarWithErroringFunctions, err := s.NewLidar(ctx, s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, logger)
+	lidarWithErroringFunctions, err := s.NewLidar(ctx, s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, s.LidarReadingFormatPCD, logger)
 	test.That(t, err, test.ShouldBeNil)
 
 	lidar, imu = s.InvalidReplayLidar, s.NoMovementSensor
-	invalidReplayLidar, err := s.NewLidar(ctx, s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, logger)
+	invalidReplayLidar, err := s.NewLidar(ctx, s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, s.LidarReadingFormatPCD, logger)
 	test.That(t, err, test.ShouldBeNil)
 
 	lidar, imu = s.GoodLidar, s.NoMovementSensor
-	goodLidar, err := s.NewLidar(ctx, s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, logger)
+	goodLidar, err := s.NewLidar(ctx, s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, s.LidarReadingFormatPCD, logger)
 	test.That(t, err, test.ShouldBeNil)
 
 	lidar, imu = s.ReplayLidar, s.NoMovementSensor
-	goodReplayLidar, err := s.NewLidar(ctx, s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, logger)
+	goodReplayLidar, err := s.NewLidar(ctx, s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, s.LidarReadingFormatPCD, logger)
 	test.That(t, err, test.ShouldBeNil)
 
 	t.Run("when the lidar returns an error, returns that error", func(t *testing.T) {
@@ -0,0 +1,172 @@
+package sensors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/pointcloud"
+)
+
+// LidarReadingFormat describes how the bytes of a TimedLidarReadingResponse are encoded.
+type LidarReadingFormat int
+
+const (
+	// LidarReadingFormatPCD is a binary or ascii PCD file. It is the default format.
+	LidarReadingFormatPCD LidarReadingFormat = iota
+	// LidarReadingFormatPoints is a sequence of little endian float32 x, y, z triples in meters.
+	LidarReadingFormatPoints
+	// LidarReadingFormatPolar is a sequence of little endian float32 ranges in meters, the first one at
+	// AngleMin and each following one AngleIncrement radians further. Ranges which are not positive and
+	// finite are missing returns.
+	LidarReadingFormatPolar
+	// LidarReadingFormatPointsIntensity is a sequence of little endian float32 x, y, z, intensity quadruples,
+	// with x, y, z in meters.
+	LidarReadingFormatPointsIntensity
+)
+
+const (
+	// pointSizeBytes is the size of a single point of a LidarReadingFormatPoints reading.
+	pointSizeBytes = 12
+	// pointIntensitySizeBytes is the size of a single point of a LidarReadingFormatPointsIntensity reading.
+	pointIntensitySizeBytes = 16
+)
+
+// lidarReadingFormatNames are the names of the lidar reading formats, as used in the config and in the
+// records of a local dataset.
+var lidarReadingFormatNames = map[LidarReadingFormat]string{
+	LidarReadingFormatPCD:             "pcd",
+	LidarReadingFormatPoints:          "points",
+	LidarReadingFormatPolar:           "polar",
+	LidarReadingFormatPointsIntensity: "points_intensity",
+}
+
+// String returns the name of the lidar reading format.
+func (format LidarReadingFormat) String() string {
+	if name, ok := lidarReadingFormatNames[format]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseLidarReadingFormat parses the name of a lidar reading format as used in the config.
+func ParseLidarReadingFormat(name string) (LidarReadingFormat, error) {
+	switch name {
+	case "", "pcd":
+		return LidarReadingFormatPCD, nil
+	case "points":
+		return LidarReadingFormatPoints, nil
+	case "points_intensity":
+		return LidarReadingFormatPointsIntensity, nil
+	default:
+		return LidarReadingFormatPCD, errors.Errorf("lidar reading format must be one of [pcd, points, points_intensity], got %q", name)
+	}
+}
+
+// IntensityPreservingFormat returns the format a point cloud is encoded in so that its intensity reaches
+// cartographer. The RDK only writes PCDs without intensity, so point clouds that carry intensity are sent
+// as LidarReadingFormatPointsIntensity instead of LidarReadingFormatPCD.
+func IntensityPreservingFormat(pc pointcloud.PointCloud, format LidarReadingFormat) LidarReadingFormat {
+	if format != LidarReadingFormatPCD {
+		return format
+	}
+	hasIntensity := false
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		hasIntensity = d != nil && d.Intensity() > 0
+		return !hasIntensity
+	})
+	if hasIntensity {
+		return LidarReadingFormatPointsIntensity
+	}
+	return format
+}
+
+// EncodeLidarReading encodes a point cloud, with positions in millimeters, in the given format.
+// Point clouds cannot be encoded as polar ranges, and PCD readings do not carry intensity, see
+// IntensityPreservingFormat.
+func EncodeLidarReading(pc pointcloud.PointCloud, format LidarReadingFormat) ([]byte, error) {
+	switch format {
+	case LidarReadingFormatPCD:
+		buf := new(bytes.Buffer)
+		if err := pointcloud.ToPCD(pc, buf, pointcloud.PCDBinary); err != nil {
+			return nil, errors.Wrap(err, "ToPCD error")
+		}
+		return buf.Bytes(), nil
+	case LidarReadingFormatPoints, LidarReadingFormatPointsIntensity:
+		withIntensity := format == LidarReadingFormatPointsIntensity
+		buf := make([]byte, 0, pc.Size()*pointIntensitySizeBytes)
+		pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(p.X/1000)))
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(p.Y/1000)))
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(p.Z/1000)))
+			if withIntensity {
+				var intensity uint16
+				if d != nil {
+					intensity = d.Intensity()
+				}
+				buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(intensity)))
+			}
+			return true
+		})
+		return buf, nil
+	default:
+		return nil, errors.Errorf("cannot encode a point cloud as lidar reading format %d", format)
+	}
+}
+
+// DecodeLidarReading decodes a lidar reading of any format into a point cloud with positions in millimeters.
+func DecodeLidarReading(reading TimedLidarReadingResponse) (pointcloud.PointCloud, error) {
+	switch reading.Format {
+	case LidarReadingFormatPCD:
+		return pointcloud.ReadPCD(bytes.NewReader(reading.Reading))
+	case LidarReadingFormatPoints, LidarReadingFormatPointsIntensity:
+		withIntensity := reading.Format == LidarReadingFormatPointsIntensity
+		pointSize := pointSizeBytes
+		if withIntensity {
+			pointSize = pointIntensitySizeBytes
+		}
+		if len(reading.Reading)%pointSize != 0 {
+			return nil, errors.Errorf("points lidar reading has invalid length %d", len(reading.Reading))
+		}
+		pc := pointcloud.New()
+		for offset := 0; offset < len(reading.Reading); offset += pointSize {
+			p := r3.Vector{
+				X: 1000 * float64(readFloat32(reading.Reading[offset:])),
+				Y: 1000 * float64(readFloat32(reading.Reading[offset+4:])),
+				Z: 1000 * float64(readFloat32(reading.Reading[offset+8:])),
+			}
+			var d pointcloud.Data
+			if withIntensity {
+				d = pointcloud.NewBasicData().SetIntensity(uint16(readFloat32(reading.Reading[offset+12:])))
+			}
+			if err := pc.Set(p, d); err != nil {
+				return nil, err
+			}
+		}
+		return pc, nil
+	case LidarReadingFormatPolar:
+		if len(reading.Reading)%4 != 0 {
+			return nil, errors.Errorf("polar lidar reading has invalid length %d", len(reading.Reading))
+		}
+		pc := pointcloud.New()
+		for i := 0; i < len(reading.Reading)/4; i++ {
+			r := float64(readFloat32(reading.Reading[4*i:]))
+			if r <= 0 || math.IsInf(r, 0) || math.IsNaN(r) {
+				continue
+			}
+			angle := float64(reading.AngleMin) + float64(i)*float64(reading.AngleIncrement)
+			if err := pc.Set(r3.Vector{X: 1000 * r * math.Cos(angle), Y: 1000 * r * math.Sin(angle)}, nil); err != nil {
+				return nil, err
+			}
+		}
+		return pc, nil
+	default:
+		return nil, errors.Errorf("unknown lidar reading format %d", reading.Format)
+	}
+}
+
+func readFloat32(b []byte) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(b))
+}
@@ -0,0 +1,165 @@
+package sensors_test
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/test"
+
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+)
+
+// testScan returns a point cloud resembling a 2D lidar scan with the given number of points.
+func testScan(t testing.TB, numPoints int) pointcloud.PointCloud {
+	pc := pointcloud.New()
+	for i := 0; i < numPoints; i++ {
+		angle := 2 * math.Pi * float64(i) / float64(numPoints)
+		p := r3.Vector{X: 3000 * math.Cos(angle), Y: 3000 * math.Sin(angle)}
+		test.That(t, pc.Set(p, pointcloud.NewBasicData()), test.ShouldBeNil)
+	}
+	return pc
+}
+
+func containsPoint(pc pointcloud.PointCloud, expected r3.Vector) bool {
+	found := false
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		found = p.Sub(expected).Norm() < 1e-2
+		return !found
+	})
+	return found
+}
+
+func TestParseLidarReadingFormat(t *testing.T) {
+	format, err := s.ParseLidarReadingFormat("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, format, test.ShouldEqual, s.LidarReadingFormatPCD)
+
+	format, err = s.ParseLidarReadingFormat("pcd")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, format, test.ShouldEqual, s.LidarReadingFormatPCD)
+
+	format, err = s.ParseLidarReadingFormat("points")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, format, test.ShouldEqual, s.LidarReadingFormatPoints)
+
+	format, err = s.ParseLidarReadingFormat("points_intensity")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, format, test.ShouldEqual, s.LidarReadingFormatPointsIntensity)
+
+	_, err = s.ParseLidarReadingFormat("polar")
+	test.That(t, err, test.ShouldBeError)
+}
+
+func TestEncodeDecodeLidarReading(t *testing.T) {
+	pc := testScan(t, 8)
+
+	for _, format := range []s.LidarReadingFormat{s.LidarReadingFormatPCD, s.LidarReadingFormatPoints} {
+		reading, err := s.EncodeLidarReading(pc, format)
+		test.That(t, err, test.ShouldBeNil)
+
+		decoded, err := s.DecodeLidarReading(s.TimedLidarReadingResponse{Reading: reading, Format: format})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, decoded.Size(), test.ShouldEqual, pc.Size())
+		pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+			test.That(t, containsPoint(decoded, p), test.ShouldBeTrue)
+			return true
+		})
+	}
+
+	t.Run("point clouds with intensity are not encoded as PCDs", func(t *testing.T) {
+		test.That(t, s.IntensityPreservingFormat(pc, s.LidarReadingFormatPCD), test.ShouldEqual, s.LidarReadingFormatPCD)
+		test.That(t, s.IntensityPreservingFormat(pc, s.LidarReadingFormatPoints), test.ShouldEqual, s.LidarReadingFormatPoints)
+
+		withIntensity := pointcloud.New()
+		test.That(t, withIntensity.Set(r3.Vector{X: 1000}, pointcloud.NewBasicData().SetIntensity(200)), test.ShouldBeNil)
+		format := s.IntensityPreservingFormat(withIntensity, s.LidarReadingFormatPCD)
+		test.That(t, format, test.ShouldEqual, s.LidarReadingFormatPointsIntensity)
+
+		reading, err := s.EncodeLidarReading(withIntensity, format)
+		test.That(t, err, test.ShouldBeNil)
+		decoded, err := s.DecodeLidarReading(s.TimedLidarReadingResponse{Reading: reading, Format: format})
+		test.That(t, err, test.ShouldBeNil)
+		d, ok := decoded.At(1000, 0, 0)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, d.Intensity(), test.ShouldEqual, 200)
+	})
+
+	t.Run("points readings are 12 bytes per point", func(t *testing.T) {
+		reading, err := s.EncodeLidarReading(pc, s.LidarReadingFormatPoints)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(reading), test.ShouldEqual, 12*pc.Size())
+
+		_, err = s.DecodeLidarReading(s.TimedLidarReadingResponse{Reading: reading[1:], Format: s.LidarReadingFormatPoints})
+		test.That(t, err, test.ShouldBeError)
+	})
+
+	t.Run("points intensity readings carry the intensity of each point", func(t *testing.T) {
+		pc := pointcloud.New()
+		test.That(t, pc.Set(r3.Vector{X: 1000}, pointcloud.NewBasicData().SetIntensity(7)), test.ShouldBeNil)
+		test.That(t, pc.Set(r3.Vector{Y: 1000}, pointcloud.NewBasicData().SetIntensity(4000)), test.ShouldBeNil)
+
+		reading, err := s.EncodeLidarReading(pc, s.LidarReadingFormatPointsIntensity)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(reading), test.ShouldEqual, 16*pc.Size())
+
+		decoded, err := s.DecodeLidarReading(s.TimedLidarReadingResponse{Reading: reading, Format: s.LidarReadingFormatPointsIntensity})
+		test.That(t, err, test.ShouldBeNil)
+		d, ok := decoded.At(1000, 0, 0)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, d.Intensity(), test.ShouldEqual, 7)
+		d, ok = decoded.At(0, 1000, 0)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, d.Intensity(), test.ShouldEqual, 4000)
+	})
+
+	t.Run("point clouds cannot be encoded as polar readings", func(t *testing.T) {
+		_, err := s.EncodeLidarReading(pc, s.LidarReadingFormatPolar)
+		test.That(t, err, test.ShouldBeError)
+	})
+
+	t.Run("polar readings skip missing returns", func(t *testing.T) {
+		var reading []byte
+		for _, r := range []float32{1, 0, 2, float32(math.Inf(1))} {
+			reading = binary.LittleEndian.AppendUint32(reading, math.Float32bits(r))
+		}
+		decoded, err := s.DecodeLidarReading(s.TimedLidarReadingResponse{
+			Reading:        reading,
+			Format:         s.LidarReadingFormatPolar,
+			AngleMin:       0,
+			AngleIncrement: math.Pi / 2,
+		})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, decoded.Size(), test.ShouldEqual, 2)
+		test.That(t, containsPoint(decoded, r3.Vector{X: 1000}), test.ShouldBeTrue)
+		test.That(t, containsPoint(decoded, r3.Vector{X: -2000}), test.ShouldBeTrue)
+	})
+}
+
+func BenchmarkEncodeLidarReading(b *testing.B) {
+	// a typical 2D lidar produces a few hundred to a couple thousand points per scan
+	pc := testScan(b, 2000)
+	for _, tc := range []struct {
+		name   string
+		format s.LidarReadingFormat
+	}{
+		{name: "pcd", format: s.LidarReadingFormatPCD},
+		{name: "points", format: s.LidarReadingFormatPoints},
+	} {
+		format := tc.format
+		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var size int
+			for i := 0; i < b.N; i++ {
+				reading, err := s.EncodeLidarReading(pc, format)
+				if err != nil {
+					b.Fatal(err)
+				}
+				size = len(reading)
+			}
+			b.ReportMetric(float64(size), "bytes/reading")
+		})
+	}
+}
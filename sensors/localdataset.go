@@ -0,0 +1,420 @@
+package sensors
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/components/camera/replaypcd"
+	replaymovementsensor "go.viam.com/rdk/components/movementsensor/replay"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/spatialmath"
+	rdkutils "go.viam.com/rdk/utils"
+	"go.viam.com/utils"
+)
+
+// DatasetTimeFormat is the format of the timestamps in the file names of a local dataset, as in
+// <sensor name>_data_<timestamp>.pcd. Timestamps in RFC3339 with nanoseconds are accepted as well.
+const DatasetTimeFormat = "2006-01-02T15:04:05.0000Z"
+
+// datasetIMUColumns are the columns an IMU CSV file of a local dataset must contain. The time is either
+// RFC3339 or unix milliseconds, linear acceleration is in m/s^2 and angular velocity in deg/s.
+var datasetIMUColumns = []string{"time", "lin_acc_x", "lin_acc_y", "lin_acc_z", "ang_vel_x", "ang_vel_y", "ang_vel_z"}
+
+// DatasetTimeSpanner is implemented by sensors that replay a dataset whose time span is known up front.
+type DatasetTimeSpanner interface {
+	// DatasetTimeSpan returns the times of the first and the last reading of the dataset.
+	DatasetTimeSpan() (time.Time, time.Time)
+}
+
+// datasetFile is a lidar file of a local dataset together with its reading time and the format of the
+// reading it holds.
+type datasetFile struct {
+	path           string
+	readingTime    time.Time
+	format         LidarReadingFormat
+	angleMin       float32
+	angleIncrement float32
+}
+
+// listDatasetFiles returns the files in the directory with the given extension, sorted by the timestamp
+// in their names. Files without a timestamp are skipped.
+func listDatasetFiles(dir, ext string, logger logging.Logger) ([]datasetFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading dataset directory %v", dir)
+	}
+
+	var files []datasetFile
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ext {
+			continue
+		}
+		base := strings.TrimSuffix(entry.Name(), ext)
+		if i := strings.LastIndex(base, "_data_"); i >= 0 {
+			base = base[i+len("_data_"):]
+		}
+		readingTime, err := time.Parse(DatasetTimeFormat, base)
+		if err != nil {
+			readingTime, err = time.Parse(time.RFC3339Nano, base)
+		}
+		if err != nil {
+			logger.Debugf("skipping dataset file %v without a timestamp", entry.Name())
+			continue
+		}
+		files = append(files, datasetFile{path: filepath.Join(dir, entry.Name()), readingTime: readingTime})
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].readingTime.Before(files[j].readingTime)
+	})
+	return files, nil
+}
+
+// readDatasetLidarRecords returns the files of the lidar records of the JSON lines files in the directory,
+// in the order they were recorded. Readings cartographer dropped while the dataset was recorded are
+// skipped, so the replay adds the readings the recorded map was built from.
+func readDatasetLidarRecords(dir string, logger logging.Logger) ([]datasetFile, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading dataset directory %v", dir)
+	}
+	sort.Strings(paths)
+
+	var files []datasetFile
+	var dropped int
+	for _, path := range paths {
+		records, err := readDatasetRecords(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			if record.Lidar == nil {
+				continue
+			}
+			if !record.Lidar.Accepted {
+				dropped++
+				continue
+			}
+			format, err := record.Lidar.LidarReadingFormat()
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, datasetFile{
+				path:           filepath.Join(dir, record.Lidar.File),
+				readingTime:    record.Lidar.Time,
+				format:         format,
+				angleMin:       record.Lidar.AngleMin,
+				angleIncrement: record.Lidar.AngleIncrement,
+			})
+		}
+	}
+	if dropped > 0 {
+		logger.Infof("skipping %d lidar readings which were dropped while dataset directory %v was recorded", dropped, dir)
+	}
+	return files, nil
+}
+
+// LocalDatasetLidar is a lidar that replays the lidar files of a local directory. Directories recorded by
+// a session hold JSON lines files, whose lidar records are replayed in the order they were recorded, in the
+// format they were recorded in. Otherwise the PCD files of the directory are replayed in the order of the
+// timestamps in their names. The files are read one at a time, so the dataset may be larger than memory.
+type LocalDatasetLidar struct {
+	name  string
+	mu    sync.Mutex
+	files []datasetFile
+	next  int
+}
+
+// NewLocalDatasetLidar returns a new LocalDatasetLidar that reads the recorded lidar readings or the PCD
+// files in dir.
+func NewLocalDatasetLidar(name, dir string, logger logging.Logger) (*LocalDatasetLidar, error) {
+	files, err := readDatasetLidarRecords(dir, logger)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		if files, err = listDatasetFiles(dir, ".pcd", logger); err != nil {
+			return nil, err
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.Errorf("dataset directory %v does not contain any accepted lidar records or timestamped .pcd files", dir)
+	}
+	logger.Infof("found %d lidar readings in dataset directory %v", len(files), dir)
+	return &LocalDatasetLidar{name: name, files: files}, nil
+}
+
+// Name returns the name of the lidar.
+func (lidar *LocalDatasetLidar) Name() string {
+	return lidar.name
+}
+
+// DataFrequencyHz returns 0, as a local dataset can only be used in offline mode.
+func (lidar *LocalDatasetLidar) DataFrequencyHz() float64 {
+	return 0
+}
+
+// DatasetTimeSpan returns the times of the first and the last lidar file of the dataset.
+func (lidar *LocalDatasetLidar) DatasetTimeSpan() (time.Time, time.Time) {
+	return lidar.files[0].readingTime, lidar.files[len(lidar.files)-1].readingTime
+}
+
+// TimedLidarReading returns the next lidar file of the dataset, or replaypcd.ErrEndOfDataset once all
+// files have been returned.
+func (lidar *LocalDatasetLidar) TimedLidarReading(ctx context.Context) (TimedLidarReadingResponse, error) {
+	lidar.mu.Lock()
+	defer lidar.mu.Unlock()
+	if lidar.next >= len(lidar.files) {
+		return TimedLidarReadingResponse{}, replaypcd.ErrEndOfDataset
+	}
+	file := lidar.files[lidar.next]
+	lidar.next++
+
+	reading, err := os.ReadFile(filepath.Clean(file.path))
+	if err != nil {
+		return TimedLidarReadingResponse{}, errors.Wrapf(err, "error reading dataset file %v", file.path)
+	}
+	return TimedLidarReadingResponse{
+		Reading:            reading,
+		ReadingTime:        file.readingTime,
+		TestIsReplaySensor: true,
+		Format:             file.format,
+		AngleMin:           file.angleMin,
+		AngleIncrement:     file.angleIncrement,
+	}, nil
+}
+
+// LocalDatasetMovementSensor is a movement sensor that replays the CSV and JSON lines files of a local
+// directory. The files are read in the order of their names, one at a time. The rows of a CSV file are
+// IMU readings and are returned in time order, the movement sensor records of a JSON lines file, as
+// written by a recording of a session, are returned in the order they were recorded. Channels cartographer
+// dropped while the session was recorded are left out of the readings, and records of which all channels
+// were dropped are skipped.
+type LocalDatasetMovementSensor struct {
+	name       string
+	properties MovementSensorProperties
+	mu         sync.Mutex
+	files      []string
+	next       int
+	rows       []TimedMovementSensorReadingResponse
+}
+
+// NewLocalDatasetMovementSensor returns a new LocalDatasetMovementSensor that reads the CSV and JSON lines
+// files in dir.
+func NewLocalDatasetMovementSensor(name, dir string) (*LocalDatasetMovementSensor, error) {
+	var files []string
+	var properties MovementSensorProperties
+	for _, ext := range []string{".csv", ".jsonl"} {
+		extFiles, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading dataset directory %v", dir)
+		}
+		files = append(files, extFiles...)
+	}
+	if len(files) == 0 {
+		return nil, errors.Errorf("dataset directory %v does not contain any .csv or .jsonl files", dir)
+	}
+	sort.Strings(files)
+
+	// the readings of CSV files are IMU readings, while the first movement sensor record of the JSON lines
+	// files tells which channels were recorded
+	recordsChecked := false
+	for _, file := range files {
+		if filepath.Ext(file) == ".csv" {
+			properties.IMUSupported = true
+			continue
+		}
+		if recordsChecked {
+			continue
+		}
+		records, err := readDatasetRecords(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			if record.IMU == nil && record.Odometer == nil {
+				continue
+			}
+			properties.IMUSupported = properties.IMUSupported || record.IMU != nil
+			properties.OdometerSupported = record.Odometer != nil
+			recordsChecked = true
+			break
+		}
+	}
+	return &LocalDatasetMovementSensor{name: name, properties: properties, files: files}, nil
+}
+
+// Name returns the name of the movement sensor.
+func (ms *LocalDatasetMovementSensor) Name() string {
+	return ms.name
+}
+
+// DataFrequencyHz returns 0, as a local dataset can only be used in offline mode.
+func (ms *LocalDatasetMovementSensor) DataFrequencyHz() float64 {
+	return 0
+}
+
+// Properties returns whether the dataset provides IMU and odometer readings.
+func (ms *LocalDatasetMovementSensor) Properties() MovementSensorProperties {
+	return ms.properties
+}
+
+// TimedMovementSensorReading returns the next reading of the dataset, or replaymovementsensor.ErrEndOfDataset
+// once all readings have been returned.
+func (ms *LocalDatasetMovementSensor) TimedMovementSensorReading(ctx context.Context) (TimedMovementSensorReadingResponse, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for len(ms.rows) == 0 {
+		if ms.next >= len(ms.files) {
+			return TimedMovementSensorReadingResponse{}, replaymovementsensor.ErrEndOfDataset
+		}
+		var rows []TimedMovementSensorReadingResponse
+		var err error
+		if filepath.Ext(ms.files[ms.next]) == ".csv" {
+			rows, err = readDatasetIMUFile(ms.files[ms.next])
+		} else {
+			rows, err = readDatasetRecordFile(ms.files[ms.next])
+		}
+		ms.next++
+		if err != nil {
+			return TimedMovementSensorReadingResponse{}, err
+		}
+		ms.rows = rows
+	}
+	reading := ms.rows[0]
+	ms.rows = ms.rows[1:]
+	return reading, nil
+}
+
+// readDatasetIMUFile reads all IMU readings of a CSV file and sorts them by time.
+func readDatasetIMUFile(path string) ([]TimedMovementSensorReadingResponse, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening dataset file %v", path)
+	}
+	defer utils.UncheckedErrorFunc(f.Close)
+
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading header of dataset file %v", path)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	indices := make([]int, len(datasetIMUColumns))
+	for i, name := range datasetIMUColumns {
+		index, ok := columns[name]
+		if !ok {
+			return nil, errors.Errorf("dataset file %v is missing column %q", path, name)
+		}
+		indices[i] = index
+	}
+
+	var readings []TimedIMUReadingResponse
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading dataset file %v", path)
+		}
+		readingTime, err := parseDatasetTime(strings.TrimSpace(record[indices[0]]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid time in line %d of dataset file %v", line, path)
+		}
+		var values [6]float64
+		for i := range values {
+			if values[i], err = strconv.ParseFloat(strings.TrimSpace(record[indices[i+1]]), 64); err != nil {
+				return nil, errors.Wrapf(err, "invalid %v in line %d of dataset file %v", datasetIMUColumns[i+1], line, path)
+			}
+		}
+		readings = append(readings, TimedIMUReadingResponse{
+			LinearAcceleration: r3.Vector{X: values[0], Y: values[1], Z: values[2]},
+			AngularVelocity: spatialmath.AngularVelocity{
+				X: rdkutils.DegToRad(values[3]),
+				Y: rdkutils.DegToRad(values[4]),
+				Z: rdkutils.DegToRad(values[5]),
+			},
+			ReadingTime: readingTime,
+		})
+	}
+	sort.SliceStable(readings, func(i, j int) bool {
+		return readings[i].ReadingTime.Before(readings[j].ReadingTime)
+	})
+	responses := make([]TimedMovementSensorReadingResponse, len(readings))
+	for i := range readings {
+		responses[i] = TimedMovementSensorReadingResponse{TimedIMUResponse: &readings[i], TestIsReplaySensor: true}
+	}
+	return responses, nil
+}
+
+// readDatasetRecords reads all records of a JSON lines file.
+func readDatasetRecords(path string) ([]DatasetRecord, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening dataset file %v", path)
+	}
+	defer utils.UncheckedErrorFunc(f.Close)
+
+	var records []DatasetRecord
+	decoder := json.NewDecoder(f)
+	for {
+		var record DatasetRecord
+		if err := decoder.Decode(&record); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "error reading dataset file %v", path)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// readDatasetRecordFile reads the movement sensor readings of a JSON lines file, skipping the records of
+// other sensors. Channels which were dropped are left out, and records without an accepted channel are
+// skipped.
+func readDatasetRecordFile(path string) ([]TimedMovementSensorReadingResponse, error) {
+	records, err := readDatasetRecords(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var responses []TimedMovementSensorReadingResponse
+	for _, record := range records {
+		response := TimedMovementSensorReadingResponse{TestIsReplaySensor: true}
+		if record.IMU != nil && record.IMU.Accepted {
+			imu := record.IMU.TimedIMUReadingResponse()
+			response.TimedIMUResponse = &imu
+		}
+		if record.Odometer != nil && record.Odometer.Accepted {
+			odometer := record.Odometer.TimedOdometerReadingResponse()
+			response.TimedOdometerResponse = &odometer
+		}
+		if response.TimedIMUResponse == nil && response.TimedOdometerResponse == nil {
+			continue
+		}
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+// parseDatasetTime parses an RFC3339 time or a time in unix milliseconds.
+func parseDatasetTime(value string) (time.Time, error) {
+	if unixMilli, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(unixMilli).UTC(), nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
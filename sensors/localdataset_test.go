@@ -0,0 +1,146 @@
+package sensors_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/components/camera/replaypcd"
+	replaymovementsensor "go.viam.com/rdk/components/movementsensor/replay"
+	"go.viam.com/rdk/logging"
+	rdkutils "go.viam.com/rdk/utils"
+	"go.viam.com/test"
+
+	s "github.com/viamrobotics/viam-cartographer/sensors"
+)
+
+func writeDatasetFile(t *testing.T, dir, name, contents string) {
+	t.Helper()
+	test.That(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o600), test.ShouldBeNil)
+}
+
+func TestLocalDatasetLidar(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Failed creation with a directory without timestamped PCDs", func(t *testing.T) {
+		dir := t.TempDir()
+		writeDatasetFile(t, dir, "notes.pcd", "no timestamp")
+		_, err := s.NewLocalDatasetLidar("lidar", dir, logger)
+		test.That(t, err, test.ShouldBeError)
+
+		_, err = s.NewLocalDatasetLidar("lidar", filepath.Join(dir, "missing"), logger)
+		test.That(t, err, test.ShouldBeError)
+	})
+
+	t.Run("Returns the readings in time order until the end of the dataset", func(t *testing.T) {
+		dir := t.TempDir()
+		second := start.Add(100 * time.Millisecond)
+		writeDatasetFile(t, dir, "lidar_data_"+second.Format(s.DatasetTimeFormat)+".pcd", "second")
+		writeDatasetFile(t, dir, "lidar_data_"+start.Format(s.DatasetTimeFormat)+".pcd", "first")
+		writeDatasetFile(t, dir, "imu.csv", "not a pcd")
+
+		lidar, err := s.NewLocalDatasetLidar("lidar", dir, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, lidar.Name(), test.ShouldEqual, "lidar")
+		test.That(t, lidar.DataFrequencyHz(), test.ShouldEqual, 0)
+
+		reading, err := lidar.TimedLidarReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, string(reading.Reading), test.ShouldEqual, "first")
+		test.That(t, reading.ReadingTime, test.ShouldEqual, start)
+		test.That(t, reading.TestIsReplaySensor, test.ShouldBeTrue)
+
+		reading, err = lidar.TimedLidarReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, string(reading.Reading), test.ShouldEqual, "second")
+		test.That(t, reading.ReadingTime, test.ShouldEqual, second)
+
+		_, err = lidar.TimedLidarReading(ctx)
+		test.That(t, errors.Is(err, replaypcd.ErrEndOfDataset), test.ShouldBeTrue)
+	})
+
+	t.Run("Replays the accepted lidar records in their recorded format", func(t *testing.T) {
+		dir := t.TempDir()
+		second := start.Add(100 * time.Millisecond)
+		writeDatasetFile(t, dir, "lidar_data_1.pcd", "dropped")
+		writeDatasetFile(t, dir, "lidar_data_2.polar", "ranges")
+		writeDatasetFile(t, dir, "recording.jsonl",
+			`{"sensor":"lidar","lidar":{"time":"`+start.Format(time.RFC3339Nano)+`","file":"lidar_data_1.pcd",`+
+				`"format":"pcd","accepted":false,"error":"dropped"}}`+"\n"+
+				`{"sensor":"lidar","lidar":{"time":"`+second.Format(time.RFC3339Nano)+`","file":"lidar_data_2.polar",`+
+				`"format":"polar","angle_min":-1.5,"angle_increment":0.25,"accepted":true}}`+"\n")
+
+		lidar, err := s.NewLocalDatasetLidar("lidar", dir, logger)
+		test.That(t, err, test.ShouldBeNil)
+		reading, err := lidar.TimedLidarReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, string(reading.Reading), test.ShouldEqual, "ranges")
+		test.That(t, reading.ReadingTime, test.ShouldEqual, second)
+		test.That(t, reading.Format, test.ShouldEqual, s.LidarReadingFormatPolar)
+		test.That(t, reading.AngleMin, test.ShouldEqual, float32(-1.5))
+		test.That(t, reading.AngleIncrement, test.ShouldEqual, float32(0.25))
+
+		_, err = lidar.TimedLidarReading(ctx)
+		test.That(t, errors.Is(err, replaypcd.ErrEndOfDataset), test.ShouldBeTrue)
+	})
+}
+
+func TestLocalDatasetMovementSensor(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Failed creation with a directory without CSVs", func(t *testing.T) {
+		_, err := s.NewLocalDatasetMovementSensor("imu", t.TempDir())
+		test.That(t, err, test.ShouldBeError)
+	})
+
+	t.Run("Returns the readings of all files in time order until the end of the dataset", func(t *testing.T) {
+		dir := t.TempDir()
+		writeDatasetFile(t, dir, "imu_1.csv",
+			"time,lin_acc_x,lin_acc_y,lin_acc_z,ang_vel_x,ang_vel_y,ang_vel_z\n"+
+				"2024-05-01T12:00:00.2Z,4,5,6,0,0,90\n"+
+				"2024-05-01T12:00:00.1Z,1,2,3,180,0,0\n")
+		writeDatasetFile(t, dir, "imu_2.csv",
+			"ang_vel_z,ang_vel_y,ang_vel_x,lin_acc_z,lin_acc_y,lin_acc_x,time\n"+
+				"0,0,0,9,8,7,1714564800300\n")
+
+		ms, err := s.NewLocalDatasetMovementSensor("imu", dir)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, ms.Name(), test.ShouldEqual, "imu")
+		test.That(t, ms.Properties(), test.ShouldResemble, s.MovementSensorProperties{IMUSupported: true})
+
+		reading, err := ms.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading.TimedOdometerResponse, test.ShouldBeNil)
+		test.That(t, reading.TimedIMUResponse.LinearAcceleration, test.ShouldResemble, r3.Vector{X: 1, Y: 2, Z: 3})
+		test.That(t, reading.TimedIMUResponse.AngularVelocity.X, test.ShouldEqual, rdkutils.DegToRad(180))
+		test.That(t, reading.TimedIMUResponse.ReadingTime, test.ShouldEqual, time.Date(2024, 5, 1, 12, 0, 0, 1e8, time.UTC))
+
+		reading, err = ms.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading.TimedIMUResponse.LinearAcceleration, test.ShouldResemble, r3.Vector{X: 4, Y: 5, Z: 6})
+
+		reading, err = ms.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading.TimedIMUResponse.LinearAcceleration, test.ShouldResemble, r3.Vector{X: 7, Y: 8, Z: 9})
+		test.That(t, reading.TimedIMUResponse.ReadingTime, test.ShouldEqual, time.Date(2024, 5, 1, 12, 0, 0, 3e8, time.UTC))
+
+		_, err = ms.TimedMovementSensorReading(ctx)
+		test.That(t, errors.Is(err, replaymovementsensor.ErrEndOfDataset), test.ShouldBeTrue)
+	})
+
+	t.Run("Returns an error for a CSV with a missing column", func(t *testing.T) {
+		dir := t.TempDir()
+		writeDatasetFile(t, dir, "imu.csv", "time,lin_acc_x\n2024-05-01T12:00:00.2Z,4\n")
+		ms, err := s.NewLocalDatasetMovementSensor("imu", dir)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = ms.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "missing column \"lin_acc_y\"")
+	})
+}
@@ -3,6 +3,8 @@ package sensors
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/geo/r3"
@@ -18,13 +20,13 @@ import (
 )
 
 const (
-	movementSensorReadingTimeToleranceMsec = 50 // Milliseconds
-	replayTimestampErrorMessage            = "replay sensor timestamp parse RFC3339Nano error"
-	timedMovementSensorReadingTimeout      = 5 * time.Second
+	// DefaultMovementSensorReadingTimeTolerance is the default maximum time between the readings of two
+	// channels of a movement sensor for them to be considered simultaneous.
+	DefaultMovementSensorReadingTimeTolerance = 50 * time.Millisecond
+	replayTimestampErrorMessage               = "replay sensor timestamp parse RFC3339Nano error"
 )
 
 var (
-	undefinedTime = time.Time{}
 	// ErrMovementSensorNeitherIMUNorOdometer denotes that the provided movement sensor does neither support
 	// an IMU nor a movement sensor.
 	ErrMovementSensorNeitherIMUNorOdometer = errors.New("'movement_sensor' must either support both LinearAcceleration and " +
@@ -37,7 +39,7 @@ var (
 // from a replay sensor.
 type TimedMovementSensor interface {
 	Name() string
-	DataFrequencyHz() int
+	DataFrequencyHz() float64
 	TimedMovementSensorReading(ctx context.Context) (TimedMovementSensorReadingResponse, error)
 	Properties() MovementSensorProperties
 }
@@ -72,12 +74,24 @@ type TimedOdometerReadingResponse struct {
 
 // MovementSensor represents a movement sensor.
 type MovementSensor struct {
-	name               string
-	dataFrequencyHz    int
-	imuSupported       bool
-	odometerSupported  bool
-	sensor             movementsensor.MovementSensor
-	testIsReplaySensor bool
+	name                 string
+	dataFrequencyHz      float64
+	imuSupported         bool
+	odometerSupported    bool
+	sensor               movementsensor.MovementSensor
+	testIsReplaySensor   atomic.Bool
+	readingTimeTolerance time.Duration
+
+	// imu pairs the LinearAcceleration and AngularVelocity channels, odometer the Position and
+	// Orientation channels. They are nil if the IMU or odometer is not supported.
+	imu               *channelPair
+	odometer          *channelPair
+	imuSampleCounters imuSampleCounters
+
+	samplingMu sync.Mutex
+	// polled is closed and replaced after every poll of a sampler. It is nil until the samplers are started.
+	polled       chan struct{}
+	samplePeriod time.Duration
 }
 
 // Name returns the name of the movement sensor.
@@ -85,193 +99,194 @@ func (ms *MovementSensor) Name() string {
 	return ms.name
 }
 
-// DataFrequencyHz returns the data rate in ms of the movement sensor.
-func (ms *MovementSensor) DataFrequencyHz() int {
+// DataFrequencyHz returns the data rate in Hz of the movement sensor.
+func (ms *MovementSensor) DataFrequencyHz() float64 {
 	return ms.dataFrequencyHz
 }
 
+// Start polls every channel of the movement sensor in its own goroutine at sampleFrequencyHz until the
+// context is done. Readings are then synchronized from the buffered samples of the channels, at the rate
+// they are requested, instead of polling the channels on every reading. A sampleFrequencyHz of zero, as
+// in offline mode, keeps polling the channels on every reading.
+func (ms *MovementSensor) Start(ctx context.Context, sampleFrequencyHz float64, activeBackgroundWorkers *sync.WaitGroup) {
+	if sampleFrequencyHz <= 0 {
+		return
+	}
+	period := time.Duration(float64(time.Second) / sampleFrequencyHz)
+
+	ms.samplingMu.Lock()
+	ms.polled = make(chan struct{})
+	ms.samplePeriod = period
+	ms.samplingMu.Unlock()
+
+	for _, pair := range []*channelPair{ms.imu, ms.odometer} {
+		if pair == nil {
+			continue
+		}
+		for _, sampler := range []*channelSampler{pair.first, pair.second} {
+			activeBackgroundWorkers.Add(1)
+			go func(sampler *channelSampler) {
+				defer activeBackgroundWorkers.Done()
+				sampler.run(ctx, period, ms.notifyPolled)
+			}(sampler)
+		}
+	}
+}
+
+// notifyPolled wakes up a reading waiting for new samples.
+func (ms *MovementSensor) notifyPolled() {
+	ms.samplingMu.Lock()
+	defer ms.samplingMu.Unlock()
+	close(ms.polled)
+	ms.polled = make(chan struct{})
+}
+
+// sampling returns the channel closed after the next poll of a sampler, nil if the samplers are not started.
+func (ms *MovementSensor) sampling() (chan struct{}, time.Duration) {
+	ms.samplingMu.Lock()
+	defer ms.samplingMu.Unlock()
+	return ms.polled, ms.samplePeriod
+}
+
 // TimedMovementSensorReading returns data from the movement sensor and the time the reading is from & whether
-// it was a replay sensor or not.
+// it was a replay sensor or not. The channels of the IMU and of the odometer are each synchronized to a
+// common reading time, interpolating one channel between its samples if needed. It must not be called
+// concurrently.
 func (ms *MovementSensor) TimedMovementSensorReading(ctx context.Context) (TimedMovementSensorReadingResponse, error) {
 	var (
-		readingTimeAngularVel, readingTimeLinearAcc time.Time
-		readingTimePosition, readingTimeOrientation time.Time
-		angVel                                      spatialmath.AngularVelocity
-		linAcc                                      r3.Vector
-		position                                    *geo.Point
-		orientation                                 spatialmath.Orientation
-		timedIMUReadingResponse                     *TimedIMUReadingResponse
-		timedOdometerReadingResponse                *TimedOdometerReadingResponse
-		err                                         error
+		timedIMUReadingResponse      *TimedIMUReadingResponse
+		timedOdometerReadingResponse *TimedOdometerReadingResponse
 	)
 
-	timeoutCtx, cancel := context.WithTimeout(ctx, timedMovementSensorReadingTimeout)
-	defer cancel()
 	if ms.odometerSupported {
-	odometerLoop:
-		for {
-			select {
-			case <-timeoutCtx.Done():
-				return TimedMovementSensorReadingResponse{}, errors.Wrap(timeoutCtx.Err(), "timed out getting odometer data")
-			default:
-				if timedOdometerReadingResponse, err = ms.timedOdometerReading(timeoutCtx, position, &orientation,
-					&readingTimePosition, &readingTimeOrientation); err != nil && !errors.Is(err, ErrNoValidReadingObtained) {
-					return TimedMovementSensorReadingResponse{}, err
-				}
-				if timedOdometerReadingResponse != nil {
-					break odometerLoop
-				}
-			}
+		position, orientation, _, err := ms.synchronizedSamples(ctx, ms.odometer)
+		if err != nil {
+			return TimedMovementSensorReadingResponse{}, err
+		}
+		timedOdometerReadingResponse = &TimedOdometerReadingResponse{
+			Position:    geo.NewPoint(position.vector.X, position.vector.Y),
+			Orientation: orientation.orientation,
+			ReadingTime: position.readingTime,
 		}
 	}
+
 	if ms.imuSupported {
-	imuLoop:
-		for {
-			select {
-			case <-timeoutCtx.Done():
-				return TimedMovementSensorReadingResponse{}, errors.Wrap(timeoutCtx.Err(), "timed out getting IMU data")
-			default:
-				if timedIMUReadingResponse, err = ms.timedIMUReading(timeoutCtx, &angVel, &linAcc,
-					&readingTimeAngularVel, &readingTimeLinearAcc); err != nil && !errors.Is(err, ErrNoValidReadingObtained) {
-					return TimedMovementSensorReadingResponse{}, err
-				}
-				if timedIMUReadingResponse != nil {
-					break imuLoop
-				}
-			}
+		linAcc, angVel, interpolated, err := ms.synchronizedSamples(ctx, ms.imu)
+		if err != nil {
+			return TimedMovementSensorReadingResponse{}, err
+		}
+		ms.imuSampleCounters.emitted.Add(1)
+		if interpolated {
+			ms.imuSampleCounters.interpolated.Add(1)
 		}
+		timedIMUReadingResponse = &TimedIMUReadingResponse{
+			LinearAcceleration: linAcc.vector,
+			AngularVelocity: spatialmath.AngularVelocity{
+				X: rdkutils.DegToRad(angVel.vector.X),
+				Y: rdkutils.DegToRad(angVel.vector.Y),
+				Z: rdkutils.DegToRad(angVel.vector.Z),
+			},
+			ReadingTime: linAcc.readingTime,
+		}
+		ms.imu.markSynchronized(linAcc.readingTime)
+	}
+
+	if timedOdometerReadingResponse != nil {
+		ms.odometer.markSynchronized(timedOdometerReadingResponse.ReadingTime)
 	}
 	return TimedMovementSensorReadingResponse{
 		TimedIMUResponse:      timedIMUReadingResponse,
 		TimedOdometerResponse: timedOdometerReadingResponse,
-		TestIsReplaySensor:    ms.testIsReplaySensor,
+		TestIsReplaySensor:    ms.testIsReplaySensor.Load(),
 	}, nil
 }
 
-func (ms *MovementSensor) timedIMUReading(ctx context.Context, angVel *spatialmath.AngularVelocity, linAcc *r3.Vector,
-	readingTimeAngularVel, readingTimeLinearAcc *time.Time,
-) (*TimedIMUReadingResponse, error) {
-	var err error
-
-	returnReadingIfTimestampsWithinTolerance := func(readingTimeAngularVel, readingTimeLinearAcc time.Time,
-		angVel *spatialmath.AngularVelocity, linAcc *r3.Vector,
-	) (TimedIMUReadingResponse, bool) {
-		if readingTimeAngularVel.Sub(readingTimeLinearAcc).Abs().Milliseconds() < movementSensorReadingTimeToleranceMsec {
-			return TimedIMUReadingResponse{
-				LinearAcceleration: *linAcc,
-				AngularVelocity: spatialmath.AngularVelocity{
-					X: rdkutils.DegToRad(angVel.X),
-					Y: rdkutils.DegToRad(angVel.Y),
-					Z: rdkutils.DegToRad(angVel.Z),
-				},
-				ReadingTime: averageReadingTimes(readingTimeLinearAcc, readingTimeAngularVel),
-			}, true
-		}
-		return TimedIMUReadingResponse{}, false
+/*
+synchronizedSamples returns the samples of a pair of channels at their next common reading time.
+
+Once the samplers are started, the latest buffered samples are synchronized, waiting at most two sampling
+periods for new samples. Otherwise both channels are polled, and then the lagging channel until the pair
+can be synchronized within the reading time tolerance. Every poll advances the reading time of the lagging
+channel, so this does not skip samples of a replayed dataset.
+*/
+func (ms *MovementSensor) synchronizedSamples(ctx context.Context, pair *channelPair) (timedVector, timedVector, bool, error) {
+	if polled, period := ms.sampling(); polled != nil {
+		return ms.bufferedSamples(ctx, pair, polled, 2*period)
 	}
 
-	if *readingTimeLinearAcc == undefinedTime || readingTimeLinearAcc.Sub(*readingTimeAngularVel).Milliseconds() < 0 {
-		ctxWithMetadata, md := contextutils.ContextWithMetadata(ctx)
-		if *linAcc, err = ms.sensor.LinearAcceleration(ctxWithMetadata, make(map[string]interface{})); err != nil {
-			return &TimedIMUReadingResponse{}, errors.Wrap(err, "could not obtain LinearAcceleration")
-		}
-
-		if timeRequestedMetadata, ok := md[contextutils.TimeRequestedMetadataKey]; ok {
-			ms.testIsReplaySensor = true
-			if *readingTimeLinearAcc, err = time.Parse(time.RFC3339Nano, timeRequestedMetadata[0]); err != nil {
-				return &TimedIMUReadingResponse{}, errors.Wrap(err, replayTimestampErrorMessage)
-			}
-		} else {
-			*readingTimeLinearAcc = time.Now().UTC()
-		}
+	if err := pair.first.poll(ctx); err != nil {
+		return timedVector{}, timedVector{}, false, err
 	}
-
-	if response, ok := returnReadingIfTimestampsWithinTolerance(*readingTimeAngularVel, *readingTimeLinearAcc, angVel, linAcc); ok {
-		return &response, nil
+	if err := pair.second.poll(ctx); err != nil {
+		return timedVector{}, timedVector{}, false, err
 	}
-
-	if *readingTimeAngularVel == undefinedTime || readingTimeAngularVel.Sub(*readingTimeLinearAcc).Milliseconds() < 0 {
-		ctxWithMetadata, md := contextutils.ContextWithMetadata(ctx)
-		if *angVel, err = ms.sensor.AngularVelocity(ctxWithMetadata, make(map[string]interface{})); err != nil {
-			return &TimedIMUReadingResponse{}, errors.Wrap(err, "could not obtain AngularVelocity")
+	for {
+		first, second, interpolated, err := pair.synchronize(ms.readingTimeTolerance, false)
+		if !errors.Is(err, ErrNoValidReadingObtained) {
+			return first, second, interpolated, err
 		}
-
-		if timeRequestedMetadata, ok := md[contextutils.TimeRequestedMetadataKey]; ok {
-			ms.testIsReplaySensor = true
-			if *readingTimeAngularVel, err = time.Parse(time.RFC3339Nano, timeRequestedMetadata[0]); err != nil {
-				return &TimedIMUReadingResponse{}, errors.Wrap(err, replayTimestampErrorMessage)
-			}
-		} else {
-			*readingTimeAngularVel = time.Now().UTC()
+		ms.recordDropped(pair)
+		if err := pair.lagging().poll(ctx); err != nil {
+			return timedVector{}, timedVector{}, false, err
 		}
 	}
-
-	if response, ok := returnReadingIfTimestampsWithinTolerance(*readingTimeAngularVel, *readingTimeLinearAcc, angVel, linAcc); ok {
-		return &response, nil
-	}
-
-	return nil, ErrNoValidReadingObtained
 }
 
-func (ms *MovementSensor) timedOdometerReading(ctx context.Context, position *geo.Point, orientation *spatialmath.Orientation,
-	readingTimePosition, readingTimeOrientation *time.Time,
-) (*TimedOdometerReadingResponse, error) {
-	var err error
-
-	returnReadingIfTimestampsWithinTolerance := func(readingTimePosition, readingTimeOrientation time.Time,
-		position *geo.Point, orientation *spatialmath.Orientation,
-	) (TimedOdometerReadingResponse, bool) {
-		if readingTimeOrientation.Sub(readingTimePosition).Abs().Milliseconds() < movementSensorReadingTimeToleranceMsec {
-			return TimedOdometerReadingResponse{
-				Position:    position,
-				Orientation: *orientation,
-				ReadingTime: averageReadingTimes(readingTimePosition, readingTimeOrientation),
-			}, true
+// bufferedSamples synchronizes the buffered samples of a pair of channels polled by the samplers. It returns
+// ErrNoValidReadingObtained if the channels are not sampled again within the timeout.
+func (ms *MovementSensor) bufferedSamples(ctx context.Context, pair *channelPair, polled chan struct{}, timeout time.Duration,
+) (timedVector, timedVector, bool, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		first, second, interpolated, err := pair.synchronize(ms.readingTimeTolerance, true)
+		if errors.Is(err, ErrNoValidReadingObtained) {
+			ms.recordDropped(pair)
 		}
-		return TimedOdometerReadingResponse{}, false
-	}
-
-	if *readingTimePosition == undefinedTime || readingTimePosition.Sub(*readingTimeOrientation).Milliseconds() < 0 {
-		ctxWithMetadata, md := contextutils.ContextWithMetadata(ctx)
-		if position, _, err = ms.sensor.Position(ctxWithMetadata, make(map[string]interface{})); err != nil {
-			return &TimedOdometerReadingResponse{}, errors.Wrap(err, "could not obtain Position")
+		if !errors.Is(err, errNoNewSample) {
+			return first, second, interpolated, err
 		}
 
-		if timeRequestedMetadata, ok := md[contextutils.TimeRequestedMetadataKey]; ok {
-			ms.testIsReplaySensor = true
-			if *readingTimePosition, err = time.Parse(time.RFC3339Nano, timeRequestedMetadata[0]); err != nil {
-				return &TimedOdometerReadingResponse{}, errors.Wrap(err, replayTimestampErrorMessage)
-			}
-		} else {
-			*readingTimePosition = time.Now().UTC()
+		select {
+		case <-ctx.Done():
+			return timedVector{}, timedVector{}, false, ctx.Err()
+		case <-timer.C:
+			return timedVector{}, timedVector{}, false, errors.Wrap(ErrNoValidReadingObtained, errNoNewSample.Error())
+		case <-polled:
+			polled, _ = ms.sampling()
 		}
 	}
+}
 
-	if response, ok := returnReadingIfTimestampsWithinTolerance(*readingTimePosition, *readingTimeOrientation, position, orientation); ok {
-		return &response, nil
+func (ms *MovementSensor) recordDropped(pair *channelPair) {
+	if pair == ms.imu {
+		ms.imuSampleCounters.dropped.Add(1)
 	}
+}
 
-	if *readingTimeOrientation == undefinedTime || readingTimeOrientation.Sub(*readingTimePosition).Milliseconds() < 0 {
+// timedRead returns a function which reads a channel and returns the sample with the time it is from.
+func (ms *MovementSensor) timedRead(read func(ctx context.Context) (timedVector, error)) func(ctx context.Context) (timedVector, error) {
+	return func(ctx context.Context) (timedVector, error) {
 		ctxWithMetadata, md := contextutils.ContextWithMetadata(ctx)
-		if *orientation, err = ms.sensor.Orientation(ctxWithMetadata, make(map[string]interface{})); err != nil {
-			return &TimedOdometerReadingResponse{}, errors.Wrap(err, "could not obtain Orientation")
+		sample, err := read(ctxWithMetadata)
+		if err != nil {
+			return timedVector{}, err
 		}
 
+		sample.readingTime = time.Now().UTC()
 		if timeRequestedMetadata, ok := md[contextutils.TimeRequestedMetadataKey]; ok {
-			ms.testIsReplaySensor = true
-			if *readingTimeOrientation, err = time.Parse(time.RFC3339Nano, timeRequestedMetadata[0]); err != nil {
-				return &TimedOdometerReadingResponse{}, errors.Wrap(err, replayTimestampErrorMessage)
+			ms.testIsReplaySensor.Store(true)
+			if sample.readingTime, err = time.Parse(time.RFC3339Nano, timeRequestedMetadata[0]); err != nil {
+				return timedVector{}, errors.Wrap(err, replayTimestampErrorMessage)
 			}
-		} else {
-			*readingTimeOrientation = time.Now().UTC()
 		}
+		return sample, nil
 	}
+}
 
-	if response, ok := returnReadingIfTimestampsWithinTolerance(*readingTimePosition, *readingTimeOrientation, position, orientation); ok {
-		return &response, nil
-	}
-
-	return nil, ErrNoValidReadingObtained
+// IMUSampleStats returns how many synchronized IMU samples have been emitted, interpolated and dropped.
+func (ms *MovementSensor) IMUSampleStats() IMUSampleStats {
+	return ms.imuSampleCounters.stats()
 }
 
 // Properties returns MovementSensorProperties, which holds information about whether or not an IMU
@@ -283,12 +298,16 @@ func (ms *MovementSensor) Properties() MovementSensorProperties {
 	}
 }
 
-// NewMovementSensor returns a new movement sensor.
+// NewMovementSensor returns a new movement sensor. If genericSensorConfig is not nil, the movement sensor
+// is read from a generic sensor component instead of a movement sensor component. A zero
+// readingTimeTolerance selects DefaultMovementSensorReadingTimeTolerance.
 func NewMovementSensor(
 	ctx context.Context,
 	deps resource.Dependencies,
 	movementSensorName string,
-	dataFrequencyHz int,
+	dataFrequencyHz float64,
+	readingTimeTolerance time.Duration,
+	genericSensorConfig *GenericSensorConfig,
 	logger logging.Logger,
 ) (TimedMovementSensor, error) {
 	_, span := trace.StartSpan(ctx, "viamcartographer::sensors::NewMovementSensor")
@@ -296,6 +315,11 @@ func NewMovementSensor(
 	if movementSensorName == "" {
 		return &MovementSensor{}, nil
 	}
+	// A generic sensor config means the movement sensor is a generic sensor component that reports
+	// IMU and/or odometer data through its Readings.
+	if genericSensorConfig != nil {
+		return newGenericMovementSensor(ctx, deps, movementSensorName, dataFrequencyHz, *genericSensorConfig)
+	}
 	movementSensor, err := movementsensor.FromDependencies(deps, movementSensorName)
 	if err != nil {
 		return &MovementSensor{}, errors.Wrapf(err, "error getting movement sensor \"%v\" for slam service", movementSensorName)
@@ -314,22 +338,47 @@ func NewMovementSensor(
 		return &MovementSensor{}, ErrMovementSensorNeitherIMUNorOdometer
 	}
 
-	return &MovementSensor{
-		name:              movementSensorName,
-		dataFrequencyHz:   dataFrequencyHz,
-		imuSupported:      imuSupported,
-		odometerSupported: odometerSupported,
-		sensor:            movementSensor,
-	}, nil
-}
+	if readingTimeTolerance == 0 {
+		readingTimeTolerance = DefaultMovementSensorReadingTimeTolerance
+	}
 
-func averageReadingTimes(a, b time.Time) time.Time {
-	switch {
-	case b.Equal(a):
-		return a
-	case b.After(a):
-		return a.Add(b.Sub(a) / 2)
-	default:
-		return b.Add(a.Sub(b) / 2)
+	ms := &MovementSensor{
+		name:                 movementSensorName,
+		dataFrequencyHz:      dataFrequencyHz,
+		imuSupported:         imuSupported,
+		odometerSupported:    odometerSupported,
+		sensor:               movementSensor,
+		readingTimeTolerance: readingTimeTolerance,
+	}
+	if imuSupported {
+		ms.imu = &channelPair{
+			first: newChannelSampler("LinearAcceleration", ms.timedRead(func(ctx context.Context) (timedVector, error) {
+				linAcc, err := movementSensor.LinearAcceleration(ctx, make(map[string]interface{}))
+				return timedVector{vector: linAcc}, err
+			})),
+			second: newChannelSampler("AngularVelocity", ms.timedRead(func(ctx context.Context) (timedVector, error) {
+				angVel, err := movementSensor.AngularVelocity(ctx, make(map[string]interface{}))
+				return timedVector{vector: r3.Vector{X: angVel.X, Y: angVel.Y, Z: angVel.Z}}, err
+			})),
+		}
+	}
+	if odometerSupported {
+		ms.odometer = &channelPair{
+			first: newChannelSampler("Position", ms.timedRead(func(ctx context.Context) (timedVector, error) {
+				position, _, err := movementSensor.Position(ctx, make(map[string]interface{}))
+				if err != nil {
+					return timedVector{}, err
+				}
+				if position == nil {
+					return timedVector{}, errors.New("position is nil")
+				}
+				return timedVector{vector: r3.Vector{X: position.Lat(), Y: position.Lng()}}, nil
+			})),
+			second: newChannelSampler("Orientation", ms.timedRead(func(ctx context.Context) (timedVector, error) {
+				orientation, err := movementSensor.Orientation(ctx, make(map[string]interface{}))
+				return timedVector{orientation: orientation}, err
+			})),
+		}
 	}
+	return ms, nil
 }
@@ -1,28 +1,148 @@
 package sensors
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/spatialmath"
 	"go.viam.com/test"
 )
 
-func TestAverageReadingTimes(t *testing.T) {
-	t.Run("a equals b", func(t *testing.T) {
-		a := time.Now()
-		b := a
-		test.That(t, a, test.ShouldEqual, averageReadingTimes(a, b))
+func TestChannelBufferSampleAt(t *testing.T) {
+	start := time.Now()
+	tolerance := 50 * time.Millisecond
+
+	t.Run("empty buffer", func(t *testing.T) {
+		var b channelBuffer
+		_, _, ok := b.sampleAt(start, tolerance)
+		test.That(t, ok, test.ShouldBeFalse)
+	})
+
+	t.Run("exact sample", func(t *testing.T) {
+		var b channelBuffer
+		b.add(timedVector{readingTime: start, vector: r3.Vector{X: 1}})
+		b.add(timedVector{readingTime: start.Add(100 * time.Millisecond), vector: r3.Vector{X: 2}})
+		sample, interpolated, ok := b.sampleAt(start, tolerance)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, interpolated, test.ShouldBeFalse)
+		test.That(t, sample.vector, test.ShouldResemble, r3.Vector{X: 1})
+	})
+
+	t.Run("interpolates between the bracketing samples", func(t *testing.T) {
+		var b channelBuffer
+		b.add(timedVector{readingTime: start, vector: r3.Vector{X: 1, Y: -2}})
+		b.add(timedVector{readingTime: start.Add(200 * time.Millisecond), vector: r3.Vector{X: 3, Y: 2}})
+		sample, interpolated, ok := b.sampleAt(start.Add(50*time.Millisecond), tolerance)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, interpolated, test.ShouldBeTrue)
+		test.That(t, sample.vector, test.ShouldResemble, r3.Vector{X: 1.5, Y: -1})
+	})
+
+	t.Run("uses the nearest sample within the tolerance when the time is not bracketed", func(t *testing.T) {
+		var b channelBuffer
+		b.add(timedVector{readingTime: start, vector: r3.Vector{X: 1}})
+		sample, interpolated, ok := b.sampleAt(start.Add(-20*time.Millisecond), tolerance)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, interpolated, test.ShouldBeFalse)
+		test.That(t, sample.vector, test.ShouldResemble, r3.Vector{X: 1})
+
+		sample, _, ok = b.sampleAt(start.Add(20*time.Millisecond), tolerance)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, sample.vector, test.ShouldResemble, r3.Vector{X: 1})
+	})
+
+	t.Run("fails when the nearest sample is outside of the tolerance", func(t *testing.T) {
+		var b channelBuffer
+		b.add(timedVector{readingTime: start, vector: r3.Vector{X: 1}})
+		_, _, ok := b.sampleAt(start.Add(-60*time.Millisecond), tolerance)
+		test.That(t, ok, test.ShouldBeFalse)
+		_, _, ok = b.sampleAt(start.Add(60*time.Millisecond), tolerance)
+		test.That(t, ok, test.ShouldBeFalse)
+	})
+
+	t.Run("keeps only the most recent samples", func(t *testing.T) {
+		var b channelBuffer
+		for i := 0; i < 2*channelBufferSize; i++ {
+			b.add(timedVector{readingTime: start.Add(time.Duration(i) * time.Millisecond), vector: r3.Vector{X: float64(i)}})
+		}
+		test.That(t, len(b.samples), test.ShouldEqual, channelBufferSize)
+		test.That(t, b.samples[channelBufferSize-1].vector, test.ShouldResemble, r3.Vector{X: float64(2*channelBufferSize - 1)})
 	})
 
-	t.Run("b 10 msec larger than a", func(t *testing.T) {
-		a := time.Now()
-		b := a.Add(10 * time.Millisecond)
-		test.That(t, averageReadingTimes(a, b), test.ShouldEqual, a.Add(5*time.Millisecond))
+	t.Run("interpolates orientations", func(t *testing.T) {
+		var b channelBuffer
+		b.add(timedVector{readingTime: start, orientation: &spatialmath.EulerAngles{Yaw: 0}})
+		b.add(timedVector{readingTime: start.Add(200 * time.Millisecond), orientation: &spatialmath.EulerAngles{Yaw: 1}})
+		sample, interpolated, ok := b.sampleAt(start.Add(50*time.Millisecond), tolerance)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, interpolated, test.ShouldBeTrue)
+		test.That(t, sample.orientation.EulerAngles().Yaw, test.ShouldAlmostEqual, 0.25)
+	})
+}
+
+// testSampler returns a channelSampler whose polls return the given samples in order.
+func testSampler(channel string, samples ...timedVector) *channelSampler {
+	return newChannelSampler(channel, func(ctx context.Context) (timedVector, error) {
+		if len(samples) == 0 {
+			return timedVector{}, errors.New("no more samples")
+		}
+		sample := samples[0]
+		samples = samples[1:]
+		return sample, nil
+	})
+}
+
+func TestChannelPairSynchronize(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now()
+	tolerance := 50 * time.Millisecond
+	at := func(msec int, x float64) timedVector {
+		return timedVector{readingTime: start.Add(time.Duration(msec) * time.Millisecond), vector: r3.Vector{X: x}}
+	}
+
+	t.Run("synchronizes at the older of the most recent samples", func(t *testing.T) {
+		pair := &channelPair{first: testSampler("first", at(0, 0), at(100, 10)), second: testSampler("second", at(60, 5))}
+		test.That(t, pair.first.poll(ctx), test.ShouldBeNil)
+		test.That(t, pair.second.poll(ctx), test.ShouldBeNil)
+		test.That(t, pair.lagging(), test.ShouldEqual, pair.first)
+		_, _, _, err := pair.synchronize(tolerance, true)
+		test.That(t, err, test.ShouldBeError, ErrNoValidReadingObtained)
+
+		test.That(t, pair.first.poll(ctx), test.ShouldBeNil)
+		first, second, interpolated, err := pair.synchronize(tolerance, true)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, interpolated, test.ShouldBeTrue)
+		test.That(t, first.readingTime, test.ShouldEqual, start.Add(60*time.Millisecond))
+		test.That(t, first.vector.X, test.ShouldAlmostEqual, 6)
+		test.That(t, second.readingTime, test.ShouldEqual, start.Add(60*time.Millisecond))
+		test.That(t, second.vector.X, test.ShouldEqual, 5)
+	})
+
+	t.Run("requires new samples after the last synchronized sample", func(t *testing.T) {
+		pair := &channelPair{first: testSampler("first", at(0, 0)), second: testSampler("second", at(10, 1))}
+		_, _, _, err := pair.synchronize(tolerance, true)
+		test.That(t, err, test.ShouldBeError, errNoNewSample)
+
+		test.That(t, pair.first.poll(ctx), test.ShouldBeNil)
+		test.That(t, pair.second.poll(ctx), test.ShouldBeNil)
+		first, _, _, err := pair.synchronize(tolerance, true)
+		test.That(t, err, test.ShouldBeNil)
+		pair.markSynchronized(first.readingTime)
+
+		_, _, _, err = pair.synchronize(tolerance, true)
+		test.That(t, err, test.ShouldBeError, errNoNewSample)
+		_, _, _, err = pair.synchronize(tolerance, false)
+		test.That(t, err, test.ShouldBeNil)
 	})
 
-	t.Run("a 66 msec larger than b", func(t *testing.T) {
-		b := time.Now()
-		a := b.Add(66 * time.Millisecond)
-		test.That(t, averageReadingTimes(a, b), test.ShouldEqual, b.Add(33*time.Millisecond))
+	t.Run("returns the error of the latest poll of a channel", func(t *testing.T) {
+		pair := &channelPair{first: testSampler("first", at(0, 0)), second: testSampler("second")}
+		test.That(t, pair.first.poll(ctx), test.ShouldBeNil)
+		test.That(t, pair.second.poll(ctx), test.ShouldNotBeNil)
+		_, _, _, err := pair.synchronize(tolerance, true)
+		test.That(t, err, test.ShouldBeError, "could not obtain second: no more samples")
 	})
 }
@@ -4,6 +4,7 @@ package sensors_test
 import (
 	"context"
 	"errors"
+	"sync"
 	"testing"
 	"time"
 
@@ -25,7 +26,7 @@ func TestNewMovementSensor(t *testing.T) {
 	t.Run("No movement sensor provided", func(t *testing.T) {
 		lidar, movementSensor := s.GoodLidar, s.NoMovementSensor
 		deps := s.SetupDeps(lidar, movementSensor)
-		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(movementSensor), testDataFrequencyHz, logger)
+		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(movementSensor), testDataFrequencyHz, 0, nil, logger)
 		test.That(t, err, test.ShouldBeNil)
 		test.That(t, actualMs, test.ShouldResemble, &s.MovementSensor{})
 	})
@@ -33,7 +34,7 @@ func TestNewMovementSensor(t *testing.T) {
 	t.Run("Failed movement sensor creation with non-existing movement sensor", func(t *testing.T) {
 		lidar, movementSensor := s.GoodLidar, s.GibberishMovementSensor
 		deps := s.SetupDeps(lidar, movementSensor)
-		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(movementSensor), testDataFrequencyHz, logger)
+		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(movementSensor), testDataFrequencyHz, 0, nil, logger)
 		test.That(t, err, test.ShouldBeError,
 			errors.New("error getting movement sensor \""+string(movementSensor)+"\" for slam service: "+
 				"Resource missing from dependencies. Resource: rdk:component:movement_sensor/"+string(movementSensor)))
@@ -43,7 +44,7 @@ func TestNewMovementSensor(t *testing.T) {
 	t.Run("Failed movement creation with sensor that does not support IMU nor odometer", func(t *testing.T) {
 		lidar, movementSensor := s.GoodLidar, s.MovementSensorWithInvalidProperties
 		deps := s.SetupDeps(lidar, movementSensor)
-		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(movementSensor), testDataFrequencyHz, logger)
+		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(movementSensor), testDataFrequencyHz, 0, nil, logger)
 		test.That(t, err, test.ShouldBeError, s.ErrMovementSensorNeitherIMUNorOdometer)
 		test.That(t, actualMs, test.ShouldResemble, &s.MovementSensor{})
 	})
@@ -51,7 +52,7 @@ func TestNewMovementSensor(t *testing.T) {
 	t.Run("Successful movement sensor creation that supports an IMU", func(t *testing.T) {
 		lidar, imu := s.GoodLidar, s.GoodIMU
 		deps := s.SetupDeps(lidar, imu)
-		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(imu), testDataFrequencyHz, logger)
+		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(imu), testDataFrequencyHz, 0, nil, logger)
 		test.That(t, err, test.ShouldBeNil)
 		test.That(t, actualMs.Name(), test.ShouldEqual, string(imu))
 
@@ -70,7 +71,7 @@ func TestNewMovementSensor(t *testing.T) {
 	t.Run("Successful movement sensor creation that supports an odometer", func(t *testing.T) {
 		lidar, odometer := s.GoodLidar, s.GoodOdometer
 		deps := s.SetupDeps(lidar, odometer)
-		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(odometer), testDataFrequencyHz, logger)
+		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(odometer), testDataFrequencyHz, 0, nil, logger)
 		test.That(t, err, test.ShouldBeNil)
 		test.That(t, actualMs.Name(), test.ShouldEqual, string(odometer))
 
@@ -89,7 +90,7 @@ func TestProperties(t *testing.T) {
 	t.Run("only IMU supported", func(t *testing.T) {
 		lidar, imu := s.GoodLidar, s.GoodIMU
 		deps := s.SetupDeps(lidar, imu)
-		actualIMU, err := s.NewMovementSensor(ctx, deps, string(imu), testDataFrequencyHz, logger)
+		actualIMU, err := s.NewMovementSensor(ctx, deps, string(imu), testDataFrequencyHz, 0, nil, logger)
 		test.That(t, err, test.ShouldBeNil)
 		properties := actualIMU.Properties()
 		test.That(t, properties.IMUSupported, test.ShouldBeTrue)
@@ -99,7 +100,7 @@ func TestProperties(t *testing.T) {
 	t.Run("only odometer supported", func(t *testing.T) {
 		lidar, odometer := s.GoodLidar, s.GoodOdometer
 		deps := s.SetupDeps(lidar, odometer)
-		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, logger)
+		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, 0, nil, logger)
 		test.That(t, err, test.ShouldBeNil)
 		properties := actualOdometer.Properties()
 		test.That(t, properties.IMUSupported, test.ShouldBeFalse)
@@ -109,7 +110,7 @@ func TestProperties(t *testing.T) {
 	t.Run("both IMU and odometer supported", func(t *testing.T) {
 		lidar, movementSensor := s.GoodLidar, s.GoodMovementSensorBothIMUAndOdometer
 		deps := s.SetupDeps(lidar, movementSensor)
-		actualMovementSensor, err := s.NewMovementSensor(ctx, deps, string(movementSensor), testDataFrequencyHz, logger)
+		actualMovementSensor, err := s.NewMovementSensor(ctx, deps, string(movementSensor), testDataFrequencyHz, 0, nil, logger)
 		test.That(t, err, test.ShouldBeNil)
 		properties := actualMovementSensor.Properties()
 		test.That(t, properties.IMUSupported, test.ShouldBeTrue)
@@ -124,7 +125,7 @@ func TestTimedMovementSensorReading(t *testing.T) {
 	t.Run("when the movement sensor's IMU functions return an error, timedIMUReading wraps that error", func(t *testing.T) {
 		lidar, imu := s.GoodLidar, s.IMUWithErroringFunctions
 		deps := s.SetupDeps(lidar, imu)
-		actualIMU, err := s.NewMovementSensor(ctx, deps, string(imu), testDataFrequencyHz, logger)
+		actualIMU, err := s.NewMovementSensor(ctx, deps, string(imu), testDataFrequencyHz, 0, nil, logger)
 		test.That(t, err, test.ShouldBeNil)
 
 		actualReading, err := actualIMU.TimedMovementSensorReading(ctx)
@@ -136,7 +137,7 @@ func TestTimedMovementSensorReading(t *testing.T) {
 	t.Run("when the movement sensor's odometer functions return an error, timedOdometerReading wraps that error", func(t *testing.T) {
 		lidar, odometer := s.GoodLidar, s.OdometerWithErroringFunctions
 		deps := s.SetupDeps(lidar, odometer)
-		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, logger)
+		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, 0, nil, logger)
 		test.That(t, err, test.ShouldBeNil)
 
 		actualReading, err := actualOdometer.TimedMovementSensorReading(ctx)
@@ -148,7 +149,7 @@ func TestTimedMovementSensorReading(t *testing.T) {
 	t.Run("when a live IMU succeeds, returns current time in UTC and the reading", func(t *testing.T) {
 		lidar, imu := s.GoodLidar, s.GoodIMU
 		deps := s.SetupDeps(lidar, imu)
-		actualIMU, err := s.NewMovementSensor(ctx, deps, string(imu), testDataFrequencyHz, logger)
+		actualIMU, err := s.NewMovementSensor(ctx, deps, string(imu), testDataFrequencyHz, 0, nil, logger)
 		test.That(t, err, test.ShouldBeNil)
 
 		beforeReading := time.Now().UTC()
@@ -172,12 +173,18 @@ func TestTimedMovementSensorReading(t *testing.T) {
 		test.That(t, actualReading.TimedIMUResponse.ReadingTime.Location(), test.ShouldEqual, time.UTC)
 		test.That(t, actualReading.TimedOdometerResponse, test.ShouldBeNil)
 		test.That(t, actualReading.TestIsReplaySensor, test.ShouldBeFalse)
+
+		_, err = actualIMU.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		stats := actualIMU.(*s.MovementSensor).IMUSampleStats()
+		test.That(t, stats.Emitted, test.ShouldEqual, 2)
+		test.That(t, stats.Dropped, test.ShouldEqual, 0)
 	})
 
 	t.Run("when a live odometer succeeds, returns current time in UTC and the reading", func(t *testing.T) {
 		lidar, odometer := s.GoodLidar, s.GoodOdometer
 		deps := s.SetupDeps(lidar, odometer)
-		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, logger)
+		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, 0, nil, logger)
 		test.That(t, err, test.ShouldBeNil)
 
 		beforeReading := time.Now().UTC()
@@ -202,7 +209,7 @@ func TestTimedMovementSensorReading(t *testing.T) {
 		" returns current time in UTC and the reading", func(t *testing.T) {
 		lidar, odometer := s.GoodLidar, s.GoodMovementSensorBothIMUAndOdometer
 		deps := s.SetupDeps(lidar, odometer)
-		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, logger)
+		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, 0, nil, logger)
 		test.That(t, err, test.ShouldBeNil)
 
 		beforeReading := time.Now().UTC()
@@ -224,4 +231,29 @@ func TestTimedMovementSensorReading(t *testing.T) {
 		test.That(t, actualReading.TimedIMUResponse.ReadingTime.Location(), test.ShouldEqual, time.UTC)
 		test.That(t, actualReading.TestIsReplaySensor, test.ShouldBeFalse)
 	})
+
+	t.Run("when the samplers are started, synchronizes the samples they buffered", func(t *testing.T) {
+		lidar, movementSensor := s.GoodLidar, s.GoodMovementSensorBothIMUAndOdometer
+		deps := s.SetupDeps(lidar, movementSensor)
+		actualMs, err := s.NewMovementSensor(ctx, deps, string(movementSensor), testDataFrequencyHz, 0, nil, logger)
+		test.That(t, err, test.ShouldBeNil)
+
+		cancelCtx, cancel := context.WithCancel(ctx)
+		var activeBackgroundWorkers sync.WaitGroup
+		actualMs.(*s.MovementSensor).Start(cancelCtx, 50, &activeBackgroundWorkers)
+
+		var previous time.Time
+		for i := 0; i < 3; i++ {
+			actualReading, err := actualMs.TimedMovementSensorReading(ctx)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, actualReading.TimedIMUResponse.LinearAcceleration, test.ShouldResemble, s.TestLinAcc)
+			test.That(t, actualReading.TimedOdometerResponse.Position, test.ShouldResemble, s.TestPosition)
+			test.That(t, actualReading.TimedIMUResponse.ReadingTime.After(previous), test.ShouldBeTrue)
+			previous = actualReading.TimedIMUResponse.ReadingTime
+		}
+		cancel()
+		activeBackgroundWorkers.Wait()
+
+		test.That(t, actualMs.(*s.MovementSensor).IMUSampleStats().Emitted, test.ShouldEqual, 3)
+	})
 }
@@ -12,6 +12,7 @@ import (
 	"go.viam.com/rdk/components/camera/replaypcd"
 	"go.viam.com/rdk/components/movementsensor"
 	"go.viam.com/rdk/components/movementsensor/replay"
+	"go.viam.com/rdk/components/sensor"
 	"go.viam.com/rdk/gostream"
 	"go.viam.com/rdk/pointcloud"
 	"go.viam.com/rdk/resource"
@@ -35,6 +36,13 @@ var (
 	TestPosition = geo.NewPoint(5, 4)
 	// TestOrientation is the successful mock orientation result used for testing.
 	TestOrientation = &spatialmath.Quaternion{Real: 0.1, Imag: -0.2, Jmag: 2.5, Kmag: -9.1}
+	// TestGenericSensorConfig maps the readings of the generic test sensors onto IMU and odometer data.
+	TestGenericSensorConfig = GenericSensorConfig{
+		LinearAccelerationKeys: []string{"acc.x", "acc.y", "acc.z"},
+		AngularVelocityKeys:    []string{"gyro.x", "gyro.y", "gyro.z"},
+		PositionKeys:           []string{"lat", "lng"},
+		OrientationKeys:        []string{"quat_w", "quat_x", "quat_y", "quat_z"},
+	}
 )
 
 // TestSensor represents sensors used for testing.
@@ -120,6 +128,15 @@ const (
 	// FinishedReplayMovementSensor is a movement sensor whose LinearAcceleration, AngularVelocity, Position, and Orientation
 	//  functions return an end of dataset error.
 	FinishedReplayMovementSensor TestSensor = "finished_replay_movement_sensor"
+
+	// ------------- Generic Sensor Test Sensors ----------.
+
+	// GoodGenericSensor is a generic sensor whose readings contain IMU and odometer values.
+	GoodGenericSensor TestSensor = "good_generic_sensor"
+	// GenericSensorWithErroringReadings is a generic sensor whose Readings function returns an error.
+	GenericSensorWithErroringReadings TestSensor = "generic_sensor_with_erroring_readings"
+	// ReplayGenericSensor is a generic sensor whose readings contain IMU and odometer values and a replay timestamp.
+	ReplayGenericSensor TestSensor = "replay_generic_sensor"
 )
 
 var (
@@ -153,6 +170,12 @@ var (
 		InvalidReplayMovementSensorBothIMUAndOdometer:         func() *inject.MovementSensor { return getReplayMovementSensor(BadTime) },
 		FinishedReplayMovementSensor:                          getFinishedReplayMovementSensor,
 	}
+
+	testGenericSensors = map[TestSensor]func() *inject.Sensor{
+		GoodGenericSensor:                 func() *inject.Sensor { return getGenericSensor(GoodGenericSensor, "") },
+		GenericSensorWithErroringReadings: getGenericSensorWithErroringReadings,
+		ReplayGenericSensor:               func() *inject.Sensor { return getGenericSensor(ReplayGenericSensor, TestTimestamp) },
+	}
 )
 
 // SetupDeps returns the dependencies based on the lidar and movement sensor names passed as arguments.
@@ -166,6 +189,10 @@ func SetupDeps(lidarName, movementSensorName TestSensor) resource.Dependencies {
 		deps[movementsensor.Named(string(movementSensorName))] = getMovementSensorFunc()
 	}
 
+	if getGenericSensorFunc, ok := testGenericSensors[movementSensorName]; ok {
+		deps[sensor.Named(string(movementSensorName))] = getGenericSensorFunc()
+	}
+
 	return deps
 }
 
@@ -582,3 +609,34 @@ func getFinishedReplayMovementSensor() *inject.MovementSensor {
 	}
 	return movementSensor
 }
+
+func getGenericSensor(name TestSensor, testTime string) *inject.Sensor {
+	genericSensor := inject.NewSensor(string(name))
+	genericSensor.ReadingsFunc = func(ctx context.Context, extra map[string]interface{}) (map[string]interface{}, error) {
+		if testTime != "" {
+			md := ctx.Value(contextutils.MetadataContextKey)
+			if mdMap, ok := md.(map[string][]string); ok {
+				mdMap[contextutils.TimeRequestedMetadataKey] = []string{testTime}
+			}
+		}
+		return map[string]interface{}{
+			"acc":    map[string]interface{}{"x": TestLinAcc.X, "y": TestLinAcc.Y, "z": TestLinAcc.Z},
+			"gyro":   map[string]interface{}{"x": TestAngVel.X, "y": TestAngVel.Y, "z": TestAngVel.Z},
+			"lat":    TestPosition.Lat(),
+			"lng":    TestPosition.Lng(),
+			"quat_w": TestOrientation.Real,
+			"quat_x": TestOrientation.Imag,
+			"quat_y": TestOrientation.Jmag,
+			"quat_z": TestOrientation.Kmag,
+		}, nil
+	}
+	return genericSensor
+}
+
+func getGenericSensorWithErroringReadings() *inject.Sensor {
+	genericSensor := inject.NewSensor(string(GenericSensorWithErroringReadings))
+	genericSensor.ReadingsFunc = func(ctx context.Context, extra map[string]interface{}) (map[string]interface{}, error) {
+		return nil, errors.New(InvalidSensorTestErrMsg)
+	}
+	return genericSensor
+}
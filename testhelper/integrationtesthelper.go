@@ -269,14 +269,14 @@ func integrationTimedLidar(
 
 	var i uint64
 
-	dataFrequencyHz, err := strconv.Atoi(lidar["data_frequency_hz"])
+	dataFrequencyHz, err := strconv.ParseFloat(lidar["data_frequency_hz"], 64)
 	if err != nil {
 		return nil, err
 	}
 
 	injectLidar := &inject.TimedLidar{}
 	injectLidar.NameFunc = func() string { return lidar["name"] }
-	injectLidar.DataFrequencyHzFunc = func() int { return dataFrequencyHz }
+	injectLidar.DataFrequencyHzFunc = func() float64 { return dataFrequencyHz }
 	injectLidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
 		defer timeTracker.mu.Unlock()
 
@@ -415,7 +415,7 @@ func IntegrationCartographer(
 
 	cSvc, ok := svc.(*viamcartographer.CartographerService)
 	test.That(t, ok, test.ShouldBeTrue)
-	test.That(t, cSvc.SlamMode, test.ShouldEqual, expectedMode)
+	test.That(t, cSvc.SlamMode(), test.ShouldEqual, expectedMode)
 
 	// Wait for sensor processes to finish sending data and for context to be canceled
 	start := time.Now().UTC()
@@ -435,7 +435,7 @@ func IntegrationCartographer(
 
 	// Test end points and retrieve internal state
 	testCartographerPosition(t, svc, useIMU, useOdometer)
-	testCartographerMap(t, svc, cSvc.SlamMode == cartofacade.LocalizingMode)
+	testCartographerMap(t, svc, cSvc.SlamMode() == cartofacade.LocalizingMode)
 
 	internalState, err := slam.InternalStateFull(context.Background(), svc)
 	test.That(t, err, test.ShouldBeNil)
@@ -481,7 +481,7 @@ func integrationTimedMovementSensor(
 		return nil, err
 	}
 
-	dataFrequencyHz, err := strconv.Atoi(movementSensor["data_frequency_hz"])
+	dataFrequencyHz, err := strconv.ParseFloat(movementSensor["data_frequency_hz"], 64)
 	if err != nil {
 		return nil, err
 	}
@@ -489,7 +489,7 @@ func integrationTimedMovementSensor(
 	var i uint64
 	injectMovementSensor := &inject.TimedMovementSensor{}
 	injectMovementSensor.NameFunc = func() string { return movementSensor["name"] }
-	injectMovementSensor.DataFrequencyHzFunc = func() int { return dataFrequencyHz }
+	injectMovementSensor.DataFrequencyHzFunc = func() float64 { return dataFrequencyHz }
 	injectMovementSensor.TimedMovementSensorReadingFunc = func(ctx context.Context) (s.TimedMovementSensorReadingResponse, error) {
 		defer timeTracker.mu.Unlock()
 		// Holds the process until for all necessary lidar data has been sent to cartographer. Is always
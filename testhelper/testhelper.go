@@ -30,7 +30,7 @@ import (
 
 const (
 	// SlamTimeFormat is the timestamp format used in the dataprocess.
-	SlamTimeFormat = "2006-01-02T15:04:05.0000Z"
+	SlamTimeFormat = s.DatasetTimeFormat
 	// CartoFacadeTimeoutForTest is the timeout used for capi requests for tests.
 	CartoFacadeTimeoutForTest = 5 * time.Second
 	// CartoFacadeInternalTimeoutForTest is the timeout used for internal capi requests for tests.
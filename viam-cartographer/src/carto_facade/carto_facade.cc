@@ -7,6 +7,10 @@
 #include <boost/uuid/uuid.hpp>             // uuid class
 #include <boost/uuid/uuid_generators.hpp>  // generators
 #include <boost/uuid/uuid_io.hpp>
+#include <algorithm>
+#include <cmath>
+#include <fstream>
+#include <vector>
 
 #include "glog/logging.h"
 #include "map_builder.h"
@@ -115,6 +119,8 @@ config from_viam_carto_config(viam_carto_config vcc) {
     c.enable_mapping = vcc.enable_mapping;
     c.existing_map = to_std_string(vcc.existing_map);
     c.lidar_config = vcc.lidar_config;
+    c.blocking_add = vcc.blocking_add;
+    c.cancelled = vcc.cancelled;
 
     if (c.camera.empty()) {
         throw VIAM_CARTO_LIDAR_CONFIG_INVALID;
@@ -199,7 +205,7 @@ void CartoFacade::IOInit() {
     auto config_basename = slam_mode_lua_config_filename(slam_mode);
     // Setup MapBuilder
     {
-        std::lock_guard<std::mutex> lk(map_builder_mutex);
+        std::lock_guard<std::timed_mutex> lk(map_builder_mutex);
         map_builder.SetUp(configuration_directory, config_basename);
         VLOG(1) << "overwriting map_builder config";
         map_builder.OverwriteOptimizeEveryNNodes(
@@ -260,13 +266,13 @@ void CartoFacade::IOInit() {
                                                std::defer_lock};
             optimization_lock.lock();
             // Load apriori map (internal state)
-            std::lock_guard<std::mutex> lk(map_builder_mutex);
+            std::lock_guard<std::timed_mutex> lk(map_builder_mutex);
             map_builder.LoadMapFromFile(config.existing_map,
                                         load_frozen_trajectory,
                                         algo_config.optimize_on_start);
         } else {
             // Load apriori map (internal state)
-            std::lock_guard<std::mutex> lk(map_builder_mutex);
+            std::lock_guard<std::timed_mutex> lk(map_builder_mutex);
             map_builder.LoadMapFromFile(config.existing_map,
                                         load_frozen_trajectory,
                                         algo_config.optimize_on_start);
@@ -276,7 +282,7 @@ void CartoFacade::IOInit() {
     }
 
     {
-        std::lock_guard<std::mutex> lk(map_builder_mutex);
+        std::lock_guard<std::timed_mutex> lk(map_builder_mutex);
         map_builder.StartTrajectoryBuilder(algo_config.use_imu_data);
     }
     state = CartoFacadeState::IO_INITIALIZED;
@@ -326,8 +332,99 @@ void CartoFacade::CacheMapInLocalizationMode() {
     }
 }
 
+void CartoFacade::ThrowIfCancelled() {
+    if (config.cancelled != nullptr &&
+        __atomic_load_n(config.cancelled, __ATOMIC_ACQUIRE) != 0) {
+        LOG(INFO) << "call was cancelled by the caller";
+        throw VIAM_CARTO_CANCELLED;
+    }
+}
+
+// fill_submap_slice prepares the slice of a submap with the given global pose
+// from its proto, so that it can be painted
+void fill_submap_slice(
+    const cartographer::transform::Rigid3d &pose,
+    const cartographer::mapping::proto::SubmapQuery::Response &response_proto,
+    ::cartographer::io::SubmapSlice &submap_slice) {
+    auto submap_textures =
+        absl::make_unique<::cartographer::io::SubmapTextures>();
+    submap_textures->version = response_proto.submap_version();
+    for (const auto &texture_proto : response_proto.textures()) {
+        const std::string compressed_cells(texture_proto.cells().begin(),
+                                           texture_proto.cells().end());
+        submap_textures->textures.emplace_back(
+            ::cartographer::io::SubmapTexture{
+                ::cartographer::io::UnpackTextureData(compressed_cells,
+                                                      texture_proto.width(),
+                                                      texture_proto.height()),
+                texture_proto.width(), texture_proto.height(),
+                texture_proto.resolution(),
+                cartographer::transform::ToRigid3(texture_proto.slice_pose())});
+    }
+
+    // Prepares SubmapSlice
+    const auto fetched_texture = submap_textures->textures.begin();
+    submap_slice.pose = pose;
+    submap_slice.width = fetched_texture->width;
+    submap_slice.height = fetched_texture->height;
+    submap_slice.slice_pose = fetched_texture->slice_pose;
+    submap_slice.resolution = fetched_texture->resolution;
+    submap_slice.cairo_data.clear();
+
+    submap_slice.surface = ::cartographer::io::DrawTexture(
+        fetched_texture->pixels.intensity, fetched_texture->pixels.alpha,
+        fetched_texture->width, fetched_texture->height,
+        &submap_slice.cairo_data);
+}
+
+// to_viam_carto_submap returns the submap with the given id and global pose,
+// without points
+viam_carto_submap to_viam_carto_submap(
+    const cartographer::mapping::SubmapId &id,
+    const cartographer::mapping::PoseGraphInterface::SubmapPose &submap_pose) {
+    viam_carto_submap submap;
+    submap.trajectory_id = id.trajectory_id;
+    submap.submap_index = id.submap_index;
+    submap.version = submap_pose.version;
+    auto pos_vector = submap_pose.pose.translation();
+    auto pos_quat = submap_pose.pose.rotation();
+    submap.x = pos_vector.x() * 1000;
+    submap.y = pos_vector.y() * 1000;
+    submap.z = pos_vector.z() * 1000;
+    submap.real = pos_quat.w();
+    submap.imag = pos_quat.x();
+    submap.jmag = pos_quat.y();
+    submap.kmag = pos_quat.z();
+    submap.point_cloud_pcd = nullptr;
+    return submap;
+}
+
+// same_submap returns whether the submaps have the same version and pose,
+// and so the same points
+bool same_submap(const viam_carto_submap &a, const viam_carto_submap &b) {
+    return a.version == b.version && a.x == b.x && a.y == b.y && a.z == b.z &&
+           a.real == b.real && a.imag == b.imag && a.jmag == b.jmag &&
+           a.kmag == b.kmag;
+}
+
+// add_intensity adds an intensity observed at position to the cell containing
+// it, keeping the highest intensity observed in a cell
+void add_intensity(IntensityCells &cells, const Eigen::Vector3d &position,
+                   float intensity) {
+    std::pair<int64_t, int64_t> cell = {
+        std::lround(position.x() / resolutionMeters),
+        std::lround(position.y() / resolutionMeters)};
+    auto [it, inserted] = cells.emplace(cell, intensity);
+    if (!inserted) {
+        it->second = std::max(it->second, intensity);
+    }
+}
+
 cartographer::io::PaintSubmapSlicesResult
-CartoFacade::GetLatestPaintedMapSlices() {
+CartoFacade::GetLatestPaintedMapSlices(
+    std::map<cartographer::mapping::SubmapId, cartographer::transform::Rigid3d>
+        &poses,
+    bool cancellable) {
     VLOG(1) << "GetLatestPaintedMapSlices()";
     cartographer::mapping::MapById<
         cartographer::mapping::SubmapId,
@@ -338,11 +435,14 @@ CartoFacade::GetLatestPaintedMapSlices() {
         response_protos;
 
     {
-        std::lock_guard<std::mutex> lk(map_builder_mutex);
+        std::lock_guard<std::timed_mutex> lk(map_builder_mutex);
         submap_poses =
             map_builder.map_builder_->pose_graph()->GetAllSubmapPoses();
 
         for (const auto &&submap_id_pose : submap_poses) {
+            if (cancellable) {
+                ThrowIfCancelled();
+            }
             cartographer::mapping::proto::SubmapQuery::Response
                 &response_proto = response_protos[submap_id_pose.id];
             const std::string error = map_builder.map_builder_->SubmapToProto(
@@ -361,40 +461,13 @@ CartoFacade::GetLatestPaintedMapSlices() {
     }
 
     for (const auto &&submap_id_pose : submap_poses) {
-        auto submap_textures =
-            absl::make_unique<::cartographer::io::SubmapTextures>();
-        submap_textures->version =
-            response_protos[submap_id_pose.id].submap_version();
-        for (const auto &texture_proto :
-             response_protos[submap_id_pose.id].textures()) {
-            const std::string compressed_cells(texture_proto.cells().begin(),
-                                               texture_proto.cells().end());
-            submap_textures->textures.emplace_back(
-                ::cartographer::io::SubmapTexture{
-                    ::cartographer::io::UnpackTextureData(
-                        compressed_cells, texture_proto.width(),
-                        texture_proto.height()),
-                    texture_proto.width(), texture_proto.height(),
-                    texture_proto.resolution(),
-                    cartographer::transform::ToRigid3(
-                        texture_proto.slice_pose())});
+        if (cancellable) {
+            ThrowIfCancelled();
         }
-
-        // Prepares SubmapSlice
-        ::cartographer::io::SubmapSlice &submap_slice =
-            submap_slices[submap_id_pose.id];
-        const auto fetched_texture = submap_textures->textures.begin();
-        submap_slice.pose = submap_id_pose.data.pose;
-        submap_slice.width = fetched_texture->width;
-        submap_slice.height = fetched_texture->height;
-        submap_slice.slice_pose = fetched_texture->slice_pose;
-        submap_slice.resolution = fetched_texture->resolution;
-        submap_slice.cairo_data.clear();
-
-        submap_slice.surface = ::cartographer::io::DrawTexture(
-            fetched_texture->pixels.intensity, fetched_texture->pixels.alpha,
-            fetched_texture->width, fetched_texture->height,
-            &submap_slice.cairo_data);
+        fill_submap_slice(submap_id_pose.data.pose,
+                          response_protos[submap_id_pose.id],
+                          submap_slices[submap_id_pose.id]);
+        poses[submap_id_pose.id] = submap_id_pose.data.pose;
     }
     cartographer::io::PaintSubmapSlicesResult painted_slices =
         cartographer::io::PaintSubmapSlices(submap_slices, resolutionMeters);
@@ -402,18 +475,18 @@ CartoFacade::GetLatestPaintedMapSlices() {
     return painted_slices;
 }
 
-void CartoFacade::GetLatestSampledPointCloudMapString(std::string &pointcloud) {
-    VLOG(1) << "GetLatestSampledPointCloudMapString()";
-    std::unique_ptr<cartographer::io::PaintSubmapSlicesResult> painted_slices =
-        nullptr;
+std::unique_ptr<cartographer::io::PaintSubmapSlicesResult>
+CartoFacade::PaintLatestMap(
+    std::map<cartographer::mapping::SubmapId, cartographer::transform::Rigid3d>
+        &submap_poses,
+    bool cancellable) {
     try {
-        painted_slices =
-            std::make_unique<cartographer::io::PaintSubmapSlicesResult>(
-                GetLatestPaintedMapSlices());
+        return std::make_unique<cartographer::io::PaintSubmapSlicesResult>(
+            GetLatestPaintedMapSlices(submap_poses, cancellable));
     } catch (std::exception &e) {
         if (e.what() == viam::carto_facade::errorNoSubmaps) {
             LOG(INFO) << "Error creating pcd map: " << e.what();
-            return;
+            return nullptr;
         } else {
             std::string errorLog = "Error writing submap to proto: ";
             errorLog += e.what();
@@ -421,9 +494,50 @@ void CartoFacade::GetLatestSampledPointCloudMapString(std::string &pointcloud) {
             throw std::runtime_error(errorLog);
         }
     }
+}
+
+void CartoFacade::GetLatestSampledPointCloudMapString(std::string &pointcloud,
+                                                      bool cancellable) {
+    VLOG(1) << "GetLatestSampledPointCloudMapString()";
+    std::map<cartographer::mapping::SubmapId, cartographer::transform::Rigid3d>
+        submap_poses;
+    auto painted_slices = PaintLatestMap(submap_poses, cancellable);
+    if (painted_slices == nullptr) {
+        return;
+    }
+
+    pointcloud = SampledPointCloudString(
+        *painted_slices, IntensityLayer(submap_poses), cancellable);
+}
+
+IntensityCells CartoFacade::IntensityLayer(
+    const std::map<cartographer::mapping::SubmapId,
+                   cartographer::transform::Rigid3d> &submap_poses) {
+    IntensityCells cells;
+    if (!algo_config.point_cloud_map_intensity) {
+        return cells;
+    }
+    std::lock_guard<std::mutex> lk(viam_response_mutex);
+    for (const auto &[id, pose] : submap_poses) {
+        auto submap_cells = intensity_layer.find(id);
+        if (submap_cells == intensity_layer.end()) {
+            continue;
+        }
+        for (const auto &[cell, intensity] : submap_cells->second) {
+            Eigen::Vector3d position(cell.first * resolutionMeters,
+                                     cell.second * resolutionMeters, 0);
+            add_intensity(cells, pose * position, intensity);
+        }
+    }
+    return cells;
+}
 
+void CartoFacade::ForEachSampledPoint(
+    cartographer::io::PaintSubmapSlicesResult &painted_slices,
+    const IntensityCells &intensities, bool cancellable,
+    const std::function<void(float, float, int)> &add_point) {
     // Get data from painted surface in ARGB32 format
-    auto painted_surface = painted_slices->surface.get();
+    auto painted_surface = painted_slices.surface.get();
     auto image_format = cairo_image_surface_get_format(painted_surface);
     if (image_format != cartographer::io::kCairoFormat) {
         std::string error_log =
@@ -436,13 +550,14 @@ void CartoFacade::GetLatestSampledPointCloudMapString(std::string &pointcloud) {
     auto image_data_ptr = cairo_image_surface_get_data(painted_surface);
 
     // Get pixel containing map origin (0, 0)
-    float origin_pixel_x = painted_slices->origin.x();
-    float origin_pixel_y = painted_slices->origin.y();
+    float origin_pixel_x = painted_slices.origin.x();
+    float origin_pixel_y = painted_slices.origin.y();
 
-    // Iterate over image data and add to pointcloud buffer
-    int num_points = 0;
-    std::string pcd_data;
+    // Iterate over image data and pass each point on
     for (int pixel_y = 0; pixel_y < height; pixel_y++) {
+        if (cancellable) {
+            ThrowIfCancelled();
+        }
         for (int pixel_x = 0; pixel_x < width; pixel_x++) {
             // Get byte index associated with pixel
             int pixel_index = pixel_x + pixel_y * width;
@@ -472,28 +587,65 @@ void CartoFacade::GetLatestSampledPointCloudMapString(std::string &pointcloud) {
             float x_pos = (pixel_x - origin_pixel_x) * resolutionMeters;
             // Y is inverted to match output from getPosition()
             float y_pos = -(pixel_y - origin_pixel_y) * resolutionMeters;
-            float z_pos = 0;  // Z is 0 in 2D SLAM
-
-            // Add point to buffer
-            viam::carto_facade::util::write_float_to_buffer_in_bytes(pcd_data,
-                                                                     x_pos);
-            viam::carto_facade::util::write_float_to_buffer_in_bytes(pcd_data,
-                                                                     y_pos);
-            viam::carto_facade::util::write_float_to_buffer_in_bytes(pcd_data,
-                                                                     z_pos);
-            viam::carto_facade::util::write_int_to_buffer_in_bytes(pcd_data,
-                                                                   prob);
-
-            num_points++;
+
+            auto intensity =
+                intensities.find({std::lround(x_pos / resolutionMeters),
+                                  std::lround(y_pos / resolutionMeters)});
+            if (intensity != intensities.end()) {
+                prob = viam::carto_facade::util::probability_with_intensity(
+                    prob, intensity->second);
+            }
+            add_point(x_pos, y_pos, prob);
         }
     }
+}
+
+// write_point appends a point of the sampled pointcloud to the buffer in the
+// binary layout of the pcd header
+void write_point(std::string &buffer, float x_pos, float y_pos, int prob) {
+    float z_pos = 0;  // Z is 0 in 2D SLAM
+    viam::carto_facade::util::write_float_to_buffer_in_bytes(buffer, x_pos);
+    viam::carto_facade::util::write_float_to_buffer_in_bytes(buffer, y_pos);
+    viam::carto_facade::util::write_float_to_buffer_in_bytes(buffer, z_pos);
+    viam::carto_facade::util::write_int_to_buffer_in_bytes(buffer, prob);
+}
+
+std::string CartoFacade::SampledPointCloudString(
+    cartographer::io::PaintSubmapSlicesResult &painted_slices,
+    const IntensityCells &intensities, bool cancellable) {
+    int num_points = 0;
+    std::string pcd_data;
+    ForEachSampledPoint(painted_slices, intensities, cancellable,
+                        [&](float x_pos, float y_pos, int prob) {
+                            write_point(pcd_data, x_pos, y_pos, prob);
+                            num_points++;
+                        });
 
     // Write our PCD file, which is written as a binary.
-    pointcloud = viam::carto_facade::util::pcd_header(num_points, true);
+    std::string pointcloud =
+        viam::carto_facade::util::pcd_header(num_points, true);
 
     // Writes data buffer to the pointcloud string
     pointcloud += pcd_data;
-    return;
+    return pointcloud;
+}
+
+void CartoFacade::WriteSampledPointCloud(
+    cartographer::io::PaintSubmapSlicesResult &painted_slices,
+    const IntensityCells &intensities, std::ostream &out, bool cancellable) {
+    // the header holds the number of points, so they are counted first
+    int num_points = 0;
+    ForEachSampledPoint(painted_slices, intensities, cancellable,
+                        [&](float, float, int) { num_points++; });
+    out << viam::carto_facade::util::pcd_header(num_points, true);
+
+    std::string point;
+    ForEachSampledPoint(painted_slices, intensities, cancellable,
+                        [&](float x_pos, float y_pos, int prob) {
+                            point.clear();
+                            write_point(point, x_pos, y_pos, prob);
+                            out.write(point.data(), point.size());
+                        });
 }
 
 void CartoFacade::RunFinalOptimization() {
@@ -502,8 +654,10 @@ void CartoFacade::RunFinalOptimization() {
                    << CartoFacadeState::STARTED;
         throw VIAM_CARTO_NOT_IN_STARTED_STATE;
     }
+    // the optimization itself cannot be interrupted
+    ThrowIfCancelled();
     {
-        std::lock_guard<std::mutex> lk(map_builder_mutex);
+        std::lock_guard<std::timed_mutex> lk(map_builder_mutex);
         map_builder.map_builder_->pose_graph()->RunFinalOptimization();
     }
 }
@@ -515,7 +669,7 @@ void CartoFacade::GetPosition(viam_carto_get_position_response *r) {
         throw VIAM_CARTO_NOT_IN_STARTED_STATE;
     }
     {
-        std::lock_guard<std::mutex> lk(map_builder_mutex);
+        std::lock_guard<std::timed_mutex> lk(map_builder_mutex);
         if (!map_builder.local_pose_initialized) {
             LOG(ERROR) << "position is not yet initialized";
             throw VIAM_CARTO_GET_POSITION_NOT_INITIALIZED;
@@ -545,6 +699,56 @@ void CartoFacade::GetPointCloudMap(viam_carto_get_point_cloud_map_response *r) {
                    << CartoFacadeState::STARTED;
         throw VIAM_CARTO_NOT_IN_STARTED_STATE;
     }
+    ThrowIfCancelled();
+    r->point_cloud_pcd = to_bstring(LatestPointCloudMap());
+};
+
+void CartoFacade::WritePointCloudMap(const std::string &path) {
+    if (state != CartoFacadeState::STARTED) {
+        LOG(ERROR) << "carto facade is in state: " << state << " expected "
+                   << CartoFacadeState::STARTED;
+        throw VIAM_CARTO_NOT_IN_STARTED_STATE;
+    }
+    ThrowIfCancelled();
+    std::ofstream f;
+    auto open_mode = std::ios::out | std::ios::binary | std::ios::trunc;
+    std::shared_lock optimization_lock{optimization_shared_mutex,
+                                       std::defer_lock};
+    if (slam_mode != viam::carto_facade::SlamMode::LOCALIZING &&
+        optimization_lock.try_lock()) {
+        // The sampled points are streamed to the file, so the map is never
+        // held in memory as a whole. Unlike LatestPointCloudMap this leaves
+        // the cached map as it is.
+        std::map<cartographer::mapping::SubmapId,
+                 cartographer::transform::Rigid3d>
+            submap_poses;
+        auto painted_slices = PaintLatestMap(submap_poses, true);
+        if (painted_slices == nullptr) {
+            LOG(ERROR) << "map pointcloud does not have points yet";
+            throw VIAM_CARTO_POINTCLOUD_MAP_EMPTY;
+        }
+        f.open(path, open_mode);
+        WriteSampledPointCloud(*painted_slices, IntensityLayer(submap_poses), f,
+                               true);
+    } else {
+        // Either we are in localization mode or the optimization is running,
+        // so the cached map is written
+        std::lock_guard<std::mutex> lk(viam_response_mutex);
+        if (latest_pointcloud_map.empty()) {
+            LOG(ERROR) << "map pointcloud does not have points yet";
+            throw VIAM_CARTO_POINTCLOUD_MAP_EMPTY;
+        }
+        f.open(path, open_mode);
+        f.write(latest_pointcloud_map.data(), latest_pointcloud_map.size());
+    }
+    f.close();
+    if (f.fail()) {
+        LOG(ERROR) << "Failed to write the pointcloud map to " << path;
+        throw VIAM_CARTO_EXPORT_FILE_WRITE_IO_ERROR;
+    }
+};
+
+std::string CartoFacade::LatestPointCloudMap() {
     std::string pointcloud_map;
     // Write or grab the latest pointcloud map in form of a string
     std::shared_lock optimization_lock{optimization_shared_mutex,
@@ -554,7 +758,7 @@ void CartoFacade::GetPointCloudMap(viam_carto_get_point_cloud_map_response *r) {
         // We are able to lock the optimization_shared_mutex, which means
         // that the optimization is not ongoing and we can grab the newest
         // map
-        GetLatestSampledPointCloudMapString(pointcloud_map);
+        GetLatestSampledPointCloudMapString(pointcloud_map, true);
         std::lock_guard<std::mutex> lk(viam_response_mutex);
         latest_pointcloud_map = pointcloud_map;
     } else {
@@ -575,7 +779,104 @@ void CartoFacade::GetPointCloudMap(viam_carto_get_point_cloud_map_response *r) {
         LOG(ERROR) << "map pointcloud does not have points yet";
         throw VIAM_CARTO_POINTCLOUD_MAP_EMPTY;
     }
-    r->point_cloud_pcd = to_bstring(pointcloud_map);
+    return pointcloud_map;
+};
+
+void CartoFacade::GetSubmaps(const viam_carto_get_submaps_request *req,
+                             viam_carto_get_submaps_response *r) {
+    if (state != CartoFacadeState::STARTED) {
+        LOG(ERROR) << "carto facade is in state: " << state << " expected "
+                   << CartoFacadeState::STARTED;
+        throw VIAM_CARTO_NOT_IN_STARTED_STATE;
+    }
+    ThrowIfCancelled();
+    // the submap poses change while optimizing, so wait for the optimized
+    // poses instead of painting submaps which are about to move
+    std::shared_lock optimization_lock{optimization_shared_mutex,
+                                       std::defer_lock};
+    if (!optimization_lock.try_lock()) {
+        LOG(INFO) << "Optimization is occuring, cannot get submaps";
+        throw VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK;
+    }
+
+    std::map<std::pair<int, int>, const viam_carto_submap *> known;
+    for (int i = 0; i < req->known_len; i++) {
+        known[{req->known[i].trajectory_id, req->known[i].submap_index}] =
+            &req->known[i];
+    }
+
+    std::vector<viam_carto_submap> submaps;
+    std::map<cartographer::mapping::SubmapId,
+             cartographer::mapping::proto::SubmapQuery::Response>
+        response_protos;
+    std::map<cartographer::mapping::SubmapId, cartographer::transform::Rigid3d>
+        changed_poses;
+    {
+        std::lock_guard<std::timed_mutex> lk(map_builder_mutex);
+        auto submap_poses =
+            map_builder.map_builder_->pose_graph()->GetAllSubmapPoses();
+        for (const auto &&submap_id_pose : submap_poses) {
+            const auto &id = submap_id_pose.id;
+            if (slam_mode == viam::carto_facade::SlamMode::LOCALIZING &&
+                id.trajectory_id == map_builder.trajectory_id) {
+                continue;
+            }
+            viam_carto_submap submap =
+                to_viam_carto_submap(id, submap_id_pose.data);
+            submaps.push_back(submap);
+
+            auto it = known.find({id.trajectory_id, id.submap_index});
+            if (it != known.end() && same_submap(*it->second, submap)) {
+                continue;
+            }
+            const std::string error = map_builder.map_builder_->SubmapToProto(
+                id, &response_protos[id]);
+            if (error != "") {
+                throw std::runtime_error(error);
+            }
+            changed_poses[id] = submap_id_pose.data.pose;
+        }
+    }
+
+    // Paint each changed submap on its own
+    std::map<cartographer::mapping::SubmapId, std::string> pointclouds;
+    for (const auto &[id, pose] : changed_poses) {
+        ThrowIfCancelled();
+        std::map<cartographer::mapping::SubmapId,
+                 ::cartographer::io::SubmapSlice>
+            submap_slices;
+        fill_submap_slice(pose, response_protos[id], submap_slices[id]);
+        cartographer::io::PaintSubmapSlicesResult painted_slices =
+            cartographer::io::PaintSubmapSlices(submap_slices,
+                                                resolutionMeters);
+        pointclouds[id] = SampledPointCloudString(
+            painted_slices, IntensityLayer({{id, pose}}), true);
+    }
+
+    r->submaps = nullptr;
+    r->submaps_len = 0;
+    if (submaps.empty()) {
+        return;
+    }
+    r->submaps = (viam_carto_submap *)calloc(submaps.size(),
+                                             sizeof(viam_carto_submap));
+    if (r->submaps == nullptr) {
+        throw VIAM_CARTO_OUT_OF_MEMORY;
+    }
+    r->submaps_len = submaps.size();
+    try {
+        for (size_t i = 0; i < submaps.size(); i++) {
+            r->submaps[i] = submaps[i];
+            auto it = pointclouds.find(cartographer::mapping::SubmapId{
+                submaps[i].trajectory_id, submaps[i].submap_index});
+            if (it != pointclouds.end()) {
+                r->submaps[i].point_cloud_pcd = to_bstring(it->second);
+            }
+        }
+    } catch (int err) {
+        viam_carto_get_submaps_response_destroy(r);
+        throw err;
+    }
 };
 
 // TODO: This function is unnecessarily prone to IO errors
@@ -589,13 +890,14 @@ void CartoFacade::GetInternalState(viam_carto_get_internal_state_response *r) {
                    << CartoFacadeState::STARTED;
         throw VIAM_CARTO_NOT_IN_STARTED_STATE;
     }
+    ThrowIfCancelled();
     boost::uuids::uuid uuid = boost::uuids::random_generator()();
 
     std::string filename = "/tmp/temp_internal_state_" +
                            boost::uuids::to_string(uuid) + ".pbstream";
 
     {
-        std::lock_guard<std::mutex> lk(map_builder_mutex);
+        std::lock_guard<std::timed_mutex> lk(map_builder_mutex);
         bool ok = map_builder.SaveMapToFile(true, filename);
         if (!ok) {
             LOG(ERROR) << "Failed to save the internal state as a pbstream.";
@@ -615,6 +917,22 @@ void CartoFacade::GetInternalState(viam_carto_get_internal_state_response *r) {
     r->internal_state = to_bstring(internal_state);
 };
 
+void CartoFacade::WriteInternalState(const std::string &path) {
+    if (state != CartoFacadeState::STARTED) {
+        LOG(ERROR) << "carto facade is in state: " << state << " expected "
+                   << CartoFacadeState::STARTED;
+        throw VIAM_CARTO_NOT_IN_STARTED_STATE;
+    }
+    ThrowIfCancelled();
+    // cartographer streams the serialized state to the file
+    std::lock_guard<std::timed_mutex> lk(map_builder_mutex);
+    bool ok = map_builder.SaveMapToFile(true, path);
+    if (!ok) {
+        LOG(ERROR) << "Failed to write the internal state to " << path;
+        throw VIAM_CARTO_EXPORT_FILE_WRITE_IO_ERROR;
+    }
+};
+
 void CartoFacade::Start() {
     if (state != CartoFacadeState::IO_INITIALIZED) {
         LOG(ERROR) << "carto facade is in state: " << state << " expected "
@@ -656,31 +974,104 @@ void CartoFacade::AddLidarReading(const viam_carto_lidar_reading *sr) {
     }
 
     int64_t lidar_reading_time_unix_milli = sr->lidar_reading_time_unix_milli;
-    auto [success, measurement] = viam::carto_facade::util::carto_lidar_reading(
-        lidar_reading, lidar_reading_time_unix_milli);
+    bool success;
+    cartographer::sensor::TimedPointCloudData measurement;
+    switch (sr->lidar_reading_format) {
+        case VIAM_CARTO_LIDAR_READING_FORMAT_PCD:
+            std::tie(success, measurement) =
+                viam::carto_facade::util::carto_lidar_reading(
+                    lidar_reading, lidar_reading_time_unix_milli);
+            break;
+        case VIAM_CARTO_LIDAR_READING_FORMAT_POINTS:
+            std::tie(success, measurement) =
+                viam::carto_facade::util::carto_lidar_reading_from_points(
+                    lidar_reading, lidar_reading_time_unix_milli);
+            break;
+        case VIAM_CARTO_LIDAR_READING_FORMAT_POINTS_INTENSITY:
+            std::tie(success, measurement) =
+                viam::carto_facade::util::carto_lidar_reading_from_points(
+                    lidar_reading, lidar_reading_time_unix_milli, true);
+            break;
+        case VIAM_CARTO_LIDAR_READING_FORMAT_POLAR:
+            std::tie(success, measurement) =
+                viam::carto_facade::util::carto_lidar_reading_from_polar(
+                    lidar_reading, sr->angle_min, sr->angle_increment,
+                    lidar_reading_time_unix_milli);
+            break;
+        default:
+            LOG(ERROR) << "unknown lidar reading format: "
+                       << sr->lidar_reading_format;
+            success = false;
+    }
     if (!success) {
         throw VIAM_CARTO_LIDAR_READING_INVALID;
     }
 
+    viam::carto_facade::util::filter_by_min_intensity(
+        measurement, algo_config.min_intensity);
+    if (measurement.ranges.empty()) {
+        VLOG(1) << "all lidar returns were below the minimum intensity";
+        throw VIAM_CARTO_LIDAR_READING_EMPTY;
+    }
+
     cartographer::transform::Rigid3d tmp_global_pose;
 
-    if (map_builder_mutex.try_lock()) {
-        VLOG(1) << "AddSensorData timestamp: " << measurement.time
-                << " Sensor type: Lidar "
-                << " measurement.ranges.size(): " << measurement.ranges.size();
-        map_builder.AddSensorData(kRangeSensorId.id, measurement);
-        tmp_global_pose = map_builder.GetGlobalPose();
-        map_builder_mutex.unlock();
-        {
-            std::lock_guard<std::mutex> lk(viam_response_mutex);
-            latest_global_pose = tmp_global_pose;
+    auto map_builder_lock = LockMapBuilderForAdd();
+    VLOG(1) << "AddSensorData timestamp: " << measurement.time
+            << " Sensor type: Lidar "
+            << " measurement.ranges.size(): " << measurement.ranges.size();
+    map_builder.AddSensorData(kRangeSensorId.id, measurement);
+    tmp_global_pose = map_builder.GetGlobalPose();
+    cartographer::mapping::SubmapId submap_id{0, 0};
+    cartographer::transform::Rigid3d pose_in_submap;
+    bool has_submap =
+        algo_config.point_cloud_map_intensity &&
+        map_builder.GetPoseInLatestSubmap(submap_id, pose_in_submap);
+    map_builder_lock.unlock();
+    {
+        std::lock_guard<std::mutex> lk(viam_response_mutex);
+        latest_global_pose = tmp_global_pose;
+        if (has_submap) {
+            UpdateIntensityLayer(measurement, submap_id, pose_in_submap);
         }
-        return;
-    } else {
-        throw VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK;
     }
 };
 
+std::unique_lock<std::timed_mutex> CartoFacade::LockMapBuilderForAdd() {
+    std::unique_lock<std::timed_mutex> map_builder_lock(map_builder_mutex,
+                                                        std::defer_lock);
+    // the wait is bounded as all calls into cartographer are serialized,
+    // so every other request waits for it as well
+    bool locked = config.blocking_add
+                      ? map_builder_lock.try_lock_for(blocking_add_max_wait)
+                      : map_builder_lock.try_lock();
+    if (!locked) {
+        throw VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK;
+    }
+    return map_builder_lock;
+}
+
+// UpdateIntensityLayer expects viam_response_mutex to be held.
+void CartoFacade::UpdateIntensityLayer(
+    const cartographer::sensor::TimedPointCloudData &measurement,
+    const cartographer::mapping::SubmapId &submap_id,
+    const cartographer::transform::Rigid3d &pose_in_submap) {
+    if (measurement.intensities.empty()) {
+        return;
+    }
+    IntensityCells &cells = intensity_layer[submap_id];
+    for (size_t i = 0; i < measurement.ranges.size(); ++i) {
+        float intensity = measurement.intensities[i];
+        if (intensity < algo_config.marker_min_intensity) {
+            continue;
+        }
+        add_intensity(cells,
+                      pose_in_submap *
+                          measurement.ranges[i].position.cast<double>(),
+                      intensity);
+    }
+}
+
 void CartoFacade::AddIMUReading(const viam_carto_imu_reading *sr) {
     if (state != CartoFacadeState::STARTED) {
         LOG(ERROR) << "carto facade is in state: " << state
@@ -712,26 +1103,22 @@ void CartoFacade::AddIMUReading(const viam_carto_imu_reading *sr) {
 
     cartographer::transform::Rigid3d tmp_global_pose;
 
-    if (map_builder_mutex.try_lock()) {
-        VLOG(1) << "AddSensorData timestamp: " << measurement.time
-                << " Sensor type: IMU ";
-        map_builder.AddSensorData(kIMUSensorId.id, measurement);
-        VLOG(1) << "Data added is: (" << measurement.linear_acceleration[0]
-                << ", " << measurement.linear_acceleration[1] << ", "
-                << measurement.linear_acceleration[2] << ") and ("
-                << measurement.angular_velocity[0] << ", "
-                << measurement.angular_velocity[1] << ", "
-                << measurement.angular_velocity[2] << ")";
-        LOG(INFO) << "Added IMU data to Cartographer";
-        tmp_global_pose = map_builder.GetGlobalPose();
-        map_builder_mutex.unlock();
-        {
-            std::lock_guard<std::mutex> lk(viam_response_mutex);
-            latest_global_pose = tmp_global_pose;
-        }
-        return;
-    } else {
-        throw VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK;
+    auto map_builder_lock = LockMapBuilderForAdd();
+    VLOG(1) << "AddSensorData timestamp: " << measurement.time
+            << " Sensor type: IMU ";
+    map_builder.AddSensorData(kIMUSensorId.id, measurement);
+    VLOG(1) << "Data added is: (" << measurement.linear_acceleration[0] << ", "
+            << measurement.linear_acceleration[1] << ", "
+            << measurement.linear_acceleration[2] << ") and ("
+            << measurement.angular_velocity[0] << ", "
+            << measurement.angular_velocity[1] << ", "
+            << measurement.angular_velocity[2] << ")";
+    LOG(INFO) << "Added IMU data to Cartographer";
+    tmp_global_pose = map_builder.GetGlobalPose();
+    map_builder_lock.unlock();
+    {
+        std::lock_guard<std::mutex> lk(viam_response_mutex);
+        latest_global_pose = tmp_global_pose;
     }
 };
 
@@ -768,21 +1155,17 @@ void CartoFacade::AddOdometerReading(const viam_carto_odometer_reading *sr) {
 
     cartographer::transform::Rigid3d tmp_global_pose;
 
-    if (map_builder_mutex.try_lock()) {
-        VLOG(1) << "AddSensorData timestamp: " << measurement.time
-                << " Sensor type: Odometer ";
-        map_builder.AddSensorData(kOdometerSensorId.id, measurement);
-        VLOG(1) << "Data added is: " << measurement.pose.DebugString();
-        LOG(INFO) << "Added odometer data to Cartographer";
-        tmp_global_pose = map_builder.GetGlobalPose();
-        map_builder_mutex.unlock();
-        {
-            std::lock_guard<std::mutex> lk(viam_response_mutex);
-            latest_global_pose = tmp_global_pose;
-        }
-        return;
-    } else {
-        throw VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK;
+    auto map_builder_lock = LockMapBuilderForAdd();
+    VLOG(1) << "AddSensorData timestamp: " << measurement.time
+            << " Sensor type: Odometer ";
+    map_builder.AddSensorData(kOdometerSensorId.id, measurement);
+    VLOG(1) << "Data added is: " << measurement.pose.DebugString();
+    LOG(INFO) << "Added odometer data to Cartographer";
+    tmp_global_pose = map_builder.GetGlobalPose();
+    map_builder_lock.unlock();
+    {
+        std::lock_guard<std::mutex> lk(viam_response_mutex);
+        latest_global_pose = tmp_global_pose;
     }
 };
 
@@ -1179,6 +1562,54 @@ extern int viam_carto_get_point_cloud_map_response_destroy(
     return return_code;
 };
 
+extern int viam_carto_get_submaps(viam_carto *vc,
+                                  const viam_carto_get_submaps_request *req,
+                                  viam_carto_get_submaps_response *r) {
+    if (vc == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
+    }
+
+    if (req == nullptr || (req->known == nullptr && req->known_len != 0)) {
+        return VIAM_CARTO_GET_SUBMAPS_REQUEST_INVALID;
+    }
+
+    if (r == nullptr) {
+        return VIAM_CARTO_GET_SUBMAPS_RESPONSE_INVALID;
+    }
+    try {
+        viam::carto_facade::CartoFacade *cf =
+            static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
+        cf->GetSubmaps(req, r);
+    } catch (int err) {
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_UNKNOWN_ERROR;
+    }
+
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_get_submaps_response_destroy(
+    viam_carto_get_submaps_response *r) {
+    if (r == nullptr) {
+        return VIAM_CARTO_GET_SUBMAPS_RESPONSE_INVALID;
+    }
+    int return_code = VIAM_CARTO_SUCCESS;
+    for (int i = 0; i < r->submaps_len; i++) {
+        if (r->submaps[i].point_cloud_pcd == nullptr) {
+            continue;
+        }
+        if (bdestroy(r->submaps[i].point_cloud_pcd) != BSTR_OK) {
+            return_code = VIAM_CARTO_DESTRUCTOR_ERROR;
+        }
+    }
+    free(r->submaps);
+    r->submaps = nullptr;
+    r->submaps_len = 0;
+    return return_code;
+};
+
 extern int viam_carto_get_internal_state(
     viam_carto *vc, viam_carto_get_internal_state_response *r) {
     if (vc == nullptr) {
@@ -1217,6 +1648,54 @@ extern int viam_carto_get_internal_state_response_destroy(
     return return_code;
 };
 
+extern int viam_carto_write_point_cloud_map(viam_carto *vc,
+                                            const bstring path) {
+    if (vc == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
+    }
+
+    if (path == nullptr || blength(path) == 0) {
+        return VIAM_CARTO_EXPORT_PATH_INVALID;
+    }
+
+    try {
+        viam::carto_facade::CartoFacade *cf =
+            static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
+        cf->WritePointCloudMap(to_std_string(path));
+    } catch (int err) {
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_UNKNOWN_ERROR;
+    }
+
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_write_internal_state(viam_carto *vc,
+                                           const bstring path) {
+    if (vc == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
+    }
+
+    if (path == nullptr || blength(path) == 0) {
+        return VIAM_CARTO_EXPORT_PATH_INVALID;
+    }
+
+    try {
+        viam::carto_facade::CartoFacade *cf =
+            static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
+        cf->WriteInternalState(to_std_string(path));
+    } catch (int err) {
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_UNKNOWN_ERROR;
+    }
+
+    return VIAM_CARTO_SUCCESS;
+};
+
 extern int viam_carto_run_final_optimization(viam_carto *vc) {
     if (vc == nullptr) {
         return VIAM_CARTO_VC_INVALID;
@@ -5,10 +5,15 @@
 #ifdef __cplusplus
 #include <atomic>
 #include <chrono>
+#include <functional>
+#include <map>
+#include <memory>
+#include <ostream>
 #include <shared_mutex>
 #include <string>
 
 #include "cartographer/io/submap_painter.h"
+#include "cartographer/sensor/timed_point_cloud_data.h"
 #include "map_builder.h"
 #else
 #include <stdbool.h>
@@ -65,10 +70,61 @@ typedef struct viam_carto_get_internal_state_response {
     bstring internal_state;
 } viam_carto_get_internal_state_response;
 
+// A submap of the map
+typedef struct viam_carto_submap {
+    int trajectory_id;
+    int submap_index;
+    // version increases whenever lidar data is inserted into the submap
+    int version;
+
+    // global pose of the submap, millimeters from the origin
+    double x;
+    double y;
+    double z;
+    double real;
+    double imag;
+    double jmag;
+    double kmag;
+
+    // point_cloud_pcd holds the points of the submap in the map frame. It is
+    // NULL if the submap has the same version and pose as the known submap
+    // with the same id.
+    bstring point_cloud_pcd;
+} viam_carto_submap;
+
+typedef struct viam_carto_get_submaps_request {
+    // known are the submaps the caller already has the points of, their
+    // point_cloud_pcd is ignored
+    const viam_carto_submap *known;
+    int known_len;
+} viam_carto_get_submaps_request;
+
+typedef struct viam_carto_get_submaps_response {
+    viam_carto_submap *submaps;
+    int submaps_len;
+} viam_carto_get_submaps_response;
+
+// Encodings of viam_carto_lidar_reading.lidar_reading
+typedef enum viam_carto_LIDAR_READING_FORMAT {
+    // a PCD file
+    VIAM_CARTO_LIDAR_READING_FORMAT_PCD = 0,
+    // little endian float32 x, y, z triples in meters
+    VIAM_CARTO_LIDAR_READING_FORMAT_POINTS = 1,
+    // little endian float32 ranges in meters, the first one at angle_min,
+    // each following one angle_increment radians further
+    VIAM_CARTO_LIDAR_READING_FORMAT_POLAR = 2,
+    // little endian float32 x, y, z, intensity quadruples, x, y, z in meters
+    VIAM_CARTO_LIDAR_READING_FORMAT_POINTS_INTENSITY = 3
+} viam_carto_LIDAR_READING_FORMAT;
+
 typedef struct viam_carto_lidar_reading {
     bstring lidar;
     bstring lidar_reading;
     int64_t lidar_reading_time_unix_milli;
+    viam_carto_LIDAR_READING_FORMAT lidar_reading_format;
+    // only used by VIAM_CARTO_LIDAR_READING_FORMAT_POLAR
+    float angle_min;
+    float angle_increment;
 } viam_carto_lidar_reading;
 
 typedef enum viam_carto_LIDAR_CONFIG {
@@ -134,6 +190,11 @@ typedef struct viam_carto_odometer_reading {
 #define VIAM_CARTO_IMU_READING_EMPTY 31
 #define VIAM_CARTO_IMU_READING_INVALID 32
 #define VIAM_CARTO_ODOMETER_READING_INVALID 33
+#define VIAM_CARTO_CANCELLED 34
+#define VIAM_CARTO_GET_SUBMAPS_REQUEST_INVALID 35
+#define VIAM_CARTO_GET_SUBMAPS_RESPONSE_INVALID 36
+#define VIAM_CARTO_EXPORT_PATH_INVALID 37
+#define VIAM_CARTO_EXPORT_FILE_WRITE_IO_ERROR 38
 
 typedef struct viam_carto_algo_config {
     bool optimize_on_start;
@@ -154,6 +215,16 @@ typedef struct viam_carto_algo_config {
     double initial_trajectory_pose_x;
     double initial_trajectory_pose_y;
     double initial_trajectory_pose_theta;
+    // lidar returns with a lower intensity are dropped before they are added
+    // to cartographer, 0 disables the filter
+    float min_intensity;
+    // only lidar returns with at least this intensity are added to the
+    // intensity layer of the map, e.g. to only keep retro-reflective markers
+    float marker_min_intensity;
+    // if true, the red and green channels of the rgb field of the point cloud
+    // map hold the highest intensity observed in each cell of the intensity
+    // layer, see util::probability_with_intensity
+    bool point_cloud_map_intensity;
 
 } viam_carto_algo_config;
 
@@ -163,6 +234,18 @@ typedef struct viam_carto_config {
     viam_carto_LIDAR_CONFIG lidar_config;
     bool enable_mapping;
     bstring existing_map;
+    // blocking_add makes adding sensor readings wait for the map builder
+    // lock for up to 100ms instead of returning
+    // VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK right away.
+    bool blocking_add;
+    // cancelled may point to a flag the caller sets to non 0 while
+    // viam_carto_get_point_cloud_map, viam_carto_get_submaps,
+    // viam_carto_get_internal_state, viam_carto_write_point_cloud_map,
+    // viam_carto_write_internal_state or viam_carto_run_final_optimization
+    // is running, which then return
+    // VIAM_CARTO_CANCELLED as soon as they can. The flag must be read and
+    // written atomically and outlive the viam_carto.
+    const int *cancelled;
 } viam_carto_config;
 
 // viam_carto_lib_init/4 takes an empty viam_carto_lib pointer to pointer
@@ -223,7 +306,9 @@ extern int viam_carto_terminate(viam_carto **vc  //
 //
 // On error: Returns a non 0 error code
 //
-// An expected error is VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK(1)
+// An expected error is VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK(1). If
+// blocking_add is set in the viam_carto_config it is only returned after
+// waiting for the lock for 100ms
 //
 // On success: Returns 0, adds lidar reading to cartographer's data model
 extern int viam_carto_add_lidar_reading(viam_carto *vc,                     //
@@ -243,7 +328,9 @@ extern int viam_carto_add_lidar_reading_destroy(viam_carto_lidar_reading *sr  //
 //
 // On error: Returns a non 0 error code
 //
-// An expected error is VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK(1)
+// An expected error is VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK(1). If
+// blocking_add is set in the viam_carto_config it is only returned after
+// waiting for the lock for 100ms
 //
 // On success: Returns 0, adds IMU reading to cartographer's data model
 extern int viam_carto_add_imu_reading(viam_carto *vc,                   //
@@ -263,7 +350,9 @@ extern int viam_carto_add_imu_reading_destroy(viam_carto_imu_reading *sr  //
 //
 // On error: Returns a non 0 error code
 //
-// An expected error is VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK(1)
+// An expected error is VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK(1). If
+// blocking_add is set in the viam_carto_config it is only returned after
+// waiting for the lock for 100ms
 //
 // On success: Returns 0, adds odometer reading to cartographer's data model
 extern int viam_carto_add_odometer_reading(
@@ -341,6 +430,53 @@ extern int viam_carto_get_internal_state(
 extern int viam_carto_get_internal_state_response_destroy(
     viam_carto_get_internal_state_response *r);
 
+// viam_carto_get_submaps/3 takes a viam_carto pointer, a
+// viam_carto_get_submaps_request pointer and a
+// viam_carto_get_submaps_response pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, mutates viam_carto_get_submaps_response to contain
+// every submap of the map, with the points of the submaps which are not
+// known or changed since
+extern int viam_carto_get_submaps(
+    viam_carto *vc,                              //
+    const viam_carto_get_submaps_request *req,  //
+    viam_carto_get_submaps_response *r          // OUT
+);
+
+// viam_carto_get_submaps_response_destroy/1 takes a
+// viam_carto_get_submaps_response pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, frees the viam_carto_get_submaps_response.
+extern int viam_carto_get_submaps_response_destroy(
+    viam_carto_get_submaps_response *r  //
+);
+
+// viam_carto_write_point_cloud_map/2 takes a viam_carto pointer and the
+// path of a file
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0 & writes the pointcloud map to the file as a PCD,
+// replacing its contents, without copying the map into a response
+extern int viam_carto_write_point_cloud_map(viam_carto *vc,      //
+                                            const bstring path  //
+);
+
+// viam_carto_write_internal_state/2 takes a viam_carto pointer and the
+// path of a file
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0 & writes the internal state to the file as a
+// pbstream, replacing its contents, without holding it in memory
+extern int viam_carto_write_internal_state(viam_carto *vc,      //
+                                           const bstring path  //
+);
+
 // viam_carto_run_final_optimization/2 takes a viam_carto pointer
 //
 // On error: Returns a non 0 error code
@@ -373,11 +509,17 @@ typedef struct config {
     viam_carto_LIDAR_CONFIG lidar_config;
     bool enable_mapping;
     std::string existing_map;
+    bool blocking_add;
+    const int *cancelled;
 } config;
 
 // function to convert viam_carto_config into  viam::carto_facade::config
 config from_viam_carto_config(viam_carto_config vcc);
 
+// blocking_add_max_wait is how long adding a sensor reading waits for the
+// map builder lock in blocking add mode.
+const std::chrono::milliseconds blocking_add_max_wait(100);
+
 // Error log for when no submaps exist
 static const std::string errorNoSubmaps = "No submaps to paint";
 
@@ -391,6 +533,11 @@ carto_facade::SlamMode determine_slam_mode(std::string path_to_map,
 int slam_mode_to_vc_slam_mode(viam::carto_facade::SlamMode sm);
 
 enum class CartoFacadeState { INITIALIZED, IO_INITIALIZED, STARTED };
+
+// IntensityCells maps the cells of size resolutionMeters of a map or submap
+// to the highest intensity of the lidar returns observed in them
+using IntensityCells = std::map<std::pair<int64_t, int64_t>, float>;
+
 class CartoFacade {
    public:
     CartoFacade(viam_carto_lib *pVCL, const viam_carto_config c,
@@ -421,6 +568,23 @@ class CartoFacade {
     // maximumGRPCByteChunkSize
     void GetInternalState(viam_carto_get_internal_state_response *r);
 
+    // GetSubmaps returns every submap of the map and the sampled pointcloud
+    // of each submap which is not known to the caller or changed since. In
+    // localizing mode the submaps of the trajectory localizing in the map are
+    // left out, as they are not part of the map.
+    void GetSubmaps(const viam_carto_get_submaps_request *req,
+                    viam_carto_get_submaps_response *r);
+
+    // WritePointCloudMap writes the current sampled pointcloud map to the
+    // file at path, streaming the sampled points instead of building the map
+    // in memory first. While optimizing or localizing the cached map is
+    // written.
+    void WritePointCloudMap(const std::string &path);
+
+    // WriteInternalState writes the current internal state of the map, which
+    // is a pbstream for cartographer, to the file at path
+    void WriteInternalState(const std::string &path);
+
     void AddLidarReading(const viam_carto_lidar_reading *sr);
 
     void AddIMUReading(const viam_carto_imu_reading *sr);
@@ -434,9 +598,50 @@ class CartoFacade {
     // non api methods
     void CacheLatestMap();
     void CacheMapInLocalizationMode();
-    void GetLatestSampledPointCloudMapString(std::string &pointcloud);
+    void GetLatestSampledPointCloudMapString(std::string &pointcloud,
+                                             bool cancellable = false);
+    // LatestPointCloudMap returns the latest sampled pointcloud map, or the
+    // cached one while optimizing or localizing
+    std::string LatestPointCloudMap();
     void RunFinalOptimization();
-    cartographer::io::PaintSubmapSlicesResult GetLatestPaintedMapSlices();
+    // PaintLatestMap paints all submaps like GetLatestPaintedMapSlices, or
+    // returns nullptr if there are no submaps yet
+    std::unique_ptr<cartographer::io::PaintSubmapSlicesResult> PaintLatestMap(
+        std::map<cartographer::mapping::SubmapId,
+                 cartographer::transform::Rigid3d> &submap_poses,
+        bool cancellable = false);
+    // GetLatestPaintedMapSlices paints all submaps and sets submap_poses to
+    // the optimized poses they were painted at
+    cartographer::io::PaintSubmapSlicesResult GetLatestPaintedMapSlices(
+        std::map<cartographer::mapping::SubmapId,
+                 cartographer::transform::Rigid3d> &submap_poses,
+        bool cancellable = false);
+    // SampledPointCloudString samples the painted slices into a pcd, packing
+    // the intensity of each cell into its rgb field
+    std::string SampledPointCloudString(
+        cartographer::io::PaintSubmapSlicesResult &painted_slices,
+        const IntensityCells &intensities, bool cancellable = false);
+    // WriteSampledPointCloud writes the pcd of SampledPointCloudString to
+    // out one point at a time
+    void WriteSampledPointCloud(
+        cartographer::io::PaintSubmapSlicesResult &painted_slices,
+        const IntensityCells &intensities, std::ostream &out,
+        bool cancellable = false);
+    // ForEachSampledPoint calls add_point with the position in meters and
+    // the probability, with the intensity of its cell packed in, of each
+    // point sampled from the painted slices
+    void ForEachSampledPoint(
+        cartographer::io::PaintSubmapSlicesResult &painted_slices,
+        const IntensityCells &intensities, bool cancellable,
+        const std::function<void(float, float, int)> &add_point);
+    // IntensityLayer returns the intensity layer of the submaps placed at
+    // the given poses, or no cells if the point cloud map has no intensity
+    IntensityCells IntensityLayer(
+        const std::map<cartographer::mapping::SubmapId,
+                       cartographer::transform::Rigid3d> &submap_poses);
+    // ThrowIfCancelled throws VIAM_CARTO_CANCELLED if the caller cancelled
+    // the running call
+    void ThrowIfCancelled();
     viam_carto_lib *lib;
     viam::carto_facade::config config;
     viam_carto_algo_config algo_config;
@@ -449,7 +654,7 @@ class CartoFacade {
     // concurrently, then optimization_shared_mutex must be taken
     // before map_builder_mutex. No other mutexes are expected to
     // be held concurrently.
-    std::mutex map_builder_mutex;
+    std::timed_mutex map_builder_mutex;
     MapBuilder map_builder;
 
    private:
@@ -466,6 +671,19 @@ class CartoFacade {
     // optimized map. It is only updated right before the optimization is
     // started.
     std::string latest_pointcloud_map;
+    // The intensity_layer holds the intensity cells of each submap in the
+    // frame of the submap, so that the layer follows the submaps when
+    // optimization moves them. It is guarded by viam_response_mutex.
+    std::map<cartographer::mapping::SubmapId, IntensityCells> intensity_layer;
+    void UpdateIntensityLayer(
+        const cartographer::sensor::TimedPointCloudData &measurement,
+        const cartographer::mapping::SubmapId &submap_id,
+        const cartographer::transform::Rigid3d &pose_in_submap);
+    // LockMapBuilderForAdd locks map_builder_mutex to add a sensor reading.
+    // In blocking add mode it waits up to blocking_add_max_wait for the
+    // lock, otherwise not at all. It throws
+    // VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK if the lock could not be taken.
+    std::unique_lock<std::timed_mutex> LockMapBuilderForAdd();
     // ---
 };
 }  // namespace carto_facade
@@ -39,6 +39,8 @@ viam_carto_config viam_carto_config_setup(viam_carto_LIDAR_CONFIG lidar_config,
     vcc.movement_sensor = bfromcstr(movement_sensor.c_str());
     vcc.enable_mapping = enable_mapping;
     vcc.existing_map = bfromcstr(existing_map.c_str());
+    vcc.blocking_add = false;
+    vcc.cancelled = nullptr;
     return vcc;
 }
 
@@ -50,7 +52,7 @@ void viam_carto_config_teardown(viam_carto_config vcc) {
 viam_carto_lidar_reading new_test_lidar_reading(
     std::string lidar, std::string pcd_path,
     int64_t lidar_reading_time_unix_milli) {
-    viam_carto_lidar_reading sr;
+    viam_carto_lidar_reading sr = {};
     sr.lidar = bfromcstr(lidar.c_str());
     std::string pcd = help::read_file(pcd_path);
     sr.lidar_reading = blk2bstr(pcd.c_str(), pcd.length());
@@ -136,6 +138,9 @@ viam_carto_algo_config viam_carto_algo_config_setup(bool use_imu_data) {
     ac.initial_trajectory_pose_x = 0;
     ac.initial_trajectory_pose_y = 0;
     ac.initial_trajectory_pose_theta = 0;
+    ac.min_intensity = 0;
+    ac.marker_min_intensity = 0;
+    ac.point_cloud_map_intensity = false;
     return ac;
 }
 
@@ -596,7 +601,7 @@ BOOST_AUTO_TEST_CASE(CartoFacade_demo_without_movement_sensor) {
 
     // empty lidar reading
     {
-        viam_carto_lidar_reading sr;
+        viam_carto_lidar_reading sr = {};
         sr.lidar = bfromcstr("lidar");
         std::string pcd = "empty lidar reading";
         // passing 0 as the second parameter makes the string empty
@@ -611,7 +616,7 @@ BOOST_AUTO_TEST_CASE(CartoFacade_demo_without_movement_sensor) {
 
     // invalid lidar reading
     {
-        viam_carto_lidar_reading sr;
+        viam_carto_lidar_reading sr = {};
         sr.lidar = bfromcstr("lidar");
         std::string pcd = "invalid lidar reading";
         sr.lidar_reading = blk2bstr(pcd.c_str(), pcd.length());
@@ -623,6 +628,20 @@ BOOST_AUTO_TEST_CASE(CartoFacade_demo_without_movement_sensor) {
                    VIAM_CARTO_SUCCESS);
     }
 
+    // lidar reading with unknown format
+    {
+        std::string pcd_path =
+            ".artifact/data/viam-cartographer/mock_lidar/0.pcd";
+        viam_carto_lidar_reading sr =
+            new_test_lidar_reading("lidar", pcd_path, 1687900029557335);
+        sr.lidar_reading_format =
+            static_cast<viam_carto_LIDAR_READING_FORMAT>(100);
+        BOOST_TEST(viam_carto_add_lidar_reading(vc, &sr) ==
+                   VIAM_CARTO_LIDAR_READING_INVALID);
+        BOOST_TEST(viam_carto_add_lidar_reading_destroy(&sr) ==
+                   VIAM_CARTO_SUCCESS);
+    }
+
     // unable to aquire lock on lidar
     {
         std::string pcd_path =
@@ -631,7 +650,7 @@ BOOST_AUTO_TEST_CASE(CartoFacade_demo_without_movement_sensor) {
             new_test_lidar_reading("lidar", pcd_path, 1687900053773475);
         viam::carto_facade::CartoFacade *cf =
             static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
-        std::lock_guard<std::mutex> lk(cf->map_builder_mutex);
+        std::lock_guard<std::timed_mutex> lk(cf->map_builder_mutex);
         BOOST_TEST(viam_carto_add_lidar_reading(vc, &sr) ==
                    VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK);
         BOOST_TEST(viam_carto_add_lidar_reading_destroy(&sr) ==
@@ -766,6 +785,48 @@ BOOST_AUTO_TEST_CASE(CartoFacade_demo_without_movement_sensor) {
                    VIAM_CARTO_SUCCESS);
     }
 
+    // GetSubmaps after 2 successful sensor readings
+    {
+        BOOST_TEST(viam_carto_get_submaps_response_destroy(nullptr) ==
+                   VIAM_CARTO_GET_SUBMAPS_RESPONSE_INVALID);
+        viam_carto_get_submaps_request req = {nullptr, 0};
+        BOOST_TEST(viam_carto_get_submaps(nullptr, &req, nullptr) ==
+                   VIAM_CARTO_VC_INVALID);
+        BOOST_TEST(viam_carto_get_submaps(vc, nullptr, nullptr) ==
+                   VIAM_CARTO_GET_SUBMAPS_REQUEST_INVALID);
+        BOOST_TEST(viam_carto_get_submaps(vc, &req, nullptr) ==
+                   VIAM_CARTO_GET_SUBMAPS_RESPONSE_INVALID);
+
+        // without known submaps every submap has points
+        viam_carto_get_submaps_response sr;
+        BOOST_TEST(viam_carto_get_submaps(vc, &req, &sr) ==
+                   VIAM_CARTO_SUCCESS);
+        BOOST_TEST(sr.submaps_len > 0);
+        for (int i = 0; i < sr.submaps_len; i++) {
+            BOOST_TEST(sr.submaps[i].point_cloud_pcd != nullptr);
+            pcl::PCLPointCloud2 blob;
+            auto s = to_std_string(sr.submaps[i].point_cloud_pcd);
+            BOOST_TEST(viam::carto_facade::util::read_pcd(s, blob) == 0);
+        }
+
+        // known submaps which did not change have no points
+        viam_carto_get_submaps_request known_req = {sr.submaps,
+                                                    sr.submaps_len};
+        viam_carto_get_submaps_response unchanged;
+        BOOST_TEST(viam_carto_get_submaps(vc, &known_req, &unchanged) ==
+                   VIAM_CARTO_SUCCESS);
+        BOOST_TEST(unchanged.submaps_len == sr.submaps_len);
+        for (int i = 0; i < unchanged.submaps_len; i++) {
+            BOOST_TEST(unchanged.submaps[i].point_cloud_pcd == nullptr);
+        }
+
+        BOOST_TEST(viam_carto_get_submaps_response_destroy(&unchanged) ==
+                   VIAM_CARTO_SUCCESS);
+        BOOST_TEST(viam_carto_get_submaps_response_destroy(&sr) ==
+                   VIAM_CARTO_SUCCESS);
+        BOOST_TEST(sr.submaps == nullptr);
+    }
+
     // GetInternalState after 2 successful sensor readings
     {
         viam_carto_get_internal_state_response isr;
@@ -781,6 +842,52 @@ BOOST_AUTO_TEST_CASE(CartoFacade_demo_without_movement_sensor) {
                    VIAM_CARTO_SUCCESS);
     }
 
+    // WritePointCloudMap & WriteInternalState after 2 successful sensor
+    // readings
+    {
+        BOOST_TEST(viam_carto_write_point_cloud_map(vc, nullptr) ==
+                   VIAM_CARTO_EXPORT_PATH_INVALID);
+        BOOST_TEST(viam_carto_write_internal_state(vc, nullptr) ==
+                   VIAM_CARTO_EXPORT_PATH_INVALID);
+
+        fs::path export_dir =
+            fs::temp_directory_path() / fs::path(bfs::unique_path().string());
+        fs::create_directory(export_dir);
+
+        auto pcd_file = export_dir / fs::path("map.pcd");
+        bstring pcd_path = bfromcstr(pcd_file.string().c_str());
+        BOOST_TEST(viam_carto_write_point_cloud_map(vc, pcd_path) ==
+                   VIAM_CARTO_SUCCESS);
+        BOOST_TEST(bdestroy(pcd_path) == BSTR_OK);
+        pcl::PCLPointCloud2 blob;
+        std::string pcd = help::read_file(pcd_file.string());
+        BOOST_TEST(viam::carto_facade::util::read_pcd(pcd, blob) == 0);
+
+        // the streamed map holds the same points as the map in memory
+        viam_carto_get_point_cloud_map_response mr;
+        BOOST_TEST(viam_carto_get_point_cloud_map(vc, &mr) ==
+                   VIAM_CARTO_SUCCESS);
+        BOOST_TEST(pcd == to_std_string(mr.point_cloud_pcd));
+        BOOST_TEST(viam_carto_get_point_cloud_map_response_destroy(&mr) ==
+                   VIAM_CARTO_SUCCESS);
+
+        auto pbstream_file = export_dir / fs::path("internal_state.pbstream");
+        bstring pbstream_path = bfromcstr(pbstream_file.string().c_str());
+        BOOST_TEST(viam_carto_write_internal_state(vc, pbstream_path) ==
+                   VIAM_CARTO_SUCCESS);
+        BOOST_TEST(bdestroy(pbstream_path) == BSTR_OK);
+        BOOST_TEST(fs::file_size(pbstream_file) > 0);
+
+        // the directory does not exist
+        auto missing_file = export_dir / fs::path("missing") / fs::path("x");
+        bstring missing_path = bfromcstr(missing_file.string().c_str());
+        BOOST_TEST(viam_carto_write_point_cloud_map(vc, missing_path) ==
+                   VIAM_CARTO_EXPORT_FILE_WRITE_IO_ERROR);
+        BOOST_TEST(bdestroy(missing_path) == BSTR_OK);
+
+        fs::remove_all(export_dir);
+    }
+
     // third sensor reading
     {
         std::string pcd_path =
@@ -889,7 +996,69 @@ BOOST_AUTO_TEST_CASE(CartoFacade_config_without_movement_sensor) {
     BOOST_TEST(c.camera == "lidar");
     BOOST_TEST(c.movement_sensor == "");
     BOOST_TEST(c.enable_mapping == true);
+    BOOST_TEST(c.blocking_add == false);
+    BOOST_TEST(c.cancelled == nullptr);
+
+    viam_carto_config_teardown(vcc);
 
+    // library terminate
+    BOOST_TEST(viam_carto_lib_terminate(&lib) == VIAM_CARTO_SUCCESS);
+}
+
+BOOST_AUTO_TEST_CASE(CartoFacade_cancelled) {
+    // library init
+    viam_carto_lib *lib;
+    BOOST_TEST(viam_carto_lib_init(&lib, 0, 1) == VIAM_CARTO_SUCCESS);
+
+    // Setup
+    viam_carto *vc;
+    int cancelled = 0;
+    std::string camera = "lidar";
+    std::string movement_sensor = "";
+    struct viam_carto_config vcc = viam_carto_config_setup(
+        VIAM_CARTO_THREE_D, camera, movement_sensor, true, "");
+    vcc.cancelled = &cancelled;
+    struct viam_carto_algo_config ac = viam_carto_algo_config_setup(false);
+
+    BOOST_TEST(viam_carto_init(&vc, lib, vcc, ac) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(viam_carto_start(vc) == VIAM_CARTO_SUCCESS);
+
+    // long running calls return early once cancelled
+    __atomic_store_n(&cancelled, 1, __ATOMIC_RELEASE);
+    {
+        viam_carto_get_point_cloud_map_response mr;
+        BOOST_TEST(viam_carto_get_point_cloud_map(vc, &mr) ==
+                   VIAM_CARTO_CANCELLED);
+    }
+    {
+        viam_carto_get_internal_state_response isr;
+        BOOST_TEST(viam_carto_get_internal_state(vc, &isr) ==
+                   VIAM_CARTO_CANCELLED);
+    }
+    BOOST_TEST(viam_carto_run_final_optimization(vc) == VIAM_CARTO_CANCELLED);
+
+    // other calls are not affected
+    {
+        viam_carto_get_position_response pr;
+        BOOST_TEST(viam_carto_get_position(vc, &pr) ==
+                   VIAM_CARTO_GET_POSITION_NOT_INITIALIZED);
+    }
+
+    // calls succeed again once the flag is cleared
+    __atomic_store_n(&cancelled, 0, __ATOMIC_RELEASE);
+    {
+        viam_carto_get_internal_state_response isr;
+        BOOST_TEST(viam_carto_get_internal_state(vc, &isr) ==
+                   VIAM_CARTO_SUCCESS);
+        BOOST_TEST(viam_carto_get_internal_state_response_destroy(&isr) ==
+                   VIAM_CARTO_SUCCESS);
+    }
+
+    // Stop
+    BOOST_TEST(viam_carto_stop(vc) == VIAM_CARTO_SUCCESS);
+
+    // Terminate
+    BOOST_TEST(viam_carto_terminate(&vc) == VIAM_CARTO_SUCCESS);
     viam_carto_config_teardown(vcc);
 
     // library terminate
@@ -1079,7 +1248,7 @@ BOOST_AUTO_TEST_CASE(CartoFacade_demo_with_movement_sensor) {
 
     // empty lidar reading
     {
-        viam_carto_lidar_reading sr;
+        viam_carto_lidar_reading sr = {};
         sr.lidar = bfromcstr("lidar");
         std::string pcd = "empty lidar reading";
         // passing 0 as the second parameter makes the string empty
@@ -1094,7 +1263,7 @@ BOOST_AUTO_TEST_CASE(CartoFacade_demo_with_movement_sensor) {
 
     // invalid lidar reading
     {
-        viam_carto_lidar_reading sr;
+        viam_carto_lidar_reading sr = {};
         sr.lidar = bfromcstr("lidar");
         std::string pcd = "invalid lidar reading";
         sr.lidar_reading = blk2bstr(pcd.c_str(), pcd.length());
@@ -1115,7 +1284,7 @@ BOOST_AUTO_TEST_CASE(CartoFacade_demo_with_movement_sensor) {
             new_test_lidar_reading("lidar", pcd_path, 1687900053773475);
         viam::carto_facade::CartoFacade *cf =
             static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
-        std::lock_guard<std::mutex> lk(cf->map_builder_mutex);
+        std::lock_guard<std::timed_mutex> lk(cf->map_builder_mutex);
         BOOST_TEST(viam_carto_add_lidar_reading(vc, &sr) ==
                    VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK);
         BOOST_TEST(viam_carto_add_lidar_reading_destroy(&sr) ==
@@ -1164,7 +1333,7 @@ BOOST_AUTO_TEST_CASE(CartoFacade_demo_with_movement_sensor) {
             new_test_imu_reading("movement_sensor", reading, 1687900053773475);
         viam::carto_facade::CartoFacade *cf =
             static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
-        std::lock_guard<std::mutex> lk(cf->map_builder_mutex);
+        std::lock_guard<std::timed_mutex> lk(cf->map_builder_mutex);
         BOOST_TEST(viam_carto_add_imu_reading(vc, &sr) ==
                    VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK);
         BOOST_TEST(viam_carto_add_imu_reading_destroy(&sr) ==
@@ -1214,7 +1383,7 @@ BOOST_AUTO_TEST_CASE(CartoFacade_demo_with_movement_sensor) {
             "movement_sensor", reading, 1687900053773475);
         viam::carto_facade::CartoFacade *cf =
             static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
-        std::lock_guard<std::mutex> lk(cf->map_builder_mutex);
+        std::lock_guard<std::timed_mutex> lk(cf->map_builder_mutex);
         BOOST_TEST(viam_carto_add_odometer_reading(vc, &sr) ==
                    VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK);
         BOOST_TEST(viam_carto_add_odometer_reading_destroy(&sr) ==
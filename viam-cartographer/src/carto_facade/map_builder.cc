@@ -149,6 +149,27 @@ cartographer::transform::Rigid3d MapBuilder::GetGlobalPose() {
     }
 }
 
+bool MapBuilder::GetPoseInLatestSubmap(
+    cartographer::mapping::SubmapId &submap_id,
+    cartographer::transform::Rigid3d &pose_in_submap) {
+    bool found = false;
+    cartographer::transform::Rigid3d submap_local_pose;
+    auto submaps = map_builder_->pose_graph()->GetAllSubmapData();
+    for (const auto &&submap : submaps.trajectory(trajectory_id)) {
+        submap_id = submap.id;
+        submap_local_pose = submap.data.submap->local_pose();
+        found = true;
+    }
+    if (!found) {
+        return false;
+    }
+    {
+        std::lock_guard<std::mutex> lk(local_slam_result_pose_mutex);
+        pose_in_submap = submap_local_pose.inverse() * local_slam_result_pose;
+    }
+    return true;
+}
+
 void MapBuilder::OverwriteOptimizeEveryNNodes(int value) {
     auto mutable_pose_graph_options =
         map_builder_options_.mutable_pose_graph_options();
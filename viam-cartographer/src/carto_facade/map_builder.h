@@ -55,6 +55,14 @@ class MapBuilder {
     // GetGlobalPose returns the local pose based on the provided a local pose.
     cartographer::transform::Rigid3d GetGlobalPose();
 
+    // GetPoseInLatestSubmap sets submap_id to the latest submap of the
+    // trajectory and pose_in_submap to the latest local pose relative to it,
+    // which stays valid when optimization moves the submap. Returns false if
+    // the trajectory has no submaps yet.
+    bool GetPoseInLatestSubmap(
+        cartographer::mapping::SubmapId &submap_id,
+        cartographer::transform::Rigid3d &pose_in_submap);
+
     // AddSensorData adds sensor data to cartographer's internal state.
     // Throws if adding sensor data fails.
     void AddSensorData(const std::string &sensor_id,
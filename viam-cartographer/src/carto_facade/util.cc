@@ -4,7 +4,10 @@
 #include <pcl/io/pcd_io.h>     // pcl::PCDReader
 #include <pcl/point_types.h>
 
+#include <algorithm>
 #include <boost/format.hpp>
+#include <cmath>
+#include <cstring>  // std::memcpy
 #include <sstream>  // std::istringstream
 
 namespace viam {
@@ -68,6 +71,11 @@ void write_int_to_buffer_in_bytes(std::string &buffer, int d) {
     }
 }
 
+int probability_with_intensity(int probability, float intensity) {
+    int packed = std::lround(std::clamp(intensity, 0.0f, 65535.0f));
+    return probability | packed << 8;
+}
+
 // based on pcl::PCDReader::read
 // https://pointclouds.org/documentation/classpcl_1_1_p_c_d_reader.html#ac9451748db653fd0901a0c4b6b750552
 // Doesn't implemented binary_compressed yet
@@ -176,9 +184,10 @@ std::tuple<bool, cartographer::sensor::TimedPointCloudData> carto_lidar_reading(
         return {false, point_cloud};
     }
     VLOG(1) << "read_pcd succeeded";
-    pcl::PointCloud<pcl::PointXYZ>::Ptr cloud(
-        new pcl::PointCloud<pcl::PointXYZ>);
+    pcl::PointCloud<pcl::PointXYZI>::Ptr cloud(
+        new pcl::PointCloud<pcl::PointXYZI>);
     pcl::fromPCLPointCloud2(blob, *cloud);
+    bool has_intensity = pcl::getFieldIndex(blob, "intensity") != -1;
 
     VLOG(1) << "Loaded " << cloud->width * cloud->height << " data points";
 
@@ -191,6 +200,9 @@ std::tuple<bool, cartographer::sensor::TimedPointCloudData> carto_lidar_reading(
         timed_rangefinder_point.time = 0 - i * 0.0001;
 
         ranges.push_back(timed_rangefinder_point);
+        if (has_intensity) {
+            point_cloud.intensities.push_back(cloud->points[i].intensity);
+        }
     }
 
     point_cloud.time =
@@ -201,6 +213,123 @@ std::tuple<bool, cartographer::sensor::TimedPointCloudData> carto_lidar_reading(
 
     return {true, point_cloud};
 }
+
+// read_float reads the little endian float32 at the given offset.
+// NOTE: This assumes a little endian platform, which is true of
+// every platform we build for.
+float read_float(const std::string &buffer, std::size_t offset) {
+    float f;
+    std::memcpy(&f, buffer.data() + offset, sizeof(float));
+    return f;
+}
+
+cartographer::sensor::TimedPointCloudData to_timed_point_cloud_data(
+    const std::vector<Eigen::Vector3f> &points,
+    const std::vector<float> &intensities,
+    int64_t lidar_reading_time_unix_milli) {
+    cartographer::sensor::TimedPointCloudData point_cloud;
+    cartographer::sensor::TimedPointCloud ranges;
+    ranges.reserve(points.size());
+    for (size_t i = 0; i < points.size(); ++i) {
+        cartographer::sensor::TimedRangefinderPoint timed_rangefinder_point;
+        timed_rangefinder_point.position = points[i];
+        // NOTE: This makes it so that each point has a time that is unique
+        // within that measurement
+        timed_rangefinder_point.time = 0 - i * 0.0001;
+        ranges.push_back(timed_rangefinder_point);
+    }
+
+    point_cloud.time =
+        cartographer::common::FromUniversal(0) +
+        cartographer::common::FromMilliseconds(lidar_reading_time_unix_milli);
+    point_cloud.origin = Eigen::Vector3f::Zero();
+    point_cloud.ranges = ranges;
+    point_cloud.intensities = intensities;
+    return point_cloud;
+}
+
+std::tuple<bool, cartographer::sensor::TimedPointCloudData>
+carto_lidar_reading_from_points(std::string lidar_reading,
+                                int64_t lidar_reading_time_unix_milli,
+                                bool has_intensity) {
+    const std::size_t point_size = (has_intensity ? 4 : 3) * sizeof(float);
+    if (lidar_reading.length() == 0 ||
+        lidar_reading.length() % point_size != 0) {
+        LOG(ERROR) << "points lidar reading has invalid length: "
+                   << lidar_reading.length();
+        return {false, cartographer::sensor::TimedPointCloudData{}};
+    }
+
+    std::vector<Eigen::Vector3f> points;
+    std::vector<float> intensities;
+    points.reserve(lidar_reading.length() / point_size);
+    for (std::size_t offset = 0; offset < lidar_reading.length();
+         offset += point_size) {
+        float x = read_float(lidar_reading, offset);
+        float y = read_float(lidar_reading, offset + sizeof(float));
+        float z = read_float(lidar_reading, offset + 2 * sizeof(float));
+        points.emplace_back(x, y, z);
+        if (has_intensity) {
+            intensities.push_back(
+                read_float(lidar_reading, offset + 3 * sizeof(float)));
+        }
+    }
+    VLOG(1) << "Loaded " << points.size() << " data points";
+    return {true, to_timed_point_cloud_data(points, intensities,
+                                            lidar_reading_time_unix_milli)};
+}
+
+std::tuple<bool, cartographer::sensor::TimedPointCloudData>
+carto_lidar_reading_from_polar(std::string lidar_reading, float angle_min,
+                               float angle_increment,
+                               int64_t lidar_reading_time_unix_milli) {
+    if (lidar_reading.length() == 0 ||
+        lidar_reading.length() % sizeof(float) != 0) {
+        LOG(ERROR) << "polar lidar reading has invalid length: "
+                   << lidar_reading.length();
+        return {false, cartographer::sensor::TimedPointCloudData{}};
+    }
+
+    std::vector<Eigen::Vector3f> points;
+    points.reserve(lidar_reading.length() / sizeof(float));
+    for (std::size_t i = 0; i < lidar_reading.length() / sizeof(float); ++i) {
+        float range = read_float(lidar_reading, i * sizeof(float));
+        if (!std::isfinite(range) || range <= 0) {
+            continue;
+        }
+        float angle = angle_min + i * angle_increment;
+        points.emplace_back(range * std::cos(angle), range * std::sin(angle),
+                            0);
+    }
+    if (points.empty()) {
+        LOG(ERROR) << "polar lidar reading has no valid ranges";
+        return {false, cartographer::sensor::TimedPointCloudData{}};
+    }
+    VLOG(1) << "Loaded " << points.size() << " data points";
+    return {true, to_timed_point_cloud_data(points, {},
+                                            lidar_reading_time_unix_milli)};
+}
+
+void filter_by_min_intensity(
+    cartographer::sensor::TimedPointCloudData &point_cloud,
+    float min_intensity) {
+    if (min_intensity <= 0 || point_cloud.intensities.empty()) {
+        return;
+    }
+    cartographer::sensor::TimedPointCloud ranges;
+    std::vector<float> intensities;
+    for (size_t i = 0; i < point_cloud.ranges.size(); ++i) {
+        if (point_cloud.intensities[i] >= min_intensity) {
+            ranges.push_back(point_cloud.ranges[i]);
+            intensities.push_back(point_cloud.intensities[i]);
+        }
+    }
+    VLOG(1) << "intensity filter dropped "
+            << point_cloud.ranges.size() - ranges.size() << " of "
+            << point_cloud.ranges.size() << " returns";
+    point_cloud.ranges = ranges;
+    point_cloud.intensities = intensities;
+}
 }  // namespace util
 }  // namespace carto_facade
 }  // namespace viam
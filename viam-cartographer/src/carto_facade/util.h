@@ -49,8 +49,37 @@ void write_float_to_buffer_in_bytes(std::string &buffer, float f);
 
 void write_int_to_buffer_in_bytes(std::string &buffer, int d);
 
+// probability_with_intensity packs an intensity into the rgb field of a map
+// point next to its probability. The intensity is rounded to a 16 bit integer
+// held in the red (high byte) and green (low byte) channels, while the blue
+// channel keeps the probability, so that readers which only expect a
+// probability, like the RDK pointcloud package, can still read the map.
+int probability_with_intensity(int probability, float intensity);
+
 std::tuple<bool, cartographer::sensor::TimedPointCloudData> carto_lidar_reading(
     std::string lidar_reading, int64_t lidar_reading_time_unix_milli);
+
+// carto_lidar_reading_from_points converts packed little endian float32
+// x, y, z triples in meters, each followed by an intensity if has_intensity
+// is true, into a cartographer point cloud
+std::tuple<bool, cartographer::sensor::TimedPointCloudData>
+carto_lidar_reading_from_points(std::string lidar_reading,
+                                int64_t lidar_reading_time_unix_milli,
+                                bool has_intensity = false);
+
+// filter_by_min_intensity drops the returns with an intensity below
+// min_intensity. Point clouds without intensities are left unchanged.
+void filter_by_min_intensity(
+    cartographer::sensor::TimedPointCloudData &point_cloud,
+    float min_intensity);
+
+// carto_lidar_reading_from_polar converts packed little endian float32
+// ranges in meters into a cartographer point cloud. Ranges which are not
+// positive & finite are treated as missing returns and skipped.
+std::tuple<bool, cartographer::sensor::TimedPointCloudData>
+carto_lidar_reading_from_polar(std::string lidar_reading, float angle_min,
+                               float angle_increment,
+                               int64_t lidar_reading_time_unix_milli);
 int read_pcd(std::string pcd, pcl::PCLPointCloud2 &blob);
 }  // namespace util
 }  // namespace carto_facade
@@ -3,9 +3,11 @@
 #include <boost/filesystem.hpp>
 #include <boost/filesystem/fstream.hpp>
 #include <boost/test/unit_test.hpp>
+#include <cmath>
 #include <cstdio>
 #include <exception>
 #include <iostream>
+#include <limits>
 #include <string>
 
 #include "test_helpers.h"
@@ -163,6 +165,139 @@ BOOST_AUTO_TEST_CASE(carto_lidar_reading_ascii_success) {
                cartographer::common::FromUniversal(-1920816663374754544));
 }
 
+BOOST_AUTO_TEST_CASE(carto_lidar_reading_from_points_invalid_length_failure) {
+    auto [empty_success, _] =
+        carto_lidar_reading_from_points("", 16409988000001121);
+    BOOST_TEST(!empty_success);
+
+    std::string buffer;
+    write_float_to_buffer_in_bytes(buffer, 0.582);
+    write_float_to_buffer_in_bytes(buffer, 0.012);
+    auto [partial_success, __] =
+        carto_lidar_reading_from_points(buffer, 16409988000001121);
+    BOOST_TEST(!partial_success);
+}
+
+BOOST_AUTO_TEST_CASE(carto_lidar_reading_from_points_success) {
+    std::vector<std::vector<double>> points = {{-0.001000, 0.002000, 0.005000},
+                                               {0.582000, 0.012000, 0.000000},
+                                               {0.007000, 0.006000, 0.001000}};
+    std::string buffer;
+    for (auto point : points) {
+        for (auto coordinate : point) {
+            write_float_to_buffer_in_bytes(buffer, coordinate);
+        }
+    }
+
+    auto [success, timed_pcd] =
+        carto_lidar_reading_from_points(buffer, 16409988000001121);
+    BOOST_TEST(success);
+    BOOST_TEST(timed_pcd.ranges.size() == points.size());
+    help::timed_pcd_contains(timed_pcd, points);
+    BOOST_TEST(timed_pcd.origin == Eigen::Vector3f::Zero());
+    BOOST_TEST(timed_pcd.time ==
+               cartographer::common::FromUniversal(-1920816663374754544));
+}
+
+BOOST_AUTO_TEST_CASE(carto_lidar_reading_from_points_with_intensity_success) {
+    std::vector<std::vector<double>> points = {{-0.001000, 0.002000, 0.005000},
+                                               {0.582000, 0.012000, 0.000000}};
+    std::vector<float> intensities = {12, 250};
+    std::string buffer;
+    for (int i = 0; i < points.size(); i++) {
+        for (auto coordinate : points.at(i)) {
+            write_float_to_buffer_in_bytes(buffer, coordinate);
+        }
+        write_float_to_buffer_in_bytes(buffer, intensities.at(i));
+    }
+
+    auto [success, timed_pcd] =
+        carto_lidar_reading_from_points(buffer, 16409988000001121, true);
+    BOOST_TEST(success);
+    BOOST_TEST(timed_pcd.ranges.size() == points.size());
+    help::timed_pcd_contains(timed_pcd, points);
+    BOOST_TEST(timed_pcd.intensities == intensities);
+
+    // a reading without intensities is rejected if they are expected
+    auto [partial_success, _] = carto_lidar_reading_from_points(
+        buffer.substr(0, 12), 16409988000001121, true);
+    BOOST_TEST(!partial_success);
+}
+
+BOOST_AUTO_TEST_CASE(filter_by_min_intensity_success) {
+    std::string buffer;
+    std::vector<std::vector<float>> points = {
+        {1, 0, 0, 5}, {2, 0, 0, 100}, {3, 0, 0, 50}};
+    for (auto point : points) {
+        for (auto value : point) {
+            write_float_to_buffer_in_bytes(buffer, value);
+        }
+    }
+    auto [success, timed_pcd] =
+        carto_lidar_reading_from_points(buffer, 16409988000001121, true);
+    BOOST_TEST(success);
+
+    // a threshold of 0 disables the filter
+    filter_by_min_intensity(timed_pcd, 0);
+    BOOST_TEST(timed_pcd.ranges.size() == 3);
+
+    filter_by_min_intensity(timed_pcd, 50);
+    BOOST_TEST(timed_pcd.ranges.size() == 2);
+    BOOST_TEST(timed_pcd.intensities == std::vector<float>({100, 50}));
+    BOOST_TEST(timed_pcd.ranges.at(0).position.x() == 2);
+    BOOST_TEST(timed_pcd.ranges.at(1).position.x() == 3);
+
+    // point clouds without intensities are not filtered
+    auto [no_intensity_success, no_intensity_pcd] =
+        carto_lidar_reading_from_points(buffer, 16409988000001121);
+    BOOST_TEST(no_intensity_success);
+    filter_by_min_intensity(no_intensity_pcd, 50);
+    BOOST_TEST(no_intensity_pcd.ranges.size() == 4);
+}
+
+BOOST_AUTO_TEST_CASE(probability_with_intensity_success) {
+    BOOST_TEST(probability_with_intensity(50, 0) == 50);
+    BOOST_TEST(probability_with_intensity(50, 300.4) == (50 | 300 << 8));
+    // intensities are clamped to 16 bits
+    BOOST_TEST(probability_with_intensity(100, 1e6) == (100 | 65535 << 8));
+    BOOST_TEST(probability_with_intensity(100, -5) == 100);
+}
+
+BOOST_AUTO_TEST_CASE(carto_lidar_reading_from_polar_no_valid_ranges_failure) {
+    auto [empty_success, _] =
+        carto_lidar_reading_from_polar("", 0, 0.1, 16409988000001121);
+    BOOST_TEST(!empty_success);
+
+    std::string buffer;
+    write_float_to_buffer_in_bytes(buffer, 0);
+    write_float_to_buffer_in_bytes(buffer,
+                                   std::numeric_limits<float>::infinity());
+    auto [invalid_success, __] =
+        carto_lidar_reading_from_polar(buffer, 0, 0.1, 16409988000001121);
+    BOOST_TEST(!invalid_success);
+}
+
+BOOST_AUTO_TEST_CASE(carto_lidar_reading_from_polar_success) {
+    std::string buffer;
+    write_float_to_buffer_in_bytes(buffer, 1);
+    write_float_to_buffer_in_bytes(buffer, 0);
+    write_float_to_buffer_in_bytes(buffer, 2);
+
+    auto [success, timed_pcd] = carto_lidar_reading_from_polar(
+        buffer, 0, M_PI / 2, 16409988000001121);
+    BOOST_TEST(success);
+    // the missing return at index 1 is skipped
+    BOOST_TEST(timed_pcd.ranges.size() == 2);
+    std::vector<Eigen::Vector3f> points = {{1, 0, 0}, {-2, 0, 0}};
+    for (int i = 0; i < points.size(); i++) {
+        BOOST_TEST((timed_pcd.ranges.at(i).position - points.at(i)).norm() <
+                   1e-5);
+    }
+    BOOST_TEST(timed_pcd.origin == Eigen::Vector3f::Zero());
+    BOOST_TEST(timed_pcd.time ==
+               cartographer::common::FromUniversal(-1920816663374754544));
+}
+
 BOOST_AUTO_TEST_SUITE_END()
 
 }  // namespace util
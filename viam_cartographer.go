@@ -5,6 +5,8 @@ package viamcartographer
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -16,6 +18,7 @@ import (
 	"github.com/golang/geo/r3"
 	"github.com/pkg/errors"
 	"go.opencensus.io/trace"
+	"go.uber.org/multierr"
 	"go.uber.org/zap/zapcore"
 	viamgrpc "go.viam.com/rdk/grpc"
 	"go.viam.com/rdk/logging"
@@ -25,6 +28,7 @@ import (
 
 	"github.com/viamrobotics/viam-cartographer/cartofacade"
 	vcConfig "github.com/viamrobotics/viam-cartographer/config"
+	"github.com/viamrobotics/viam-cartographer/mapupdates"
 	"github.com/viamrobotics/viam-cartographer/postprocess"
 	"github.com/viamrobotics/viam-cartographer/sensorprocess"
 	s "github.com/viamrobotics/viam-cartographer/sensors"
@@ -44,6 +48,28 @@ var (
 	ErrBadPostprocessingPointsFormat = errors.New("invalid postprocessing points format")
 	// ErrBadPostprocessingPointsFormat denotest that the postprocesing points have not been correctly provided.
 	ErrBadPostprocessingPath = errors.New("could not parse path to pcd")
+	// ErrJobStatusInOnlineMode denotes that the job status was requested while mapping in online mode.
+	ErrJobStatusInOnlineMode = errors.New("job status is only available in offline mode")
+	// ErrCancelJobInOnlineMode denotes that cancelling the job was requested while mapping in online mode.
+	ErrCancelJobInOnlineMode = errors.New("cancel job is only available in offline mode")
+	// ErrNoRunningJob denotes that cancelling the job was requested after the job ended.
+	ErrNoRunningJob = errors.New("there is no running job to cancel")
+	// ErrIngestStatsInOfflineMode denotes that the ingest stats were requested while mapping in offline mode.
+	ErrIngestStatsInOfflineMode = errors.New("ingest stats are only available in online mode")
+	// ErrSchedulingStatsInOfflineMode denotes that the scheduling stats were requested while mapping in offline mode.
+	ErrSchedulingStatsInOfflineMode = errors.New("scheduling stats are only available in online mode")
+	// ErrSensorHealthInOfflineMode denotes that the sensor health was requested while mapping in offline mode.
+	ErrSensorHealthInOfflineMode = errors.New("sensor health is only available in online mode")
+	// ErrMotionGateNotEnabled denotes that the motion gate stats were requested without skipping stationary scans.
+	ErrMotionGateNotEnabled = errors.New("motion gate stats are only available with config_params[skip_stationary_scans] set to true")
+	// ErrMapRendererNotEnabled denotes that the map is not rendered in the background.
+	ErrMapRendererNotEnabled = errors.New("rendering the map in the background is only available in online mode with " +
+		"config_params[map_render_interval_sec] or config_params[map_render_node_threshold] set")
+	// ErrIMUSampleStatsNotAvailable denotes that the IMU sample stats were requested without a movement sensor
+	// component which supports an IMU.
+	ErrIMUSampleStatsNotAvailable = errors.New("IMU sample stats are only available for a movement sensor component which supports an IMU")
+	// ErrBadMapChangesSinceFormat denotes that the revision of the map changes has not been correctly provided.
+	ErrBadMapChangesSinceFormat = errors.New("invalid map changes since format")
 	// startPosRegex contains the regex formula for extracting the optional initial_starting_pose values from the config.
 	startPosRegex = regexp.MustCompile(`X:(\d+(?:\.\d+)?),\s*Y:(\d+(?:\.\d+)?),\s*Theta:(\d+(?:\.\d+)?)`)
 )
@@ -55,10 +81,51 @@ const (
 	defaultCartoFacadeTimeout            = 5 * time.Minute
 	defaultCartoFacadeInternalTimeout    = 15 * time.Minute
 	chunkSizeBytes                       = 1 * 1024 * 1024
+	exportFilePattern                    = "viam-cartographer-export-*"
 	internalStateFileType                = ".pbstream"
 
 	// JobDoneCommand is the string that needs to be sent to DoCommand to find out if the job has finished.
 	JobDoneCommand = "job_done"
+	// JobStatusCommand is the string that needs to be sent to DoCommand to get the progress of an offline job.
+	JobStatusCommand = "job_status"
+	// PauseMappingCommand is the string that needs to be sent to DoCommand to pause adding sensor readings.
+	PauseMappingCommand = "pause_mapping"
+	// ResumeMappingCommand is the string that needs to be sent to DoCommand to resume adding sensor readings.
+	ResumeMappingCommand = "resume_mapping"
+	// CancelJobCommand is the string that needs to be sent to DoCommand to stop an offline job before it finished.
+	CancelJobCommand = "cancel_job"
+	// IngestStatsCommand is the string that needs to be sent to DoCommand to get the counters of the ingest queue.
+	IngestStatsCommand = "ingest_stats"
+	// SchedulingStatsCommand is the string that needs to be sent to DoCommand to get the missed deadlines and
+	// jitter of polling the sensors.
+	SchedulingStatsCommand = "scheduling_stats"
+	// SensorHealthCommand is the string that needs to be sent to DoCommand to get the health of the sensors.
+	SensorHealthCommand = "sensor_health"
+	// MotionGateStatsCommand is the string that needs to be sent to DoCommand to get the lidar readings skipped
+	// while the robot was stationary.
+	MotionGateStatsCommand = "motion_gate_stats"
+	// TimestampAnomaliesCommand is the string that needs to be sent to DoCommand to get the counts of sensor
+	// readings which went back in time or had skewed reading times.
+	TimestampAnomaliesCommand = "timestamp_anomalies"
+	// CartographerHealthCommand is the string that needs to be sent to DoCommand to get whether cartographer is
+	// running and how often it was restarted after hanging or failing.
+	CartographerHealthCommand = "cartographer_health"
+	// CartoFacadeQueueStatsCommand is the string that needs to be sent to DoCommand to get the queue latencies of
+	// the requests into cartographer of each priority class.
+	CartoFacadeQueueStatsCommand = "cartofacade_queue_stats"
+	// MapRenderStatusCommand is the string that needs to be sent to DoCommand to get the generation and render
+	// time of the map served by PointCloudMap when the map is rendered in the background.
+	MapRenderStatusCommand = "map_render_status"
+	// RenderMapCommand is the string that needs to be sent to DoCommand to render the map served by PointCloudMap
+	// now instead of waiting for the next background render. The response holds the rendered map as a base64 PCD
+	// together with its generation and render time, as PointCloudMap may already serve a later render.
+	RenderMapCommand = "render_map"
+	// IMUSampleStatsCommand is the string that needs to be sent to DoCommand to get how many IMU samples were
+	// synchronized from the sampled channels of the movement sensor, interpolated or dropped.
+	IMUSampleStatsCommand = "imu_sample_stats"
+	// MapChangesSinceCommand is the string that needs to be sent to DoCommand to get the points of the submaps
+	// added or changed since a revision of the map, and the submaps removed since. Postprocessing is not applied.
+	MapChangesSinceCommand = mapupdates.Command
 	// SuccessMessage is sent back after a successful DoCommand request.
 	SuccessMessage = "success"
 	// PostprocessToggleResponseKey is the key sent back for the toggle postprocess command.
@@ -136,17 +203,50 @@ func TerminateCartoLib() error {
 
 func initSensorProcesses(cancelCtx context.Context, cartoSvc *CartographerService) {
 	spConfig := sensorprocess.Config{
-		CartoFacade:     cartoSvc.cartofacade,
-		IsOnline:        cartoSvc.lidar.DataFrequencyHz() != 0,
-		Lidar:           cartoSvc.lidar,
-		MovementSensor:  cartoSvc.movementSensor,
-		Timeout:         cartoSvc.cartoFacadeTimeout,
-		InternalTimeout: cartoSvc.cartoFacadeInternalTimeout,
-		Logger:          cartoSvc.logger,
+		CartoFacade:      cartoSvc.cartofacade,
+		IsOnline:         cartoSvc.lidar.DataFrequencyHz() != 0,
+		Lidar:            cartoSvc.lidar,
+		MovementSensor:   cartoSvc.movementSensor,
+		LidarAccumulator: sensorprocess.NewLidarAccumulator(cartoSvc.lidarAccumulation),
+		Recorder:         cartoSvc.recorder,
+		Gate:             cartoSvc.ingestGate,
+		MotionGate:       cartoSvc.motionGate,
+		MapRenderer:      cartoSvc.mapRenderer,
+		Timeout:          cartoSvc.cartoFacadeTimeout,
+		InternalTimeout:  cartoSvc.cartoFacadeInternalTimeout,
+		Logger:           cartoSvc.logger,
+	}
+	cartoSvc.timestampValidator = sensorprocess.NewTimestampValidator(cartoSvc.maxClockSkew, spConfig.IsOnline)
+	spConfig.TimestampValidator = cartoSvc.timestampValidator
+
+	if cartoSvc.mapRenderer != nil {
+		cartoSvc.mapRenderer.Start(cancelCtx, &cartoSvc.sensorProcessWorkers)
 	}
 
 	if spConfig.IsOnline {
-		// online mode is parallelized
+		// online mode is parallelized, with a queue between the sensor processes and the cartofacade
+		cartoSvc.ingestQueue = sensorprocess.NewIngestQueue(cartoSvc.ingestQueueConfig)
+		spConfig.IngestQueue = cartoSvc.ingestQueue
+		cartoSvc.lidarScheduler = sensorprocess.NewScheduler(cartoSvc.lidar.DataFrequencyHz())
+		spConfig.LidarScheduler = cartoSvc.lidarScheduler
+		cartoSvc.lidarHealth = sensorprocess.NewSensorHealth()
+		spConfig.LidarHealth = cartoSvc.lidarHealth
+		if spConfig.MovementSensor != nil && spConfig.MovementSensor.DataFrequencyHz() > 0 {
+			cartoSvc.movementSensorScheduler = sensorprocess.NewScheduler(spConfig.MovementSensor.DataFrequencyHz())
+			spConfig.MovementSensorScheduler = cartoSvc.movementSensorScheduler
+		}
+		if spConfig.MovementSensor != nil {
+			cartoSvc.movementSensorHealth = sensorprocess.NewSensorHealth()
+			spConfig.MovementSensorHealth = cartoSvc.movementSensorHealth
+			cartoSvc.movementSensorOutage = sensorprocess.NewMovementSensorOutage(cartoSvc.movementSensorOutageTimeout)
+			spConfig.MovementSensorOutage = cartoSvc.movementSensorOutage
+		}
+		cartoSvc.sensorProcessWorkers.Add(1)
+		go func() {
+			defer cartoSvc.sensorProcessWorkers.Done()
+			spConfig.StartIngest(cancelCtx)
+		}()
+
 		cartoSvc.sensorProcessWorkers.Add(1)
 		go func() {
 			defer cartoSvc.sensorProcessWorkers.Done()
@@ -154,6 +254,11 @@ func initSensorProcesses(cancelCtx context.Context, cartoSvc *CartographerServic
 		}()
 
 		if spConfig.MovementSensor != nil {
+			// sample the channels of a movement sensor component in the background
+			if ms, ok := spConfig.MovementSensor.(*s.MovementSensor); ok {
+				ms.Start(cancelCtx, cartoSvc.movementSensorSampleFreqHz, &cartoSvc.sensorProcessWorkers)
+			}
+
 			cartoSvc.sensorProcessWorkers.Add(1)
 			go func() {
 				defer cartoSvc.sensorProcessWorkers.Done()
@@ -162,6 +267,12 @@ func initSensorProcesses(cancelCtx context.Context, cartoSvc *CartographerServic
 		}
 	} else {
 		// offline mode is sequential
+		cartoSvc.jobProgress = sensorprocess.NewJobProgress()
+		spConfig.Progress = cartoSvc.jobProgress
+		if cartoSvc.trajectoryFile != "" {
+			cartoSvc.trajectory = sensorprocess.NewTrajectory(cartoSvc.trajectoryFile)
+			spConfig.Trajectory = cartoSvc.trajectory
+		}
 		cartoSvc.sensorProcessWorkers.Add(1)
 		go func() {
 			defer cartoSvc.sensorProcessWorkers.Done()
@@ -214,7 +325,16 @@ func New(
 
 	// Get the lidar for the Dim2D cartographer sub algorithm
 	lidarName := svcConfig.Camera["name"]
-	timedLidar, err := s.NewLidar(ctx, deps, lidarName, optionalConfigParams.LidarDataFrequencyHz, logger)
+	var timedLidar s.TimedLidar
+	switch {
+	case optionalConfigParams.LidarDatasetDir != "":
+		timedLidar, err = s.NewLocalDatasetLidar(lidarName, optionalConfigParams.LidarDatasetDir, logger)
+	case optionalConfigParams.LidarCaptureDir != "":
+		timedLidar, err = s.NewCaptureDatasetLidar(lidarName, optionalConfigParams.LidarCaptureDir, logger)
+	default:
+		timedLidar, err = s.NewLidar(ctx, deps, lidarName, optionalConfigParams.LidarDataFrequencyHz,
+			optionalConfigParams.LidarReadingFormat, logger)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -233,8 +353,20 @@ func New(
 			return nil, errors.New("In online mode, but movement sensor data frequency is zero")
 		}
 
-		if timedMovementSensor, err = s.NewMovementSensor(ctx, deps, movementSensorName,
-			optionalConfigParams.MovementSensorDataFrequencyHz, logger); err != nil {
+		if optionalConfigParams.MovementSensorDatasetDir != "" {
+			if timedMovementSensor, err = s.NewLocalDatasetMovementSensor(movementSensorName,
+				optionalConfigParams.MovementSensorDatasetDir); err != nil {
+				return nil, err
+			}
+		} else if optionalConfigParams.MovementSensorCaptureDir != "" {
+			if timedMovementSensor, err = s.NewCaptureDatasetMovementSensor(movementSensorName,
+				optionalConfigParams.MovementSensorCaptureDir, optionalConfigParams.MovementSensorReadingTimeTolerance,
+				logger); err != nil {
+				return nil, err
+			}
+		} else if timedMovementSensor, err = s.NewMovementSensor(ctx, deps, movementSensorName,
+			optionalConfigParams.MovementSensorDataFrequencyHz, optionalConfigParams.MovementSensorReadingTimeTolerance,
+			optionalConfigParams.GenericMovementSensorConfig, logger); err != nil {
 			return nil, err
 		}
 	}
@@ -263,8 +395,41 @@ func New(
 		logger:                     logger,
 		cartoFacadeTimeout:         cartoFacadeTimeout,
 		cartoFacadeInternalTimeout: cartoFacadeInternalTimeout,
-		enableMapping:              optionalConfigParams.EnableMapping,
-		existingMap:                optionalConfigParams.ExistingMap,
+		ingestGate:                 sensorprocess.NewIngestGate(),
+		ingestQueueConfig: sensorprocess.IngestQueueConfig{
+			Capacity:      optionalConfigParams.IngestQueueSize,
+			DropPolicy:    sensorprocess.DropPolicy(optionalConfigParams.IngestDropPolicy),
+			ReorderWindow: optionalConfigParams.IngestReorderWindow,
+		},
+		maxClockSkew:                optionalConfigParams.MaxClockSkew,
+		movementSensorOutageTimeout: optionalConfigParams.MovementSensorOutageTimeout,
+		movementSensorSampleFreqHz:  optionalConfigParams.MovementSensorSampleFrequencyHz,
+		trajectoryFile:              optionalConfigParams.TrajectoryFile,
+		enableMapping:               optionalConfigParams.EnableMapping,
+		existingMap:                 optionalConfigParams.ExistingMap,
+		lidarAccumulation: sensorprocess.LidarAccumulationConfig{
+			NumScans:          optionalConfigParams.LidarAccumulateScans,
+			UntilFullCoverage: optionalConfigParams.LidarAccumulateUntilFullCoverage,
+		},
+		motionGate: sensorprocess.NewMotionGate(sensorprocess.MotionGateConfig{
+			Enabled:                  optionalConfigParams.SkipStationaryScans,
+			TranslationMm:            optionalConfigParams.StationaryTranslationMm,
+			RotationDeg:              optionalConfigParams.StationaryRotationDeg,
+			AngularVelocityDegPerSec: optionalConfigParams.StationaryAngularVelocityDegPerSec,
+			ScanChangeMm:             optionalConfigParams.StationaryScanChangeMm,
+			Keepalive:                optionalConfigParams.StationaryKeepalive,
+		}),
+		watchdogConfig: cartofacade.WatchdogConfig{
+			MaxConsecutiveFailures: optionalConfigParams.MaxConsecutiveCartoFailures,
+			SnapshotInterval:       optionalConfigParams.InternalStateSnapshotInterval,
+			InternalTimeout:        cartoFacadeInternalTimeout,
+		},
+		mapRendererConfig: cartofacade.MapRendererConfig{
+			Interval:        optionalConfigParams.MapRenderInterval,
+			NodeThreshold:   optionalConfigParams.MapRenderNodeThreshold,
+			InternalTimeout: cartoFacadeInternalTimeout,
+		},
+		mapUpdates: mapupdates.NewTracker(),
 	}
 
 	defer func() {
@@ -303,6 +468,17 @@ func New(
 		}, nil
 	}
 
+	if optionalConfigParams.RecordDir != "" {
+		cartoSvc.recorder, err = sensorprocess.NewRecorder(sensorprocess.RecorderConfig{
+			Dir:               optionalConfigParams.RecordDir,
+			MaxFileSizeBytes:  optionalConfigParams.RecordMaxFileSizeBytes,
+			MaxTotalSizeBytes: optionalConfigParams.RecordMaxTotalSizeBytes,
+		}, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if err = initCartoFacade(cancelCartoFacadeCtx, cartoSvc); err != nil {
 		return nil, err
 	}
@@ -452,8 +628,38 @@ func parseCartoAlgoConfig(configParams map[string]string, logger logging.Logger)
 			} else {
 				return cartoAlgoCfg, errors.Errorf("initial_starting_pose needs to be in format 'X:<val>, Y:<val>, Theta:<val>, but received %v", val)
 			}
+		case "min_intensity":
+			cartoAlgoCfg.MinIntensity, err = parseFloat32OrDefault(val, defaultCartoAlgoCfg.MinIntensity)
+			if err != nil {
+				return cartoAlgoCfg, err
+			}
+		case "marker_min_intensity":
+			cartoAlgoCfg.MarkerMinIntensity, err = parseFloat32OrDefault(val, defaultCartoAlgoCfg.MarkerMinIntensity)
+			if err != nil {
+				return cartoAlgoCfg, err
+			}
+		case "point_cloud_map_intensity":
+			cartoAlgoCfg.PointCloudMapIntensity, err = strconv.ParseBool(val)
+			if err != nil {
+				return cartoAlgoCfg, err
+			}
 			// ignore mode as it is a special case
 		case "mode":
+		// recording is configured by the config package
+		case "record_dir", "record_max_file_size_mb", "record_max_total_size_mb":
+		// the ingest queue is configured by the config package
+		case "ingest_queue_size", "ingest_drop_policy", "ingest_reorder_window_msec":
+		// validating reading times is configured by the config package
+		case "max_clock_skew_msec":
+		// the trajectory of localizing in offline mode is configured by the config package
+		case "trajectory_file":
+		// skipping stationary scans is configured by the config package
+		case "skip_stationary_scans", "stationary_translation_mm", "stationary_rotation_deg",
+			"stationary_angular_velocity_deg_per_sec", "stationary_scan_change_mm", "stationary_keepalive_sec":
+		// restarting cartographer is configured by the config package
+		case "max_consecutive_cartographer_failures", "internal_state_snapshot_interval_sec":
+		// rendering the map in the background is configured by the config package
+		case "map_render_interval_sec", "map_render_node_threshold":
 		default:
 			logger.Warnf("unused config param: %s: %s", k, val)
 		}
@@ -494,10 +700,12 @@ func initCartoFacade(ctx context.Context, cartoSvc *CartographerService) error {
 		LidarConfig:    cartofacade.TwoD,
 		EnableMapping:  cartoSvc.enableMapping,
 		ExistingMap:    cartoSvc.existingMap,
+		// in offline mode every reading is added, so wait for cartographer to be unlocked before retrying
+		BlockingAdd: cartoSvc.lidar.DataFrequencyHz() == 0,
 	}
 
-	cf := cartofacade.New(&cartoLib, cartoCfg, cartoAlgoConfig)
-	slamMode, err := cf.Initialize(ctx, cartoSvc.cartoFacadeTimeout, &cartoSvc.cartoFacadeWorkers)
+	cf := cartofacade.NewWatchdog(&cartoLib, cartoCfg, cartoAlgoConfig, cartoSvc.watchdogConfig, cartoSvc.logger)
+	_, err = cf.Initialize(ctx, cartoSvc.cartoFacadeTimeout, &cartoSvc.cartoFacadeWorkers)
 	if err != nil {
 		cartoSvc.logger.Errorw("cartofacade initialize failed", "error", err)
 		return err
@@ -514,8 +722,12 @@ func initCartoFacade(ctx context.Context, cartoSvc *CartographerService) error {
 		return err
 	}
 
-	cartoSvc.cartofacade = &cf
-	cartoSvc.SlamMode = slamMode
+	cartoSvc.cartofacade = cf
+	cartoSvc.watchdog = cf
+	// offline jobs add every reading as fast as they can, so the map is only rendered on demand
+	if cartoSvc.mapRendererConfig.Enabled() && cartoSvc.lidar.DataFrequencyHz() != 0 {
+		cartoSvc.mapRenderer = cartofacade.NewMapRenderer(cf, cartoSvc.mapRendererConfig, cartoSvc.logger)
+	}
 
 	return nil
 }
@@ -544,18 +756,48 @@ type CartographerService struct {
 	resource.Named
 	resource.AlwaysRebuild
 	mu             sync.Mutex
-	SlamMode       cartofacade.SlamMode
 	closed         bool
 	lidar          s.TimedLidar
 	movementSensor s.TimedMovementSensor
 	subAlgo        SubAlgo
 
+	lidarAccumulation sensorprocess.LidarAccumulationConfig
+	motionGate        *sensorprocess.MotionGate
+	recorder          *sensorprocess.Recorder
+	jobProgress       *sensorprocess.JobProgress
+	trajectoryFile    string
+	trajectory        *sensorprocess.Trajectory
+	ingestGate        *sensorprocess.IngestGate
+	ingestQueueConfig sensorprocess.IngestQueueConfig
+	ingestQueue       *sensorprocess.IngestQueue
+	// lidarScheduler and movementSensorScheduler are only set in online mode
+	lidarScheduler          *sensorprocess.Scheduler
+	movementSensorScheduler *sensorprocess.Scheduler
+	lidarHealth             *sensorprocess.SensorHealth
+	movementSensorHealth    *sensorprocess.SensorHealth
+	movementSensorOutage    *sensorprocess.MovementSensorOutage
+
+	movementSensorOutageTimeout time.Duration
+	movementSensorSampleFreqHz  float64
+	maxClockSkew                time.Duration
+	timestampValidator          *sensorprocess.TimestampValidator
+
 	configParams map[string]string
 
 	cartofacade                cartofacade.Interface
+	watchdog                   *cartofacade.Watchdog
+	watchdogConfig             cartofacade.WatchdogConfig
+	mapRenderer                *cartofacade.MapRenderer
+	mapRendererConfig          cartofacade.MapRendererConfig
 	cartoFacadeTimeout         time.Duration
 	cartoFacadeInternalTimeout time.Duration
 
+	// mapUpdatesMu serializes fetching the submaps, so that knownSubmaps matches the submaps of mapUpdates
+	mapUpdatesMu sync.Mutex
+	// knownSubmaps are the submaps of the latest revision of mapUpdates, without their points
+	knownSubmaps []cartofacade.Submap
+	mapUpdates   *mapupdates.Tracker
+
 	cancelSensorProcessFunc func()
 	cancelCartoFacadeFunc   func()
 	logger                  logging.Logger
@@ -623,26 +865,82 @@ func (cartoSvc *CartographerService) PointCloudMap(ctx context.Context, returnEd
 		return toChunkedFunc(*cartoSvc.postprocessedPointCloud), nil
 	}
 
-	pc, err := cartoSvc.cartofacade.PointCloudMap(ctx, cartoSvc.cartoFacadeInternalTimeout)
+	// a map rendered on demand without postprocessing is streamed to a file by cartographer and served from it,
+	// so it is never held in memory. A map rendered in the background is already held in memory by the map
+	// renderer and served without another copy, and postprocessing needs the whole map in memory to update it.
+	if cartoSvc.mapRenderer == nil && !cartoSvc.postprocessed.Load() {
+		return cartoSvc.exportToChunkedFunc(ctx, cartoSvc.cartofacade.WritePointCloudMap)
+	}
+
+	pc, err := cartoSvc.pointCloudMap(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if pc, err = cartoSvc.postprocessPointCloudMap(pc); err != nil {
+		return nil, err
+	}
+	return toChunkedFunc(pc), nil
+}
 
-	if cartoSvc.postprocessed.Load() {
-		var updatedPc []byte
-		err = postprocess.UpdatePointCloud(pc, &updatedPc, cartoSvc.postprocessingTasks)
-		if err != nil {
+// postprocessPointCloudMap applies the postprocessing tasks to a map if postprocessing is toggled on.
+func (cartoSvc *CartographerService) postprocessPointCloudMap(pc []byte) ([]byte, error) {
+	if !cartoSvc.postprocessed.Load() {
+		return pc, nil
+	}
+	var updatedPc []byte
+	if err := postprocess.UpdatePointCloud(pc, &updatedPc, cartoSvc.postprocessingTasks); err != nil {
+		return nil, err
+	}
+	return updatedPc, nil
+}
+
+// pointCloudMap returns the map cached by the map renderer, rendering it first if none was rendered yet.
+// Without a map renderer the map is rendered on demand.
+func (cartoSvc *CartographerService) pointCloudMap(ctx context.Context) ([]byte, error) {
+	if cartoSvc.mapRenderer == nil {
+		return cartoSvc.cartofacade.PointCloudMap(ctx, cartoSvc.cartoFacadeInternalTimeout)
+	}
+	rendered, ok := cartoSvc.mapRenderer.Latest()
+	if !ok {
+		var err error
+		if rendered, err = cartoSvc.mapRenderer.Render(ctx); err != nil {
 			return nil, err
 		}
+	}
+	return rendered.PointCloud, nil
+}
+
+// mapChangesSince fetches the submaps changed since the previous fetch and returns the update from the
+// given revision of the epoch.
+func (cartoSvc *CartographerService) mapChangesSince(
+	ctx context.Context,
+	revision uint64,
+	epoch string,
+) (mapupdates.Update, error) {
+	cartoSvc.mapUpdatesMu.Lock()
+	defer cartoSvc.mapUpdatesMu.Unlock()
 
-		return toChunkedFunc(updatedPc), nil
+	submaps, err := cartoSvc.cartofacade.Submaps(ctx, cartoSvc.cartoFacadeInternalTimeout, cartoSvc.knownSubmaps)
+	if err != nil {
+		return mapupdates.Update{}, err
 	}
 
-	return toChunkedFunc(pc), nil
+	changes := make([]mapupdates.Submap, 0, len(submaps))
+	known := make([]cartofacade.Submap, 0, len(submaps))
+	for _, submap := range submaps {
+		id := mapupdates.SubmapID{TrajectoryID: submap.TrajectoryID, SubmapIndex: submap.SubmapIndex}
+		changes = append(changes, mapupdates.Submap{ID: id, PointCloud: submap.PointCloud})
+		submap.PointCloud = nil
+		known = append(known, submap)
+	}
+	cartoSvc.mapUpdates.Update(changes)
+	cartoSvc.knownSubmaps = known
+
+	return cartoSvc.mapUpdates.Since(revision, epoch), nil
 }
 
-// InternalState creates a request, calls the slam algorithms InternalState endpoint and returns a callback
-// function which will return the next chunk of the current internal state of the slam algo.
+// InternalState creates a request, has the slam algo write its current internal state to a file and returns a
+// callback function which will return the next chunk of the file.
 func (cartoSvc *CartographerService) InternalState(ctx context.Context) (func() ([]byte, error), error) {
 	ctx, span := trace.StartSpan(ctx, "viamcartographer::CartographerService::InternalState")
 	defer span.End()
@@ -651,12 +949,29 @@ func (cartoSvc *CartographerService) InternalState(ctx context.Context) (func()
 		return nil, err
 	}
 
-	is, err := cartoSvc.cartofacade.InternalState(ctx, cartoSvc.cartoFacadeInternalTimeout)
+	return cartoSvc.exportToChunkedFunc(ctx, cartoSvc.cartofacade.WriteInternalState)
+}
+
+// exportToChunkedFunc has cartographer write an export to a temporary file and returns a callback function
+// which will return the next chunk of the file, so that the export is never held in memory in full.
+func (cartoSvc *CartographerService) exportToChunkedFunc(
+	ctx context.Context,
+	write func(ctx context.Context, timeout time.Duration, path string) error,
+) (func() ([]byte, error), error) {
+	f, err := os.CreateTemp("", exportFilePattern)
 	if err != nil {
 		return nil, err
 	}
+	path := f.Name()
+	if err := f.Close(); err != nil {
+		return nil, multierr.Combine(err, os.Remove(path))
+	}
+
+	if err := write(ctx, cartoSvc.cartoFacadeInternalTimeout, path); err != nil {
+		return nil, multierr.Combine(err, os.Remove(path))
+	}
 
-	return toChunkedFunc(is), nil
+	return toChunkedFileFunc(path)
 }
 
 func toChunkedFunc(b []byte) func() ([]byte, error) {
@@ -674,6 +989,40 @@ func toChunkedFunc(b []byte) func() ([]byte, error) {
 	return f
 }
 
+// toChunkedFileFunc returns a callback function which will return the next chunk of the file at path, and
+// removes the file. The file is closed once it was read to the end or reading it failed, and by the garbage
+// collector if the callback is abandoned before.
+func toChunkedFileFunc(path string) (func() ([]byte, error), error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, multierr.Combine(err, os.Remove(path))
+	}
+	// the open file can still be read after it is removed, and is deleted once it is closed
+	if err := os.Remove(path); err != nil {
+		return nil, multierr.Combine(err, file.Close())
+	}
+
+	chunk := make([]byte, chunkSizeBytes)
+	var readErr error
+
+	f := func() ([]byte, error) {
+		if readErr != nil {
+			return nil, readErr
+		}
+		bytesRead, err := file.Read(chunk)
+		if err != nil {
+			readErr = err
+			// failing to close the file does not fail a complete read
+			if closeErr := file.Close(); closeErr != nil && !errors.Is(err, io.EOF) {
+				readErr = multierr.Combine(err, closeErr)
+			}
+			return nil, readErr
+		}
+		return chunk[:bytesRead], nil
+	}
+	return f, nil
+}
+
 // Properties returns information regarding the current SLAM session including the mapping mode and
 // is the session is being run in the cloud.
 func (cartoSvc *CartographerService) Properties(ctx context.Context) (slam.Properties, error) {
@@ -696,6 +1045,9 @@ func (cartoSvc *CartographerService) Properties(ctx context.Context) (slam.Prope
 	}
 
 	switch {
+	// a mapping session restarted from its own internal state updates it from then on
+	case cartoSvc.enableMapping && cartoSvc.SlamMode() == cartofacade.UpdatingMode:
+		props.MappingMode = slam.MappingModeUpdateExistingMap
 	case cartoSvc.enableMapping && cartoSvc.existingMap == "":
 		props.MappingMode = slam.MappingModeNewMap
 	case cartoSvc.enableMapping && cartoSvc.existingMap != "":
@@ -709,6 +1061,15 @@ func (cartoSvc *CartographerService) Properties(ctx context.Context) (slam.Prope
 	return props, nil
 }
 
+// SlamMode returns the mode of the current cartographer instance, which may have changed since it was
+// initialized if cartographer was restarted. Cloud SLAM does not run cartographer and returns UnknownMode.
+func (cartoSvc *CartographerService) SlamMode() cartofacade.SlamMode {
+	if cartoSvc.watchdog == nil {
+		return cartofacade.UnknownMode
+	}
+	return cartoSvc.watchdog.Status().SlamMode
+}
+
 // DoCommand receives arbitrary commands.
 func (cartoSvc *CartographerService) DoCommand(ctx context.Context, req map[string]interface{}) (map[string]interface{}, error) {
 	_, span := trace.StartSpan(ctx, "viamcartographer::CartographerService::DoCommand")
@@ -722,6 +1083,147 @@ func (cartoSvc *CartographerService) DoCommand(ctx context.Context, req map[stri
 		return map[string]interface{}{JobDoneCommand: cartoSvc.jobDone.Load()}, nil
 	}
 
+	if _, ok := req[JobStatusCommand]; ok {
+		if cartoSvc.jobProgress == nil {
+			return nil, ErrJobStatusInOnlineMode
+		}
+		resp := jobStatusResponse(cartoSvc.jobProgress.Status())
+		resp["paused"] = cartoSvc.ingestGate.Paused()
+		if cartoSvc.trajectory != nil {
+			resp["trajectory_file"] = cartoSvc.trajectory.Path()
+			resp["trajectory_poses"] = float64(len(cartoSvc.trajectory.Poses()))
+		}
+		return map[string]interface{}{JobStatusCommand: resp}, nil
+	}
+
+	if _, ok := req[IngestStatsCommand]; ok {
+		if cartoSvc.ingestQueue == nil {
+			return nil, ErrIngestStatsInOfflineMode
+		}
+		return map[string]interface{}{IngestStatsCommand: ingestStatsResponse(cartoSvc.ingestQueue.Stats())}, nil
+	}
+
+	if _, ok := req[SchedulingStatsCommand]; ok {
+		if cartoSvc.lidarScheduler == nil {
+			return nil, ErrSchedulingStatsInOfflineMode
+		}
+		resp := map[string]interface{}{"lidar": schedulerStatsResponse(cartoSvc.lidarScheduler.Stats())}
+		if cartoSvc.movementSensorScheduler != nil {
+			resp["movement_sensor"] = schedulerStatsResponse(cartoSvc.movementSensorScheduler.Stats())
+		}
+		return map[string]interface{}{SchedulingStatsCommand: resp}, nil
+	}
+
+	if _, ok := req[SensorHealthCommand]; ok {
+		if cartoSvc.lidarHealth == nil {
+			return nil, ErrSensorHealthInOfflineMode
+		}
+		resp := map[string]interface{}{"lidar": sensorHealthResponse(cartoSvc.lidarHealth.Status())}
+		if cartoSvc.movementSensorHealth != nil {
+			movementSensorResp := sensorHealthResponse(cartoSvc.movementSensorHealth.Status())
+			outage := cartoSvc.movementSensorOutage.Status()
+			movementSensorResp["out"] = outage.Out
+			movementSensorResp["neutral_readings"] = float64(outage.NeutralReadings)
+			if outage.Out {
+				movementSensorResp["out_since"] = outage.Since.UTC().Format(time.RFC3339Nano)
+			}
+			resp["movement_sensor"] = movementSensorResp
+		}
+		return map[string]interface{}{SensorHealthCommand: resp}, nil
+	}
+
+	if _, ok := req[MotionGateStatsCommand]; ok {
+		if cartoSvc.motionGate == nil {
+			return nil, ErrMotionGateNotEnabled
+		}
+		return map[string]interface{}{MotionGateStatsCommand: motionGateStatsResponse(cartoSvc.motionGate.Stats())}, nil
+	}
+
+	if _, ok := req[IMUSampleStatsCommand]; ok {
+		ms, ok := cartoSvc.movementSensor.(*s.MovementSensor)
+		if !ok || !ms.Properties().IMUSupported {
+			return nil, ErrIMUSampleStatsNotAvailable
+		}
+		return map[string]interface{}{IMUSampleStatsCommand: imuSampleStatsResponse(ms.IMUSampleStats())}, nil
+	}
+
+	if _, ok := req[TimestampAnomaliesCommand]; ok {
+		stats := cartoSvc.timestampValidator.Stats()
+		resp := map[string]interface{}{"lidar": timestampAnomaliesResponse(stats.Lidar)}
+		if cartoSvc.movementSensor != nil {
+			resp["movement_sensor"] = timestampAnomaliesResponse(stats.MovementSensor)
+		}
+		return map[string]interface{}{TimestampAnomaliesCommand: resp}, nil
+	}
+
+	if _, ok := req[CartographerHealthCommand]; ok {
+		return map[string]interface{}{CartographerHealthCommand: watchdogStatusResponse(cartoSvc.watchdog.Status())}, nil
+	}
+
+	if _, ok := req[CartoFacadeQueueStatsCommand]; ok {
+		stats := cartoSvc.cartofacade.QueueStats()
+		return map[string]interface{}{CartoFacadeQueueStatsCommand: map[string]interface{}{
+			cartofacade.PriorityInteractive.String():  queueClassStatsResponse(stats.Interactive),
+			cartofacade.PrioritySensorInsert.String(): queueClassStatsResponse(stats.SensorInsert),
+			cartofacade.PriorityExport.String():       queueClassStatsResponse(stats.Export),
+		}}, nil
+	}
+
+	if _, ok := req[MapRenderStatusCommand]; ok {
+		if cartoSvc.mapRenderer == nil {
+			return nil, ErrMapRendererNotEnabled
+		}
+		return map[string]interface{}{MapRenderStatusCommand: mapRendererStatusResponse(cartoSvc.mapRenderer.Status())}, nil
+	}
+
+	if _, ok := req[RenderMapCommand]; ok {
+		if cartoSvc.mapRenderer == nil {
+			return nil, ErrMapRendererNotEnabled
+		}
+		rendered, err := cartoSvc.mapRenderer.Render(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if rendered.PointCloud, err = cartoSvc.postprocessPointCloudMap(rendered.PointCloud); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{RenderMapCommand: renderedMapResponse(rendered)}, nil
+	}
+
+	if args, ok := req[MapChangesSinceCommand]; ok {
+		revision, epoch, err := mapupdates.ParseRequest(args)
+		if err != nil {
+			return nil, errors.Wrap(ErrBadMapChangesSinceFormat, err.Error())
+		}
+		update, err := cartoSvc.mapChangesSince(ctx, revision, epoch)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{MapChangesSinceCommand: update.Response()}, nil
+	}
+
+	if _, ok := req[PauseMappingCommand]; ok {
+		cartoSvc.ingestGate.Pause()
+		return map[string]interface{}{PauseMappingCommand: SuccessMessage}, nil
+	}
+
+	if _, ok := req[ResumeMappingCommand]; ok {
+		cartoSvc.ingestGate.Resume()
+		return map[string]interface{}{ResumeMappingCommand: SuccessMessage}, nil
+	}
+
+	if _, ok := req[CancelJobCommand]; ok {
+		if cartoSvc.jobProgress == nil {
+			return nil, ErrCancelJobInOnlineMode
+		}
+		if !cartoSvc.jobProgress.Cancel() {
+			return nil, ErrNoRunningJob
+		}
+		// stopping the sensor process keeps the cartofacade, so the map built so far can still be queried
+		cartoSvc.cancelSensorProcessFunc()
+		return map[string]interface{}{CancelJobCommand: SuccessMessage}, nil
+	}
+
 	if _, ok := req[postprocess.ToggleCommand]; ok {
 		cartoSvc.postprocessed.Store(!cartoSvc.postprocessed.Load())
 		return map[string]interface{}{PostprocessToggleResponseKey: cartoSvc.postprocessed.Load()}, nil
@@ -777,6 +1279,160 @@ func (cartoSvc *CartographerService) DoCommand(ctx context.Context, req map[stri
 	return nil, viamgrpc.UnimplementedError
 }
 
+// jobStatusResponse converts the status of an offline job to a DoCommand response. Durations are in
+// seconds, and the dataset total and ETA are only included when they are known.
+func jobStatusResponse(status sensorprocess.JobStatus) map[string]interface{} {
+	resp := map[string]interface{}{
+		"phase":                              string(status.Phase),
+		"lidar_readings_processed":           float64(status.LidarReadingsProcessed),
+		"movement_sensor_readings_processed": float64(status.MovementSensorReadingsProcessed),
+		"dataset_time_covered_sec":           status.DatasetTimeCovered.Seconds(),
+		"elapsed_sec":                        status.Elapsed.Seconds(),
+		"readings_per_sec":                   status.ReadingsPerSecond,
+		"skipped_files":                      float64(status.SkippedFiles),
+	}
+	if status.DatasetTimeTotal > 0 {
+		resp["dataset_time_total_sec"] = status.DatasetTimeTotal.Seconds()
+	}
+	if status.ETA > 0 {
+		resp["eta_sec"] = status.ETA.Seconds()
+	}
+	if status.Err != nil {
+		resp["error"] = status.Err.Error()
+	}
+	return resp
+}
+
+// ingestStatsResponse converts the counters of the ingest queue to a DoCommand response.
+func ingestStatsResponse(stats sensorprocess.IngestQueueStats) map[string]interface{} {
+	counts := func(counts sensorprocess.IngestCounts) map[string]interface{} {
+		return map[string]interface{}{
+			"queued":   float64(counts.Queued),
+			"dropped":  float64(counts.Dropped),
+			"inserted": float64(counts.Inserted),
+		}
+	}
+	return map[string]interface{}{
+		"queue_length":    float64(stats.Length),
+		"lidar":           counts(stats.Lidar),
+		"movement_sensor": counts(stats.MovementSensor),
+	}
+}
+
+// schedulerStatsResponse converts the polling statistics of a sensor to a DoCommand response.
+func schedulerStatsResponse(stats sensorprocess.SchedulerStats) map[string]interface{} {
+	return map[string]interface{}{
+		"target_frequency_hz": stats.TargetFrequencyHz,
+		"actual_frequency_hz": stats.ActualFrequencyHz,
+		"samples":             float64(stats.Samples),
+		"missed_deadlines":    float64(stats.MissedDeadlines),
+		"mean_jitter_ms":      float64(stats.MeanJitter) / float64(time.Millisecond),
+		"max_jitter_ms":       float64(stats.MaxJitter) / float64(time.Millisecond),
+	}
+}
+
+// sensorHealthResponse converts the health of a sensor to a DoCommand response.
+func sensorHealthResponse(status sensorprocess.SensorHealthStatus) map[string]interface{} {
+	resp := map[string]interface{}{
+		"state":                string(status.State),
+		"consecutive_failures": float64(status.ConsecutiveFailures),
+		"identical_readings":   float64(status.IdenticalReadings),
+	}
+	if !status.LastReadingTime.IsZero() {
+		resp["last_reading_time"] = status.LastReadingTime.UTC().Format(time.RFC3339Nano)
+	}
+	if status.Err != nil {
+		resp["error"] = status.Err.Error()
+	}
+	return resp
+}
+
+// motionGateStatsResponse converts the readings passed and skipped by the motion gate to a DoCommand response.
+func motionGateStatsResponse(stats sensorprocess.MotionGateStats) map[string]interface{} {
+	return map[string]interface{}{
+		"stationary":       stats.Stationary,
+		"passed_readings":  float64(stats.PassedReadings),
+		"skipped_readings": float64(stats.SkippedReadings),
+	}
+}
+
+// imuSampleStatsResponse converts the counters of the synchronized IMU samples to a DoCommand response.
+func imuSampleStatsResponse(stats s.IMUSampleStats) map[string]interface{} {
+	return map[string]interface{}{
+		"emitted":      float64(stats.Emitted),
+		"interpolated": float64(stats.Interpolated),
+		"dropped":      float64(stats.Dropped),
+	}
+}
+
+// timestampAnomaliesResponse converts the reading time anomalies of a sensor to a DoCommand response.
+func timestampAnomaliesResponse(anomalies sensorprocess.TimestampAnomalies) map[string]interface{} {
+	return map[string]interface{}{
+		"out_of_order": float64(anomalies.OutOfOrder),
+		"skewed":       float64(anomalies.Skewed),
+	}
+}
+
+// watchdogStatusResponse converts the state of cartographer and its restarts to a DoCommand response.
+func watchdogStatusResponse(status cartofacade.WatchdogStatus) map[string]interface{} {
+	resp := map[string]interface{}{
+		"state":                string(status.State),
+		"consecutive_failures": float64(status.ConsecutiveFailures),
+		"restarts":             float64(status.Restarts),
+	}
+	if status.Restarts > 0 {
+		resp["last_restart"] = status.LastRestart.UTC().Format(time.RFC3339Nano)
+		resp["last_restart_reason"] = status.LastRestartReason
+		resp["last_restart_source"] = string(status.LastRestartSource)
+	}
+	if !status.SavedStateTime.IsZero() {
+		resp["saved_internal_state_time"] = status.SavedStateTime.UTC().Format(time.RFC3339Nano)
+	}
+	if status.Err != nil {
+		resp["error"] = status.Err.Error()
+	}
+	return resp
+}
+
+// renderedMapResponse converts a rendered map to a DoCommand response, with the map as a base64 PCD.
+func renderedMapResponse(rendered cartofacade.RenderedMap) map[string]interface{} {
+	return map[string]interface{}{
+		"generation":  float64(rendered.Generation),
+		"rendered_at": rendered.RenderedAt.UTC().Format(time.RFC3339Nano),
+		"pcd":         base64.StdEncoding.EncodeToString(rendered.PointCloud),
+	}
+}
+
+// mapRendererStatusResponse converts the status of the map renderer to a DoCommand response.
+func mapRendererStatusResponse(status cartofacade.MapRendererStatus) map[string]interface{} {
+	resp := map[string]interface{}{
+		"generation":         float64(status.Generation),
+		"nodes_since_render": float64(status.NodesSinceRender),
+		"renders":            float64(status.Renders),
+		"failures":           float64(status.Failures),
+	}
+	if status.Generation > 0 {
+		resp["rendered_at"] = status.RenderedAt.UTC().Format(time.RFC3339Nano)
+	}
+	if status.Err != nil {
+		resp["error"] = status.Err.Error()
+	}
+	return resp
+}
+
+// queueClassStatsResponse converts the queue stats of a priority class to a DoCommand response.
+func queueClassStatsResponse(stats cartofacade.QueueClassStats) map[string]interface{} {
+	return map[string]interface{}{
+		"pending":               float64(stats.Pending),
+		"dispatched":            float64(stats.Dispatched),
+		"coalesced":             float64(stats.Coalesced),
+		"skipped":               float64(stats.Skipped),
+		"cancelled":             float64(stats.Cancelled),
+		"mean_queue_latency_ms": float64(stats.MeanQueueLatency) / float64(time.Millisecond),
+		"max_queue_latency_ms":  float64(stats.MaxQueueLatency) / float64(time.Millisecond),
+	}
+}
+
 // Close out of all slam related processes.
 func (cartoSvc *CartographerService) Close(ctx context.Context) error {
 	cartoSvc.mu.Lock()
@@ -795,6 +1451,13 @@ func (cartoSvc *CartographerService) Close(ctx context.Context) error {
 	cartoSvc.cancelSensorProcessFunc()
 	cartoSvc.sensorProcessWorkers.Wait()
 
+	// flush the recorded sensor readings
+	if cartoSvc.recorder != nil {
+		if err := cartoSvc.recorder.Close(); err != nil {
+			cartoSvc.logger.Errorw("error closing sensor recorder", "error", err)
+		}
+	}
+
 	// terminate carto facade
 	err := terminateCartoFacade(ctx, cartoSvc)
 	if err != nil {
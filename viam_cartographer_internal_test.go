@@ -2,8 +2,11 @@ package viamcartographer
 
 import (
 	"context"
+	"encoding/base64"
+	"io"
 	"math"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -18,6 +21,8 @@ import (
 	"go.viam.com/utils/artifact"
 
 	"github.com/viamrobotics/viam-cartographer/cartofacade"
+	"github.com/viamrobotics/viam-cartographer/mapupdates"
+	"github.com/viamrobotics/viam-cartographer/sensorprocess"
 	"github.com/viamrobotics/viam-cartographer/sensors/inject"
 )
 
@@ -155,6 +160,13 @@ func setMockPointCloudFunc(
 	) ([]byte, error) {
 		return pc, nil
 	}
+	mock.WritePointCloudMapFunc = func(
+		ctx context.Context,
+		timeout time.Duration,
+		path string,
+	) error {
+		return os.WriteFile(path, pc, 0o600)
+	}
 }
 
 func testApisThatReturnCallbackFuncsSuccess(
@@ -259,11 +271,12 @@ func TestPointCloudMapEndpoint(t *testing.T) {
 	t.Run("cartofacade error", func(t *testing.T) {
 		setMockPointCloudFunc(mockCartoFacade, []byte{})
 
-		mockCartoFacade.PointCloudMapFunc = func(
+		mockCartoFacade.WritePointCloudMapFunc = func(
 			ctx context.Context,
 			timeout time.Duration,
-		) ([]byte, error) {
-			return nil, errors.New("test")
+			path string,
+		) error {
+			return errors.New("test")
 		}
 
 		callback, err := svc.PointCloudMap(context.Background(), false)
@@ -282,6 +295,13 @@ func setMockInternalStateFunc(
 	) ([]byte, error) {
 		return pc, nil
 	}
+	mock.WriteInternalStateFunc = func(
+		ctx context.Context,
+		timeout time.Duration,
+		path string,
+	) error {
+		return os.WriteFile(path, pc, 0o600)
+	}
 }
 
 func TestInternalStateEndpoint(t *testing.T) {
@@ -302,11 +322,12 @@ func TestInternalStateEndpoint(t *testing.T) {
 	t.Run("cartofacade error", func(t *testing.T) {
 		setMockInternalStateFunc(mockCartoFacade, []byte{})
 
-		mockCartoFacade.InternalStateFunc = func(
+		mockCartoFacade.WriteInternalStateFunc = func(
 			ctx context.Context,
 			timeout time.Duration,
-		) ([]byte, error) {
-			return nil, errors.New("test")
+			path string,
+		) error {
+			return errors.New("test")
 		}
 
 		callback, err := svc.InternalState(context.Background())
@@ -315,6 +336,124 @@ func TestInternalStateEndpoint(t *testing.T) {
 	})
 }
 
+func TestToChunkedFileFunc(t *testing.T) {
+	t.Run("returns the file in chunks and removes it", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "export")
+		contents := make([]byte, chunkSizeBytes+10)
+		contents[len(contents)-1] = 1
+		test.That(t, os.WriteFile(path, contents, 0o600), test.ShouldBeNil)
+
+		callback, err := toChunkedFileFunc(path)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = os.Stat(path)
+		test.That(t, os.IsNotExist(err), test.ShouldBeTrue)
+
+		chunk, err := callback()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(chunk), test.ShouldEqual, chunkSizeBytes)
+		chunk, err = callback()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, chunk, test.ShouldResemble, contents[chunkSizeBytes:])
+		// the callback keeps returning io.EOF after the file was closed
+		for i := 0; i < 2; i++ {
+			chunk, err = callback()
+			test.That(t, err, test.ShouldEqual, io.EOF)
+			test.That(t, chunk, test.ShouldBeNil)
+		}
+	})
+
+	t.Run("removes the file when writing the export fails", func(t *testing.T) {
+		var exportPath string
+		svc := &CartographerService{}
+		callback, err := svc.exportToChunkedFunc(context.Background(), func(
+			ctx context.Context,
+			timeout time.Duration,
+			path string,
+		) error {
+			exportPath = path
+			test.That(t, os.WriteFile(path, []byte("partial"), 0o600), test.ShouldBeNil)
+			return errors.New("test")
+		})
+		test.That(t, callback, test.ShouldBeNil)
+		test.That(t, err, test.ShouldBeError, errors.New("test"))
+		_, err = os.Stat(exportPath)
+		test.That(t, os.IsNotExist(err), test.ShouldBeTrue)
+	})
+}
+
+func TestMapChangesSince(t *testing.T) {
+	svc := &CartographerService{Named: resource.NewName(slam.API, "test").AsNamed(), mapUpdates: mapupdates.NewTracker()}
+	mockCartoFacade := &cartofacade.Mock{}
+	svc.cartofacade = mockCartoFacade
+
+	first := cartofacade.Submap{SubmapID: cartofacade.SubmapID{SubmapIndex: 0}, Version: 1}
+	second := cartofacade.Submap{SubmapID: cartofacade.SubmapID{SubmapIndex: 1}, Version: 1}
+	var known []cartofacade.Submap
+	// the fake cartographer returns the points of the submaps which are not known with the same version
+	setSubmaps := func(submaps ...cartofacade.Submap) {
+		mockCartoFacade.SubmapsFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+			knownSubmaps []cartofacade.Submap,
+		) ([]cartofacade.Submap, error) {
+			known = knownSubmaps
+			resp := []cartofacade.Submap{}
+			for _, submap := range submaps {
+				changed := true
+				for _, k := range knownSubmaps {
+					if k.SubmapID == submap.SubmapID && k.Version == submap.Version {
+						changed = false
+					}
+				}
+				if changed {
+					submap.PointCloud = []byte{byte(submap.SubmapIndex), byte(submap.Version)}
+				}
+				resp = append(resp, submap)
+			}
+			return resp, nil
+		}
+	}
+
+	t.Run("returns every submap without a revision", func(t *testing.T) {
+		setSubmaps(first, second)
+		update, err := svc.mapChangesSince(context.Background(), 0, "")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, known, test.ShouldBeEmpty)
+		test.That(t, update.Since, test.ShouldEqual, 0)
+		test.That(t, update.Revision, test.ShouldEqual, 1)
+		test.That(t, len(update.Submaps), test.ShouldEqual, 2)
+	})
+
+	t.Run("only returns the submaps changed or removed since a revision", func(t *testing.T) {
+		epoch := svc.mapUpdates.Since(0, "").Epoch
+		changed := second
+		changed.Version = 2
+		setSubmaps(changed)
+		update, err := svc.mapChangesSince(context.Background(), 1, epoch)
+		test.That(t, err, test.ShouldBeNil)
+		// the known submaps are the submaps of the previous fetch, without their points
+		test.That(t, known, test.ShouldResemble, []cartofacade.Submap{first, second})
+		test.That(t, update.Since, test.ShouldEqual, 1)
+		test.That(t, update.Revision, test.ShouldEqual, 2)
+		test.That(t, update.Submaps, test.ShouldResemble, []mapupdates.Submap{
+			{ID: mapupdates.SubmapID{SubmapIndex: 1}, PointCloud: []byte{1, 2}},
+		})
+		test.That(t, update.Removed, test.ShouldResemble, []mapupdates.SubmapID{{SubmapIndex: 0}})
+	})
+
+	t.Run("cartofacade error", func(t *testing.T) {
+		mockCartoFacade.SubmapsFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+			knownSubmaps []cartofacade.Submap,
+		) ([]cartofacade.Submap, error) {
+			return nil, errors.New("test")
+		}
+		_, err := svc.mapChangesSince(context.Background(), 0, "")
+		test.That(t, err, test.ShouldBeError, errors.New("test"))
+	})
+}
+
 func TestParseCartoAlgoConfig(t *testing.T) {
 	logger := logging.NewTestLogger(t)
 
@@ -417,6 +556,28 @@ func TestParseCartoAlgoConfig(t *testing.T) {
 		test.That(t, cartoAlgoConfig, test.ShouldResemble, overRidenCartoAlgoCfg)
 	})
 
+	t.Run("returns overridden intensity params", func(t *testing.T) {
+		configParams := map[string]string{
+			"min_intensity":             "20",
+			"marker_min_intensity":      "200.5",
+			"point_cloud_map_intensity": "true",
+		}
+
+		overRidenCartoAlgoCfg := defaultCartoAlgoCfg
+		overRidenCartoAlgoCfg.MinIntensity = 20
+		overRidenCartoAlgoCfg.MarkerMinIntensity = 200.5
+		overRidenCartoAlgoCfg.PointCloudMapIntensity = true
+
+		cartoAlgoConfig, err := parseCartoAlgoConfig(configParams, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, cartoAlgoConfig, test.ShouldResemble, overRidenCartoAlgoCfg)
+	})
+
+	t.Run("returns an error for an invalid point_cloud_map_intensity", func(t *testing.T) {
+		_, err := parseCartoAlgoConfig(map[string]string{"point_cloud_map_intensity": "yes"}, logger)
+		test.That(t, err, test.ShouldBeError)
+	})
+
 	t.Run("returns error when unsupported param provided", func(t *testing.T) {
 		configParams := map[string]string{
 			"optimize_on_start": "true",
@@ -485,3 +646,77 @@ func TestBuiltinQuaternion(t *testing.T) {
 		test.That(t, pose, test.ShouldBeNil)
 	})
 }
+
+func TestJobStatusResponse(t *testing.T) {
+	t.Run("omits the dataset total, ETA and error when they are unknown", func(t *testing.T) {
+		resp := jobStatusResponse(sensorprocess.JobStatus{
+			Phase:                  sensorprocess.JobPhaseIngest,
+			LidarReadingsProcessed: 3,
+			DatasetTimeCovered:     1500 * time.Millisecond,
+			Elapsed:                2 * time.Second,
+			ReadingsPerSecond:      1.5,
+			SkippedFiles:           2,
+		})
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			"phase":                              "ingest",
+			"lidar_readings_processed":           3.0,
+			"movement_sensor_readings_processed": 0.0,
+			"dataset_time_covered_sec":           1.5,
+			"elapsed_sec":                        2.0,
+			"readings_per_sec":                   1.5,
+			"skipped_files":                      2.0,
+		})
+	})
+
+	t.Run("includes the dataset total, ETA and error when they are known", func(t *testing.T) {
+		resp := jobStatusResponse(sensorprocess.JobStatus{
+			Phase:            sensorprocess.JobPhaseFailed,
+			DatasetTimeTotal: 10 * time.Second,
+			ETA:              4 * time.Second,
+			Err:              errors.New("cartofacade error"),
+		})
+		test.That(t, resp["phase"], test.ShouldEqual, "failed")
+		test.That(t, resp["dataset_time_total_sec"], test.ShouldEqual, 10.0)
+		test.That(t, resp["eta_sec"], test.ShouldEqual, 4.0)
+		test.That(t, resp["error"], test.ShouldEqual, "cartofacade error")
+	})
+}
+
+func TestRenderedMapResponse(t *testing.T) {
+	renderedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	resp := renderedMapResponse(cartofacade.RenderedMap{
+		PointCloud: []byte("rendered map"),
+		Generation: 3,
+		RenderedAt: renderedAt,
+	})
+	test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+		"generation":  3.0,
+		"rendered_at": "2024-05-01T12:00:00Z",
+		"pcd":         base64.StdEncoding.EncodeToString([]byte("rendered map")),
+	})
+}
+
+func TestSensorHealthResponse(t *testing.T) {
+	t.Run("omits the last reading time and error when they are unknown", func(t *testing.T) {
+		resp := sensorHealthResponse(sensorprocess.SensorHealthStatus{State: sensorprocess.SensorHealthy})
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			"state":                "healthy",
+			"consecutive_failures": 0.0,
+			"identical_readings":   0.0,
+		})
+	})
+
+	t.Run("includes the last reading time and error when they are known", func(t *testing.T) {
+		lastReadingTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		resp := sensorHealthResponse(sensorprocess.SensorHealthStatus{
+			State:               sensorprocess.SensorFailed,
+			ConsecutiveFailures: 10,
+			LastReadingTime:     lastReadingTime,
+			Err:                 errors.New("lidar unreachable"),
+		})
+		test.That(t, resp["state"], test.ShouldEqual, "failed")
+		test.That(t, resp["consecutive_failures"], test.ShouldEqual, 10.0)
+		test.That(t, resp["last_reading_time"], test.ShouldEqual, "2024-05-01T12:00:00Z")
+		test.That(t, resp["error"], test.ShouldEqual, "lidar unreachable")
+	})
+}
@@ -171,7 +171,7 @@ func TestNew(t *testing.T) {
 
 		cs, ok := svc.(*viamcartographer.CartographerService)
 		test.That(t, ok, test.ShouldBeTrue)
-		test.That(t, cs.SlamMode, test.ShouldEqual, cartofacade.LocalizingMode)
+		test.That(t, cs.SlamMode(), test.ShouldEqual, cartofacade.LocalizingMode)
 
 		// Test position
 		pose, err := svc.Position(context.Background())
@@ -227,7 +227,7 @@ func TestNew(t *testing.T) {
 
 		cs, ok := svc.(*viamcartographer.CartographerService)
 		test.That(t, ok, test.ShouldBeTrue)
-		test.That(t, cs.SlamMode, test.ShouldEqual, cartofacade.UpdatingMode)
+		test.That(t, cs.SlamMode(), test.ShouldEqual, cartofacade.UpdatingMode)
 
 		// Test position
 		pose, err := svc.Position(context.Background())
@@ -403,6 +403,122 @@ func TestDoCommand(t *testing.T) {
 			map[string]interface{}{viamcartographer.JobDoneCommand: false},
 		)
 	})
+	t.Run("returns an error when given 'job_status' in online mode", func(t *testing.T) {
+		cmd := map[string]interface{}{viamcartographer.JobStatusCommand: ""}
+		resp, err := svc.DoCommand(context.Background(), cmd)
+		test.That(t, err, test.ShouldBeError, viamcartographer.ErrJobStatusInOnlineMode)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+	t.Run("returns success when given 'pause_mapping' and 'resume_mapping'", func(t *testing.T) {
+		for _, command := range []string{viamcartographer.PauseMappingCommand, viamcartographer.ResumeMappingCommand} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{command: ""})
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, resp, test.ShouldResemble, map[string]interface{}{command: viamcartographer.SuccessMessage})
+		}
+	})
+	t.Run("returns the ingest queue counters when given 'ingest_stats' in online mode", func(t *testing.T) {
+		cmd := map[string]interface{}{viamcartographer.IngestStatsCommand: ""}
+		resp, err := svc.DoCommand(context.Background(), cmd)
+		test.That(t, err, test.ShouldBeNil)
+		stats, ok := resp[viamcartographer.IngestStatsCommand].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, stats, test.ShouldContainKey, "queue_length")
+		test.That(t, stats, test.ShouldContainKey, "lidar")
+		test.That(t, stats, test.ShouldContainKey, "movement_sensor")
+	})
+	t.Run("returns the lidar polling stats when given 'scheduling_stats' in online mode", func(t *testing.T) {
+		cmd := map[string]interface{}{viamcartographer.SchedulingStatsCommand: ""}
+		resp, err := svc.DoCommand(context.Background(), cmd)
+		test.That(t, err, test.ShouldBeNil)
+		stats, ok := resp[viamcartographer.SchedulingStatsCommand].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, stats, test.ShouldNotContainKey, "movement_sensor")
+		lidarStats, ok := stats["lidar"].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, lidarStats["target_frequency_hz"], test.ShouldEqual, 5.0)
+		test.That(t, lidarStats, test.ShouldContainKey, "missed_deadlines")
+		test.That(t, lidarStats, test.ShouldContainKey, "mean_jitter_ms")
+	})
+	t.Run("returns the lidar health when given 'sensor_health' in online mode", func(t *testing.T) {
+		cmd := map[string]interface{}{viamcartographer.SensorHealthCommand: ""}
+		resp, err := svc.DoCommand(context.Background(), cmd)
+		test.That(t, err, test.ShouldBeNil)
+		health, ok := resp[viamcartographer.SensorHealthCommand].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, health, test.ShouldNotContainKey, "movement_sensor")
+		lidarHealth, ok := health["lidar"].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, lidarHealth, test.ShouldContainKey, "state")
+		test.That(t, lidarHealth, test.ShouldContainKey, "consecutive_failures")
+	})
+	t.Run("returns the lidar reading time anomalies when given 'timestamp_anomalies'", func(t *testing.T) {
+		cmd := map[string]interface{}{viamcartographer.TimestampAnomaliesCommand: ""}
+		resp, err := svc.DoCommand(context.Background(), cmd)
+		test.That(t, err, test.ShouldBeNil)
+		anomalies, ok := resp[viamcartographer.TimestampAnomaliesCommand].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, anomalies, test.ShouldNotContainKey, "movement_sensor")
+		lidarAnomalies, ok := anomalies["lidar"].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, lidarAnomalies, test.ShouldContainKey, "out_of_order")
+		test.That(t, lidarAnomalies, test.ShouldContainKey, "skewed")
+	})
+	t.Run("returns whether cartographer is running when given 'cartographer_health'", func(t *testing.T) {
+		cmd := map[string]interface{}{viamcartographer.CartographerHealthCommand: ""}
+		resp, err := svc.DoCommand(context.Background(), cmd)
+		test.That(t, err, test.ShouldBeNil)
+		health, ok := resp[viamcartographer.CartographerHealthCommand].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, health["state"], test.ShouldEqual, "running")
+		test.That(t, health["restarts"], test.ShouldEqual, 0.0)
+		test.That(t, health, test.ShouldNotContainKey, "error")
+	})
+	t.Run("returns the queue latencies of each priority class when given 'cartofacade_queue_stats'", func(t *testing.T) {
+		cmd := map[string]interface{}{viamcartographer.CartoFacadeQueueStatsCommand: ""}
+		resp, err := svc.DoCommand(context.Background(), cmd)
+		test.That(t, err, test.ShouldBeNil)
+		stats, ok := resp[viamcartographer.CartoFacadeQueueStatsCommand].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		for _, class := range []string{"interactive", "sensor_insert", "export"} {
+			classStats, ok := stats[class].(map[string]interface{})
+			test.That(t, ok, test.ShouldBeTrue)
+			test.That(t, classStats, test.ShouldContainKey, "dispatched")
+			test.That(t, classStats, test.ShouldContainKey, "cancelled")
+			test.That(t, classStats, test.ShouldContainKey, "mean_queue_latency_ms")
+		}
+	})
+	t.Run("returns an error when given 'motion_gate_stats' without skipping stationary scans", func(t *testing.T) {
+		cmd := map[string]interface{}{viamcartographer.MotionGateStatsCommand: ""}
+		resp, err := svc.DoCommand(context.Background(), cmd)
+		test.That(t, err, test.ShouldBeError, viamcartographer.ErrMotionGateNotEnabled)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+	t.Run("returns an error when given 'imu_sample_stats' without a movement sensor component", func(t *testing.T) {
+		cmd := map[string]interface{}{viamcartographer.IMUSampleStatsCommand: ""}
+		resp, err := svc.DoCommand(context.Background(), cmd)
+		test.That(t, err, test.ShouldBeError, viamcartographer.ErrIMUSampleStatsNotAvailable)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+	t.Run("returns an error when given 'map_render_status' or 'render_map' without rendering the map in the background",
+		func(t *testing.T) {
+			for _, command := range []string{viamcartographer.MapRenderStatusCommand, viamcartographer.RenderMapCommand} {
+				resp, err := svc.DoCommand(context.Background(), map[string]interface{}{command: ""})
+				test.That(t, err, test.ShouldBeError, viamcartographer.ErrMapRendererNotEnabled)
+				test.That(t, resp, test.ShouldBeNil)
+			}
+		})
+	t.Run("returns an error when given 'map_changes_since' with an invalid revision", func(t *testing.T) {
+		cmd := map[string]interface{}{viamcartographer.MapChangesSinceCommand: map[string]interface{}{"revision": "1"}}
+		resp, err := svc.DoCommand(context.Background(), cmd)
+		test.That(t, errors.Is(err, viamcartographer.ErrBadMapChangesSinceFormat), test.ShouldBeTrue)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+	t.Run("returns an error when given 'cancel_job' in online mode", func(t *testing.T) {
+		cmd := map[string]interface{}{viamcartographer.CancelJobCommand: ""}
+		resp, err := svc.DoCommand(context.Background(), cmd)
+		test.That(t, err, test.ShouldBeError, viamcartographer.ErrCancelJobInOnlineMode)
+		test.That(t, resp, test.ShouldBeNil)
+	})
 	t.Run("changes postprocess bool after 'postprocess_toggle'", func(t *testing.T) {
 		cmd := map[string]interface{}{postprocess.ToggleCommand: ""}
 		resp, err := svc.DoCommand(context.Background(), cmd)